@@ -0,0 +1,66 @@
+package transportc
+
+import (
+	"fmt"
+)
+
+// AcceptStage is the stage of accepting an offer at which it failed.
+type AcceptStage uint8
+
+const (
+	ACCEPT_STAGE_OFFER       AcceptStage = iota + 1 // parsing, verifying the identity of, or transforming the offer
+	ACCEPT_STAGE_ADMISSION                          // admitting the peer, e.g., to a namespace or by Config.ListenerOfferFilter
+	ACCEPT_STAGE_NEGOTIATION                        // creating the PeerConnection and gathering the answer
+	ACCEPT_STAGE_SIGNAL                             // signaling the answer
+	ACCEPT_STAGE_CONNECT                            // connecting the ICE and DTLS transports, before any Conn is accepted
+	ACCEPT_STAGE_DATACHANNEL                        // setting up a DataChannel opened by the peer, e.g., the wire handshake
+	ACCEPT_STAGE_RESTART                            // answering an ICE restart, see Config.ListenerRestartTimeout
+)
+
+func (s AcceptStage) String() string {
+	switch s {
+	case ACCEPT_STAGE_OFFER:
+		return "offer"
+	case ACCEPT_STAGE_ADMISSION:
+		return "admission"
+	case ACCEPT_STAGE_NEGOTIATION:
+		return "negotiation"
+	case ACCEPT_STAGE_SIGNAL:
+		return "signal"
+	case ACCEPT_STAGE_CONNECT:
+		return "connect"
+	case ACCEPT_STAGE_DATACHANNEL:
+		return "datachannel"
+	case ACCEPT_STAGE_RESTART:
+		return "restart"
+	default:
+		return "unknown"
+	}
+}
+
+// AcceptError is the failure of a Listener to accept a peer, emitted as the
+// Err of an EVENT_ACCEPT_FAILED, see Listener.Events, so operators see why
+// clients fail to connect.
+type AcceptError struct {
+	OfferID uint64 // ID of the offer, as returned by Signal.ReadOffer
+	PeerID  uint64 // ID of the PeerConnection, 0 if not created yet
+	Stage   AcceptStage
+	Err     error
+}
+
+func (e *AcceptError) Error() string {
+	return fmt.Sprintf("listener: failed to accept offer #%d at %s: %v", e.OfferID, e.Stage, e.Err)
+}
+
+func (e *AcceptError) Unwrap() error {
+	return e.Err
+}
+
+// acceptFailed reports err failing the offer of offerID at stage, returning
+// the AcceptError.
+func (l *Listener) acceptFailed(offerID uint64, peerID uint64, stage AcceptStage, err error) *AcceptError {
+	acceptErr := &AcceptError{OfferID: offerID, PeerID: peerID, Stage: stage, Err: err}
+	l.logger.Debugf("%v", acceptErr)
+	l.events.emit(TransportEvent{Type: EVENT_ACCEPT_FAILED, PeerID: peerID, OfferID: offerID, Err: acceptErr})
+	return acceptErr
+}
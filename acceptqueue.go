@@ -0,0 +1,96 @@
+package transportc
+
+import (
+	"net"
+	"sync"
+)
+
+// acceptQueue queues the Conns pending on Accept, higher priority first and
+// in arrival order within the same priority.
+type acceptQueue struct {
+	mutex   sync.Mutex
+	entries []acceptQueueEntry // sorted by priority, descending
+	closed  bool
+
+	ready chan struct{} // signaled while entries is not empty
+}
+
+type acceptQueueEntry struct {
+	conn     net.Conn
+	priority int
+}
+
+func newAcceptQueue() *acceptQueue {
+	return &acceptQueue{
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// push queues conn behind the Conns of the same or higher priority. If the
+// queue is closed, conn is closed instead.
+func (q *acceptQueue) push(conn net.Conn, priority int) {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		closeConnWith(conn, CLOSE_REASON_LISTENER_CLOSED)
+		return
+	}
+
+	i := len(q.entries)
+	for i > 0 && q.entries[i-1].priority < priority {
+		i--
+	}
+	q.entries = append(q.entries, acceptQueueEntry{})
+	copy(q.entries[i+1:], q.entries[i:])
+	q.entries[i] = acceptQueueEntry{conn: conn, priority: priority}
+	q.mutex.Unlock()
+
+	q.signal()
+}
+
+// pop dequeues the Conn of the highest priority, if any.
+func (q *acceptQueue) pop() (net.Conn, bool) {
+	q.mutex.Lock()
+	if len(q.entries) == 0 {
+		q.mutex.Unlock()
+		return nil, false
+	}
+	conn := q.entries[0].conn
+	q.entries[0] = acceptQueueEntry{}
+	q.entries = q.entries[1:]
+	remaining := len(q.entries)
+	q.mutex.Unlock()
+
+	if remaining > 0 {
+		q.signal() // wake up the next Accept
+	}
+	return conn, true
+}
+
+// signal wakes up one Accept waiting on ready.
+func (q *acceptQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// len returns the number of Conns pending.
+func (q *acceptQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.entries)
+}
+
+// close closes all Conns pending, and the Conns pushed afterwards.
+func (q *acceptQueue) close() {
+	q.mutex.Lock()
+	entries := q.entries
+	q.entries = nil
+	q.closed = true
+	q.mutex.Unlock()
+
+	for _, entry := range entries {
+		closeConnWith(entry.conn, CLOSE_REASON_LISTENER_CLOSED)
+	}
+}
@@ -0,0 +1,112 @@
+package transportc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// BandwidthEstimate estimates the bandwidth available to a Conn.
+//
+// pion does not expose the SCTP congestion window, nor transport-cc feedback
+// for DataChannels, so the estimate is derived from the throughput of the
+// SCTP association, shared by all Conns on the same PeerConnection, and the
+// amount of data queued in the datachannel. A growing BufferedAmount at a
+// steady SendRate indicates the sender outpaces the available bandwidth.
+type BandwidthEstimate struct {
+	// SendRate and ReceiveRate are the bytes per second sent and received on
+	// the PeerConnection over the sampling interval.
+	SendRate    float64
+	ReceiveRate float64
+
+	// BufferedAmount is the number of bytes written to the Conn and not
+	// yet sent.
+	BufferedAmount uint64
+
+	// Interval is the sampling interval, i.e., the time since the previous
+	// estimate, or since the Conn is created for the first estimate.
+	Interval time.Duration
+}
+
+// bandwidthSampler computes the throughput between consecutive samples.
+type bandwidthSampler struct {
+	mutex         sync.Mutex
+	lastTime      time.Time
+	lastSent      uint64
+	lastReceived  uint64
+	bufferedBytes func() uint64
+}
+
+// sample returns the BandwidthEstimate since the previous sample.
+func (s *bandwidthSampler) sample(peerConnection *webrtc.PeerConnection, start time.Time) BandwidthEstimate {
+	var sent, received uint64
+	if peerConnection != nil {
+		sent, received = sctpTransportStats(peerConnection)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := currentClock().Now()
+	if s.lastTime.IsZero() {
+		s.lastTime = start
+	}
+	estimate := BandwidthEstimate{
+		Interval: now.Sub(s.lastTime),
+	}
+	if seconds := estimate.Interval.Seconds(); seconds > 0 {
+		if sent >= s.lastSent {
+			estimate.SendRate = float64(sent-s.lastSent) / seconds
+		}
+		if received >= s.lastReceived {
+			estimate.ReceiveRate = float64(received-s.lastReceived) / seconds
+		}
+	}
+	if s.bufferedBytes != nil {
+		estimate.BufferedAmount = s.bufferedBytes()
+	}
+
+	s.lastTime, s.lastSent, s.lastReceived = now, sent, received
+	return estimate
+}
+
+// bufferedAmount returns the bytes queued in the datachannel, if known.
+func (c *Conn) bufferedAmount() uint64 {
+	if dc, ok := c.dataChannel.(interface{ BufferedAmount() uint64 }); ok {
+		return dc.BufferedAmount()
+	}
+	return 0
+}
+
+// EstimatedBandwidth returns the BandwidthEstimate since the previous call.
+func (c *Conn) EstimatedBandwidth() BandwidthEstimate {
+	return c.bandwidth.sample(c.peerConnection, c.created)
+}
+
+// OnBandwidthEstimate calls f with a BandwidthEstimate every interval until
+// the Conn is closed, so adaptive applications can pace themselves. It is
+// independent of EstimatedBandwidth. No estimate is made while the Conn is
+// paused, see Conn.Pause.
+func (c *Conn) OnBandwidthEstimate(interval time.Duration, f func(BandwidthEstimate)) {
+	sampler := &bandwidthSampler{bufferedBytes: c.bufferedAmount}
+	start := currentClock().Now()
+	sampler.sample(c.peerConnection, start) // baseline
+
+	go func() {
+		ticker := currentClock().NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C():
+				if c.paused.Load() {
+					continue
+				}
+				f(sampler.sample(c.peerConnection, start))
+			}
+		}
+	}()
+}
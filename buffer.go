@@ -0,0 +1,137 @@
+package transportc
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+)
+
+var (
+	// ErrInvalidBufferSize is returned by Conn.SetReadBuffer and
+	// Conn.SetWriteBuffer when the size is negative.
+	ErrInvalidBufferSize = errors.New("invalid buffer size")
+
+	// ErrWriteBufferUnsupported is returned by Conn.SetWriteBuffer on a Conn
+	// whose datachannel does not report when its BufferedAmount is low.
+	ErrWriteBufferUnsupported = errors.New("write buffer unsupported")
+)
+
+// bufferedAmountNotifier is implemented by the datachannels reporting when
+// their BufferedAmount drops to a threshold, as pion's datachannel.
+type bufferedAmountNotifier interface {
+	SetBufferedAmountLowThreshold(th uint64)
+	OnBufferedAmountLow(f func())
+}
+
+// connBuffers holds the read and write buffer sizes of a Conn, see
+// Conn.SetReadBuffer and Conn.SetWriteBuffer.
+type connBuffers struct {
+	readSize   atomic.Int64  // 0 for unlimited
+	readQueued atomic.Int64  // bytes in recvBuf
+	readSpace  chan struct{} // poked once bytes are taken from recvBuf, or readSize is updated
+
+	writeSize  atomic.Int64  // 0 for unlimited
+	writeOnce  atomic.Bool   // set once OnBufferedAmountLow is registered
+	writeSpace chan struct{} // poked once the BufferedAmount drops to writeSize
+}
+
+func newConnBuffers() connBuffers {
+	return connBuffers{
+		readSpace:  make(chan struct{}, 1),
+		writeSpace: make(chan struct{}, 1),
+	}
+}
+
+func poke(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// SetReadBuffer bounds the bytes of the messages received on the Conn and not
+// yet Read, as does TCPConn.SetReadBuffer. Once reached, the Conn stops
+// reading from its datachannel, so the SCTP receive window fills up and the
+// remote peer is slowed down by flow control. A single message larger than
+// bytes is still received.
+//
+// The SCTP receive window itself is shared by all Conns on the same
+// PeerConnection, and set by Config.SCTPMaxReceiveBufferSize. A zero bytes
+// removes the bound, so only CONN_DEFAULT_CONCURRENCY messages are queued.
+func (c *Conn) SetReadBuffer(bytes int) error {
+	if bytes < 0 {
+		return ErrInvalidBufferSize
+	}
+	c.buffers.readSize.Store(int64(bytes))
+	poke(c.buffers.readSpace) // the readloop may wait for a smaller bound
+	return nil
+}
+
+// SetWriteBuffer bounds the bytes written to the Conn and not yet sent, i.e.,
+// its BufferedAmount, as does TCPConn.SetWriteBuffer. While the
+// BufferedAmount exceeds bytes, Write blocks until it drops to bytes, the
+// write deadline is exceeded or the Conn is closed. A zero bytes removes the
+// bound.
+//
+// Unlike Config.MaxBufferedAmount, which fails a Write at once, the writer is
+// paced by the remote peer.
+func (c *Conn) SetWriteBuffer(bytes int) error {
+	if bytes < 0 {
+		return ErrInvalidBufferSize
+	}
+	notifier, ok := c.dataChannel.(bufferedAmountNotifier)
+	if !ok {
+		return ErrWriteBufferUnsupported
+	}
+
+	c.buffers.writeSize.Store(int64(bytes))
+	notifier.SetBufferedAmountLowThreshold(uint64(bytes))
+	if c.buffers.writeOnce.CompareAndSwap(false, true) {
+		notifier.OnBufferedAmountLow(func() {
+			poke(c.buffers.writeSpace)
+		})
+	}
+	poke(c.buffers.writeSpace) // a pending Write may wait for a larger bound
+	return nil
+}
+
+// waitReadSpace blocks the readloop while the bytes queued in recvBuf reach
+// the read buffer size. It returns false once the Conn is closed.
+func (c *Conn) waitReadSpace() bool {
+	for {
+		size := c.buffers.readSize.Load()
+		if size == 0 || c.buffers.readQueued.Load() < size {
+			return true
+		}
+		select {
+		case <-c.buffers.readSpace:
+		case <-c.done:
+			return false
+		}
+	}
+}
+
+// releaseReadSpace accounts for n bytes taken from recvBuf.
+func (c *Conn) releaseReadSpace(n int) {
+	c.buffers.readQueued.Add(-int64(n))
+	poke(c.buffers.readSpace)
+}
+
+// waitWriteSpace blocks a Write while the BufferedAmount exceeds the write
+// buffer size, until dl is exceeded or the Conn is closed.
+func (c *Conn) waitWriteSpace(dl *ioDeadline) error {
+	for {
+		size := c.buffers.writeSize.Load()
+		if size == 0 || c.bufferedAmount() <= uint64(size) {
+			return nil
+		}
+		select {
+		case <-c.buffers.writeSpace:
+		case <-dl.Done():
+			return &WriteError{Kind: WRITE_ERROR_DEADLINE, Err: os.ErrDeadlineExceeded}
+		case <-c.done:
+			return &WriteError{Kind: WRITE_ERROR_CLOSED, Err: net.ErrClosed}
+		}
+	}
+}
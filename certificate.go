@@ -0,0 +1,142 @@
+//go:build !js
+
+package transportc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	CERTIFICATE_DEFAULT_VALIDITY = 10 * 365 * 24 * time.Hour
+	CERTIFICATE_COMMON_NAME      = "transportc"
+)
+
+// Certificate is a DTLS certificate, see Config.Certificates.
+type Certificate = webrtc.Certificate
+
+// setCertificates overrides the certificates of configuration, if any.
+func setCertificates(configuration *webrtc.Configuration, certificates []Certificate) {
+	if len(certificates) > 0 {
+		configuration.Certificates = certificates
+	}
+}
+
+// GenerateCertificate generates a long-lived DTLS certificate with an ECDSA
+// P-256 key, valid for validity from now. If validity is zero,
+// CERTIFICATE_DEFAULT_VALIDITY is used. Unlike the certificates generated by
+// pion, which expire in a month, it is meant to be saved with SaveCertificate
+// and reused across restarts via Config.Certificates.
+func GenerateCertificate(validity time.Duration) (*webrtc.Certificate, error) {
+	if validity == 0 {
+		validity = CERTIFICATE_DEFAULT_VALIDITY
+	}
+
+	secretKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return webrtc.NewCertificate(secretKey, x509.Certificate{
+		Issuer:       pkix.Name{CommonName: CERTIFICATE_COMMON_NAME},
+		Subject:      pkix.Name{CommonName: CERTIFICATE_COMMON_NAME},
+		NotBefore:    now.Add(-24 * time.Hour), // tolerate clock skew
+		NotAfter:     now.Add(validity),
+		SerialNumber: serialNumber,
+		Version:      2,
+	})
+}
+
+// SaveCertificate saves certificate with its private key to path in PEM, as
+// encoded by webrtc.Certificate.PEM. The file is only readable by the owner.
+func SaveCertificate(path string, certificate *webrtc.Certificate) error {
+	pems, err := certificate.PEM()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(pems); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path) // CreateTemp creates the file with 0600
+}
+
+// LoadCertificate loads a certificate saved by SaveCertificate from path. It
+// fails with webrtc.ErrCertificateExpired if the certificate has expired.
+func LoadCertificate(path string) (*webrtc.Certificate, error) {
+	pems, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := webrtc.CertificateFromPEM(string(pems))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	if time.Now().After(certificate.Expires()) {
+		return nil, webrtc.ErrCertificateExpired
+	}
+	return certificate, nil
+}
+
+// LoadOrGenerateCertificate loads the certificate at path, or generates and
+// saves one with CERTIFICATE_DEFAULT_VALIDITY if path does not exist.
+func LoadOrGenerateCertificate(path string) (*webrtc.Certificate, error) {
+	certificate, err := LoadCertificate(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return certificate, err
+	}
+
+	certificate, err = GenerateCertificate(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveCertificate(path, certificate); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of certificate as
+// announced in the SDP, e.g., "sha-256 AB:CD:...", to be pinned by the remote
+// peers out-of-band.
+func CertificateFingerprint(certificate *webrtc.Certificate) (string, error) {
+	fingerprints, err := certificate.GetFingerprints()
+	if err != nil {
+		return "", err
+	}
+	for _, fingerprint := range fingerprints {
+		if fingerprint.Algorithm == "sha-256" {
+			return fingerprint.Algorithm + " " + strings.ToUpper(fingerprint.Value), nil
+		}
+	}
+	return "", errors.New("no sha-256 fingerprint")
+}
@@ -0,0 +1,129 @@
+//go:build transportc_chaos
+
+package transportc
+
+import (
+	"errors"
+	mrand "math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Built with the transportc_chaos build tag, the package injects faults into
+// the Conns, DataChannels and signaling of Dialers and Listeners once
+// EnableChaos is called, so tests run under -race exercise the rare
+// interleavings of their state machines:
+//
+//	go test -race -tags transportc_chaos ./...
+//
+// Without the build tag, the hooks compile to nothing.
+
+// ErrChaosWrite is the error of a write to a DataChannel failed by chaos.
+var ErrChaosWrite = errors.New("chaos: injected write failure")
+
+// ChaosConfig sets the faults injected by EnableChaos.
+type ChaosConfig struct {
+	// WriteFailureRate is the probability of a write to a DataChannel to
+	// fail with ErrChaosWrite, as if the SCTP stream failed.
+	WriteFailureRate float64
+
+	// OpenDelayMax, if non-zero, delays the OnOpen of every DataChannel by
+	// a random duration up to OpenDelayMax.
+	OpenDelayMax time.Duration
+
+	// SignalDropRate is the probability of an offer read or an answer
+	// submitted by a Listener to be silently dropped, as by a lossy broker.
+	SignalDropRate float64
+
+	// Seed seeds the faults injected.
+	Seed int64
+}
+
+// ChaosStats counts the faults injected since EnableChaos.
+type ChaosStats struct {
+	WriteFailures uint64
+	OpenDelays    uint64
+	SignalDrops   uint64
+}
+
+type chaosState struct {
+	config ChaosConfig
+
+	mutex sync.Mutex
+	rand  *mrand.Rand
+
+	writeFailures atomic.Uint64
+	openDelays    atomic.Uint64
+	signalDrops   atomic.Uint64
+}
+
+var chaos atomic.Pointer[chaosState] // nil unless enabled
+
+// EnableChaos injects the faults of config into the whole package until the
+// returned function is called. It MUST NOT be used in production.
+func EnableChaos(config ChaosConfig) (disable func()) {
+	state := &chaosState{
+		config: config,
+		rand:   mrand.New(mrand.NewSource(config.Seed)), // skipcq: GSC-G404
+	}
+	previous := chaos.Swap(state)
+	return func() {
+		chaos.CompareAndSwap(state, previous)
+	}
+}
+
+// ChaosInjected returns the faults injected since chaos was last enabled.
+func ChaosInjected() ChaosStats {
+	state := chaos.Load()
+	if state == nil {
+		return ChaosStats{}
+	}
+	return ChaosStats{
+		WriteFailures: state.writeFailures.Load(),
+		OpenDelays:    state.openDelays.Load(),
+		SignalDrops:   state.signalDrops.Load(),
+	}
+}
+
+// chance returns true with probability p.
+func (s *chaosState) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rand.Float64() < p
+}
+
+// chaosWriteFailure returns ErrChaosWrite if a write to a DataChannel is to
+// fail.
+func chaosWriteFailure() error {
+	if state := chaos.Load(); state != nil && state.chance(state.config.WriteFailureRate) {
+		state.writeFailures.Add(1)
+		return ErrChaosWrite
+	}
+	return nil
+}
+
+// chaosDelayOpen sleeps before an OnOpen handler runs.
+func chaosDelayOpen() {
+	state := chaos.Load()
+	if state == nil || state.config.OpenDelayMax <= 0 {
+		return
+	}
+	state.mutex.Lock()
+	delay := time.Duration(state.rand.Int63n(int64(state.config.OpenDelayMax)))
+	state.mutex.Unlock()
+	state.openDelays.Add(1)
+	time.Sleep(delay)
+}
+
+// chaosDropSignal returns true if a signaling message is to be dropped.
+func chaosDropSignal() bool {
+	if state := chaos.Load(); state != nil && state.chance(state.config.SignalDropRate) {
+		state.signalDrops.Add(1)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+//go:build !transportc_chaos
+
+package transportc
+
+// The chaos hooks are no-ops unless built with the transportc_chaos build
+// tag, see chaos.go.
+
+func chaosWriteFailure() error { return nil }
+
+func chaosDelayOpen() {}
+
+func chaosDropSignal() bool { return false }
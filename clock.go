@@ -0,0 +1,258 @@
+package transportc
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of the package, driving the timeouts of Conns
+// and PeerConnections, the backoffs, the expiry of pregathered offers and the
+// bandwidth estimates, so tests can replace it with a FakeClock via WithClock.
+//
+// Context deadlines and the deadlines set on Conns are enforced by the
+// standard library and pion, and always follow the system clock, as do the
+// polls of the Signals.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a time.Timer created by a Clock.
+type Timer interface {
+	// C returns the channel the time is sent on once the Timer fires, or nil
+	// for a Timer created by AfterFunc.
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker is a time.Ticker created by a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock of the package unless replaced by WithClock.
+var SystemClock Clock = systemClock{}
+
+var (
+	clockMutex   sync.RWMutex
+	packageClock Clock = SystemClock
+)
+
+// WithClock replaces the Clock of the package with clock, e.g., a FakeClock
+// so tests of timeouts and backoffs are deterministic. It affects the whole
+// package until the returned function is called.
+//
+// Only timers created after the call use clock. It MUST NOT be used in
+// production.
+func WithClock(clock Clock) (restore func()) {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+
+	previous := packageClock
+	packageClock = clock
+	return func() {
+		clockMutex.Lock()
+		defer clockMutex.Unlock()
+		packageClock = previous
+	}
+}
+
+// currentClock returns the Clock of the package.
+func currentClock() Clock {
+	clockMutex.RLock()
+	defer clockMutex.RUnlock()
+	return packageClock
+}
+
+// clockAfter is time.After on the Clock of the package.
+func clockAfter(d time.Duration) <-chan time.Time {
+	return currentClock().NewTimer(d).C()
+}
+
+// clockSince is time.Since on the Clock of the package.
+func clockSince(t time.Time) time.Duration {
+	return currentClock().Now().Sub(t)
+}
+
+// clockSleep is time.Sleep on the Clock of the package.
+func clockSleep(d time.Duration) {
+	<-clockAfter(d)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// FakeClock is a Clock for tests, whose time only advances with Advance.
+type FakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer // pending, in creation order
+}
+
+// NewFakeClock creates a FakeClock starting at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements Clock.Now.
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// NewTimer implements Clock.NewTimer.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.schedule(d, 0, nil)
+}
+
+// NewTicker implements Clock.NewTicker.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return fakeTicker{c.schedule(d, d, nil)}
+}
+
+// AfterFunc implements Clock.AfterFunc. f is called in its own goroutine.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.schedule(d, 0, f)
+}
+
+// Pending returns the number of timers and tickers not stopped nor fired,
+// so a test can wait for the code under test to start waiting on the clock
+// before calling Advance.
+func (c *FakeClock) Pending() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.timers)
+}
+
+// Advance moves the time forward by d, firing the timers and tickers due in
+// chronological order. As with a time.Ticker, a tick not received before the
+// next one is dropped.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	target := c.now.Add(d)
+	for {
+		var next *fakeTimer
+		for _, t := range c.timers {
+			if !t.when.After(target) && (next == nil || t.when.Before(next.when)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		c.now = next.when
+		if next.period > 0 {
+			next.when = next.when.Add(next.period)
+		} else {
+			c.remove(next)
+		}
+		next.fire(c.now)
+	}
+	c.now = target
+}
+
+func (c *FakeClock) schedule(d, period time.Duration, f func()) *fakeTimer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := &fakeTimer{
+		clock:  c,
+		when:   c.now.Add(d),
+		period: period,
+		f:      f,
+	}
+	if f == nil {
+		t.c = make(chan time.Time, 1)
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// remove removes t from the pending timers. Caller MUST hold the mutex.
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	when   time.Time
+	period time.Duration // 0 for a Timer
+	c      chan time.Time
+	f      func()
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.f != nil {
+		go t.f()
+		return
+	}
+	select {
+	case t.c <- now:
+	default: // dropped, as a time.Ticker does
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	return t.clock.remove(t)
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
@@ -0,0 +1,110 @@
+package transportc
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// CloseReason is why a Conn is closed, see Conn.CloseReason, to tell network
+// problems apart from the behavior of the application.
+type CloseReason uint8
+
+const (
+	CLOSE_REASON_NONE                   CloseReason = iota // not closed
+	CLOSE_REASON_LOCAL                                     // closed by the application with Close
+	CLOSE_REASON_REMOTE                                    // the remote peer closed the datachannel
+	CLOSE_REASON_PEER_CONNECTION_FAILED                    // the PeerConnection failed, e.g., the ICE failed
+	CLOSE_REASON_PEER_CONNECTION_CLOSED                    // the PeerConnection was closed, e.g., by Dialer.Close or by the remote peer
+	CLOSE_REASON_IDLE_TIMEOUT                              // no Write for Config.Timeout
+	CLOSE_REASON_WRITE_STALLED                             // a Write blocked longer than Config.DefaultWriteTimeout
+	CLOSE_REASON_LISTENER_CLOSED                           // closed by the Listener, i.e., by Listener.Close or closing a namespace
+	CLOSE_REASON_SETUP_FAILED                              // the Conn failed to be set up, e.g., the wire handshake failed
+	CLOSE_REASON_MESSAGE_TOO_LARGE                         // a message larger than Config.MaxMessageSize was received
+	CLOSE_REASON_CONTEXT_DONE                              // the context of WithConnContext is done
+	CLOSE_REASON_PEER_CLOSED                               // the PeerConnection was closed by Listener.ClosePeer
+
+	closeReasonCount // number of CloseReasons
+)
+
+func (r CloseReason) String() string {
+	switch r {
+	case CLOSE_REASON_NONE:
+		return "none"
+	case CLOSE_REASON_LOCAL:
+		return "local"
+	case CLOSE_REASON_REMOTE:
+		return "remote"
+	case CLOSE_REASON_PEER_CONNECTION_FAILED:
+		return "peer_connection_failed"
+	case CLOSE_REASON_PEER_CONNECTION_CLOSED:
+		return "peer_connection_closed"
+	case CLOSE_REASON_IDLE_TIMEOUT:
+		return "idle_timeout"
+	case CLOSE_REASON_WRITE_STALLED:
+		return "write_stalled"
+	case CLOSE_REASON_LISTENER_CLOSED:
+		return "listener_closed"
+	case CLOSE_REASON_SETUP_FAILED:
+		return "setup_failed"
+	case CLOSE_REASON_MESSAGE_TOO_LARGE:
+		return "message_too_large"
+	case CLOSE_REASON_CONTEXT_DONE:
+		return "context_done"
+	case CLOSE_REASON_PEER_CLOSED:
+		return "peer_closed"
+	default:
+		return "unknown"
+	}
+}
+
+// CloseReason returns why the Conn is closed, or is no longer readable as
+// the remote peer closed the datachannel. The first reason is kept, e.g.,
+// CLOSE_REASON_REMOTE even if Close is called afterwards. It returns
+// CLOSE_REASON_NONE while the Conn is open.
+func (c *Conn) CloseReason() CloseReason {
+	c.tagMutex.Lock()
+	defer c.tagMutex.Unlock()
+	return c.closeReason
+}
+
+// setCloseReason records reason unless a reason is already recorded.
+// Caller MUST hold the tagMutex.
+func (c *Conn) setCloseReason(reason CloseReason) {
+	if c.closeReason == CLOSE_REASON_NONE {
+		c.closeReason = reason
+	}
+}
+
+// markCloseReason records reason before the Conn is closed as a consequence,
+// e.g., of its PeerConnection being closed.
+func (c *Conn) markCloseReason(reason CloseReason) {
+	c.tagMutex.Lock()
+	c.setCloseReason(reason)
+	c.tagMutex.Unlock()
+}
+
+// readFailureReason classifies err failing the read from the datachannel.
+func (c *Conn) readFailureReason(err error) CloseReason {
+	if errors.Is(err, io.EOF) {
+		return CLOSE_REASON_REMOTE
+	}
+	if errors.Is(err, io.ErrShortBuffer) { // the datachannel read a message larger than the buffer
+		return CLOSE_REASON_MESSAGE_TOO_LARGE
+	}
+	if c.peerConnection != nil && c.peerConnection.ConnectionState() == webrtc.PeerConnectionStateFailed {
+		return CLOSE_REASON_PEER_CONNECTION_FAILED
+	}
+	return CLOSE_REASON_PEER_CONNECTION_CLOSED
+}
+
+// closeConnWith closes conn, a Conn or a Conn wrapped by a DatagramConn,
+// for reason.
+func closeConnWith(conn net.Conn, reason CloseReason) error {
+	if c, ok := conn.(interface{ closeWith(CloseReason) error }); ok {
+		return c.closeWith(reason)
+	}
+	return conn.Close()
+}
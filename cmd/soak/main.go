@@ -0,0 +1,184 @@
+// Command soak dials and closes Conns against an in-process echo Listener,
+// for hours if need be, reporting the goroutines, file descriptors and heap of
+// the process as it goes.
+//
+// Once done, it checks that nothing leaked: no goroutine nor file descriptor
+// beyond those alive after the first Conn, and none at all once the Dialer and
+// Listener are closed. It exits with 1 otherwise.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gaukas/logging"
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/internal/leakcheck"
+)
+
+const settleTimeout = time.Minute
+
+var errMismatch = errors.New("echoed bytes differ from those written")
+
+func main() {
+	duration := flag.Duration("duration", time.Hour, "how long to dial Conns for")
+	conns := flag.Int("conns", 0, "stop after this many Conns, 0 for no limit")
+	concurrency := flag.Int("concurrency", 16, "Conns open at once")
+	interval := flag.Duration("interval", time.Minute, "interval between reports")
+	size := flag.Int("size", 1024, "bytes echoed over each Conn")
+	reuse := flag.Bool("reuse", false, "share PeerConnections between Conns, see Config.ReusePeerConnection")
+	flag.Parse()
+
+	logger := logging.DefaultStderrLogger(logging.LOG_INFO)
+	if *concurrency < 1 || *size < 1 || *size > transportc.CONN_DEFAULT_MTU {
+		logger.Fatalf("-concurrency must be positive and -size within 1 and %d", transportc.CONN_DEFAULT_MTU)
+	}
+
+	start := leakcheck.Take()
+	config := &transportc.Config{
+		Signal:              transportc.NewDebugSignal(*concurrency),
+		ReusePeerConnection: *reuse,
+	}
+	listener, err := config.NewListener()
+	if err != nil {
+		logger.Fatalf("failed to create listener: %v", err)
+	}
+	if err := listener.Start(); err != nil {
+		logger.Fatalf("failed to start listener: %v", err)
+	}
+	go echo(listener)
+	dialer, err := config.NewDialer()
+	if err != nil {
+		logger.Fatalf("failed to create dialer: %v", err)
+	}
+
+	// the first Conn starts what lives as long as the Dialer and Listener
+	if err := lifecycle(dialer, *size); err != nil {
+		logger.Fatalf("first Conn failed: %v", err)
+	}
+	baseline := leakcheck.Take()
+	logger.Infof("start %s, after the first Conn %s", start, baseline)
+
+	var established, failed atomic.Int64
+	deadline := time.Now().Add(*duration)
+	var remaining atomic.Int64
+	remaining.Store(int64(*conns))
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				if *conns > 0 && remaining.Add(-1) < 0 {
+					return
+				}
+				if err := lifecycle(dialer, *size); err != nil {
+					failed.Add(1)
+					logger.Warnf("Conn failed: %v", err)
+					continue
+				}
+				established.Add(1)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(*interval)
+	began := time.Now()
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+		case <-done:
+			running = false
+		}
+		s := leakcheck.Take()
+		logger.Infof("%s: %d Conns, %d failed, %s, heap growth %+dKiB",
+			time.Since(began).Round(time.Second), established.Load(), failed.Load(), s,
+			(int64(s.HeapInuse)-int64(baseline.HeapInuse))/1024)
+	}
+	ticker.Stop()
+
+	leaked := false
+	if s, err := leakcheck.WaitSettled(baseline, 0, settleTimeout); err != nil {
+		logger.Errorf("leaked after %d Conns: %v", established.Load(), err)
+		leaked = true
+	} else {
+		logger.Infof("nothing leaked after %d Conns: %s", established.Load(), s)
+	}
+
+	dialer.Close()
+	listener.Close()
+	if s, err := leakcheck.WaitSettled(start, 0, settleTimeout); err != nil {
+		logger.Errorf("leaked after closing the dialer and listener: %v", err)
+		leaked = true
+	} else {
+		logger.Infof("nothing leaked after closing the dialer and listener: %s", s)
+	}
+
+	if leaked {
+		os.Stderr.WriteString(leakcheck.Stacks())
+		os.Exit(1)
+	}
+}
+
+// echo echoes every message on the Conns accepted by listener.
+func echo(listener *transportc.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+			for {
+				n, err := conn.Read(buf)
+				if err != nil {
+					return
+				}
+				if _, err := conn.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// lifecycle dials a Conn, echoes size random bytes over it and closes it.
+func lifecycle(dialer *transportc.Dialer, size int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	conn, err := dialer.DialContext(ctx, "soak")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	payload := make([]byte, size)
+	rand.Read(payload)
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(payload); err != nil {
+		return err
+	}
+	received := make([]byte, size)
+	if _, err := io.ReadFull(conn, received); err != nil {
+		return err
+	}
+	if !bytes.Equal(received, payload) {
+		return errMismatch
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// relayConfig is the configuration file of transportc-relay.
+//
+// Broker, ICEServers and MaxConns are applied live on reload. Changing
+// Backend, ProxyProtocol or Certificate requires a restart.
+type relayConfig struct {
+	// Broker is the TCP address of the signaling broker.
+	Broker string `json:"broker"`
+
+	// Backend is the TCP address accepted Conns are forwarded to.
+	Backend string `json:"backend"`
+
+	// ProxyProtocol enables PROXY protocol v2 headers towards the Backend.
+	ProxyProtocol bool `json:"proxy_protocol"`
+
+	// ICEServers are the STUN/TURN servers used for new PeerConnections.
+	ICEServers []webrtc.ICEServer `json:"ice_servers"`
+
+	// MaxConns limits the number of Conns relayed concurrently. 0 for unlimited.
+	MaxConns int64 `json:"max_conns"`
+
+	// Certificate is the path to the DTLS certificate, generated if it does
+	// not exist, so the fingerprint of the relay is stable across restarts.
+	// If empty, a new certificate is generated for each PeerConnection.
+	Certificate string `json:"certificate"`
+}
+
+func loadConfig(path string) (*relayConfig, error) {
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &relayConfig{}
+	if err := json.Unmarshal(configBytes, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
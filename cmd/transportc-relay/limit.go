@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"sync"
+)
+
+// limitListener wraps a net.Listener so that at most limit Conns accepted
+// from it are open concurrently. The limit can be changed at any time.
+type limitListener struct {
+	net.Listener
+
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	limit  int64 // 0 for unlimited
+	active int64
+}
+
+func newLimitListener(listener net.Listener, limit int64) *limitListener {
+	ll := &limitListener{
+		Listener: listener,
+		limit:    limit,
+	}
+	ll.cond = sync.NewCond(&ll.mutex)
+	return ll
+}
+
+// SetLimit changes the limit. Conns already accepted are not affected.
+func (ll *limitListener) SetLimit(limit int64) {
+	ll.mutex.Lock()
+	ll.limit = limit
+	ll.mutex.Unlock()
+	ll.cond.Broadcast()
+}
+
+// Accept blocks until the number of open Conns is below the limit,
+// then accepts the next Conn.
+func (ll *limitListener) Accept() (net.Conn, error) {
+	ll.mutex.Lock()
+	for ll.limit > 0 && ll.active >= ll.limit {
+		ll.cond.Wait()
+	}
+	ll.active++
+	ll.mutex.Unlock()
+
+	conn, err := ll.Listener.Accept()
+	if err != nil {
+		ll.release()
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: ll.release}, nil
+}
+
+func (ll *limitListener) release() {
+	ll.mutex.Lock()
+	ll.active--
+	ll.mutex.Unlock()
+	ll.cond.Signal()
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (lc *limitConn) Close() error {
+	lc.once.Do(lc.release)
+	return lc.Conn.Close()
+}
@@ -0,0 +1,134 @@
+// Command transportc-relay accepts Conns over WebRTC DataChannels and forwards
+// them to a TCP backend.
+//
+// The configuration file is reloaded on SIGHUP or when it is modified, and
+// changes to the broker, ICE servers and connection limit apply live.
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gaukas/logging"
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/relay"
+	"github.com/pion/webrtc/v3"
+)
+
+const configPollInterval = 5 * time.Second
+
+func main() {
+	configPath := flag.String("config", "transportc-relay.json", "path to the configuration file")
+	flag.Parse()
+
+	logger := logging.DefaultStderrLogger(logging.LOG_INFO)
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		logger.Fatalf("failed to load config: %v", err)
+	}
+
+	reloadable := &reloadableSignal{}
+	if err := reloadable.connect(config.Broker); err != nil {
+		logger.Fatalf("failed to connect to broker %s: %v", config.Broker, err)
+	}
+
+	transportConfig := &transportc.Config{
+		Logger: logger,
+		Signal: reloadable,
+		WebRTCConfiguration: webrtc.Configuration{
+			ICEServers: config.ICEServers,
+		},
+	}
+	if config.Certificate != "" {
+		certificate, err := transportc.LoadOrGenerateCertificate(config.Certificate)
+		if err != nil {
+			logger.Fatalf("failed to load certificate: %v", err)
+		}
+		fingerprint, err := transportc.CertificateFingerprint(certificate)
+		if err != nil {
+			logger.Fatalf("failed to load certificate: %v", err)
+		}
+		logger.Infof("using certificate with fingerprint %s", fingerprint)
+		transportConfig.Certificates = []webrtc.Certificate{*certificate}
+	}
+	listener, err := transportConfig.NewListener()
+	if err != nil {
+		logger.Fatalf("failed to create listener: %v", err)
+	}
+	if err := listener.Start(); err != nil {
+		logger.Fatalf("failed to start listener: %v", err)
+	}
+
+	limited := newLimitListener(listener, config.MaxConns)
+
+	rc := &relay.Config{
+		Backend:       config.Backend,
+		Logger:        logger,
+		ProxyProtocol: config.ProxyProtocol,
+	}
+	r, err := rc.NewRelay(limited)
+	if err != nil {
+		logger.Fatalf("failed to create relay: %v", err)
+	}
+
+	logger.Infof("relaying to %s", config.Backend)
+	go watchConfig(*configPath, func(newConfig *relayConfig) {
+		if newConfig.Backend != config.Backend || newConfig.ProxyProtocol != config.ProxyProtocol || newConfig.Certificate != config.Certificate {
+			logger.Warnf("backend or certificate changes require a restart, ignored")
+			newConfig.Backend = config.Backend
+			newConfig.ProxyProtocol = config.ProxyProtocol
+			newConfig.Certificate = config.Certificate
+		}
+		if err := reloadable.connect(newConfig.Broker); err != nil {
+			logger.Errorf("failed to connect to broker %s, keeping %s: %v", newConfig.Broker, config.Broker, err)
+			newConfig.Broker = config.Broker
+		}
+		listener.UpdateICEServers(newConfig.ICEServers)
+		limited.SetLimit(newConfig.MaxConns)
+
+		config = newConfig
+		logger.Infof("config reloaded")
+	}, logger)
+
+	if err := r.Serve(); err != nil {
+		logger.Errorf("relay stopped: %v", err)
+	}
+}
+
+// watchConfig calls apply with the reloaded configuration on SIGHUP or
+// whenever the modification time of the file at path changes.
+func watchConfig(path string, apply func(*relayConfig), logger logging.Logger) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sighup:
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+		}
+
+		config, err := loadConfig(path)
+		if err != nil {
+			logger.Errorf("failed to reload config: %v", err)
+			continue
+		}
+		apply(config)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/internal/broker"
+)
+
+// reloadableSignal implements transportc.Signal by delegating to a
+// SharedSignal which can be replaced when the broker changes.
+type reloadableSignal struct {
+	mutex   sync.Mutex // serializes reloads
+	broker  string
+	session *broker.TCPSession
+	signal  atomic.Pointer[transportc.SharedSignal]
+}
+
+// connect connects to the broker, replacing the current session if the
+// broker changed.
+func (rs *reloadableSignal) connect(addr string) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if current := rs.signal.Load(); current != nil && addr == rs.broker && current.Err() == nil {
+		return nil
+	}
+
+	session, err := broker.Dial(addr)
+	if err != nil {
+		return err
+	}
+
+	rs.signal.Store(transportc.NewSharedSignal(session))
+	if rs.session != nil {
+		rs.session.Close()
+	}
+	rs.broker = addr
+	rs.session = session
+	return nil
+}
+
+func (rs *reloadableSignal) Offer(offer []byte) (uint64, error) {
+	return rs.signal.Load().Offer(offer)
+}
+
+func (rs *reloadableSignal) ReadOffer() (uint64, []byte, error) {
+	return rs.signal.Load().ReadOffer()
+}
+
+func (rs *reloadableSignal) Answer(offerID uint64, answer []byte) error {
+	return rs.signal.Load().Answer(offerID, answer)
+}
+
+func (rs *reloadableSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	return rs.signal.Load().ReadAnswer(offerID)
+}
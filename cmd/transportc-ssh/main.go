@@ -0,0 +1,254 @@
+// Command transportc-ssh forwards TCP connections over SSH over WebRTC
+// DataChannels, e.g., to reach the sshd of a host behind a NAT.
+//
+// On the remote host, run the server, which accepts port forwarding requests
+// from clients authorized by their public keys:
+//
+//	transportc-ssh -broker BROKER -server -hostkey HOST_KEY -authorized AUTHORIZED_KEYS
+//
+// On the local host, run the client to forward a local port to an address
+// reachable from the remote host:
+//
+//	transportc-ssh -broker BROKER -identity KEY -hostpubkey HOST_PUBLIC_KEY -forward 127.0.0.1:2222=127.0.0.1:22
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gaukas/logging"
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/internal/broker"
+	"github.com/gaukas/transportc/sshtunnel"
+	"golang.org/x/crypto/ssh"
+)
+
+const dialTimeout = 30 * time.Second
+
+func main() {
+	brokerAddr := flag.String("broker", "", "TCP address of the signaling broker")
+	server := flag.Bool("server", false, "run as server")
+	hostKey := flag.String("hostkey", "", "server: path to the private host key")
+	authorized := flag.String("authorized", "", "server: path to the authorized_keys file")
+	identity := flag.String("identity", "", "client: path to the private key")
+	hostPubKey := flag.String("hostpubkey", "", "client: path to the public host key of the server")
+	forward := flag.String("forward", "", "client: LOCAL_ADDR=REMOTE_ADDR to forward")
+	flag.Parse()
+
+	logger := logging.DefaultStderrLogger(logging.LOG_INFO)
+
+	session, err := broker.Dial(*brokerAddr)
+	if err != nil {
+		logger.Fatalf("failed to connect to broker %s: %v", *brokerAddr, err)
+	}
+	transportConfig := &transportc.Config{
+		Logger: logger,
+		Signal: transportc.NewSharedSignal(session),
+	}
+
+	if *server {
+		err = runServer(logger, transportConfig, *hostKey, *authorized)
+	} else {
+		err = runClient(logger, transportConfig, *identity, *hostPubKey, *forward)
+	}
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+}
+
+func runServer(logger logging.Logger, transportConfig *transportc.Config, hostKeyPath, authorizedPath string) error {
+	hostKey, err := loadPrivateKey(hostKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load host key: %w", err)
+	}
+
+	authorizedBytes, err := os.ReadFile(authorizedPath)
+	if err != nil {
+		return fmt.Errorf("failed to load authorized keys: %w", err)
+	}
+	authorizedKeys := make(map[string]bool)
+	for len(authorizedBytes) > 0 {
+		pubKey, _, _, rest, err := ssh.ParseAuthorizedKey(authorizedBytes)
+		if err != nil {
+			break
+		}
+		authorizedKeys[string(pubKey.Marshal())] = true
+		authorizedBytes = rest
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, pubKey ssh.PublicKey) (*ssh.Permissions, error) {
+			if authorizedKeys[string(pubKey.Marshal())] {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unauthorized public key for %s", meta.User())
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	listener, err := transportConfig.NewListener()
+	if err != nil {
+		return fmt.Errorf("failed to create listener: %w", err)
+	}
+	if err := listener.Start(); err != nil {
+		return fmt.Errorf("failed to start listener: %w", err)
+	}
+
+	tunnelConfig := &sshtunnel.Config{}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+			defer cancel()
+
+			sshConn, chans, reqs, err := tunnelConfig.Server(ctx, conn, serverConfig)
+			if err != nil {
+				logger.Warnf("SSH handshake failed: %v", err)
+				conn.Close()
+				return
+			}
+			logger.Infof("SSH connection from %s as %s", sshConn.RemoteAddr(), sshConn.User())
+
+			go ssh.DiscardRequests(reqs)
+			for newChannel := range chans {
+				go handleDirectTCPIP(logger, newChannel)
+			}
+		}()
+	}
+}
+
+// handleDirectTCPIP serves a port forwarding request from the client.
+func handleDirectTCPIP(logger logging.Logger, newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "direct-tcpip" {
+		newChannel.Reject(ssh.UnknownChannelType, "only port forwarding is supported")
+		return
+	}
+
+	// RFC4254, Section 7.2
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "malformed request")
+		return
+	}
+
+	addr := net.JoinHostPort(target.Host, fmt.Sprint(target.Port))
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		logger.Warnf("failed to forward to %s: %v", addr, err)
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	pipe(channel, conn)
+}
+
+func runClient(logger logging.Logger, transportConfig *transportc.Config, identityPath, hostPubKeyPath, forward string) error {
+	localAddr, remoteAddr, ok := strings.Cut(forward, "=")
+	if !ok {
+		return fmt.Errorf("malformed forward %q, expecting LOCAL_ADDR=REMOTE_ADDR", forward)
+	}
+
+	signer, err := loadPrivateKey(identityPath)
+	if err != nil {
+		return fmt.Errorf("failed to load identity: %w", err)
+	}
+
+	hostPubKeyBytes, err := os.ReadFile(hostPubKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load host public key: %w", err)
+	}
+	hostPubKey, _, _, _, err := ssh.ParseAuthorizedKey(hostPubKeyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse host public key: %w", err)
+	}
+
+	clientConfig := &ssh.ClientConfig{
+		User:            os.Getenv("USER"),
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostPubKey),
+	}
+
+	dialer, err := transportConfig.NewDialer()
+	if err != nil {
+		return fmt.Errorf("failed to create dialer: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	client, err := (&sshtunnel.Config{}).Dial(ctx, dialer, "ssh", clientConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Close()
+
+	localListener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return err
+	}
+	logger.Infof("forwarding %s to %s", localAddr, remoteAddr)
+
+	for {
+		localConn, err := localListener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			remoteConn, err := client.Dial("tcp", remoteAddr)
+			if err != nil {
+				logger.Warnf("failed to forward to %s: %v", remoteAddr, err)
+				localConn.Close()
+				return
+			}
+			pipe(localConn, remoteConn)
+		}()
+	}
+}
+
+func loadPrivateKey(path string) (ssh.Signer, error) {
+	keyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(keyBytes)
+}
+
+// pipe copies between a and b until either is closed.
+func pipe(a, b io.ReadWriteCloser) {
+	defer a.Close()
+	defer b.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
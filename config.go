@@ -1,6 +1,9 @@
 package transportc
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"net"
 	"time"
 
@@ -10,35 +13,339 @@ import (
 )
 
 const (
+	// Deprecated: MTU_DEFAULT is not used. The size of the messages written to
+	// and read from a Conn is bounded by Config.MaxMessageSize.
 	MTU_DEFAULT              = 1024
 	MAX_RECV_TIMEOUT_DEFAULT = time.Second * 10
 )
 
+var (
+	// ErrGatherTimeout is used internally when the ICE gathering is not
+	// complete after GatherTimeout.
+	ErrGatherTimeout = errors.New("ICE gathering timed out")
+
+	// ErrICECredentialsWithUDPMux is returned when static ICE credentials are
+	// configured for a Listener sharing a UDPMux.
+	ErrICECredentialsWithUDPMux = errors.New("static ICE credentials can't be used with UDPMux")
+
+	// ErrICECredentialsWithTCPMux is returned when static ICE credentials are
+	// configured for a Listener sharing a TCPMux.
+	ErrICECredentialsWithTCPMux = errors.New("static ICE credentials can't be used with TCPMux")
+
+	// ErrInvalidICERole is returned when DialerICERole or ListenerICERole is
+	// neither zero, ICERoleControlling nor ICERoleControlled, or when
+	// ListenerICERole is ICERoleControlled along with ListenerICELite.
+	ErrInvalidICERole = errors.New("invalid ICE role")
+
+	// ErrInvalidMaxMessageSize is returned when MaxMessageSize is negative or
+	// larger than CONN_DEFAULT_MTU.
+	ErrInvalidMaxMessageSize = errors.New("invalid max message size")
+
+	// ErrUnsupportedPlatform is returned when a Config option is not supported
+	// by the WebRTC stack of the platform, e.g., the browser's under GOOS=js.
+	ErrUnsupportedPlatform = errors.New("unsupported on this platform")
+)
+
 // Config is the configuration for the Dialer and Listener.
 type Config struct {
+	// BundlePolicy, if set, overrides WebRTCConfiguration.BundlePolicy.
+	BundlePolicy webrtc.BundlePolicy
+
 	// CandidateNetworkTypes restricts ICE agent to gather
 	// on only selected types of networks.
 	CandidateNetworkTypes []webrtc.NetworkType
 
+	// Certificates, if set, overrides WebRTCConfiguration.Certificates. The DTLS
+	// fingerprint of a certificate stays the same across restarts, unlike the
+	// one generated for each PeerConnection otherwise. See
+	// webrtc.CertificateFromPEM to load a certificate saved with
+	// webrtc.Certificate.PEM.
+	//
+	// Not supported under GOOS=js, where the browser generates the certificates.
+	Certificates []Certificate
+
+	// ConnContext, if set, derives the context of every Conn dialed or
+	// accepted from ctx, see Conn.Context, e.g., to attach the claims of the
+	// peer identity or a trace span. It is called before the Conn is returned
+	// by Dial or Accept, or passed to a handler.
+	ConnContext func(ctx context.Context, conn *Conn) context.Context
+
 	// InterfaceFilter restricts ICE agent to gather ICE candidates
-	// on only selected interfaces.
+	// on only selected interfaces, e.g., to avoid a VPN or cellular interface.
+	// Interface names are platform-specific, such as "eth0" on Linux, "en0"
+	// on macOS and "Ethernet" on Windows.
 	InterfaceFilter func(interfaceName string) (allowed bool)
 
+	// IPFilter restricts ICE agent to gather ICE candidates on only
+	// selected local IP addresses.
+	IPFilter func(ip net.IP) (allowed bool)
+
+	// DefaultReadTimeout, if non-zero, bounds every Read on the Conns created,
+	// unless a read deadline is set, so a dead peer can't block Read forever.
+	// A timed out Read fails with os.ErrDeadlineExceeded.
+	DefaultReadTimeout time.Duration
+
+	// DefaultWriteTimeout, if non-zero, bounds every Write on the Conns created,
+	// unless a write deadline is set. As a Write blocked on the DataChannel
+	// can't be aborted, the Conn is closed once the timeout elapses, and the
+	// Write fails with a WriteError of WRITE_ERROR_STALLED.
+	DefaultWriteTimeout time.Duration
+
+	// DialerDTLSRole defines the DTLS role when Dialing.
+	// If DTLSRoleClient or DTLSRoleServer, the role is announced in the offer
+	// and the Listener takes the other role. Otherwise, the Listener decides.
+	//
+	// The ICE roles are set by DialerICERole and ListenerICERole.
+	DialerDTLSRole DTLSRole
+
+	// DialerICERole, if set, is the ICE role the Dialer requires. As per
+	// RFC8445, Section 6.1.1, the Dialer, offering, is ICE controlling unless
+	// the Listener is in ICE-lite mode, see ListenerICERole. An answer which
+	// would make the Dialer take the other role is rejected with
+	// ErrICERoleConflict, so role mismatches between brokered peers fail
+	// deterministically instead of depending on the remote configuration.
+	DialerICERole ICERole
+
+	// DialerIdlePeerConnectionTimeout, if non-zero, is how long a
+	// PeerConnection of the Dialer is kept without any open Conn before
+	// it is closed, freeing its sockets and TURN allocations. The next Dial
+	// negotiates a new one. PeerConnections of PeerHandles are not closed.
+	// Otherwise, PeerConnections are kept until the Dialer is closed.
+	DialerIdlePeerConnectionTimeout time.Duration
+
+	// DialerPinnedFingerprints, if set, restricts the DTLS fingerprints the
+	// Listener may answer with, e.g., "sha-256 AB:CD:..." as returned by
+	// CertificateFingerprint for the certificate of the Listener. Otherwise,
+	// an answer is rejected with ErrFingerprintNotPinned.
+	DialerPinnedFingerprints []string
+
+	// DialerReconnectTicket, if set, is the reconnect ticket submitted in the
+	// offers until the Listener issues another, e.g., as persisted from
+	// Dialer.ReconnectTicket before a restart. See ListenerTicketKey.
+	//
+	// Dialer only.
+	DialerReconnectTicket string
+
+	// GatherTimeout, if non-zero, is the maximum time to wait for the ICE
+	// gathering to complete before signaling. Once elapsed, the offer or
+	// answer is signaled with whatever candidates have been gathered so far,
+	// instead of blocking until all ICE servers respond.
+	GatherTimeout time.Duration
+
+	// ICEPairPolicy is how the ICE candidate pair is nominated, e.g.,
+	// relayed for privacy or direct for latency. The Dialer, offering,
+	// nominates the pair, so the policy of the Listener only affects the
+	// candidates it gathers, i.e., with ICE_PAIR_POLICY_PREFER_RELAY.
+	//
+	// Under GOOS=js, where the browser runs the ICE agent, only
+	// ICE_PAIR_POLICY_PREFER_RELAY is supported.
+	ICEPairPolicy ICEPairPolicy
+
+	// ICETimeouts, if set, overrides how fast the ICE agent detects a dead
+	// peer, e.g., shorter than the defaults for interactive apps to fail over
+	// within seconds. Fields left zero take the defaults of pion.
+	//
+	// Not supported under GOOS=js, where the browser runs the ICE agent.
+	ICETimeouts *ICETimeouts
+
+	// IdentityKey, if set, is used to sign the DTLS fingerprint and ICE username
+	// fragment of every SDP before signaling, binding the connection to the
+	// identity of this peer. The other fields of the offer or answer, e.g.,
+	// the namespace, the metadata or the reconnect ticket, are signed as well,
+	// so the signaling cannot rewrite them.
+	IdentityKey ed25519.PrivateKey
+
+	// AllowedPeers, if set, restricts the remote peers to those presenting an SDP
+	// signed by one of the keys. Otherwise, SDP from any peer is accepted, and the
+	// signature is verified only if present.
+	AllowedPeers []ed25519.PublicKey
+
 	// IPs includes a slice of IP addresses and one single ICE Candidate Type.
 	// If set, will add these IPs as ICE Candidates
 	IPs *NAT1To1IPs
 
+	// LocalIPs, if set, binds the ICE agent to the listed local IP addresses,
+	// i.e., ICE candidates are only gathered on these addresses. Useful on
+	// multi-homed hosts. Applied in addition to IPFilter and InterfaceFilter.
+	LocalIPs []net.IP
+
+	// ListenerAcceptPriority, if set, returns the priority of a Conn accepted
+	// from a DataChannel of label and protocol. Among the Conns pending, Accept
+	// returns the ones of higher priority first, e.g., interactive or control
+	// channels ahead of bulk transfers under load.
+	ListenerAcceptPriority func(label, protocol string) (priority int)
+
+	// ListenerICECredentials overrides the ICE username fragment and password
+	// used by the Listener for all PeerConnections. If nil, random credentials
+	// are generated per PeerConnection.
+	//
+	// MUST NOT be used together with UDPMux, which demultiplexes PeerConnections
+	// by their username fragments.
+	ListenerICECredentials *ICECredentials
+
+	// ListenerICELite enables the ICE-lite mode (RFC8445, Section 2.5) when Listening.
+	// Only host candidates are gathered and ICE servers are ignored, which simplifies
+	// server deployments on public IP addresses and reduces the gathering time per
+	// accepted PeerConnection.
+	//
+	// The Listener is then ICE controlling, unless the Dialer is in ICE-lite
+	// mode as well.
+	ListenerICELite bool
+
+	// ListenerICERole, if set, is the ICE role the Listener requires. The
+	// Listener, answering, is ICE controlled unless in ICE-lite mode, so
+	// ICERoleControlling enables the ICE-lite mode as ListenerICELite does,
+	// and ICERoleControlled MUST NOT be set along with ListenerICELite. An
+	// offer which would make the Listener take the other role, i.e., from a
+	// Dialer in ICE-lite mode, is rejected with ErrICERoleConflict.
+	//
+	// Under GOOS=js, only ICERoleControlled is supported.
+	ListenerICERole ICERole
+
 	// ListenerDTLSRole defines the DTLS role when Listening.
 	// MUST be either DTLSRoleClient or DTLSRoleServer, as defined in RFC4347
 	// DTLSRoleClient will send the ClientHello and start the handshake.
 	// DTLSRoleServer will wait for the ClientHello.
+	//
+	// If unset, the Listener takes the role opposite to DialerDTLSRole of
+	// the Dialer. Offers requiring the same role are rejected.
 	ListenerDTLSRole DTLSRole
 
+	// ListenerMaxAcceptBacklog, if positive, limits the number of Conns
+	// pending on Accept. Once reached, the Listener stops reading offers from
+	// its Signals, which hold them until Accept catches up, instead of
+	// negotiating PeerConnections nobody accepts Conns from.
+	ListenerMaxAcceptBacklog int
+
+	// ListenerMaxDataChannels, if positive, limits the number of DataChannels
+	// open at the same time on each PeerConnection accepted by the Listener.
+	// DataChannels exceeding the limit are closed without being accepted.
+	ListenerMaxDataChannels int
+
+	// ListenerMaxPeerConnections, if positive, limits the number of
+	// PeerConnections of the Listener, including those being negotiated. Once
+	// reached, the Listener stops reading offers from its Signals until a
+	// PeerConnection is closed.
+	ListenerMaxPeerConnections int
+
+	// ListenerOfferFilter, if set, is called with the OfferInfo of each offer
+	// before negotiating its PeerConnection, e.g., to check the metadata
+	// submitted with WithOfferMetadata. An offer it returns an error for is
+	// not answered, so no ICE or TURN traffic is spent on it, and the Dialer
+	// fails once its context is done.
+	ListenerOfferFilter func(info OfferInfo) error
+
+	// ListenerRejectUnknownProtocols closes the DataChannels with a protocol
+	// not registered with Listener.Handle, instead of surfacing them via Accept.
+	ListenerRejectUnknownProtocols bool
+
+	// ListenerRestartTimeout, if non-zero, keeps a disconnected or failed
+	// PeerConnection for up to ListenerRestartTimeout, along with its Conns,
+	// so the Dialer may ICE restart it, e.g., upon Dialer.Resume once a mobile
+	// app is back from the background. Otherwise, a PeerConnection is torn
+	// down once disconnected, and ICE restarts are rejected.
+	ListenerRestartTimeout time.Duration
+
+	// ListenerSignals are Signals the Listener accepts offers from, along with
+	// Signal, e.g., an HTTP broker, a domain-fronted broker and an AMP cache.
+	// Each Signal is polled by its own loop, and the Conns of all are
+	// accepted from the same Listener. An offer is answered via the Signal it
+	// was read from.
+	ListenerSignals []Signal
+
+	// ListenerStandbyOffers, if non-zero, is the number of PeerConnections the
+	// Listener keeps offered in standby on ListenerStandbySignal, with their
+	// candidates gathered beforehand, e.g., for an offer-pool style broker
+	// handing them to clients. A client answers one with Dialer.DialStandby,
+	// so its Conn is open after one signaling exchange and the DTLS
+	// handshake. An offer answered or expired is replaced by a fresh one.
+	//
+	// Standby PeerConnections are not restartable, and not subject to
+	// ListenerOfferFilter nor namespaces, as the client sends no offer.
+	ListenerStandbyOffers int
+
+	// ListenerStandbySignal is the Signal the standby offers are published
+	// on, and their answers read from. It MUST NOT be a Signal the Listener
+	// accepts offers from, which would read its own standby offers.
+	ListenerStandbySignal Signal
+
+	// ListenerStandbyTTL is how long a standby offer is published before being
+	// replaced, and the expiry of its signature if IdentityKey is set.
+	// Defaults to STANDBY_TTL_DEFAULT.
+	ListenerStandbyTTL time.Duration
+
+	// ListenerTicketKey, if set, is the HMAC key of the reconnect tickets the
+	// Listener issues in its answers, of at least TICKET_KEY_MIN_SIZE bytes.
+	// Once connected, the Dialer submits its ticket in the following offers:
+	// a valid ticket skips ListenerOfferFilter and the allowed peers of the
+	// namespace, and its Conns are accepted with TICKET_ACCEPT_PRIORITY. A
+	// ticket is bound to the identity of the Dialer, if set, otherwise it is
+	// a bearer token. Listeners sharing the key accept each other's tickets.
+	ListenerTicketKey []byte
+
+	// ListenerTicketTTL is how long a reconnect ticket is valid once issued.
+	// Defaults to TICKET_TTL_DEFAULT.
+	ListenerTicketTTL time.Duration
+
 	Logger logging.Logger
 
+	// MaxBufferedAmount, if non-zero, bounds the bytes written to a Conn and
+	// not yet sent: a Write that would exceed it fails at once with a
+	// temporary WriteError wrapping ErrWriteBufferFull, instead of queuing
+	// behind a slow peer. A Write to a Conn with nothing buffered never fails
+	// so.
+	MaxBufferedAmount uint64
+
+	// MaxMessageSize is the maximum size of a message written to or read from
+	// a Conn, for the Dialer and the Listener alike. If zero, CONN_DEFAULT_MTU
+	// is used, which is also the max message size negotiated by pion over SCTP
+	// and MUST NOT be exceeded.
+	//
+	// A Write larger than MaxMessageSize fails with ErrMessageTooLarge, unless
+	// SplitLargeWrites is set. A message received larger than MaxMessageSize
+	// closes the Conn with CLOSE_REASON_MESSAGE_TOO_LARGE, so both peers
+	// SHOULD agree on it, e.g., advertised by SDPBandwidth.MaxMessageSize.
+	MaxMessageSize int
+
+	// Namespace is the namespace of the Listener the Dialer connects to, e.g.,
+	// one of the tenants sharing the Signal. If empty, the Conns are accepted
+	// by the Listener itself, otherwise by the net.Listener returned from
+	// Listener.Namespace. Dialer only.
+	Namespace string
+
+	// NewPacer, if set, creates the Pacer of each Conn created, pacing the
+	// messages written, see Pacer. A Conn is not paced if it returns nil.
+	NewPacer func() Pacer
+
+	// OpenTimeout, if non-zero, is how long Dial waits for the DataChannel to
+	// open once the answer is set as the remote description, so a stuck DTLS
+	// or SCTP handshake fails with ErrOpenTimeout instead of lasting as long
+	// as the context of Dial. Dialer only.
+	OpenTimeout time.Duration
+
+	// PreGatherPoolSize, if positive, is the number of PeerConnections the Dialer
+	// keeps ready in the background with the ICE gathering complete, so Dial is
+	// only delayed by the signaling of the offer and answer. Only effective
+	// when Signal is set.
+	PreGatherPoolSize int
+
+	// PreGatherTTL is the lifetime of a pre-gathered PeerConnection, after
+	// which its candidates are considered stale and it is discarded.
+	// If 0, PREGATHER_TTL_DEFAULT is used.
+	PreGatherTTL time.Duration
+
+	// PeerIdentity, if set, overrides WebRTCConfiguration.PeerIdentity.
+	PeerIdentity string
+
 	// PortRange is the range of ports to use for the DataChannel.
 	PortRange *PortRange
 
+	// RecordTranscript records the offer, the answer and the candidate and
+	// state events of each PeerConnection, retrieved with Conn.Transcript
+	// until the Conn is closed. Each PeerConnection records up to
+	// TRANSCRIPT_MAX_EVENTS events.
+	RecordTranscript bool
+
 	// ReusePeerConnection indicates whether to reuse the same PeerConnection
 	// if possible, when Dialer dials multiple times.
 	//
@@ -46,18 +353,158 @@ type Config struct {
 	// Otherwise, Dialer.Dial() negotiates for a new PeerConnection and creates a new DataChannel on it.
 	ReusePeerConnection bool
 
+	// RTCPMuxPolicy, if set, overrides WebRTCConfiguration.RTCPMuxPolicy.
+	RTCPMuxPolicy webrtc.RTCPMuxPolicy
+
+	// SCTPMaxReceiveBufferSize, if non-zero, is the SCTP receive window of
+	// each PeerConnection in bytes, shared by all Conns on it. pion defaults to
+	// 1 MiB. See Conn.SetReadBuffer for the bound of each Conn.
+	SCTPMaxReceiveBufferSize uint32
+
+	// SDPBandwidth, if set, caps the bandwidth advertised in every local SDP
+	// to the remote peer, before SDPTransformOutgoing is applied.
+	SDPBandwidth *SDPBandwidth
+
+	// SDPTransformIncoming, if set, is applied to every SDP received from the
+	// remote peer before it is set as the remote description.
+	SDPTransformIncoming SDPTransform
+
+	// SDPTransformOutgoing, if set, is applied to every local SDP before it is
+	// signaled to the remote peer. The local description is not affected.
+	SDPTransformOutgoing SDPTransform
+
+	// SignedOfferClockSkew is the clock skew tolerated between the Dialer and
+	// the Listener when checking the expiry of signed offers, see
+	// SignedOfferTTL. If 0, SIGNED_OFFER_CLOCK_SKEW_DEFAULT is used.
+	// Listener only.
+	SignedOfferClockSkew time.Duration
+
+	// SignedOfferTTL, if non-zero, is the lifetime of the offers signed by
+	// the Dialer with IdentityKey: the issued-at and expiry times are signed
+	// along with the offer, so a captured offer cannot be replayed once
+	// expired. The Listener rejects the signed offers expired with
+	// ErrOfferExpired, and, if set on the Listener too, those without expiry
+	// with ErrMissingOfferExpiry.
+	//
+	// A Listener checks the expiry of signed offers whether set or not, but
+	// peers predating it fail to verify the signature of offers with expiry.
+	SignedOfferTTL time.Duration
+
+	// SplitLargeWrites splits a Write larger than MaxMessageSize into multiple
+	// messages. Message boundaries are not preserved for such writes.
+	SplitLargeWrites bool
+
 	// Signal offers the automatic signaling when establishing the DataChannel.
 	Signal Signal
 
+	// Stats, if set, aggregates the statistics of all Conns created, and of the
+	// PeerConnections answered if used by a Listener, see Stats.Listener.
+	Stats *Stats
+
 	Timeout time.Duration
 
+	// TCPMux, if set, gathers ICE-TCP passive host candidates served over one
+	// TCP listener, e.g., created by webrtc.NewICETCPMux on port 443, so
+	// clients on networks blocking UDP, such as browsers, connect over TCP.
+	// The TCP network types are gathered along with the UDP ones, unless
+	// CandidateNetworkTypes is set, which MUST then include them.
+	//
+	// Dialers of this package only gather passive TCP candidates, and connect
+	// over TCP via a TURN server over TCP or TLS instead, e.g., with the ICE
+	// server "turns:turn.example.com:443?transport=tcp".
+	TCPMux ice.TCPMux
+
+	// Tracer, if set, traces the Dial, the signaling, the ICE gathering and
+	// the Accept of each PeerConnection. See the oteltrace package for an
+	// OpenTelemetry Tracer.
+	Tracer Tracer
+
 	// UDPMux allows serving multiple DataChannels over the one or more pre-established UDP socket.
 	UDPMux ice.UDPMux
 
+	// WireHandshake enables the wire handshake on every reliable Conn: upon
+	// open, both peers exchange the wire version and WireFeatures supported
+	// before any other message. A Conn failing the handshake is closed.
+	//
+	// MUST be set on both peers or neither. Otherwise, the Conns are in raw
+	// mode, where messages are exchanged as-is.
+	WireHandshake bool
+
+	// WireFeatures is the set of WireFeatures announced in the wire handshake.
+	WireFeatures WireFeatures
+
 	// WebRTCConfiguration is the configuration for the underlying WebRTC PeerConnection.
 	WebRTCConfiguration webrtc.Configuration
 }
 
+// webRTCConfiguration returns WebRTCConfiguration overridden by the typed
+// fields of Config, if set.
+func (c *Config) webRTCConfiguration() webrtc.Configuration {
+	configuration := c.WebRTCConfiguration
+	if c.BundlePolicy != webrtc.BundlePolicy(webrtc.Unknown) {
+		configuration.BundlePolicy = c.BundlePolicy
+	}
+	if c.RTCPMuxPolicy != webrtc.RTCPMuxPolicy(webrtc.Unknown) {
+		configuration.RTCPMuxPolicy = c.RTCPMuxPolicy
+	}
+	setCertificates(&configuration, c.Certificates)
+	if c.PeerIdentity != "" {
+		configuration.PeerIdentity = c.PeerIdentity
+	}
+	return configuration
+}
+
+// signedOfferClockSkew returns SignedOfferClockSkew, or its default if 0.
+func (c *Config) signedOfferClockSkew() time.Duration {
+	if c.SignedOfferClockSkew == 0 {
+		return SIGNED_OFFER_CLOCK_SKEW_DEFAULT
+	}
+	return c.SignedOfferClockSkew
+}
+
+// listenerICELite returns whether the Listener is in ICE-lite mode, see
+// ListenerICELite and ListenerICERole.
+func (c *Config) listenerICELite() bool {
+	return c.ListenerICELite || c.ListenerICERole == ICERoleControlling
+}
+
+// validICERole returns whether role is a valid DialerICERole or
+// ListenerICERole.
+func validICERole(role ICERole) bool {
+	return role == 0 || role == ICERoleControlling || role == ICERoleControlled
+}
+
+// listenerTicketTTL returns ListenerTicketTTL, or TICKET_TTL_DEFAULT if zero.
+func (c *Config) listenerTicketTTL() time.Duration {
+	if c.ListenerTicketTTL == 0 {
+		return TICKET_TTL_DEFAULT
+	}
+	return c.ListenerTicketTTL
+}
+
+// listenerStandbyTTL returns ListenerStandbyTTL, or STANDBY_TTL_DEFAULT if
+// zero.
+func (c *Config) listenerStandbyTTL() time.Duration {
+	if c.ListenerStandbyTTL == 0 {
+		return STANDBY_TTL_DEFAULT
+	}
+	return c.ListenerStandbyTTL
+}
+
+// listenerSignals returns Signal, if set, followed by ListenerSignals.
+func (c *Config) listenerSignals() []Signal {
+	var signals []Signal
+	if c.Signal != nil {
+		signals = append(signals, c.Signal)
+	}
+	for _, signal := range c.ListenerSignals {
+		if signal != nil {
+			signals = append(signals, signal)
+		}
+	}
+	return signals
+}
+
 // NewDialer creates a new Dialer from the given configuration.
 func (c *Config) NewDialer() (*Dialer, error) {
 	settingEngine, err := c.BuildSettingEngine()
@@ -69,14 +516,61 @@ func (c *Config) NewDialer() (*Dialer, error) {
 		c.Logger = logging.DefaultStderrLogger(logging.LOG_WARN)
 	}
 
-	return &Dialer{
+	maxMessageSize, err := c.maxMessageSize()
+	if err != nil {
+		return nil, err
+	}
+
+	if !validICERole(c.DialerICERole) {
+		return nil, ErrInvalidICERole
+	}
+
+	d := &Dialer{
 		logger:              c.Logger,
 		signal:              c.Signal,
 		timeout:             c.Timeout,
+		gatherTimeout:       c.GatherTimeout,
+		openTimeout:         c.OpenTimeout,
+		identityKey:         c.IdentityKey,
+		signedOfferTTL:      c.SignedOfferTTL,
+		allowedPeers:        c.AllowedPeers,
+		namespace:           c.Namespace,
+		dtlsRole:            c.DialerDTLSRole,
+		iceRole:             c.DialerICERole,
+		pinnedFingerprints:  c.DialerPinnedFingerprints,
+		ticket:              c.DialerReconnectTicket,
+		connContext:         c.ConnContext,
+		newPacer:            c.NewPacer,
 		settingEngine:       settingEngine,
-		configuration:       c.WebRTCConfiguration,
+		configuration:       c.webRTCConfiguration(),
+		icePairPolicy:       c.ICEPairPolicy,
 		reusePeerConnection: c.ReusePeerConnection,
-	}, nil
+		idlePCTimeout:       c.DialerIdlePeerConnectionTimeout,
+		sdpBandwidth:        c.SDPBandwidth,
+		sdpTransformIn:      c.SDPTransformIncoming,
+		sdpTransformOut:     c.SDPTransformOutgoing,
+		stats:               c.Stats,
+		tracer:              c.Tracer,
+		maxMessageSize:      maxMessageSize,
+		splitWrites:         c.SplitLargeWrites,
+		readTimeout:         c.DefaultReadTimeout,
+		writeTimeout:        c.DefaultWriteTimeout,
+		maxBufferedAmount:   c.MaxBufferedAmount,
+		wireHandshake:       c.WireHandshake,
+		wireFeatures:        c.WireFeatures,
+		events:              newEventBus(),
+		conns:               make(map[*Conn]struct{}),
+		idlePCTimers:        make(map[*webrtc.PeerConnection]Timer),
+		turnTrackers:        make(map[*webrtc.PeerConnection]*turnTracker),
+		recordTranscript:    c.RecordTranscript,
+		transcripts:         make(map[*webrtc.PeerConnection]*transcriptRecorder),
+	}
+
+	if c.PreGatherPoolSize > 0 && c.Signal != nil {
+		d.pool = newOfferPool(d, c.PreGatherPoolSize, c.PreGatherTTL)
+	}
+
+	return d, nil
 }
 
 // NewListener creates a new Listener from the given configuration.
@@ -90,48 +584,128 @@ func (c *Config) NewListener() (*Listener, error) {
 		c.Logger = logging.DefaultStderrLogger(logging.LOG_ERROR)
 	}
 
-	settingEngine.SetAnsweringDTLSRole(c.ListenerDTLSRole) // ignore if any error
+	maxMessageSize, err := c.maxMessageSize()
+	if err != nil {
+		return nil, err
+	}
+
+	configuration := c.webRTCConfiguration()
+	if err := c.buildListenerSettings(&settingEngine, &configuration); err != nil {
+		return nil, err
+	}
+
+	if len(c.ListenerTicketKey) > 0 && len(c.ListenerTicketKey) < TICKET_KEY_MIN_SIZE {
+		return nil, ErrInvalidTicketKey
+	}
+
+	if c.ListenerStandbyOffers > 0 && c.ListenerStandbySignal == nil {
+		return nil, ErrStandbyWithoutSignal
+	}
+
+	if !validICERole(c.ListenerICERole) || (c.ListenerICERole == ICERoleControlled && c.ListenerICELite) {
+		return nil, ErrInvalidICERole
+	}
 
 	l := &Listener{
-		logger:          c.Logger,
-		signal:          c.Signal,
-		timeout:         c.Timeout,
-		runningStatus:   LISTENER_NEW,
-		settingEngine:   settingEngine,
-		configuration:   c.WebRTCConfiguration,
-		peerConnections: make(map[uint64]*webrtc.PeerConnection),
-		conns:           make(chan net.Conn),
-		closed:          make(chan bool),
+		logger:                 c.Logger,
+		signals:                c.listenerSignals(),
+		timeout:                c.Timeout,
+		gatherTimeout:          c.GatherTimeout,
+		identityKey:            c.IdentityKey,
+		signedOfferTTL:         c.SignedOfferTTL,
+		signedOfferClockSkew:   c.signedOfferClockSkew(),
+		allowedPeers:           c.AllowedPeers,
+		dtlsRole:               c.ListenerDTLSRole,
+		maxDataChannels:        c.ListenerMaxDataChannels,
+		maxAcceptBacklog:       c.ListenerMaxAcceptBacklog,
+		maxPeerConnections:     c.ListenerMaxPeerConnections,
+		offerFilter:            c.ListenerOfferFilter,
+		routes:                 make(map[string]func(net.Conn)),
+		rejectUnknownProtocols: c.ListenerRejectUnknownProtocols,
+		restartTimeout:         c.ListenerRestartTimeout,
+		recordTranscript:       c.RecordTranscript,
+		ticketKey:              c.ListenerTicketKey,
+		ticketTTL:              c.listenerTicketTTL(),
+		staticCertificates:     len(c.Certificates) > 0,
+		runningStatus:          LISTENER_NEW,
+		settingEngine:          settingEngine,
+		configuration:          configuration,
+		icePairPolicy:          c.ICEPairPolicy,
+		iceLite:                c.listenerICELite(),
+		iceRole:                c.ListenerICERole,
+		standbySignal:          c.ListenerStandbySignal,
+		standbyOffers:          c.ListenerStandbyOffers,
+		standbyTTL:             c.listenerStandbyTTL(),
+		sdpBandwidth:           c.SDPBandwidth,
+		sdpTransformIn:         c.SDPTransformIncoming,
+		sdpTransformOut:        c.SDPTransformOutgoing,
+		stats:                  c.Stats,
+		tracer:                 c.Tracer,
+		maxMessageSize:         maxMessageSize,
+		splitWrites:            c.SplitLargeWrites,
+		readTimeout:            c.DefaultReadTimeout,
+		writeTimeout:           c.DefaultWriteTimeout,
+		maxBufferedAmount:      c.MaxBufferedAmount,
+		wireHandshake:          c.WireHandshake,
+		wireFeatures:           c.WireFeatures,
+		connContext:            c.ConnContext,
+		newPacer:               c.NewPacer,
+		namespaces:             make(map[string]*namespace),
+		acceptQueue:            newAcceptQueue(),
+		acceptPriority:         c.ListenerAcceptPriority,
+		closed:                 make(chan bool),
+		events:                 newEventBus(),
 	}
 
 	return l, nil
 }
 
-// BuildSettingEngine builds a SettingEngine from the configuration.
-func (c *Config) BuildSettingEngine() (webrtc.SettingEngine, error) {
-	var settingEngine webrtc.SettingEngine = webrtc.SettingEngine{}
-
-	if c.IPs != nil {
-		settingEngine.SetNAT1To1IPs(c.IPs.IPs, c.IPs.Type)
+// buildIPFilter combines IPFilter and LocalIPs.
+func (c *Config) buildIPFilter() func(net.IP) bool {
+	ipFilter := c.IPFilter
+	localIPs := append([]net.IP(nil), c.LocalIPs...)
+	return func(ip net.IP) bool {
+		if ipFilter != nil && !ipFilter(ip) {
+			return false
+		}
+		if len(localIPs) == 0 {
+			return true
+		}
+		for _, localIP := range localIPs {
+			if localIP.Equal(ip) {
+				return true
+			}
+		}
+		return false
 	}
+}
 
-	if c.PortRange != nil {
-		err := settingEngine.SetEphemeralUDPPortRange(c.PortRange.Min, c.PortRange.Max)
-		if err != nil {
-			return webrtc.SettingEngine{}, err
-		}
+func (c *Config) maxMessageSize() (int, error) {
+	if c.MaxMessageSize < 0 || c.MaxMessageSize > CONN_DEFAULT_MTU {
+		return 0, ErrInvalidMaxMessageSize
 	}
+	if c.MaxMessageSize == 0 {
+		return CONN_DEFAULT_MTU, nil
+	}
+	return c.MaxMessageSize, nil
+}
+
+// BuildSettingEngine builds a SettingEngine from the configuration.
+func (c *Config) BuildSettingEngine() (webrtc.SettingEngine, error) {
+	var settingEngine webrtc.SettingEngine = webrtc.SettingEngine{}
 
-	if c.UDPMux != nil {
-		settingEngine.SetICEUDPMux(c.UDPMux)
+	if err := c.ICEPairPolicy.validate(); err != nil {
+		return webrtc.SettingEngine{}, err
 	}
 
-	if c.CandidateNetworkTypes != nil {
-		settingEngine.SetNetworkTypes(c.CandidateNetworkTypes)
+	if err := c.buildNetworkSettings(&settingEngine); err != nil {
+		return webrtc.SettingEngine{}, err
 	}
 
-	if c.InterfaceFilter != nil {
-		settingEngine.SetInterfaceFilter(c.InterfaceFilter)
+	if c.SCTPMaxReceiveBufferSize > 0 {
+		if err := setSCTPMaxReceiveBufferSize(&settingEngine, c.SCTPMaxReceiveBufferSize); err != nil {
+			return webrtc.SettingEngine{}, err
+		}
 	}
 
 	// GW: Making sure we will get a detached DataChannel as
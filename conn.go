@@ -2,11 +2,19 @@ package transportc
 
 import (
 	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/pion/datachannel"
+	"github.com/pion/transport/deadline"
+	"github.com/pion/webrtc/v3"
 )
 
 const (
@@ -15,145 +23,567 @@ const (
 	CONN_DEFAULT_CONCURRENCY = 4
 )
 
+var (
+	// ErrMessageTooLarge is returned when writing a message larger than
+	// the max message size of the Conn, see Config.MaxMessageSize.
+	ErrMessageTooLarge = errors.New("message too large")
+
+	// ErrStringMessageUnsupported is returned when writing a string message
+	// to a Conn not backed by a pion datachannel, see Conn.WriteMessage.
+	ErrStringMessageUnsupported = errors.New("string messages unsupported")
+)
+
+// connMessage is a message read from the datachannel.
+type connMessage struct {
+	data     []byte
+	isString bool // sent with the string PPID
+}
+
 // Conn defines a connection based on a dedicated datachannel.
 // Conn interfaces net.Conn.
 type Conn struct {
 	dataChannel io.ReadWriteCloser
+	label       string
+	protocol    string
+	peerID      uint64 // ID of the PeerConnection in the Listener, 0 if dialed
 	localAddr   net.Addr
 	remoteAddr  net.Addr
 
-	recvBuf    chan []byte // only readloop may write to or close this channel
-	recvClosed atomic.Bool
+	recvBuf    chan connMessage // only readloop, or Close if readloop never started, may write to or close this channel
+	readOnce   sync.Once        // starts readloop upon the first Read or StartReader
+	done       chan struct{}    // closed on Close
+	terminated chan struct{}    // closed once both Close is called and readloop exited
+	teardown   atomic.Int32     // number of Close and readloop yet to finish, see release
+
+	deadlineRd *ioDeadline
+	deadlineWr *ioDeadline
+
+	// readTimeout and writeTimeout bound each Read and Write unless a
+	// deadline is set, see Config.DefaultReadTimeout
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	halvesOnce sync.Once // creates reader and writer upon the first Reader or Writer call
+	reader     *ConnReader
+	writer     *ConnWriter
+	halvesOpen atomic.Int32 // number of reader and writer not closed
+
+	idle   atomic.Bool
+	paused atomic.Bool // see Pause
 
-	deadlineRd time.Time
-	deadlineWr time.Time
+	maxMessageSize    int         // 0 if unset, see MaxMessageSize
+	maxBufferedAmount uint64      // 0 for unlimited, see Config.MaxBufferedAmount
+	splitWrites       bool        // split writes larger than maxMessageSize instead of failing
+	buffers           connBuffers // see SetReadBuffer and SetWriteBuffer
 
-	idle atomic.Bool
+	pacer atomic.Pointer[connPacer] // nil unless paced, see SetPacer
+
+	handshakeInfo HandshakeInfo
+	peerIdentity  ed25519.PublicKey
+	offerMetadata map[string]string // see WithOfferMetadata
+	reconnected   bool              // see Reconnected
+
+	peerConnection *webrtc.PeerConnection // nil if unknown
+	turn           *turnTracker           // TURN allocations of peerConnection, see TURNState
+	created        time.Time
+	bandwidth      bandwidthSampler // for EstimatedBandwidth
+
+	wireVersion  uint8 // 0 in raw mode
+	wireFeatures WireFeatures
+
+	tagMutex    sync.Mutex // protects tag, closed and transcript against concurrent SetTag and Close
+	tag         string
+	closed      bool
+	closeReason CloseReason
+	transcript  *transcriptRecorder // nil unless Config.RecordTranscript, purged on Close
+	onClose     func()              // called once upon the first Close, if set
+	stats       *Stats
+	counters    atomic.Pointer[tagCounters] // counters of tag in stats, nil if not tracked
+
+	ctx       context.Context // see Context, guarded by tagMutex
+	cancelCtx context.CancelFunc
 }
 
 // BuildConningle builds a Conningle from an existing datachannel.
 func NewConn(dataChannel io.ReadWriteCloser, maxConcurrency int) *Conn {
-	return &Conn{
+	c := &Conn{
 		dataChannel: dataChannel,
-		recvBuf:     make(chan []byte, maxConcurrency),
+		recvBuf:     make(chan connMessage, maxConcurrency),
+		done:        make(chan struct{}),
+		terminated:  make(chan struct{}),
+		deadlineRd:  newIODeadline(),
+		deadlineWr:  newIODeadline(),
+		created:     currentClock().Now(),
+		buffers:     newConnBuffers(),
 	}
+	c.ctx, c.cancelCtx = context.WithCancel(context.WithValue(context.Background(), connContextKey{}, c))
+	c.bandwidth.bufferedBytes = c.bufferedAmount
+	c.teardown.Store(2)
+	c.halvesOpen.Store(2)
+	return c
 }
 
 // Read reads data from the connection (underlying datachannel). It blocks until
 // read deadline is reached, data is received in read buffer or error occurs.
+//
+// Updating the read deadline affects a pending Read as well. If no read
+// deadline is set, Read fails after Config.DefaultReadTimeout, if non-zero.
+//
+// Once the remote peer closed its Conn, Read returns the messages received
+// before, then io.EOF.
+//
+// The first Read starts reading from the datachannel, see StartReader.
 func (c *Conn) Read(p []byte) (n int, err error) {
-	if c.recvClosed.Load() {
-		return 0, io.EOF
+	return c.read(p, c.deadlineRd, nil)
+}
+
+// StartReader starts reading messages from the datachannel ahead of the first
+// Read, e.g., to observe the remote peer closing a Conn only written to, see
+// CloseReason. Otherwise, a Conn never read from runs no reading goroutine
+// and holds no read buffer, which adds up for relays with many Conns. It is a
+// no-op once started or closed.
+func (c *Conn) StartReader() {
+	c.readOnce.Do(func() {
+		go c.readloop()
+	})
+}
+
+// ReadMessage reads a message like Read, and reports whether it was sent as a
+// string, i.e., with the string PPID, such as a string sent by a browser,
+// or binary, such as an ArrayBuffer.
+func (c *Conn) ReadMessage(p []byte) (n int, isString bool, err error) {
+	return c.readMessage(p, c.deadlineRd, nil)
+}
+
+// read reads a message into p, until dl is exceeded or closed is closed.
+func (c *Conn) read(p []byte, dl *ioDeadline, closed <-chan struct{}) (n int, err error) {
+	n, _, err = c.readMessage(p, dl, closed)
+	return n, err
+}
+
+func (c *Conn) readMessage(p []byte, dl *ioDeadline, closed <-chan struct{}) (n int, isString bool, err error) {
+	defer func() {
+		if counters := c.counters.Load(); counters != nil && n > 0 {
+			counters.bytesRead.Add(uint64(n))
+		}
+	}()
+
+	// Messages received before the remote peer closed the datachannel are
+	// still read from recvBuf, but not those left once the Conn is closed.
+	select {
+	case <-c.done:
+		return 0, false, io.EOF
+	default:
 	}
 
-	var ctxRead context.Context = context.Background()
-	var cancelRead context.CancelFunc = func() {}
-	if !c.deadlineRd.IsZero() {
-		ctxRead, cancelRead = context.WithDeadline(ctxRead, c.deadlineRd)
+	c.StartReader()
+
+	var timeout <-chan time.Time
+	if c.readTimeout > 0 && !dl.set.Load() {
+		timer := currentClock().NewTimer(c.readTimeout)
+		defer timer.Stop()
+		timeout = timer.C()
 	}
-	defer cancelRead()
 
-	// First select: check if anything readily available.
 	select {
-	case <-ctxRead.Done(): // if context is done, return error
-		return 0, ctxRead.Err()
-	case buf := <-c.recvBuf: // if anything is in the read buffer, read from it
-		if buf == nil {
-			return 0, io.EOF
+	case <-dl.Done(): // if deadline is exceeded, return error
+		return 0, false, os.ErrDeadlineExceeded
+	case <-closed:
+		return 0, false, net.ErrClosed
+	case <-timeout:
+		return 0, false, os.ErrDeadlineExceeded
+	case msg := <-c.recvBuf:
+		if msg.data == nil {
+			return 0, false, io.EOF
 		}
-		n = copy(p, buf)
-		if n < len(buf) {
+		c.releaseReadSpace(len(msg.data))
+		n = copy(p, msg.data)
+		if n < len(msg.data) {
 			err = io.ErrShortBuffer
 		}
-		return n, err
-	default: // nothing readily available, read from datachannel into recvBuf
-		go func() {
-			buf := make([]byte, CONN_DEFAULT_MTU)
-			n, err := c.dataChannel.Read(buf)
-			if err != nil {
-				c.dataChannel.Close() // immediately close datachannel on error
-				c.recvClosed.Store(true)
-				close(c.recvBuf)
-				return
-			}
-			if c.recvClosed.Load() {
-				return
-			}
-			c.recvBuf <- buf[:n]
-		}()
+		return n, msg.isString, err
 	}
+}
 
-	// Second select:
-	select {
-	case <-ctxRead.Done(): // if context is done, return error
-		return 0, ctxRead.Err()
-	case buf := <-c.recvBuf: // if anything is in the read buffer, read from it
-		if buf == nil {
-			return 0, io.EOF
+// readloop reads messages from the datachannel into recvBuf until the
+// datachannel fails or the Conn is closed. It is the only reader of the
+// datachannel, so messages are never reordered.
+func (c *Conn) readloop() {
+	defer c.terminate()
+
+	reader, _ := c.dataChannel.(datachannel.Reader)
+	buf := make([]byte, c.MaxMessageSize()) // reused, each message is copied out at its size
+	for {
+		if !c.waitReadSpace() {
+			return
 		}
-		n = copy(p, buf)
-		if n < len(buf) {
-			err = io.ErrShortBuffer
+
+		var n int
+		var isString bool
+		var err error
+		if reader != nil {
+			n, isString, err = reader.ReadDataChannel(buf)
+		} else {
+			n, err = c.dataChannel.Read(buf)
+		}
+		if err != nil {
+			c.markCloseReason(c.readFailureReason(err))
+			c.dataChannel.Close() // immediately close datachannel on error
+			return
+		}
+
+		data := make([]byte, n) // never nil, which marks io.EOF
+		copy(data, buf[:n])
+		c.buffers.readQueued.Add(int64(n))
+		select {
+		case c.recvBuf <- connMessage{data: data, isString: isString}:
+		case <-c.done:
+			return
 		}
-		return n, err
 	}
 }
 
 // Write writes data to the connection (underlying datachannel). It blocks until
 // write deadline is reached, data is accepted by write buffer or error occurs.
+//
+// p is sent as a single message. If p is larger than the max message size,
+// Write fails with ErrMessageTooLarge, or sends p in multiple messages if
+// Config.SplitLargeWrites is set. Other failures are reported as a WriteError.
 func (c *Conn) Write(p []byte) (n int, err error) {
-	if c.deadlineWr.IsZero() {
-		n, err = c.dataChannel.Write(p)
-		if err == nil || n > 0 {
-			c.idle.Store(false)
+	return c.write(p, c.deadlineWr)
+}
+
+// write writes p, in multiple messages if needed and allowed, until dl is exceeded.
+func (c *Conn) write(p []byte, dl *ioDeadline) (n int, err error) {
+	if !c.splitWrites || c.maxMessageSize == 0 {
+		return c.writeMessageDeadline(p, dl)
+	}
+
+	for len(p) > c.maxMessageSize {
+		m, err := c.writeMessageDeadline(p[:c.maxMessageSize], dl)
+		n += m
+		if err != nil {
+			return n, err
 		}
-		return n, err
+		p = p[m:]
 	}
+	m, err := c.writeMessageDeadline(p, dl)
+	return n + m, err
+}
+
+// writeMessage writes p as a single message to the underlying datachannel.
+func (c *Conn) writeMessage(p []byte) (n int, err error) {
+	return c.writeMessageDeadline(p, c.deadlineWr)
+}
+
+// WriteMessage writes p as a single message like Write, as a string, i.e., with
+// the string PPID, if isString is set, or binary otherwise. Browser peers
+// receive a string message as a string instead of an ArrayBuffer or Blob.
+//
+// p is never split, see Config.SplitLargeWrites.
+func (c *Conn) WriteMessage(p []byte, isString bool) (n int, err error) {
+	return c.writeDataChannel(p, isString, c.deadlineWr)
+}
+
+func (c *Conn) writeMessageDeadline(p []byte, dl *ioDeadline) (n int, err error) {
+	return c.writeDataChannel(p, false, dl)
+}
+
+// writeDataChannel writes p as a single message, binary unless isString,
+// until dl is exceeded.
+func (c *Conn) writeDataChannel(p []byte, isString bool, dl *ioDeadline) (n int, err error) {
+	if c.maxMessageSize > 0 && len(p) > c.maxMessageSize {
+		return 0, fmt.Errorf("%w: %d bytes exceeds %d", ErrMessageTooLarge, len(p), c.maxMessageSize)
+	}
+
+	defer func() {
+		if counters := c.counters.Load(); counters != nil && n > 0 {
+			counters.bytesWritten.Add(uint64(n))
+		}
+	}()
 
 	select {
-	case <-time.After(time.Until(c.deadlineWr)):
-		return 0, os.ErrDeadlineExceeded
+	case <-c.done:
+		return 0, &WriteError{Kind: WRITE_ERROR_CLOSED, Err: net.ErrClosed}
 	default:
-		n, err = c.dataChannel.Write(p)
-		if err == nil || n > 0 {
-			c.idle.Store(false)
+	}
+	select {
+	case <-dl.Done():
+		return 0, &WriteError{Kind: WRITE_ERROR_DEADLINE, Err: os.ErrDeadlineExceeded}
+	default:
+	}
+
+	if err = c.pace(len(p), dl); err != nil {
+		return 0, err
+	}
+
+	// Fail fast instead of queuing behind a slow peer, unless nothing is
+	// queued so a message is never refused for good
+	if c.maxBufferedAmount > 0 {
+		if buffered := c.bufferedAmount(); buffered > 0 && buffered+uint64(len(p)) > c.maxBufferedAmount {
+			return 0, &WriteError{Kind: WRITE_ERROR_BUFFER_FULL, Err: fmt.Errorf("%w: %d bytes buffered", ErrWriteBufferFull, buffered)}
 		}
-		return n, err
 	}
+
+	// A Write blocked longer than writeTimeout indicates a dead peer, and
+	// there is no way to abort it other than closing the Conn.
+	if c.writeTimeout > 0 && !dl.set.Load() {
+		var timedOut atomic.Bool
+		timer := currentClock().AfterFunc(c.writeTimeout, func() {
+			timedOut.Store(true)
+			c.closeWith(CLOSE_REASON_WRITE_STALLED)
+		})
+		defer func() {
+			if !timer.Stop() && timedOut.Load() {
+				err = &WriteError{Kind: WRITE_ERROR_STALLED, Err: os.ErrDeadlineExceeded}
+			}
+		}()
+	}
+
+	if err = c.waitWriteSpace(dl); err != nil {
+		return 0, err
+	}
+
+	switch err = chaosWriteFailure(); { // nil unless built for chaos testing
+	case err != nil:
+	case isString:
+		writer, ok := c.dataChannel.(datachannel.Writer)
+		if !ok {
+			return 0, ErrStringMessageUnsupported
+		}
+		n, err = writer.WriteDataChannel(p, true)
+	default:
+		n, err = c.dataChannel.Write(p)
+	}
+	if err == nil || n > 0 {
+		c.idle.Store(false)
+	}
+	if err != nil {
+		return n, c.writeFailure(err)
+	}
+	return n, nil
 }
 
+// terminate marks the Conn as no longer readable once recvBuf is drained. It
+// is called exactly once, by readloop upon exiting, or by Close if readloop
+// was never started.
+func (c *Conn) terminate() {
+	close(c.recvBuf)
+	c.release()
+}
+
+// release closes terminated after both Close and terminate are done.
+func (c *Conn) release() {
+	if c.teardown.Add(-1) == 0 {
+		close(c.terminated)
+	}
+}
+
+// Close closes the Conn and the underlying datachannel. A pending Read is
+// unblocked, even if the remote peer never closes the datachannel.
+//
+// The datachannel is closed by resetting its SCTP stream, so the remote peer
+// reads the messages written before Close, then io.EOF, without waiting for
+// the PeerConnection to time out.
 func (c *Conn) Close() error {
+	return c.closeWith(CLOSE_REASON_LOCAL)
+}
+
+// closeWith closes the Conn for reason, unless another reason is recorded.
+func (c *Conn) closeWith(reason CloseReason) error {
+	c.tagMutex.Lock()
+	c.setCloseReason(reason)
+	first := !c.closed
+	if first {
+		c.closed = true
+		c.transcript = nil
+		close(c.done)
+		c.cancelCtx()
+		if counters := c.counters.Load(); counters != nil {
+			counters.activeConns.Add(-1)
+			counters.closedConns[c.closeReason].Add(1)
+		}
+	}
+	c.tagMutex.Unlock()
+
+	if !first {
+		if c.dataChannel == nil {
+			return nil
+		}
+		return c.dataChannel.Close()
+	}
+
+	if c.onClose != nil {
+		c.onClose()
+	}
+	defer c.release()
+	c.readOnce.Do(c.terminate) // readloop never started
+
+	if c.dataChannel == nil {
+		return nil // datachannel not open yet
+	}
+
+	// Closing a datachannel only closes the write-direction, so the read
+	// deadline is used to unblock readloop.
+	if dc, ok := c.dataChannel.(interface{ SetReadDeadline(time.Time) error }); ok {
+		dc.SetReadDeadline(time.Now())
+	}
 	return c.dataChannel.Close()
 }
 
+// Done returns a channel closed once the Conn is closed and all its
+// goroutines reading from the datachannel have exited.
+func (c *Conn) Done() <-chan struct{} {
+	return c.terminated
+}
+
+// SetTag tags the Conn. If the Conn is tracked by Stats, its traffic from
+// now on is accounted to the new tag.
+func (c *Conn) SetTag(tag string) {
+	c.tagMutex.Lock()
+	defer c.tagMutex.Unlock()
+
+	if c.tag == tag {
+		return
+	}
+	c.tag = tag
+
+	if c.stats == nil || c.closed {
+		return
+	}
+	if counters := c.counters.Load(); counters != nil {
+		counters.activeConns.Add(-1)
+	}
+	counters := c.stats.counters(tag)
+	counters.activeConns.Add(1)
+	counters.totalConns.Add(1)
+	c.counters.Store(counters)
+}
+
+// Tag returns the tag of the Conn.
+func (c *Conn) Tag() string {
+	c.tagMutex.Lock()
+	defer c.tagMutex.Unlock()
+	return c.tag
+}
+
+// trackStats starts accounting the Conn under its current tag in stats.
+func (c *Conn) trackStats(stats *Stats) {
+	if stats == nil {
+		return
+	}
+
+	c.tagMutex.Lock()
+	defer c.tagMutex.Unlock()
+
+	c.stats = stats
+	if c.closed {
+		return
+	}
+	counters := stats.counters(c.tag)
+	counters.activeConns.Add(1)
+	counters.totalConns.Add(1)
+	c.counters.Store(counters)
+}
+
+// Label returns the label of the underlying datachannel.
+func (c *Conn) Label() string {
+	return c.label
+}
+
+// Protocol returns the protocol of the underlying datachannel, i.e., the name
+// of the service requested by the Dialer.
+func (c *Conn) Protocol() string {
+	return c.protocol
+}
+
+// PeerID returns the ID of the PeerConnection the Conn was accepted from,
+// which can be passed to Listener.ClosePeer. It is 0 for Conns created by
+// a Dialer.
+func (c *Conn) PeerID() uint64 {
+	return c.peerID
+}
+
 // LocalAddr returns the address of Local ICE Candidate
-// selected for the datachannel
+// selected for the datachannel. It is never nil, even if
+// the selected candidate is unknown.
 func (c *Conn) LocalAddr() net.Addr {
+	if c.localAddr == nil {
+		return &Addr{}
+	}
 	return c.localAddr
 }
 
 // RemoteAddr returns the address of Remote ICE Candidate
-// selected for the datachannel
+// selected for the datachannel. It is never nil, even if
+// the selected candidate is unknown.
 func (c *Conn) RemoteAddr() net.Addr {
+	if c.remoteAddr == nil {
+		return &Addr{}
+	}
 	return c.remoteAddr
 }
 
+// HandshakeInfo returns the time spent in each stage of establishing the Conn.
+func (c *Conn) HandshakeInfo() HandshakeInfo {
+	return c.handshakeInfo
+}
+
+// Transcript returns the negotiation of the PeerConnection of the Conn, or nil
+// if Config.RecordTranscript is not set or the Conn is closed.
+func (c *Conn) Transcript() *Transcript {
+	c.tagMutex.Lock()
+	transcript := c.transcript
+	c.tagMutex.Unlock()
+	return transcript.snapshot()
+}
+
+// PeerIdentity returns the identity public key of the remote peer, or nil
+// if the remote peer did not sign its SDP.
+func (c *Conn) PeerIdentity() ed25519.PublicKey {
+	return c.peerIdentity
+}
+
+// Reconnected returns true if the Conn was accepted from a PeerConnection
+// offered with a valid reconnect ticket, see Config.ListenerTicketKey.
+func (c *Conn) Reconnected() bool {
+	return c.reconnected
+}
+
+// TURNState returns the state of the TURN allocations of the PeerConnection
+// of the Conn, shared by the Conns on the same PeerConnection.
+func (c *Conn) TURNState() TURNState {
+	return c.turn.state(c.peerConnection)
+}
+
+// MaxMessageSize returns the maximum size of a message written to or read
+// from the Conn, see Config.MaxMessageSize. A buffer of this size always fits
+// a message returned by Read.
+func (c *Conn) MaxMessageSize() int {
+	if c.maxMessageSize == 0 {
+		return CONN_DEFAULT_MTU
+	}
+	return c.maxMessageSize
+}
+
 // SetDeadline sets the deadline for future Read and Write calls.
 func (c *Conn) SetDeadline(t time.Time) error {
-	c.deadlineRd = t
-	c.deadlineWr = t
+	c.SetReadDeadline(t)
+	c.SetWriteDeadline(t)
 	return nil
 }
 
-// SetReadDeadline sets the deadline for future Read calls.
+// SetReadDeadline sets the deadline for future Read calls. A zero t clears
+// the deadline, restoring Config.DefaultReadTimeout.
 func (c *Conn) SetReadDeadline(t time.Time) error {
-	c.deadlineRd = t
+	c.deadlineRd.Set(t)
 	return nil
 }
 
-// SetWriteDeadline sets the deadline for future Write calls.
+// SetWriteDeadline sets the deadline for future Write calls. A zero t clears
+// the deadline, restoring Config.DefaultWriteTimeout.
 func (c *Conn) SetWriteDeadline(t time.Time) error {
-	c.deadlineWr = t
+	c.deadlineWr.Set(t)
 	return nil
 }
 
@@ -162,12 +592,40 @@ func (c *Conn) idleloop(t time.Duration) {
 		return // no idle timeout
 	}
 
+	ticker := currentClock().NewTicker(t)
+	defer ticker.Stop()
+
 	for {
-		if c.idle.Load() {
-			c.Close()
+		select {
+		case <-c.done:
 			return
+		case <-ticker.C():
+			if c.paused.Load() {
+				c.idle.Store(false) // grant a full timeout upon Resume
+				continue
+			}
+			if c.idle.Swap(true) { // no Write since the last tick
+				c.closeWith(CLOSE_REASON_IDLE_TIMEOUT)
+				return
+			}
 		}
-		c.idle.Store(true)
-		time.Sleep(t)
 	}
 }
+
+// ioDeadline is the deadline of Read or Write calls.
+type ioDeadline struct {
+	*deadline.Deadline
+	set atomic.Bool // a non-zero deadline is set, overriding the default timeout
+}
+
+func newIODeadline() *ioDeadline {
+	return &ioDeadline{
+		Deadline: deadline.New(),
+	}
+}
+
+// Set sets the deadline. A zero t clears the deadline.
+func (d *ioDeadline) Set(t time.Time) {
+	d.set.Store(!t.IsZero())
+	d.Deadline.Set(t)
+}
@@ -0,0 +1,88 @@
+package transportc
+
+import (
+	"context"
+	"time"
+)
+
+type connContextKey struct{}
+
+// Context returns the context of the Conn, canceled once the Conn is closed,
+// for request-scoped tracing and cancellation in handlers.
+//
+// It carries the Conn, see ConnFromContext, along with the values of the
+// context passed to DialContext for a dialed Conn, and those added by
+// Config.ConnContext, if set.
+func (c *Conn) Context() context.Context {
+	c.tagMutex.Lock()
+	defer c.tagMutex.Unlock()
+	return c.ctx
+}
+
+// ConnFromContext returns the Conn of ctx derived from Conn.Context, e.g., to
+// retrieve its PeerID, Tag or PeerIdentity.
+func ConnFromContext(ctx context.Context) (*Conn, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(*Conn)
+	return conn, ok
+}
+
+// initContext derives the context of the Conn from parent and connContext,
+// see Config.ConnContext. It MUST be called before the Conn is returned to
+// the application.
+func (c *Conn) initContext(parent context.Context, connContext func(context.Context, *Conn) context.Context) {
+	ctx := context.WithValue(parent, connContextKey{}, c)
+	if connContext != nil {
+		ctx = connContext(ctx, c)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.tagMutex.Lock()
+	defer c.tagMutex.Unlock()
+	c.cancelCtx() // the placeholder of NewConn
+	c.ctx, c.cancelCtx = ctx, cancel
+	if c.closed {
+		cancel()
+	}
+}
+
+// WithConnContext ties the lifetime of the Conn to ctx: the Conn is closed
+// with CLOSE_REASON_CONTEXT_DONE once ctx is done, e.g., along with the
+// request it tunnels. Unlike the context passed to DialContext, which only
+// bounds the dial, ctx outlives it. A Conn dialed or accepted with ctx
+// already done is returned closed.
+//
+// It applies to Listener.AcceptWith as well.
+func WithConnContext(ctx context.Context) DialOption {
+	return func(o *dialOptions) {
+		o.connCtx = ctx
+	}
+}
+
+// closeOnContext closes the Conn once ctx is done, see WithConnContext.
+func (c *Conn) closeOnContext(ctx context.Context) {
+	if ctx == nil || ctx.Done() == nil {
+		return // never done
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.closeWith(CLOSE_REASON_CONTEXT_DONE)
+		case <-c.done:
+		}
+	}()
+}
+
+// valuesContext carries the values of its parent, but neither its deadline
+// nor its cancellation, so the context passed to DialContext does not cancel
+// the context of the Conn.
+type valuesContext struct {
+	parent context.Context
+}
+
+func (valuesContext) Deadline() (deadline time.Time, ok bool) { return }
+func (valuesContext) Done() <-chan struct{}                   { return nil }
+func (valuesContext) Err() error                              { return nil }
+
+func (vc valuesContext) Value(key any) any {
+	return vc.parent.Value(key)
+}
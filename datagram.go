@@ -0,0 +1,271 @@
+package transportc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DATAGRAM_HEADER_SIZE is the size of the header prepended to every
+	// message sent over a DatagramConn: 4-byte sequence number followed
+	// by 8-byte send timestamp in nanoseconds since Unix epoch.
+	DATAGRAM_HEADER_SIZE = 12
+
+	// DATAGRAM_REORDER_WINDOW is the number of sequence numbers behind the
+	// highest received for which a DatagramConn remembers whether they were
+	// received, to tell a late message from a duplicate.
+	DATAGRAM_REORDER_WINDOW = 1024
+)
+
+var (
+	// ErrMalformedDatagram is returned by DatagramConn when a received message
+	// is too short to carry the datagram header.
+	ErrMalformedDatagram = errors.New("malformed datagram")
+)
+
+// DatagramInfo describes a single message received on a DatagramConn.
+type DatagramInfo struct {
+	// Seq is the sequence number assigned by the sender.
+	Seq uint32
+
+	// Dropped is the number of messages detected as lost right before
+	// this message, based on the gap in sequence numbers. Always 0 for
+	// a message arriving out of order.
+	Dropped uint32
+
+	// Late indicates the message arrived after a message with a higher
+	// sequence number, i.e., it was reordered on the path. A duplicate or a
+	// message sent before the first message received is not late.
+	Late bool
+
+	// Age is the time elapsed since the message was sent. It relies on
+	// the clocks of both peers being synchronized and MAY be negative
+	// if they are not.
+	Age time.Duration
+}
+
+// DatagramStats summarizes the messages received on a DatagramConn.
+type DatagramStats struct {
+	Received uint64 // messages received
+	Dropped  uint64 // messages detected as lost and not received later, within DATAGRAM_REORDER_WINDOW
+	Late     uint64 // messages received out of order, excluding duplicates
+
+	LastAge time.Duration // Age of the latest received message
+}
+
+// DatagramConn defines a datagram-oriented connection based on an unordered
+// and unreliable datachannel. Each message is prefixed with a sequence number
+// and a send timestamp so the receiver is able to detect drops and measure
+// message age, allowing real-time applications to adapt their send rate.
+//
+// DatagramConn interfaces net.Conn. Read and Write transparently strip and
+// prepend the datagram header. The other ways to read and write the Conn,
+// e.g., Conn.ReadMessage or Conn.Writer, are not exposed, as they would skip
+// the header.
+type DatagramConn struct {
+	conn *Conn
+
+	sendSeq atomic.Uint32
+
+	readMutex sync.Mutex
+	readBuf   []byte // reused by ReadDatagram, sized by Conn.MaxMessageSize
+
+	statsMutex sync.Mutex
+	recvSeq    uint32                               // highest sequence number received
+	recvAny    bool                                 // whether any message has been received
+	recvSpan   uint64                               // recvSeq minus the first sequence number received
+	recvWindow [DATAGRAM_REORDER_WINDOW / 64]uint64 // whether each sequence number in the window was received, indexed modulo DATAGRAM_REORDER_WINDOW
+	stats      DatagramStats
+}
+
+// NewDatagramConn builds a DatagramConn from an existing Conn.
+// The Conn SHOULD be backed by an unordered and unreliable datachannel.
+func NewDatagramConn(conn *Conn) *DatagramConn {
+	return &DatagramConn{
+		conn:    conn,
+		readBuf: make([]byte, conn.MaxMessageSize()),
+	}
+}
+
+// Read reads the payload of the next datagram. Use ReadDatagram to
+// retrieve the DatagramInfo of the message as well.
+func (dc *DatagramConn) Read(p []byte) (n int, err error) {
+	n, _, err = dc.ReadDatagram(p)
+	return n, err
+}
+
+// ReadDatagram reads the payload of the next datagram into p and returns
+// the DatagramInfo describing the message.
+func (dc *DatagramConn) ReadDatagram(p []byte) (n int, info DatagramInfo, err error) {
+	dc.readMutex.Lock()
+	defer dc.readMutex.Unlock()
+
+	buf := dc.readBuf
+	n, err = dc.conn.Read(buf)
+	if err != nil {
+		return 0, info, err
+	}
+	if n < DATAGRAM_HEADER_SIZE {
+		return 0, info, ErrMalformedDatagram
+	}
+
+	info.Seq = binary.BigEndian.Uint32(buf[0:4])
+	sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(buf[4:DATAGRAM_HEADER_SIZE])))
+	info.Age = time.Since(sentAt)
+	dc.account(&info)
+
+	payload := buf[DATAGRAM_HEADER_SIZE:n]
+	n = copy(p, payload)
+	if n < len(payload) {
+		err = io.ErrShortBuffer
+	}
+	return n, info, err
+}
+
+// account updates the statistics with the newly received datagram
+// and fills in the Dropped and Late fields of info.
+//
+// A message older than the highest received is late only if its sequence
+// number was counted as dropped, which is then no longer. Beyond
+// DATAGRAM_REORDER_WINDOW, it is late but Dropped is not corrected.
+func (dc *DatagramConn) account(info *DatagramInfo) {
+	dc.statsMutex.Lock()
+	defer dc.statsMutex.Unlock()
+
+	dc.stats.Received++
+	dc.stats.LastAge = info.Age
+
+	switch {
+	case !dc.recvAny:
+		dc.recvAny = true
+		dc.recvSeq = info.Seq
+		dc.markReceived(info.Seq)
+	case info.Seq-dc.recvSeq < 1<<31 && info.Seq != dc.recvSeq: // newer, with wraparound
+		info.Dropped = info.Seq - dc.recvSeq - 1
+		dc.stats.Dropped += uint64(info.Dropped)
+		for i := uint32(0); i < info.Dropped && i < DATAGRAM_REORDER_WINDOW; i++ {
+			dc.clearReceived(info.Seq - 1 - i)
+		}
+		dc.recvSpan += uint64(info.Seq - dc.recvSeq)
+		dc.recvSeq = info.Seq
+		dc.markReceived(info.Seq)
+	default: // older or duplicate
+		age := dc.recvSeq - info.Seq
+		switch {
+		case uint64(age) > dc.recvSpan: // sent before the first message received
+		case age >= DATAGRAM_REORDER_WINDOW:
+			info.Late = true
+			dc.stats.Late++
+		case !dc.isReceived(info.Seq): // previously counted as dropped
+			info.Late = true
+			dc.stats.Late++
+			dc.stats.Dropped--
+			dc.markReceived(info.Seq)
+		}
+	}
+}
+
+func (dc *DatagramConn) markReceived(seq uint32) {
+	seq %= DATAGRAM_REORDER_WINDOW
+	dc.recvWindow[seq/64] |= 1 << (seq % 64)
+}
+
+func (dc *DatagramConn) clearReceived(seq uint32) {
+	seq %= DATAGRAM_REORDER_WINDOW
+	dc.recvWindow[seq/64] &^= 1 << (seq % 64)
+}
+
+func (dc *DatagramConn) isReceived(seq uint32) bool {
+	seq %= DATAGRAM_REORDER_WINDOW
+	return dc.recvWindow[seq/64]&(1<<(seq%64)) != 0
+}
+
+// Write sends p as a single datagram.
+func (dc *DatagramConn) Write(p []byte) (n int, err error) {
+	return dc.WriteDatagram(p)
+}
+
+// WriteDatagram sends p as a single datagram with the next sequence number.
+// It returns the number of payload bytes written.
+func (dc *DatagramConn) WriteDatagram(p []byte) (n int, err error) {
+	buf := make([]byte, DATAGRAM_HEADER_SIZE+len(p))
+	binary.BigEndian.PutUint32(buf[0:4], dc.sendSeq.Add(1)-1)
+	binary.BigEndian.PutUint64(buf[4:DATAGRAM_HEADER_SIZE], uint64(time.Now().UnixNano()))
+	copy(buf[DATAGRAM_HEADER_SIZE:], p)
+
+	n, err = dc.conn.writeMessage(buf) // never split a datagram
+	n -= DATAGRAM_HEADER_SIZE
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+// Stats returns a snapshot of the receive statistics.
+func (dc *DatagramConn) Stats() DatagramStats {
+	dc.statsMutex.Lock()
+	defer dc.statsMutex.Unlock()
+	return dc.stats
+}
+
+// Close closes the Conn.
+func (dc *DatagramConn) Close() error {
+	return dc.conn.Close()
+}
+
+// closeWith closes the Conn for reason, see closeConnWith.
+func (dc *DatagramConn) closeWith(reason CloseReason) error {
+	return dc.conn.closeWith(reason)
+}
+
+// LocalAddr returns the local address of the Conn.
+func (dc *DatagramConn) LocalAddr() net.Addr {
+	return dc.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the Conn.
+func (dc *DatagramConn) RemoteAddr() net.Addr {
+	return dc.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the Conn.
+func (dc *DatagramConn) SetDeadline(t time.Time) error {
+	return dc.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the Conn.
+func (dc *DatagramConn) SetReadDeadline(t time.Time) error {
+	return dc.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the Conn.
+func (dc *DatagramConn) SetWriteDeadline(t time.Time) error {
+	return dc.conn.SetWriteDeadline(t)
+}
+
+// EstimatedBandwidth returns the bandwidth estimate of the Conn, see
+// Conn.EstimatedBandwidth.
+func (dc *DatagramConn) EstimatedBandwidth() BandwidthEstimate {
+	return dc.conn.EstimatedBandwidth()
+}
+
+// HandshakeInfo returns the timings of the establishment of the Conn.
+func (dc *DatagramConn) HandshakeInfo() HandshakeInfo {
+	return dc.conn.HandshakeInfo()
+}
+
+// TURNState returns the state of the TURN allocation of the Conn, see
+// Conn.TURNState.
+func (dc *DatagramConn) TURNState() TURNState {
+	return dc.conn.TURNState()
+}
+
+// CloseReason returns why the Conn was closed, see Conn.CloseReason.
+func (dc *DatagramConn) CloseReason() CloseReason {
+	return dc.conn.CloseReason()
+}
@@ -0,0 +1,76 @@
+package transportc
+
+import (
+	"context"
+	"net"
+)
+
+// ConfigOption sets fields of the Config built by Dial or Listen. A Preset
+// applies as one, e.g., transportc.PRESET_BULK.Apply.
+type ConfigOption func(*Config)
+
+// WithConfig applies opts to the Config of the Dialer created by the
+// package-level Dial. It is ignored by the methods of Dialer.
+func WithConfig(opts ...ConfigOption) DialOption {
+	return func(o *dialOptions) {
+		o.config = append(o.config, opts...)
+	}
+}
+
+// DefaultConfig returns the Config used by Dial and Listen before applying
+// their options: signal, and every other field left zero, i.e., host
+// candidates only unless ICE servers are set, a PeerConnection per Conn, and
+// no timeouts other than pion's.
+func DefaultConfig(signal Signal) *Config {
+	return &Config{
+		Signal: signal,
+	}
+}
+
+// Dial connects to the Listener behind signal with a Dialer of its own, built
+// from DefaultConfig(signal) with the ConfigOptions of WithConfig in opts.
+// The Dialer is closed along with the returned Conn, or once Dial fails.
+//
+// Dialing multiple Conns SHOULD reuse a Dialer instead, see Config.NewDialer.
+func Dial(ctx context.Context, signal Signal, label string, opts ...DialOption) (net.Conn, error) {
+	options := &dialOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	config := DefaultConfig(signal)
+	for _, opt := range options.config {
+		opt(config)
+	}
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialer.DialContext(ctx, label, append(opts, func(o *dialOptions) {
+		o.closeDialer = true
+	})...)
+	if err != nil {
+		dialer.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Listen returns a started Listener accepting Conns over signal, built from
+// DefaultConfig(signal) with opts applied.
+func Listen(signal Signal, opts ...ConfigOption) (*Listener, error) {
+	config := DefaultConfig(signal)
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		return nil, err
+	}
+	if err := listener.Start(); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
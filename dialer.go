@@ -2,11 +2,12 @@ package transportc
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gaukas/logging"
@@ -21,21 +22,168 @@ type Dialer struct {
 	logger  logging.Logger
 	signal  Signal
 	timeout time.Duration
+	stats   *Stats
+	tracer  Tracer
+
+	gatherTimeout time.Duration
+	openTimeout   time.Duration // see Config.OpenTimeout
+
+	identityKey    ed25519.PrivateKey
+	signedOfferTTL time.Duration // see Config.SignedOfferTTL
+	allowedPeers   []ed25519.PublicKey
+	namespace      string
+
+	maxMessageSize    int
+	splitWrites       bool
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	maxBufferedAmount uint64
+	wireHandshake     bool
+	wireFeatures      WireFeatures
+	connContext       func(context.Context, *Conn) context.Context
+	newPacer          func() Pacer // see Config.NewPacer
+
+	dtlsRole           DTLSRole
+	iceRole            ICERole // required, see Config.DialerICERole
+	pinnedFingerprints []string
+	rendezvousNonce    uint64 // non-zero if dialing for Config.Rendezvous
+
+	ticketMutex sync.Mutex
+	ticket      string // reconnect ticket submitted in the offers, see Config.ListenerTicketKey
+
+	pool *offerPool // nil if pre-gathering is disabled
+
+	events *eventBus
 
 	// WebRTC configuration
-	settingEngine webrtc.SettingEngine
-	configuration webrtc.Configuration
+	settingEngine   webrtc.SettingEngine
+	configMutex     sync.Mutex // configMutex makes configuration thread-safe
+	configuration   webrtc.Configuration
+	icePairPolicy   ICEPairPolicy // applied to configuration, see ICEPairPolicy.configure
+	sdpBandwidth    *SDPBandwidth
+	sdpTransformIn  SDPTransform
+	sdpTransformOut SDPTransform
 
 	// WebRTC PeerConnection
-	mutex               sync.Mutex // mutex makes peerConnection thread-safe
-	peerConnection      *webrtc.PeerConnection
+	dialerPeer          // the PeerConnection of Dial, see PeerHandle for others
 	reusePeerConnection bool
+	idlePCTimeout       time.Duration
+
+	// Lifecycle, see Pause. connsMutex MAY be taken while holding the mutex of
+	// dialerPeer, e.g., by reapIdlePeerConnection, never the other way around.
+	paused     atomic.Bool
+	connsMutex sync.Mutex
+	conns      map[*Conn]struct{} // Conns dialed and not closed
+
+	idlePCTimers map[*webrtc.PeerConnection]Timer // guarded by connsMutex
+
+	turnMutex    sync.Mutex
+	turnTrackers map[*webrtc.PeerConnection]*turnTracker // of the PeerConnections not closed, see TURNState
+
+	recordTranscript bool
+	transcriptMutex  sync.Mutex
+	transcripts      map[*webrtc.PeerConnection]*transcriptRecorder // of the PeerConnections not closed, see Conn.Transcript
+}
+
+// dialerPeer is a PeerConnection dialed by a Dialer along with its state,
+// either the one of Dial or the dedicated one of a PeerHandle.
+type dialerPeer struct {
+	mutex          sync.Mutex // mutex makes peerConnection thread-safe
+	peerConnection *webrtc.PeerConnection
+	handshake      *handshakeTimer   // handshakeTimer of peerConnection
+	peerIdentity   ed25519.PublicKey // identity of the remote peer of peerConnection
+	offerID        uint64            // ID of the offer peerConnection was created from
+	dedicated      bool              // never replaced by another PeerConnection, see PeerHandle
+	offerInfo      *OfferInfo        // submitted in the next offer, see WithOfferMetadata
+	dataChannels   int               // DataChannels created on peerConnection by Dials
+	dialing        int               // Dials with a DataChannel created but no Conn tracked yet
+	negotiating    *peerNegotiation  // of peerConnection, nil once negotiated
+	offerTicket    string            // reconnect ticket submitted in the offer of peerConnection
+	issuedTicket   string            // reconnect ticket issued in the answer to peerConnection
+}
+
+// peerNegotiation is the automatic signaling of a new PeerConnection of a
+// dialerPeer, run without holding its mutex.
+type peerNegotiation struct {
+	done chan struct{} // closed once negotiated or failed
+
+	peerConnection *webrtc.PeerConnection
+	handshake      *handshakeTimer
+	pregathered    bool
+	peerIdentity   ed25519.PublicKey // set before done is closed
+	issuedTicket   string            // set before done is closed
+}
+
+// peerSnapshot is the state of the PeerConnection a Dial created its
+// DataChannel on, taken while holding the mutex of the dialerPeer.
+type peerSnapshot struct {
+	peerConnection *webrtc.PeerConnection
+	handshake      *handshakeTimer
+	peerIdentity   ed25519.PublicKey
+	issuedTicket   string
+	reused         bool // created by a previous Dial
+}
+
+// snapshot returns the state of the PeerConnection of p.
+//
+// Not thread-safe. Caller MUST hold the mutex of p before calling this function.
+func (p *dialerPeer) snapshot(reused bool) peerSnapshot {
+	return peerSnapshot{
+		peerConnection: p.peerConnection,
+		handshake:      p.handshake,
+		peerIdentity:   p.peerIdentity,
+		issuedTicket:   p.issuedTicket,
+		reused:         reused,
+	}
 }
 
 var (
 	ErrBrokenDialer = errors.New("dialer need to be recreated")
+
+	// ErrOpenTimeout is returned by Dial if the DataChannel is not open
+	// within Config.OpenTimeout once negotiated.
+	ErrOpenTimeout = errors.New("datachannel open timed out")
 )
 
+const (
+	DIAL_PERSISTENT_ATTEMPT_TIMEOUT = 10 * time.Second
+	DIAL_PERSISTENT_BACKOFF_MIN     = 500 * time.Millisecond
+	DIAL_PERSISTENT_BACKOFF_MAX     = 30 * time.Second
+
+	// DIAL_CLOSE_LINGER bounds how long the PeerConnection of a closed Conn
+	// outlives it to deliver what was written, unless reused.
+	DIAL_CLOSE_LINGER               = 5 * time.Second
+	DIAL_CLOSE_LINGER_POLL_INTERVAL = 10 * time.Millisecond
+)
+
+// DialOption configures a single call to Dial.
+type DialOption func(*dialOptions)
+
+type dialOptions struct {
+	tag         string
+	protocol    string
+	submitOffer bool // see WithOfferMetadata
+	metadata    map[string]string
+	config      []ConfigOption  // see WithConfig, only for the package-level Dial
+	closeDialer bool            // close the Dialer along with the Conn, see Dial
+	connCtx     context.Context // see WithConnContext
+}
+
+// WithTag tags the dialed Conn. See Conn.SetTag.
+func WithTag(tag string) DialOption {
+	return func(o *dialOptions) {
+		o.tag = tag
+	}
+}
+
+// WithProtocol sets the protocol of the DataChannel to the name of the
+// service to connect to, which the Listener may route on. See Listener.Handle.
+func WithProtocol(protocol string) DialOption {
+	return func(o *dialOptions) {
+		o.protocol = protocol
+	}
+}
+
 // Dial connects to a remote peer with SDP-based negotiation.
 //
 // Internally calls DialContext with context.Background().
@@ -45,8 +193,8 @@ var (
 // the Offer/Answer exchange per new PeerConnection will be done automatically.
 // Otherwise, it is recommended to call NewPeerConnection and exchange the SDP
 // offer/answer manually before dialing.
-func (d *Dialer) Dial(label string) (net.Conn, error) {
-	return d.DialContext(context.Background(), label)
+func (d *Dialer) Dial(label string, opts ...DialOption) (net.Conn, error) {
+	return d.DialContext(context.Background(), label, opts...)
 }
 
 // DialContext connects to a remote peer with SDP-based negotiation
@@ -62,27 +210,166 @@ func (d *Dialer) Dial(label string) (net.Conn, error) {
 // the Offer/Answer exchange per new PeerConnection will be done automatically.
 // Otherwise, it is recommended to call NewPeerConnection and exchange the SDP
 // offer/answer manually before dialing.
-func (d *Dialer) DialContext(ctx context.Context, label string) (net.Conn, error) {
+func (d *Dialer) DialContext(ctx context.Context, label string, opts ...DialOption) (net.Conn, error) {
+	conn, err := d.dialContext(ctx, label, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// DialPersistent keeps calling DialContext until a connection is established
+// or ctx is done, for long-running clients on unreliable networks.
+//
+// Each attempt is bounded by DIAL_PERSISTENT_ATTEMPT_TIMEOUT. Between attempts,
+// it waits for an exponential backoff from DIAL_PERSISTENT_BACKOFF_MIN up to
+// DIAL_PERSISTENT_BACKOFF_MAX, with jitter to avoid synchronized retries of
+// many clients. Each failed attempt emits an EVENT_DIAL_FAILED, see Events.
+//
+// If ctx is done, the error of the last attempt is returned, or ctx.Err()
+// if no attempt was made.
+func (d *Dialer) DialPersistent(ctx context.Context, label string, opts ...DialOption) (net.Conn, error) {
+	backoff := DIAL_PERSISTENT_BACKOFF_MIN
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, DIAL_PERSISTENT_ATTEMPT_TIMEOUT)
+		conn, err := d.DialContext(attemptCtx, label, opts...)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+
+		d.logger.Debugf("dialer: attempt #%d to dial %q failed: %v", attempt, label, err)
+		d.events.emit(TransportEvent{Type: EVENT_DIAL_FAILED, Label: label, Attempt: attempt, Err: err})
+
+		// equal jitter: wait between backoff/2 and backoff
+		wait := backoff/2 + time.Duration(randomInt63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+		case <-clockAfter(wait):
+		}
+
+		backoff *= 2
+		if backoff > DIAL_PERSISTENT_BACKOFF_MAX {
+			backoff = DIAL_PERSISTENT_BACKOFF_MAX
+		}
+	}
+}
+
+// DialDatagram connects to a remote peer with SDP-based negotiation and
+// returns a DatagramConn backed by an unordered and unreliable DataChannel.
+//
+// Internally calls DialDatagramContext with context.Background().
+func (d *Dialer) DialDatagram(label string, opts ...DialOption) (*DatagramConn, error) {
+	return d.DialDatagramContext(context.Background(), label, opts...)
+}
+
+// DialDatagramContext connects to a remote peer with SDP-based negotiation
+// using the provided context and returns a DatagramConn backed by an
+// unordered DataChannel which never retransmits lost messages.
+//
+// The remote Listener recognizes the unreliable DataChannel and surfaces
+// a DatagramConn from Accept as well.
+func (d *Dialer) DialDatagramContext(ctx context.Context, label string, opts ...DialOption) (*DatagramConn, error) {
+	ordered := false
+	var maxRetransmits uint16 = 0
+	conn, err := d.dialContext(ctx, label, &webrtc.DataChannelInit{
+		Ordered:        &ordered,
+		MaxRetransmits: &maxRetransmits,
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatagramConn(conn), nil
+}
+
+func (d *Dialer) dialContext(ctx context.Context, label string, init *webrtc.DataChannelInit, opts []DialOption) (*Conn, error) {
+	return d.dialPeer(ctx, &d.dialerPeer, label, init, opts)
+}
+
+// dialPeer dials a Conn over the PeerConnection of p, which is replaced if
+// needed unless dedicated.
+func (d *Dialer) dialPeer(ctx context.Context, p *dialerPeer, label string, init *webrtc.DataChannelInit, opts []DialOption) (conn *Conn, err error) {
 	// check if context is done
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
+	ctx, span := startSpan(ctx, d.tracer, SPAN_DIAL, TraceAttribute{Key: "transportc.label", Value: label})
+	defer func() {
+		span.End(err)
+	}()
+
+	options := &dialOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
 
-	dataChannel, err := d.nextDataChannel(ctx, label)
+	if options.protocol != "" {
+		withProtocol := webrtc.DataChannelInit{}
+		if init != nil {
+			withProtocol = *init
+		}
+		withProtocol.Protocol = &options.protocol
+		init = &withProtocol
+	}
+
+	start := currentClock().Now()
+
+	var offerInfo *OfferInfo
+	if options.submitOffer {
+		offerInfo = &OfferInfo{Label: label, Protocol: options.protocol, Metadata: options.metadata}
+	}
+
+	dataChannel, peer, err := d.nextDataChannel(ctx, p, label, init, offerInfo)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		p.mutex.Lock()
+		p.dialing--
+		p.mutex.Unlock()
+	}()
 
-	conn := NewConn(nil, CONN_DEFAULT_CONCURRENCY)
+	conn = NewConn(nil, CONN_DEFAULT_CONCURRENCY)
+	conn.maxMessageSize = d.maxMessageSize
+	conn.splitWrites = d.splitWrites
+	conn.readTimeout = d.readTimeout
+	conn.writeTimeout = d.writeTimeout
+	conn.maxBufferedAmount = d.maxBufferedAmount
+	conn.label = label
+	conn.protocol = options.protocol
+	dedicated := p.dedicated // immutable
+	conn.onClose = func() {
+		d.connsMutex.Lock()
+		delete(d.conns, conn)
+		if !dedicated && d.reusePeerConnection {
+			d.watchIdlePeerConnection(conn.peerConnection)
+		}
+		d.connsMutex.Unlock()
+		if !dedicated && !d.reusePeerConnection && conn.peerConnection != nil {
+			d.releasePeerConnection(p, conn) // no other Conn may use it
+		}
+		d.events.emit(TransportEvent{Type: EVENT_CONN_CLOSED, Label: label})
+		if options.closeDialer {
+			go d.Close() // Close closes conn, so not under its onClose
+		}
+	}
 
 	// set event handlers
-	var detachChan chan datachannel.ReadWriteCloser = make(chan datachannel.ReadWriteCloser)
+	var detachChan chan datachannel.ReadWriteCloser = make(chan datachannel.ReadWriteCloser, 1) // never blocks OnOpen if the dial is canceled
 	dataChannel.OnOpen(func() {
+		chaosDelayOpen()
 		// detach from wrapper
-		dc, err := dataChannel.Detach()
+		dc, err := detachDataChannel(dataChannel)
 		if err != nil {
 			close(detachChan)
 		} else {
@@ -93,29 +380,42 @@ func (d *Dialer) DialContext(ctx context.Context, label string) (net.Conn, error
 
 	dataChannel.OnClose(func() {
 		// TODO: possibly tear down the PeerConnection if it is the last DataChannel?
-		conn.Close()
+		conn.closeWith(CLOSE_REASON_REMOTE)
 	})
 
 	// OnError won't be used as pion's readLoop is ignored
 	// dataChannel.OnError(func(err error) {
 	// })
 
-	// wait for datachannel
+	// wait for datachannel, failing fast on a stuck DTLS or SCTP handshake
+	var openTimeout <-chan time.Time
+	if d.openTimeout > 0 {
+		timer := currentClock().NewTimer(d.openTimeout)
+		defer timer.Stop()
+		openTimeout = timer.C()
+	}
 	select {
 	case <-ctx.Done():
+		d.abortDataChannel(p, dataChannel, peer)
 		return nil, ctx.Err()
+	case <-openTimeout:
+		d.abortDataChannel(p, dataChannel, peer)
+		return nil, ErrOpenTimeout
 	case dataChannelDetach := <-detachChan:
 		if dataChannelDetach == nil {
+			d.abortDataChannel(p, dataChannel, peer)
 			return nil, errors.New("failed to receive datachannel")
 		}
 		conn.dataChannel = dataChannelDetach
 
 		// Set LocalAddr and RemoteAddr
-		if sctp := d.peerConnection.SCTP(); sctp != nil {
+		if sctp := peer.peerConnection.SCTP(); sctp != nil {
 			if dtls := sctp.Transport(); dtls != nil {
 				if ice := dtls.ICETransport(); ice != nil {
 					icePair, err := ice.GetSelectedCandidatePair()
 					if err != nil {
+						conn.closeWith(CLOSE_REASON_SETUP_FAILED)
+						d.abortDataChannel(p, dataChannel, peer)
 						return nil, fmt.Errorf("dialer: failed to get selected ICE Candidate pair: %w", err)
 					}
 					conn.localAddr = &Addr{
@@ -129,17 +429,144 @@ func (d *Dialer) DialContext(ctx context.Context, label string) (net.Conn, error
 				}
 			}
 		}
-		go conn.idleloop(d.timeout) // start the read loop
+		if d.wireHandshake && dataChannel.Ordered() && dataChannel.MaxRetransmits() == nil && dataChannel.MaxPacketLifeTime() == nil { // reliable datachannel
+			deadline := time.Now().Add(WIRE_HANDSHAKE_TIMEOUT)
+			if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+				deadline = ctxDeadline
+			}
+			if err := conn.wireHandshake(d.wireFeatures, deadline); err != nil {
+				conn.closeWith(CLOSE_REASON_SETUP_FAILED)
+				return nil, fmt.Errorf("dialer: %w", err)
+			}
+		}
+
+		if !peer.reused {
+			d.storeTicket(peer.issuedTicket) // once connected
+		}
+		conn.handshakeInfo = peer.handshake.info(start, peer.reused)
+		conn.peerIdentity = peer.peerIdentity
+		conn.peerConnection = peer.peerConnection
+		conn.turn = d.turnTracker(peer.peerConnection)
+		conn.transcript = d.transcript(peer.peerConnection)
+		if d.newPacer != nil {
+			conn.SetPacer(d.newPacer())
+		}
+		conn.tag = options.tag
+		conn.initContext(valuesContext{ctx}, d.connContext)
+		conn.trackStats(d.stats)
+		d.trackConn(conn)
+		go conn.idleloop(d.timeout) // start the idle timeout loop
+		conn.closeOnContext(options.connCtx)
+		d.events.emit(TransportEvent{Type: EVENT_DC_OPENED, Label: label})
 
 		return conn, nil
 	}
 }
 
+// abortDataChannel closes dataChannel of a failed dial, along with the
+// PeerConnection of peer unless reused or shared by another Dial since, so
+// neither lingers until the Dialer is closed.
+func (d *Dialer) abortDataChannel(p *dialerPeer, dataChannel *webrtc.DataChannel, peer peerSnapshot) {
+	dataChannel.Close()
+	if peer.reused {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.peerConnection == peer.peerConnection {
+		if p.dataChannels > 1 {
+			return // another Dial created a DataChannel on it meanwhile
+		}
+		p.peerConnection = nil
+	}
+	peer.peerConnection.Close()
+}
+
+// releasePeerConnection closes the PeerConnection of conn, dedicated to it
+// as PeerConnections are not reused, so it does not linger until the Dialer
+// is closed. What conn wrote before it was closed is first delivered, i.e.,
+// its BufferedAmount drops to 0, for up to DIAL_CLOSE_LINGER.
+func (d *Dialer) releasePeerConnection(p *dialerPeer, conn *Conn) {
+	p.mutex.Lock()
+	if p.peerConnection == conn.peerConnection {
+		p.peerConnection = nil
+	}
+	p.mutex.Unlock()
+
+	go func() {
+		deadline := time.Now().Add(DIAL_CLOSE_LINGER)
+		for conn.bufferedAmount() > 0 && time.Now().Before(deadline) {
+			time.Sleep(DIAL_CLOSE_LINGER_POLL_INTERVAL)
+		}
+		conn.peerConnection.Close()
+	}()
+}
+
+// TURNState returns the state of the TURN allocations of all the
+// PeerConnections of the Dialer not closed, including pre-gathered ones and
+// those of PeerHandles.
+func (d *Dialer) TURNState() TURNState {
+	d.turnMutex.Lock()
+	trackers := make(map[*webrtc.PeerConnection]*turnTracker, len(d.turnTrackers))
+	for peerConnection, turn := range d.turnTrackers {
+		trackers[peerConnection] = turn
+	}
+	d.turnMutex.Unlock()
+
+	var state TURNState
+	for peerConnection, turn := range trackers {
+		state.merge(turn.state(peerConnection))
+	}
+	return state
+}
+
+// turnTracker returns the turnTracker of peerConnection, or nil if closed.
+func (d *Dialer) turnTracker(peerConnection *webrtc.PeerConnection) *turnTracker {
+	d.turnMutex.Lock()
+	defer d.turnMutex.Unlock()
+	return d.turnTrackers[peerConnection]
+}
+
+// transcript returns the transcriptRecorder of peerConnection, or nil if
+// closed or Config.RecordTranscript is not set.
+func (d *Dialer) transcript(peerConnection *webrtc.PeerConnection) *transcriptRecorder {
+	d.transcriptMutex.Lock()
+	defer d.transcriptMutex.Unlock()
+	return d.transcripts[peerConnection]
+}
+
+// Events returns the channel of TransportEvents emitted by the Dialer.
+//
+// Events are only emitted after the first call to Events, and are dropped
+// if not received fast enough to keep up with the buffer of EVENT_BUFFER_SIZE.
+func (d *Dialer) Events() <-chan TransportEvent {
+	return d.events.subscribe()
+}
+
 // Close closes the WebRTC PeerConnection and with it
 // all the WebRTC DataChannels under it.
 //
 // SHOULD be called when done using the transport.
 func (d *Dialer) Close() error {
+	d.pool.close()
+
+	d.connsMutex.Lock()
+	for peerConnection, timer := range d.idlePCTimers {
+		timer.Stop()
+		delete(d.idlePCTimers, peerConnection)
+	}
+	conns := make([]*Conn, 0, len(d.conns))
+	for conn := range d.conns {
+		conns = append(conns, conn)
+	}
+	d.connsMutex.Unlock()
+
+	// closed without holding connsMutex, taken by their onClose
+	for _, conn := range conns {
+		conn.closeWith(CLOSE_REASON_PEER_CONNECTION_CLOSED)
+	}
+
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 	if d.peerConnection != nil {
@@ -148,55 +575,291 @@ func (d *Dialer) Close() error {
 	return nil
 }
 
-func (d *Dialer) nextDataChannel(ctx context.Context, label string) (*webrtc.DataChannel, error) {
-	if d.peerConnection == nil || !d.reusePeerConnection {
-		dc, err := d.startPeerConnection(ctx, label)
+// UpdateICEServers replaces the ICE servers (STUN/TURN) used by the Dialer.
+//
+// Only PeerConnections created afterwards are affected, so long-running
+// processes can rotate TURN credentials without being restarted. Pre-gathered
+// PeerConnections are discarded.
+func (d *Dialer) UpdateICEServers(iceServers []webrtc.ICEServer) {
+	d.configMutex.Lock()
+	d.configuration.ICEServers = append([]webrtc.ICEServer(nil), iceServers...)
+	d.configMutex.Unlock()
+
+	d.pool.invalidate() // gathered with the previous ICE servers
+}
+
+// nextDataChannel creates a DataChannel on the PeerConnection of p, which is
+// replaced if needed unless dedicated, and returns it along with the state of
+// its PeerConnection.
+//
+// The mutex of p is only held to pick or create the PeerConnection, not
+// during its negotiation, so neither concurrent Dials nor the state changes
+// of the PeerConnections wait for the ICE gathering and the signaling. Dials
+// reusing a PeerConnection being negotiated wait for it to complete.
+func (d *Dialer) nextDataChannel(ctx context.Context, p *dialerPeer, label string, init *webrtc.DataChannelInit, offerInfo *OfferInfo) (*webrtc.DataChannel, peerSnapshot, error) {
+	for {
+		p.mutex.Lock()
+		if n := p.negotiating; n != nil && (p.dedicated || d.reusePeerConnection) {
+			p.mutex.Unlock()
+			select {
+			case <-ctx.Done():
+				return nil, peerSnapshot{}, ctx.Err()
+			case <-n.done:
+			}
+			continue // failed negotiations are retried within ctx
+		}
+
+		if p.dedicated {
+			if p.peerConnection == nil {
+				p.mutex.Unlock()
+				return nil, peerSnapshot{}, ErrPeerHandleClosed
+			}
+			dataChannel, err := p.peerConnection.CreateDataChannel(label, init)
+			if err != nil {
+				p.mutex.Unlock()
+				return nil, peerSnapshot{}, err
+			}
+			p.dialing++
+			peer := p.snapshot(true)
+			p.mutex.Unlock()
+			return dataChannel, peer, nil
+		}
+
+		if p.peerConnection != nil && d.reusePeerConnection {
+			dataChannel, err := p.peerConnection.CreateDataChannel(label, init)
+			if err == nil {
+				p.dataChannels++
+				p.dialing++
+				peer := p.snapshot(true)
+				p.mutex.Unlock()
+				return dataChannel, peer, nil
+			}
+			// retry after getting a new peer connection
+			p.peerConnection.Close()
+			p.peerConnection = nil
+		}
+
+		dataChannel, n, err := d.startPeerConnection(p, label, init)
 		if err != nil {
-			return nil, err
+			p.mutex.Unlock()
+			return nil, peerSnapshot{}, err
 		}
-		return dc, nil
+		p.dialing++
+		peer := p.snapshot(false)
+		p.mutex.Unlock()
+
+		if n != nil {
+			if err := d.negotiate(ctx, p, n, offerInfo); err != nil {
+				p.mutex.Lock()
+				p.dialing--
+				p.mutex.Unlock()
+				return nil, peerSnapshot{}, err
+			}
+			peer.peerIdentity = n.peerIdentity
+			peer.issuedTicket = n.issuedTicket
+		}
+		return dataChannel, peer, nil
 	}
+}
 
-	// try getting a new data channel from the existing peer connection
-	dataChannel, err := d.peerConnection.CreateDataChannel(label, nil)
+// startPeerConnection sets a new PeerConnection to p that can be reused in
+// following Dial calls, and creates its first DataChannel. Note: the returned
+// DataChannel is not guaranteed to be open yet. It is caller's responsibility
+// to check the DataChannel's state and handle the OnOpen event.
+//
+// If Dialer.signal is set, the returned peerNegotiation MUST be run by
+// negotiate without holding the mutex of p.
+//
+// Not thread-safe. Caller MUST hold the mutex of p before calling this function.
+func (d *Dialer) startPeerConnection(p *dialerPeer, dataChannelLabel string, dataChannelInit *webrtc.DataChannelInit) (*webrtc.DataChannel, *peerNegotiation, error) {
+	pregathered, err := d.acquirePeerConnection(p)
 	if err != nil {
-		// error: retry after getting a new peer connection.
-		// if errors.Is(err, webrtc.ErrConnectionClosed) {
-		d.peerConnection.Close()
-		d.peerConnection = nil
-		dataChannel, err = d.startPeerConnection(ctx, label)
-		if err != nil {
-			return nil, err
+		return nil, nil, err
+	}
+
+	dataChannel, err := p.peerConnection.CreateDataChannel(dataChannelLabel, dataChannelInit)
+	if err != nil {
+		// Don't leave a PeerConnection failed to establish for following Dial calls
+		p.peerConnection.Close()
+		p.peerConnection = nil
+		return nil, nil, err
+	}
+	p.dataChannels = 1
+	p.peerIdentity = nil
+	p.issuedTicket = ""
+
+	if d.signal == nil {
+		return dataChannel, nil, nil
+	}
+	n := &peerNegotiation{
+		done:           make(chan struct{}),
+		peerConnection: p.peerConnection,
+		handshake:      p.handshake,
+		pregathered:    pregathered,
+	}
+	p.negotiating = n
+	return dataChannel, n, nil
+}
+
+// negotiate runs n for p, i.e., the automatic signaling of its PeerConnection,
+// then records the outcome in p. A PeerConnection failed to negotiate is
+// closed, so following Dial calls don't reuse it.
+//
+// The mutex of p MUST NOT be held, as it is only taken to record the outcome.
+func (d *Dialer) negotiate(ctx context.Context, p *dialerPeer, n *peerNegotiation, offerInfo *OfferInfo) error {
+	// The negotiation state is private until recorded in p
+	negotiated := &dialerPeer{
+		peerConnection: n.peerConnection,
+		handshake:      n.handshake,
+		offerInfo:      offerInfo,
+	}
+	err := d.negotiatePeerConnection(ctx, negotiated, n.pregathered)
+	n.peerIdentity = negotiated.peerIdentity
+	n.issuedTicket = negotiated.issuedTicket
+
+	p.mutex.Lock()
+	if p.negotiating == n {
+		p.negotiating = nil
+	}
+	if err != nil {
+		n.peerConnection.Close()
+		if p.peerConnection == n.peerConnection {
+			p.peerConnection = nil
 		}
-		// } else { // error but not due to PC closed
-		// 	return nil, err
-		// }
+	} else if p.peerConnection == n.peerConnection {
+		p.offerID = negotiated.offerID
+		p.peerIdentity = negotiated.peerIdentity
+		p.issuedTicket = negotiated.issuedTicket
 	}
-	return dataChannel, nil
+	p.mutex.Unlock()
+
+	close(n.done)
+	return err
 }
 
-// startPeerConnection creates a new PeerConnection that can be reused in following Dial calls.
-// If Dialer.signal is set, the Offer/Answer exchange will be done automatically.
+// acquirePeerConnection sets a new PeerConnection to p, pre-gathered if
+// available to skip the ICE gathering.
 //
-// It returns the first DataChannel created with the PeerConnection. Note: the returned DataChannel
-// is not guaranteed to be open yet.It is caller's responsibility to check the DataChannel's state
-// and handle the OnOpen event.
+// Not thread-safe. Caller MUST hold the mutex of p before calling this function.
+func (d *Dialer) acquirePeerConnection(p *dialerPeer) (pregathered bool, err error) {
+	if pg := d.pool.get(); pg != nil {
+		p.peerConnection = pg.peerConnection
+		p.handshake = pg.handshake
+		return true, nil
+	}
+
+	peerConnection, handshake, err := d.newPeerConnection()
+	if err != nil {
+		return false, err
+	}
+	p.peerConnection = peerConnection
+	p.handshake = handshake
+	return false, nil
+}
+
+// negotiatePeerConnection gathers the offer of the PeerConnection of p unless
+// pregathered, then exchanges it for the answer of the remote peer.
 //
-// Not thread-safe. Caller MUST hold the mutex before calling this function.
-func (d *Dialer) startPeerConnection(ctx context.Context, dataChannelLabel string) (*webrtc.DataChannel, error) {
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(d.settingEngine))
+// Not thread-safe. Caller MUST hold the mutex of p, or p MUST NOT be shared.
+func (d *Dialer) negotiatePeerConnection(ctx context.Context, p *dialerPeer, pregathered bool) error {
+	if !pregathered {
+		if err := d.gatherOffer(ctx, p.peerConnection, nil); err != nil {
+			return fmt.Errorf("dialer: failed to send offer: %w", err)
+		}
+	}
 
-	peerConnection, err := api.NewPeerConnection(d.configuration)
+	offerID, err := d.exchangeOffer(ctx, p)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	p.offerID = offerID
+	return nil
+}
+
+// exchangeOffer signals the local description of p and sets the answer of the
+// remote peer as the remote description, traced as a SPAN_SIGNAL.
+func (d *Dialer) exchangeOffer(ctx context.Context, p *dialerPeer) (offerID uint64, err error) {
+	ctx, span := startSpan(ctx, d.tracer, SPAN_SIGNAL)
+	defer func() {
+		span.End(err)
+	}()
+
+	offerID, err = d.signalOffer(ctx, p, 0)
+	if err != nil {
+		return 0, fmt.Errorf("dialer: failed to send offer: %w", err)
+	}
+
+	err = d.setAnswer(ctx, p, offerID)
+	if err != nil {
+		return 0, fmt.Errorf("dialer: failed to set answer: %w", err)
+	}
+	return offerID, nil
+}
+
+// newPeerConnection creates a new PeerConnection with the current configuration.
+func (d *Dialer) newPeerConnection() (*webrtc.PeerConnection, *handshakeTimer, error) {
+	settingEngine := d.settingEngine
+	turn := withTURNTracker(&settingEngine, d.stats)
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(settingEngine))
+
+	d.configMutex.Lock()
+	configuration := d.icePairPolicy.configure(d.configuration)
+	d.configMutex.Unlock()
+
+	peerConnection, err := api.NewPeerConnection(configuration)
+	if err != nil {
+		return nil, nil, err
 	} else if peerConnection == nil {
-		return nil, errors.New("dialer: created nil PeerConnection")
+		return nil, nil, errors.New("dialer: created nil PeerConnection")
 	}
 
+	d.turnMutex.Lock()
+	d.turnTrackers[peerConnection] = turn
+	d.turnMutex.Unlock()
+
+	var transcript *transcriptRecorder
+	if d.recordTranscript {
+		transcript = newTranscriptRecorder(peerConnection)
+		d.transcriptMutex.Lock()
+		d.transcripts[peerConnection] = transcript
+		d.transcriptMutex.Unlock()
+	}
+
+	d.events.emit(TransportEvent{Type: EVENT_PC_CREATED})
+
+	handshake := &handshakeTimer{}
+	peerConnection.OnICEConnectionStateChange(func(s webrtc.ICEConnectionState) {
+		transcript.record(TRANSCRIPT_ICE_STATE, s.String())
+		if s == webrtc.ICEConnectionStateConnected {
+			handshake.markICEConnected()
+		} else if s == webrtc.ICEConnectionStateFailed {
+			d.events.emit(TransportEvent{Type: EVENT_ICE_FAILED})
+		}
+	})
+
 	peerConnection.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
 		// TODO: handle this better
-		if s > webrtc.PeerConnectionStateConnected {
+		transcript.record(TRANSCRIPT_PC_STATE, s.String())
+		if s == webrtc.PeerConnectionStateConnected {
+			handshake.markDTLSConnected()
+		} else if s > webrtc.PeerConnectionStateConnected {
+			if s == webrtc.PeerConnectionStateClosed {
+				d.turnMutex.Lock()
+				delete(d.turnTrackers, peerConnection)
+				d.turnMutex.Unlock()
+				turn.close()
+				d.transcriptMutex.Lock()
+				delete(d.transcripts, peerConnection)
+				d.transcriptMutex.Unlock()
+			}
+			if s != webrtc.PeerConnectionStateClosed && d.paused.Load() {
+				d.logger.Debugf("dialer: PeerConnection %s while paused, kept for ICE restart", s)
+				return
+			}
 			d.logger.Warnf("dialer: PeerConnection disconnected.")
+			if s == webrtc.PeerConnectionStateFailed {
+				d.markPeerConnectionFailed(peerConnection)
+			}
 			d.mutex.Lock()
 			peerConnection.Close()
 			if d.peerConnection == peerConnection {
@@ -206,110 +869,190 @@ func (d *Dialer) startPeerConnection(ctx context.Context, dataChannelLabel strin
 		}
 	})
 
-	d.peerConnection = peerConnection
-
-	dataChannel, err := d.peerConnection.CreateDataChannel(dataChannelLabel, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Automatic Signalling when possible
-	if d.signal != nil {
-		offerID, err := d.SendOffer(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("dialer: failed to send offer: %w", err)
-		}
-
-		err = d.SetAnswer(ctx, offerID)
-		if err != nil {
-			return nil, fmt.Errorf("dialer: failed to set answer: %w", err)
-		}
-	}
-
-	return dataChannel, nil
+	return peerConnection, handshake, nil
 }
 
 // SendOffer creates a local offer and sets it as the local description,
 // then signals the offer to the remote peer and return the offer ID.
 //
-// Automatically called by startPeerConnection when Dialer.signal is set.
+// Automatically called by negotiate when Dialer.signal is set.
 func (d *Dialer) SendOffer(ctx context.Context) (uint64, error) {
-	localDescription, err := d.peerConnection.CreateOffer(nil)
+	if err := d.gatherOffer(ctx, d.peerConnection, nil); err != nil {
+		return 0, err
+	}
+	return d.signalOffer(ctx, &d.dialerPeer, 0)
+}
+
+// gatherOffer creates a local offer with options and sets it as the local
+// description of peerConnection, then waits for the ICE gathering to complete.
+func (d *Dialer) gatherOffer(ctx context.Context, peerConnection *webrtc.PeerConnection, options *webrtc.OfferOptions) (err error) {
+	_, span := startSpan(ctx, d.tracer, SPAN_ICE_GATHER)
+	defer func() {
+		span.End(err)
+	}()
+
+	localDescription, err := peerConnection.CreateOffer(options)
 	if err != nil {
-		return 0, fmt.Errorf("dialer: failed to create local offer: %w", err)
+		return fmt.Errorf("dialer: failed to create local offer: %w", err)
 	}
 
 	// Create channel that is blocked until ICE Gathering is complete
-	gatherComplete := webrtc.GatheringCompletePromise(d.peerConnection)
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
 
 	// Sets the LocalDescription, and starts our UDP listeners
-	err = d.peerConnection.SetLocalDescription(localDescription)
+	err = peerConnection.SetLocalDescription(localDescription)
 	if err != nil {
-		return 0, fmt.Errorf("dialer: failed to set local description: %w", err)
+		return fmt.Errorf("dialer: failed to set local description: %w", err)
 	}
 
 	// Block until ICE Gathering is complete, disabling trickle ICE
 	// we do this because we only can exchange one signaling message
 	// in a production application you should exchange ICE Candidates via OnICECandidate
 	// TODO: use OnICECandidate callback instead
-	select {
-	case <-ctx.Done():
-		return 0, fmt.Errorf("dialer: context done before ICE gathering complete: %w", ctx.Err())
-	case <-gatherComplete:
-		offer := d.peerConnection.LocalDescription()
-		offerByte, err := json.Marshal(offer)
+	err = waitForGathering(ctx, gatherComplete, d.gatherTimeout)
+	if err == ErrGatherTimeout {
+		d.logger.Warnf("dialer: ICE gathering incomplete after %v, proceeding with partial candidates", d.gatherTimeout)
+	} else if err != nil {
+		return fmt.Errorf("dialer: context done before ICE gathering complete: %w", err)
+	}
+	return nil
+}
+
+// signalOffer signals the local description of p to the remote peer and returns
+// the offer ID. If restart is non-zero, the offer is an ICE restart of the
+// PeerConnection created from the offer of ID restart. The offer carries the
+// trace of ctx, see TracePropagator.
+func (d *Dialer) signalOffer(ctx context.Context, p *dialerPeer, restart uint64) (uint64, error) {
+	offer := p.peerConnection.LocalDescription()
+	if d.dtlsRole == DTLSRoleClient || d.dtlsRole == DTLSRoleServer {
+		offer = withDTLSSetupRole(offer, d.dtlsRole)
+	}
+	if d.sdpBandwidth != nil {
+		cappedOffer, err := withSDPBandwidth(offer, d.sdpBandwidth)
 		if err != nil {
-			return 0, fmt.Errorf("dialer: failed to marshal local offer: %w", err)
+			return 0, fmt.Errorf("dialer: failed to cap the bandwidth of local offer: %w", err)
 		}
-
-		offerID, err := d.signal.Offer(offerByte)
+		offer = cappedOffer
+	}
+	if d.sdpTransformOut != nil {
+		transformedOffer, err := d.sdpTransformOut(*offer)
 		if err != nil {
-			return 0, fmt.Errorf("dialer: failed to signal local offer: %w", err)
+			return 0, fmt.Errorf("dialer: failed to transform local offer: %w", err)
 		}
+		offer = &transformedOffer
+	}
 
-		return offerID, nil
+	envelope := newSDPEnvelope(offer, d.namespace)
+	envelope.Restart = restart
+	envelope.Nonce = d.rendezvousNonce
+	envelope.Trace = injectTrace(ctx, d.tracer)
+	if restart == 0 && p.offerInfo != nil {
+		envelope.Label = p.offerInfo.Label
+		envelope.Protocol = p.offerInfo.Protocol
+		envelope.Metadata = p.offerInfo.Metadata
+	}
+	p.offerTicket = ""
+	if restart == 0 {
+		p.offerTicket = d.reconnectTicket()
+		envelope.Ticket = p.offerTicket
+	}
+	signSessionDescription(envelope, d.identityKey, d.signedOfferTTL)
+	offerID, err := signalOffer(d.signal, signalMessage{envelope: envelope})
+	if err != nil {
+		return 0, fmt.Errorf("dialer: failed to signal local offer: %w", err)
 	}
+	p.handshake.markOfferSent()
+	d.transcript(p.peerConnection).setOffer(offer)
+
+	return offerID, nil
 }
 
 // SetAnswer reads the answer from the signaler and sets it as the remote description.
 //
-// Automatically called by startPeerConnection when Dialer.signal is set.
+// Automatically called by negotiate when Dialer.signal is set.
 func (d *Dialer) SetAnswer(ctx context.Context, offerID uint64) error {
-	var blockingChan chan error = make(chan error)
-	var answerUnmarshal webrtc.SessionDescription
-
-	go func(blockingChan chan error, webrtcAnswer *webrtc.SessionDescription) {
-		defer close(blockingChan)
-		answerBytes, err := d.signal.ReadAnswer(offerID)
-		for err == ErrAnswerNotReady {
-			time.Sleep(100 * time.Millisecond)
-			answerBytes, err = d.signal.ReadAnswer(offerID)
-		}
-
-		if err != nil {
-			blockingChan <- fmt.Errorf("dialer: failed to read answer: %w", err)
-			return
-		}
+	return d.setAnswer(ctx, &d.dialerPeer, offerID)
+}
 
-		err = json.Unmarshal(answerBytes, webrtcAnswer)
-		if err != nil {
-			blockingChan <- fmt.Errorf("dialer: failed to unmarshal answer: %w", err)
-			return
+// setAnswer reads the answer to the offer of offerID from the signaler and
+// sets it as the remote description of the PeerConnection of p.
+func (d *Dialer) setAnswer(ctx context.Context, p *dialerPeer, offerID uint64) error {
+	offer := p.peerConnection.LocalDescription()
+	var envelope *sdpEnvelope
+	var remoteIdentity ed25519.PublicKey
+	err := runContext(ctx, func() (err error) {
+		envelope, remoteIdentity, err = d.readAnswer(ctx, offerID)
+		return err
+	})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("dialer: context done before answer received: %w", ctxErr)
 		}
-	}(blockingChan, &answerUnmarshal)
+		return err
+	}
+	p.handshake.markAnswerReceived()
 
-	select {
-	case <-ctx.Done():
-		return fmt.Errorf("dialer: context done before answer received: %w", ctx.Err())
-	case remoteErr := <-blockingChan:
-		if remoteErr != nil {
-			return remoteErr
+	// Don't apply an answer injected or mixed up by the signaling
+	answer := envelope.SessionDescription
+	pinnedFingerprints := d.pinnedFingerprints
+	if ticket, err := parseTicket(p.offerTicket); err == nil && ticket.Fingerprint != "" {
+		pinnedFingerprints = []string{ticket.Fingerprint} // of the Listener that issued the ticket
+	}
+	if err := validateAnswer(offer, &answer, pinnedFingerprints); err != nil {
+		if errors.Is(err, ErrFingerprintNotPinned) && p.offerTicket != "" {
+			d.dropTicket(p.offerTicket) // e.g., the Listener rotated its certificates
 		}
+		return fmt.Errorf("dialer: invalid answer: %w", err)
 	}
-	err := d.peerConnection.SetRemoteDescription(answerUnmarshal)
+	p.peerIdentity = remoteIdentity
+	p.issuedTicket = envelope.Ticket
+
+	err = p.peerConnection.SetRemoteDescription(answer)
 	if err != nil {
 		return fmt.Errorf("dialer: failed to set remote description: %w", err)
 	}
+	p.handshake.markICEStarted()
+	d.transcript(p.peerConnection).setAnswer(&answer)
 
 	return nil
 }
+
+// readAnswer reads the answer to the offer of offerID from the signaler,
+// polling until it is ready or ctx is done. The SessionDescription of the
+// envelope returned is transformed by Config.SDPTransformIncoming.
+func (d *Dialer) readAnswer(ctx context.Context, offerID uint64) (*sdpEnvelope, ed25519.PublicKey, error) {
+	message, err := readSignalAnswer(d.signal, offerID)
+	for err == ErrAnswerNotReady && ctx.Err() == nil {
+		time.Sleep(100 * time.Millisecond)
+		message, err = readSignalAnswer(d.signal, offerID)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("dialer: failed to read answer: %w", err)
+	}
+
+	envelope, remoteIdentity, err := message.open(webrtc.SDPTypeAnswer, d.allowedPeers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dialer: failed to parse answer: %w", err)
+	}
+
+	if d.sdpTransformIn != nil {
+		envelope.SessionDescription, err = d.sdpTransformIn(envelope.SessionDescription)
+		if err != nil {
+			return nil, nil, fmt.Errorf("dialer: failed to transform answer: %w", err)
+		}
+	}
+
+	if (d.dtlsRole == DTLSRoleClient || d.dtlsRole == DTLSRoleServer) && dtlsSetupRole(&envelope.SessionDescription) == d.dtlsRole {
+		return nil, nil, fmt.Errorf("dialer: %w", ErrDTLSRoleConflict)
+	}
+	// Offering and never in ICE-lite mode, the Dialer is only controlled by a
+	// Listener in ICE-lite mode
+	iceRole := ICERoleControlling
+	if iceLite(&envelope.SessionDescription) {
+		iceRole = ICERoleControlled
+	}
+	if d.iceRole != 0 && d.iceRole != iceRole {
+		return nil, nil, fmt.Errorf("dialer: %w: %s", ErrICERoleConflict, iceRole)
+	}
+	return envelope, remoteIdentity, nil
+}
@@ -0,0 +1,90 @@
+package transportc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	ECHO_PROTOCOL = "transportc-echo"
+	PING_LABEL    = "ping"
+	PING_SIZE     = 32
+)
+
+var (
+	// ErrPingMismatch is returned by Ping when the echoed message differs
+	// from the message sent.
+	ErrPingMismatch = errors.New("unexpected ping response")
+)
+
+// EchoHandler writes back every message read from conn until it fails, then
+// closes conn. It can be registered for ECHO_PROTOCOL with Listener.Handle
+// to answer Dialer.Ping alongside other services.
+func EchoHandler(conn net.Conn) {
+	defer conn.Close()
+
+	buf := make([]byte, CONN_DEFAULT_MTU)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+// ServeEcho accepts Conns and serves each with EchoHandler, so operators
+// can validate the connectivity with Dialer.Ping. It blocks until Accept
+// fails, e.g., the Listener is closed, and returns the error.
+func (l *Listener) ServeEcho() error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go EchoHandler(conn)
+	}
+}
+
+// Ping dials a Conn to an echo server, see Listener.ServeEcho, and returns
+// the round-trip time of a message over the established datachannel. The
+// time spent dialing is not included.
+func (d *Dialer) Ping(ctx context.Context) (time.Duration, error) {
+	conn, err := d.DialContext(ctx, PING_LABEL, WithProtocol(ECHO_PROTOCOL))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	ping := make([]byte, PING_SIZE)
+	if _, err := rand.Read(ping); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if _, err := conn.Write(ping); err != nil {
+		return 0, err
+	}
+
+	pong := make([]byte, PING_SIZE)
+	n, err := conn.Read(pong)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+
+	if !bytes.Equal(ping, pong[:n]) {
+		return 0, ErrPingMismatch
+	}
+	return rtt, nil
+}
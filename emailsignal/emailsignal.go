@@ -0,0 +1,398 @@
+// Package emailsignal implements transportc.Signal over email, for extremely
+// constrained or asynchronous rendezvous: the Dialer sends its offer by email
+// to the address of the Listener, which polls its mailbox and replies with the
+// answer to the sender of the offer.
+//
+// Offers and answers are split into chunks sent as separate emails, so they
+// fit the size limits of the mail servers and gateways on the way. Emails are
+// sent with a Sender, e.g., an SMTPSender, and received from a Mailbox, e.g.,
+// an IMAPMailbox.
+package emailsignal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+const (
+	SUBJECT_PREFIX        = "transportc " // prefix of the subject of all emails sent
+	DEFAULT_CHUNK_SIZE    = 4096          // bytes of base64 per email
+	DEFAULT_POLL_INTERVAL = 10 * time.Second
+	MAX_CHUNKS            = 64               // max emails per offer or answer
+	CHUNK_TTL             = 10 * time.Minute // how long offers and answers, complete or not, are kept
+	SEND_TIMEOUT          = 30 * time.Second // per email
+	RECEIVE_TIMEOUT       = time.Minute      // per poll of the Mailbox
+
+	emailLineLength = 76
+
+	emailKindOffer  = "offer"
+	emailKindAnswer = "answer"
+)
+
+var (
+	// ErrMissingMailbox is returned by NewSignal if the Config has no
+	// Address, Sender or Mailbox.
+	ErrMissingMailbox = errors.New("emailsignal: address, sender and mailbox required")
+
+	// ErrTooManyChunks is returned by Offer and Answer if the offer or answer
+	// needs more than MAX_CHUNKS emails.
+	ErrTooManyChunks = errors.New("emailsignal: too many chunks")
+)
+
+// Email is an email sent by a Sender or received from a Mailbox.
+type Email struct {
+	From    string // address only, e.g., listener@example.com
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender sends emails, e.g., an SMTPSender.
+type Sender interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// Mailbox receives emails, e.g., an IMAPMailbox.
+type Mailbox interface {
+	// Receive returns the emails received whose subject starts with
+	// subjectPrefix, and deletes them from the mailbox.
+	Receive(ctx context.Context, subjectPrefix string) ([]Email, error)
+}
+
+// Config configures a Signal.
+type Config struct {
+	// Address is the email address of this peer, sending from it and
+	// receiving in Mailbox.
+	Address string
+
+	// PeerAddress is the email address offers are sent to, i.e., the Address
+	// of the Listener. It is only required by Dialers.
+	PeerAddress string
+
+	Sender  Sender
+	Mailbox Mailbox
+
+	// ChunkSize is the size of the base64 body of each email. If zero,
+	// DEFAULT_CHUNK_SIZE is used.
+	ChunkSize int
+
+	// PollInterval is how often the Mailbox is polled at most. If zero,
+	// DEFAULT_POLL_INTERVAL is used.
+	PollInterval time.Duration
+}
+
+// Signal implements transportc.Signal over email.
+//
+// ReadOffer blocks until the Mailbox is polled, at most once per
+// PollInterval. ReadAnswer does not block, it returns
+// transportc.ErrAnswerNotReady until the answer is received. Offer fails with
+// transportc.ErrSignalDirection without PeerAddress.
+type Signal struct {
+	address      string
+	peerAddress  string
+	sender       Sender
+	mailbox      Mailbox
+	chunkSize    int
+	pollInterval time.Duration
+
+	receiveMutex sync.Mutex // held while polling the Mailbox
+	lastReceive  time.Time
+
+	mutex   sync.Mutex
+	chunks  map[emailChunksKey]*emailChunks // incomplete offers and answers
+	offers  []emailOffer                    // complete offers not read yet
+	answers map[uint64]emailAnswer          // complete answers not read yet
+	peers   map[uint64]emailPeer            // offers read not answered yet
+}
+
+type emailChunksKey struct {
+	kind string
+	id   uint64
+}
+
+type emailChunks struct {
+	from     string
+	parts    []string
+	received int
+	expires  time.Time
+}
+
+type emailOffer struct {
+	id    uint64
+	offer []byte
+}
+
+type emailAnswer struct {
+	answer  []byte
+	expires time.Time
+}
+
+type emailPeer struct {
+	address string
+	expires time.Time
+}
+
+// NewSignal creates a Signal from config.
+func NewSignal(config *Config) (*Signal, error) {
+	if config.Address == "" || config.Sender == nil || config.Mailbox == nil {
+		return nil, ErrMissingMailbox
+	}
+
+	s := &Signal{
+		address:      config.Address,
+		peerAddress:  config.PeerAddress,
+		sender:       config.Sender,
+		mailbox:      config.Mailbox,
+		chunkSize:    config.ChunkSize,
+		pollInterval: config.PollInterval,
+		chunks:       make(map[emailChunksKey]*emailChunks),
+		answers:      make(map[uint64]emailAnswer),
+		peers:        make(map[uint64]emailPeer),
+	}
+	if s.chunkSize == 0 {
+		s.chunkSize = DEFAULT_CHUNK_SIZE
+	}
+	if s.pollInterval == 0 {
+		s.pollInterval = DEFAULT_POLL_INTERVAL
+	}
+	return s, nil
+}
+
+// Offer implements transportc.Signal.Offer.
+// It sends the offer to PeerAddress under a new random offerID.
+func (s *Signal) Offer(offer []byte) (uint64, error) {
+	if s.peerAddress == "" {
+		return 0, transportc.ErrSignalDirection
+	}
+
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, fmt.Errorf("emailsignal: %w", err)
+	}
+	id := binary.BigEndian.Uint64(b[:])
+
+	if err := s.send(s.peerAddress, emailKindOffer, id, offer); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// ReadOffer implements transportc.Signal.ReadOffer.
+// It returns the oldest offer received, polling the Mailbox if there is none.
+func (s *Signal) ReadOffer() (uint64, []byte, error) {
+	if id, offer, ok := s.nextOffer(); ok {
+		return id, offer, nil
+	}
+
+	if err := s.receive(true); err != nil {
+		return 0, nil, err
+	}
+	if id, offer, ok := s.nextOffer(); ok {
+		return id, offer, nil
+	}
+	return 0, nil, transportc.ErrOfferNotReady
+}
+
+// Answer implements transportc.Signal.Answer.
+// It sends the answer to the sender of the offer.
+func (s *Signal) Answer(offerID uint64, answer []byte) error {
+	s.mutex.Lock()
+	peer, ok := s.peers[offerID]
+	delete(s.peers, offerID)
+	s.mutex.Unlock()
+	if !ok {
+		return transportc.ErrInvalidOfferID
+	}
+
+	return s.send(peer.address, emailKindAnswer, offerID, answer)
+}
+
+// ReadAnswer implements transportc.Signal.ReadAnswer.
+// It polls the Mailbox if not polled within PollInterval.
+func (s *Signal) ReadAnswer(offerID uint64) ([]byte, error) {
+	if answer, ok := s.takeAnswer(offerID); ok {
+		return answer, nil
+	}
+
+	if err := s.receive(false); err != nil {
+		return nil, err
+	}
+	if answer, ok := s.takeAnswer(offerID); ok {
+		return answer, nil
+	}
+	return nil, transportc.ErrAnswerNotReady
+}
+
+func (s *Signal) nextOffer() (uint64, []byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.offers) == 0 {
+		return 0, nil, false
+	}
+	offer := s.offers[0]
+	s.offers = s.offers[1:]
+	return offer.id, offer.offer, true
+}
+
+func (s *Signal) takeAnswer(offerID uint64) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	answer, ok := s.answers[offerID]
+	delete(s.answers, offerID)
+	return answer.answer, ok
+}
+
+// send sends data in chunks of s.chunkSize, each email with the subject
+// "transportc <kind> <id> <i>/<n>".
+func (s *Signal) send(to, kind string, id uint64, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	n := (len(encoded) + s.chunkSize - 1) / s.chunkSize
+	if n > MAX_CHUNKS {
+		return ErrTooManyChunks
+	}
+
+	for i := 0; i < n; i++ {
+		chunk := encoded[i*s.chunkSize:]
+		if len(chunk) > s.chunkSize {
+			chunk = chunk[:s.chunkSize]
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), SEND_TIMEOUT)
+		err := s.sender.Send(ctx, Email{
+			From:    s.address,
+			To:      to,
+			Subject: SUBJECT_PREFIX + kind + " " + strconv.FormatUint(id, 16) + " " + strconv.Itoa(i+1) + "/" + strconv.Itoa(n),
+			Body:    wrapLines(chunk, emailLineLength),
+		})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("emailsignal: %w", err)
+		}
+	}
+	return nil
+}
+
+// receive polls the Mailbox once PollInterval has passed since the last
+// poll, waiting for it if wait is set, and reassembles the chunks received.
+func (s *Signal) receive(wait bool) error {
+	s.receiveMutex.Lock()
+	defer s.receiveMutex.Unlock()
+
+	next := s.lastReceive.Add(s.pollInterval)
+	if delay := time.Until(next); delay > 0 {
+		if !wait {
+			return nil
+		}
+		time.Sleep(delay)
+	}
+	s.lastReceive = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), RECEIVE_TIMEOUT)
+	defer cancel()
+	emails, err := s.mailbox.Receive(ctx, SUBJECT_PREFIX)
+	if err != nil {
+		return fmt.Errorf("emailsignal: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for key, chunks := range s.chunks {
+		if now.After(chunks.expires) {
+			delete(s.chunks, key)
+		}
+	}
+	for offerID, peer := range s.peers {
+		if now.After(peer.expires) {
+			delete(s.peers, offerID)
+		}
+	}
+	for offerID, answer := range s.answers {
+		if now.After(answer.expires) {
+			delete(s.answers, offerID) // never read
+		}
+	}
+
+	for _, email := range emails {
+		key, i, n, ok := parseSubject(email.Subject)
+		if !ok {
+			continue
+		}
+
+		chunks := s.chunks[key]
+		if chunks == nil {
+			chunks = &emailChunks{from: email.From, parts: make([]string, n), expires: now.Add(CHUNK_TTL)}
+			s.chunks[key] = chunks
+		}
+		if len(chunks.parts) != n || chunks.parts[i-1] != "" {
+			continue // inconsistent or duplicate chunk
+		}
+		chunks.parts[i-1] = strings.Join(strings.Fields(email.Body), "")
+		chunks.received++
+		if chunks.received < n {
+			continue
+		}
+
+		delete(s.chunks, key)
+		data, err := base64.StdEncoding.DecodeString(strings.Join(chunks.parts, ""))
+		if err != nil {
+			continue
+		}
+		switch key.kind {
+		case emailKindOffer:
+			s.offers = append(s.offers, emailOffer{id: key.id, offer: data})
+			s.peers[key.id] = emailPeer{address: chunks.from, expires: now.Add(CHUNK_TTL)}
+		case emailKindAnswer:
+			s.answers[key.id] = emailAnswer{answer: data, expires: now.Add(CHUNK_TTL)}
+		}
+	}
+	return nil
+}
+
+// parseSubject parses the subject of an email sent by send.
+func parseSubject(subject string) (key emailChunksKey, i, n int, ok bool) {
+	fields := strings.Fields(strings.TrimPrefix(subject, SUBJECT_PREFIX))
+	if !strings.HasPrefix(subject, SUBJECT_PREFIX) || len(fields) != 3 {
+		return key, 0, 0, false
+	}
+	if fields[0] != emailKindOffer && fields[0] != emailKindAnswer {
+		return key, 0, 0, false
+	}
+	id, err := strconv.ParseUint(fields[1], 16, 64)
+	if err != nil {
+		return key, 0, 0, false
+	}
+
+	index, total, found := strings.Cut(fields[2], "/")
+	i, errI := strconv.Atoi(index)
+	n, errN := strconv.Atoi(total)
+	if !found || errI != nil || errN != nil || n < 1 || n > MAX_CHUNKS || i < 1 || i > n {
+		return key, 0, 0, false
+	}
+	return emailChunksKey{kind: fields[0], id: id}, i, n, true
+}
+
+// wrapLines splits s in lines of length, as mail servers limit the length of
+// lines.
+func wrapLines(s string, length int) string {
+	var b strings.Builder
+	for len(s) > length {
+		b.WriteString(s[:length] + "\r\n")
+		s = s[length:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
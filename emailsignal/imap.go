@@ -0,0 +1,254 @@
+package emailsignal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+const (
+	imapMaxLiteralSize = 1024 * 1024 // max size of an email fetched
+)
+
+var (
+	// ErrIMAP is returned by IMAPMailbox when the server fails a command.
+	ErrIMAP = errors.New("imap command failed")
+)
+
+// IMAPConfig configures an IMAPMailbox.
+type IMAPConfig struct {
+	// Addr is the address of the IMAP server over TLS, e.g.,
+	// imap.example.com:993.
+	Addr string
+
+	Username string
+	Password string
+
+	// Mailbox is the mailbox polled. If empty, INBOX is used.
+	Mailbox string
+
+	// TLSConfig configures the TLS connection. If nil, the server is
+	// verified against the host of Addr.
+	TLSConfig *tls.Config
+}
+
+// IMAPMailbox is a Mailbox polling an IMAP server with a minimal client,
+// logging in, fetching the emails of matching subject, then deleting them,
+// over a new connection per Receive.
+type IMAPMailbox struct {
+	config IMAPConfig
+}
+
+// NewIMAPMailbox creates an IMAPMailbox from config.
+func NewIMAPMailbox(config *IMAPConfig) *IMAPMailbox {
+	m := &IMAPMailbox{config: *config}
+	if m.config.Mailbox == "" {
+		m.config.Mailbox = "INBOX"
+	}
+	return m
+}
+
+// Receive implements Mailbox.Receive.
+func (m *IMAPMailbox) Receive(ctx context.Context, subjectPrefix string) ([]Email, error) {
+	tlsConfig := m.config.TLSConfig
+	if tlsConfig == nil {
+		host, _, err := net.SplitHostPort(m.config.Addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+
+	conn, err := (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", m.config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c := &imapClient{r: bufio.NewReader(conn), w: conn}
+	if _, err := c.readLine(); err != nil { // greeting
+		return nil, err
+	}
+	if _, err := c.command("LOGIN " + imapQuote(m.config.Username) + " " + imapQuote(m.config.Password)); err != nil {
+		return nil, err
+	}
+	if _, err := c.command("SELECT " + imapQuote(m.config.Mailbox)); err != nil {
+		return nil, err
+	}
+
+	// SEARCH SUBJECT matches substrings, the prefix is checked once fetched
+	responses, err := c.command("UID SEARCH SUBJECT " + imapQuote(subjectPrefix))
+	if err != nil {
+		return nil, err
+	}
+	var uids []string
+	for _, response := range responses {
+		if fields := strings.Fields(response.text); len(fields) >= 2 && fields[1] == "SEARCH" {
+			uids = append(uids, fields[2:]...)
+		}
+	}
+
+	var emails []Email
+	for _, uid := range uids {
+		if _, err := strconv.ParseUint(uid, 10, 32); err != nil {
+			continue
+		}
+		responses, err := c.command("UID FETCH " + uid + " BODY.PEEK[]")
+		if err != nil {
+			return nil, err
+		}
+		for _, response := range responses {
+			if len(response.literals) == 0 {
+				continue
+			}
+			email, err := parseEmail(response.literals[0])
+			if err != nil || !strings.HasPrefix(email.Subject, subjectPrefix) {
+				continue
+			}
+			emails = append(emails, email)
+		}
+		if _, err := c.command("UID STORE " + uid + ` +FLAGS.SILENT (\Deleted)`); err != nil {
+			return nil, err
+		}
+	}
+	if len(uids) > 0 {
+		if _, err := c.command("EXPUNGE"); err != nil {
+			return nil, err
+		}
+	}
+
+	c.command("LOGOUT") // the emails are received regardless
+	return emails, nil
+}
+
+// parseEmail parses a message fetched from the IMAP server.
+func parseEmail(message []byte) (Email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return Email{}, err
+	}
+
+	var body io.Reader = msg.Body
+	if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return Email{}, err
+	}
+
+	email := Email{
+		Subject: msg.Header.Get("Subject"),
+		Body:    string(content),
+	}
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		email.From = from.Address
+	}
+	if to, err := mail.ParseAddress(msg.Header.Get("To")); err == nil {
+		email.To = to.Address
+	}
+	return email, nil
+}
+
+// imapClient sends tagged IMAP commands and reads their responses.
+type imapClient struct {
+	r   *bufio.Reader
+	w   io.Writer
+	tag int
+}
+
+// imapResponse is an untagged response, with its literals apart.
+type imapResponse struct {
+	text     string
+	literals [][]byte
+}
+
+// command sends cmd and returns the untagged responses until the tagged
+// completion, failing with ErrIMAP unless it is OK.
+func (c *imapClient) command(cmd string) ([]imapResponse, error) {
+	c.tag++
+	tag := "T" + strconv.Itoa(c.tag)
+	if _, err := io.WriteString(c.w, tag+" "+cmd+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	var responses []imapResponse
+	for {
+		response, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(response.text, tag+" ") {
+			responses = append(responses, response)
+			continue
+		}
+
+		status := strings.TrimPrefix(response.text, tag+" ")
+		if !strings.HasPrefix(status, "OK") {
+			verb, _, _ := strings.Cut(cmd, " ")
+			return nil, fmt.Errorf("%w: %s: %s", ErrIMAP, verb, status)
+		}
+		return responses, nil
+	}
+}
+
+// readResponse reads a response, including the literals within.
+func (c *imapClient) readResponse() (imapResponse, error) {
+	var response imapResponse
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return response, err
+		}
+		response.text += line
+
+		// a literal {n} ends the line, then n bytes and the rest of the response follow
+		if !strings.HasSuffix(line, "}") {
+			return response, nil
+		}
+		brace := strings.LastIndexByte(line, '{')
+		if brace < 0 {
+			return response, nil
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(line[brace+1:len(line)-1], "+"))
+		if err != nil {
+			return response, nil
+		}
+		if size > imapMaxLiteralSize {
+			return response, fmt.Errorf("%w: literal of %d bytes", ErrIMAP, size)
+		}
+
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return response, err
+		}
+		response.literals = append(response.literals, literal)
+	}
+}
+
+func (c *imapClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// imapQuote quotes s as an IMAP quoted string.
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
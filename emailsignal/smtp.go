@@ -0,0 +1,104 @@
+package emailsignal
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPSender is a Sender submitting emails to an SMTP server, upgrading the
+// connection with STARTTLS if the server supports it, as smtp.SendMail.
+type SMTPSender struct {
+	addr      string
+	auth      smtp.Auth
+	tlsConfig *tls.Config
+}
+
+// NewSMTPSender creates an SMTPSender submitting emails to the server at
+// addr, e.g., smtp.example.com:587, authenticated with auth if not nil.
+// If tlsConfig is not nil, the connection is TLS from the start, e.g., to
+// port 465, instead of upgraded with STARTTLS.
+func NewSMTPSender(addr string, auth smtp.Auth, tlsConfig *tls.Config) *SMTPSender {
+	return &SMTPSender{
+		addr:      addr,
+		auth:      auth,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// Send implements Sender.Send.
+func (s *SMTPSender) Send(ctx context.Context, email Email) error {
+	host, _, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+	if s.tlsConfig != nil {
+		conn, err = (&tls.Dialer{Config: s.tlsConfig}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && s.tlsConfig == nil {
+		if err := client.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if s.auth != nil {
+		if err := client.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(email.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(email.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(formatEmail(email)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// formatEmail formats email as a plain text message.
+func formatEmail(email Email) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: <%s>\r\n", email.From)
+	fmt.Fprintf(&b, "To: <%s>\r\n", email.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", email.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=us-ascii\r\n")
+	b.WriteString("Content-Transfer-Encoding: 7bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(email.Body)
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
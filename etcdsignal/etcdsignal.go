@@ -0,0 +1,110 @@
+// Package etcdsignal implements transportc.KVStore with etcd, so Dialers and
+// Listeners inside a cluster signal through the etcd of its control plane,
+// e.g., the one of Kubernetes or of a service mesh.
+//
+// Each key is attached to a lease of its TTL, so offers and answers never
+// read are removed by etcd.
+package etcdsignal
+
+import (
+	"context"
+	"time"
+
+	"github.com/gaukas/transportc"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Store is a transportc.KVStore over an etcd client.
+type Store struct {
+	client *clientv3.Client
+}
+
+// NewStore returns a Store over client. Closing the client is left to the
+// caller.
+func NewStore(client *clientv3.Client) *Store {
+	return &Store{
+		client: client,
+	}
+}
+
+// NewSignal returns a transportc.KVSignal storing its state in etcd under
+// prefix, see transportc.NewKVSignal.
+func NewSignal(client *clientv3.Client, prefix string, ttl time.Duration) *transportc.KVSignal {
+	return transportc.NewKVSignal(NewStore(client), prefix, ttl)
+}
+
+// Create implements transportc.KVStore.Create.
+// It puts the key with a new lease of ttl, if the key was never created.
+func (s *Store) Create(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	seconds := int64((ttl + time.Second - 1) / time.Second) // leases are in seconds, rounded up
+	lease, err := s.client.Grant(ctx, seconds)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(value), clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		s.client.Revoke(ctx, lease.ID) // the key is not attached to it
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return transportc.ErrKVKeyExists
+	}
+	return nil
+}
+
+// Take implements transportc.KVStore.Take.
+// It deletes the key, returning the value it had.
+func (s *Store) Take(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.client.Delete(ctx, key, clientv3.WithPrevKV())
+	if err != nil {
+		return nil, err
+	}
+	if resp.Deleted == 0 || len(resp.PrevKvs) == 0 {
+		return nil, transportc.ErrKVKeyNotFound
+	}
+	return resp.PrevKvs[0].Value, nil
+}
+
+// Keys implements transportc.KVStore.Keys.
+// The keys are sorted by their create revision.
+func (s *Store) Keys(ctx context.Context, prefix string) ([]string, error) {
+	resp, err := s.client.Get(ctx, prefix,
+		clientv3.WithPrefix(),
+		clientv3.WithKeysOnly(),
+		clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		keys = append(keys, string(kv.Key))
+	}
+	return keys, nil
+}
+
+// Watch implements transportc.KVStore.Watch.
+// It notifies of every put under prefix.
+func (s *Store) Watch(ctx context.Context, prefix string) <-chan struct{} {
+	notify := make(chan struct{}, 1)
+	watch := s.client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithFilterDelete())
+	go func() {
+		for resp := range watch {
+			if len(resp.Events) == 0 {
+				continue
+			}
+			select {
+			case notify <- struct{}{}:
+			default: // a notification is already pending
+			}
+		}
+	}()
+	return notify
+}
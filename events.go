@@ -0,0 +1,110 @@
+package transportc
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EVENT_BUFFER_SIZE = 64
+)
+
+type TransportEventType uint8
+
+const (
+	EVENT_OFFER_RECEIVED TransportEventType = iota + 1 // Listener only
+	EVENT_PC_CREATED
+	EVENT_DC_OPENED
+	EVENT_ICE_FAILED
+	EVENT_CONN_CLOSED
+	EVENT_DIAL_FAILED   // Dialer only, see Dialer.DialPersistent
+	EVENT_ICE_RESTARTED // see Dialer.Resume
+	EVENT_ACCEPT_FAILED // Listener only, see AcceptError
+	EVENT_PC_IDLE       // Dialer only, see Config.DialerIdlePeerConnectionTimeout
+)
+
+func (t TransportEventType) String() string {
+	switch t {
+	case EVENT_OFFER_RECEIVED:
+		return "OfferReceived"
+	case EVENT_PC_CREATED:
+		return "PCCreated"
+	case EVENT_DC_OPENED:
+		return "DCOpened"
+	case EVENT_ICE_FAILED:
+		return "ICEFailed"
+	case EVENT_CONN_CLOSED:
+		return "ConnClosed"
+	case EVENT_DIAL_FAILED:
+		return "DialFailed"
+	case EVENT_ICE_RESTARTED:
+		return "ICERestarted"
+	case EVENT_ACCEPT_FAILED:
+		return "AcceptFailed"
+	case EVENT_PC_IDLE:
+		return "PCIdle"
+	default:
+		return "Unknown"
+	}
+}
+
+// TransportEvent is emitted by a Listener or Dialer as it establishes and
+// tears down PeerConnections and Conns.
+type TransportEvent struct {
+	Type TransportEventType
+	Time time.Time
+
+	// PeerID is the ID of the PeerConnection in the Listener, see Conn.PeerID.
+	// Always 0 on the Dialer.
+	PeerID uint64
+
+	// OfferID is the ID of the offer the PeerConnection is created from, as
+	// returned by Signal.ReadOffer. Always 0 on the Dialer.
+	OfferID uint64
+
+	// Label is the label of the DataChannel, for EVENT_DC_OPENED,
+	// EVENT_CONN_CLOSED and EVENT_DIAL_FAILED.
+	Label string
+
+	// Attempt is the number of the failed attempt, starting from 1, and Err
+	// is the error it failed with, for EVENT_DIAL_FAILED.
+	Attempt int
+
+	// Err is the error of EVENT_DIAL_FAILED, or the *AcceptError of
+	// EVENT_ACCEPT_FAILED.
+	Err error
+}
+
+// eventBus delivers TransportEvents without blocking the emitter. Events are
+// discarded until the first subscription, and dropped if the buffer is full.
+// emit is safe to call on a nil eventBus.
+type eventBus struct {
+	events     chan TransportEvent
+	subscribed atomic.Bool
+	dropped    atomic.Uint64
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		events: make(chan TransportEvent, EVENT_BUFFER_SIZE),
+	}
+}
+
+// subscribe enables the eventBus and returns the channel of events.
+func (b *eventBus) subscribe() <-chan TransportEvent {
+	b.subscribed.Store(true)
+	return b.events
+}
+
+func (b *eventBus) emit(event TransportEvent) {
+	if b == nil || !b.subscribed.Load() {
+		return
+	}
+
+	event.Time = time.Now()
+	select {
+	case b.events <- event:
+	default:
+		b.dropped.Add(1)
+	}
+}
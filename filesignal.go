@@ -0,0 +1,233 @@
+package transportc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FILE_SIGNAL_DEFAULT_TTL = time.Minute
+
+	fileSignalOfferPrefix  = "offer-"
+	fileSignalAnswerPrefix = "answer-"
+	fileSignalTempPrefix   = ".tmp-"
+)
+
+// FileSignal implements Signal by persisting the offers and answers as files
+// in a local directory, so the signaling state survives process restarts in
+// single-node deployments, e.g., a Dialer and a Listener in two processes on
+// the same host.
+//
+// Every file is written to a temporary file first and then linked into place,
+// so a partially written offer or answer is never read. Each offer is claimed
+// by a single ReadOffer, even across processes. Offers and answers older than
+// the TTL are discarded.
+//
+// ReadAnswer does not block, it returns ErrAnswerNotReady instead.
+//
+// FileSignal implements OfferExpirySignal, so the Listener does not accept an
+// offer past its TTL.
+type FileSignal struct {
+	dir string
+	ttl time.Duration
+
+	expiryMutex sync.Mutex
+	expiries    map[uint64]time.Time // offers read, by offerID
+}
+
+// NewFileSignal creates a FileSignal storing its state in dir, which is
+// created if it does not exist. If ttl is zero, FILE_SIGNAL_DEFAULT_TTL is used.
+func NewFileSignal(dir string, ttl time.Duration) (*FileSignal, error) {
+	if ttl == 0 {
+		ttl = FILE_SIGNAL_DEFAULT_TTL
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("filesignal: %w", err)
+	}
+
+	return &FileSignal{
+		dir:      dir,
+		ttl:      ttl,
+		expiries: make(map[uint64]time.Time),
+	}, nil
+}
+
+// Offer implements Signal.Offer.
+// It persists the offer under a new random offerID.
+func (fs *FileSignal) Offer(offer []byte) (uint64, error) {
+	for {
+		id := randomUint64()
+		err := fs.write(fs.path(fileSignalOfferPrefix, id), offer)
+		if errors.Is(err, os.ErrExist) {
+			continue // offerID already used
+		}
+		if err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+}
+
+// ReadOffer implements Signal.ReadOffer.
+// It claims the oldest offer not expired, or returns ErrOfferNotReady if
+// there is none.
+func (fs *FileSignal) ReadOffer() (uint64, []byte, error) {
+	entries, err := fs.entries()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, entry := range entries {
+		id, ok := parseFileSignalName(entry.Name(), fileSignalOfferPrefix)
+		if !ok {
+			continue
+		}
+
+		// claim the offer by renaming it, which only one reader can do
+		path := filepath.Join(fs.dir, entry.Name())
+		claimed := filepath.Join(fs.dir, fileSignalTempPrefix+entry.Name())
+		if err := os.Rename(path, claimed); err != nil {
+			continue // claimed by another reader
+		}
+
+		offer, err := os.ReadFile(claimed)
+		os.Remove(claimed)
+		if err != nil {
+			return 0, nil, fmt.Errorf("filesignal: %w", err)
+		}
+
+		fs.expiryMutex.Lock()
+		for offerID, expiry := range fs.expiries {
+			if time.Now().After(expiry) {
+				delete(fs.expiries, offerID) // never looked up
+			}
+		}
+		fs.expiries[id] = entry.ModTime().Add(fs.ttl)
+		fs.expiryMutex.Unlock()
+		return id, offer, nil
+	}
+	return 0, nil, ErrOfferNotReady
+}
+
+// OfferExpiry implements OfferExpirySignal.OfferExpiry.
+// An offer expires once it is older than the TTL.
+func (fs *FileSignal) OfferExpiry(offerID uint64) time.Time {
+	fs.expiryMutex.Lock()
+	defer fs.expiryMutex.Unlock()
+
+	expiry := fs.expiries[offerID]
+	delete(fs.expiries, offerID)
+	return expiry
+}
+
+// Answer implements Signal.Answer.
+// It persists the answer to be read by ReadAnswer with the same offerID.
+func (fs *FileSignal) Answer(offerID uint64, answer []byte) error {
+	err := fs.write(fs.path(fileSignalAnswerPrefix, offerID), answer)
+	if errors.Is(err, os.ErrExist) {
+		return ErrInvalidOfferID // offerID already answered
+	}
+	return err
+}
+
+// ReadAnswer implements Signal.ReadAnswer.
+// It reads and removes the answer associated with the offerID.
+func (fs *FileSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	path := fs.path(fileSignalAnswerPrefix, offerID)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrAnswerNotReady
+	} else if err != nil {
+		return nil, fmt.Errorf("filesignal: %w", err)
+	}
+
+	if fs.expired(info) {
+		os.Remove(path)
+		return nil, ErrInvalidOfferID
+	}
+
+	answer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("filesignal: %w", err)
+	}
+	os.Remove(path) // so it can't be used again
+	return answer, nil
+}
+
+func (fs *FileSignal) path(prefix string, id uint64) string {
+	return filepath.Join(fs.dir, prefix+strconv.FormatUint(id, 16))
+}
+
+// write persists data to path, failing with an error wrapping os.ErrExist if
+// path already exists.
+func (fs *FileSignal) write(path string, data []byte) error {
+	f, err := os.CreateTemp(fs.dir, fileSignalTempPrefix)
+	if err != nil {
+		return fmt.Errorf("filesignal: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("filesignal: %w", err)
+	}
+
+	if err := os.Link(f.Name(), path); err != nil {
+		return fmt.Errorf("filesignal: %w", err)
+	}
+	return nil
+}
+
+// entries returns the files in the directory not expired, oldest first, and
+// removes the expired ones.
+func (fs *FileSignal) entries() ([]os.FileInfo, error) {
+	dirEntries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, fmt.Errorf("filesignal: %w", err)
+	}
+
+	infos := make([]os.FileInfo, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue // removed meanwhile
+		}
+		if fs.expired(info) {
+			os.Remove(filepath.Join(fs.dir, info.Name()))
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	return infos, nil
+}
+
+func (fs *FileSignal) expired(info os.FileInfo) bool {
+	return time.Since(info.ModTime()) > fs.ttl
+}
+
+// parseFileSignalName returns the ID in the name of a file with prefix.
+func parseFileSignalName(name, prefix string) (uint64, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(name, prefix), 16, 64)
+	return id, err == nil
+}
@@ -0,0 +1,46 @@
+package transportc
+
+import (
+	"context"
+	"time"
+)
+
+// waitForGathering blocks until the ICE gathering is complete or ctx is done.
+//
+// If timeout is non-zero, it returns ErrGatherTimeout once timeout elapses so
+// the caller may proceed with whatever candidates have been gathered so far.
+func waitForGathering(ctx context.Context, gatherComplete <-chan struct{}, timeout time.Duration) error {
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := currentClock().NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-gatherComplete:
+		return nil
+	case <-timeoutChan:
+		return ErrGatherTimeout
+	}
+}
+
+// runContext runs f in a goroutine and returns its error, or the error of ctx
+// once done. As f may keep running after ctx is done, it SHOULD return early
+// once ctx is done, and the caller MUST NOT use anything written by f unless
+// runContext returns nil.
+func runContext(ctx context.Context, f func() error) error {
+	errChan := make(chan error, 1) // f never blocks once the caller returned
+	go func() {
+		errChan <- f()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errChan:
+		return err
+	}
+}
@@ -3,29 +3,45 @@ module github.com/gaukas/transportc
 go 1.19
 
 require (
+	github.com/flynn/noise v1.0.0
 	github.com/gaukas/logging v0.0.2
 	github.com/pion/datachannel v1.5.5
 	github.com/pion/ice/v2 v2.2.12
+	github.com/pion/logging v0.2.2
+	github.com/pion/sdp/v3 v3.0.6
+	github.com/pion/transport v0.14.1
+	github.com/pion/turn/v2 v2.0.9
 	github.com/pion/webrtc/v3 v3.1.50
+	go.etcd.io/etcd/client/v3 v3.5.6
+	golang.org/x/crypto v0.4.0
+	golang.org/x/net v0.4.0
+	golang.zx2c4.com/wireguard v0.0.0-20220920152132-bb719d3a6e2c
+	google.golang.org/grpc v1.51.0
 )
 
 require (
+	github.com/coreos/go-semver v0.3.0 // indirect
+	github.com/coreos/go-systemd/v22 v22.3.2 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/pion/dtls/v2 v2.1.5 // indirect
 	github.com/pion/interceptor v0.1.12 // indirect
-	github.com/pion/logging v0.2.2 // indirect
 	github.com/pion/mdns v0.0.5 // indirect
 	github.com/pion/randutil v0.1.0 // indirect
 	github.com/pion/rtcp v1.2.10 // indirect
 	github.com/pion/rtp v1.7.13 // indirect
 	github.com/pion/sctp v1.8.5 // indirect
-	github.com/pion/sdp/v3 v3.0.6 // indirect
 	github.com/pion/srtp/v2 v2.0.10 // indirect
 	github.com/pion/stun v0.3.5 // indirect
-	github.com/pion/transport v0.14.1 // indirect
-	github.com/pion/turn/v2 v2.0.9 // indirect
 	github.com/pion/udp v0.1.1 // indirect
-	golang.org/x/crypto v0.4.0 // indirect
-	golang.org/x/net v0.4.0 // indirect
+	go.etcd.io/etcd/api/v3 v3.5.6 // indirect
+	go.etcd.io/etcd/client/pkg/v3 v3.5.6 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/multierr v1.6.0 // indirect
+	go.uber.org/zap v1.17.0 // indirect
 	golang.org/x/sys v0.3.0 // indirect
+	golang.org/x/text v0.5.0 // indirect
+	google.golang.org/genproto v0.0.0-20210602131652-f16073e35f0c // indirect
+	google.golang.org/protobuf v1.27.1 // indirect
 )
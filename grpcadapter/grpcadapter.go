@@ -0,0 +1,40 @@
+// Package grpcadapter runs gRPC over DataChannels, with a transportc.Dialer
+// on the client side and a transportc.Listener on the server side.
+//
+// Conns are idle-closed after transportc.Config.Timeout without any write.
+// To keep an idle gRPC connection alive, set keepalive.ClientParameters.Time
+// shorter than the Timeout of both peers and permit it on the server with a
+// matching keepalive.EnforcementPolicy.
+package grpcadapter
+
+import (
+	"context"
+	"net"
+
+	"github.com/gaukas/transportc"
+	"google.golang.org/grpc"
+)
+
+// DialOption returns a grpc.DialOption dialing every gRPC connection as a
+// DataChannel with the Dialer and opts. The target address of the connection
+// is encoded into the label of the DataChannel, see transportc.ProxyLabel.
+//
+// DataChannels are already encrypted by DTLS, so it is typically combined with
+// grpc.WithTransportCredentials(insecure.NewCredentials()).
+func DialOption(d *transportc.Dialer, opts ...transportc.DialOption) grpc.DialOption {
+	proxyDialer := d.ProxyDialer(opts...)
+	return grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := proxyDialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return transportc.NewStreamConn(conn), nil
+	})
+}
+
+// Listener wraps the Listener to be served by grpc.Server.Serve.
+//
+// Closing the returned net.Listener closes the Listener.
+func Listener(l *transportc.Listener) net.Listener {
+	return transportc.NewStreamListener(l)
+}
@@ -0,0 +1,119 @@
+package transportc
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ConnReader is the read half of a Conn, see Conn.Reader.
+type ConnReader struct {
+	conn      *Conn
+	deadline  *ioDeadline
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// ConnWriter is the write half of a Conn, see Conn.Writer.
+type ConnWriter struct {
+	conn      *Conn
+	deadline  *ioDeadline
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (c *Conn) initHalves() {
+	c.halvesOnce.Do(func() {
+		c.reader = &ConnReader{
+			conn:     c,
+			deadline: newIODeadline(),
+			closed:   make(chan struct{}),
+		}
+		c.writer = &ConnWriter{
+			conn:     c,
+			deadline: newIODeadline(),
+			closed:   make(chan struct{}),
+		}
+	})
+}
+
+// Reader returns the read half of the Conn, which can be handed to another
+// goroutine or library than the write half, similar to the halves of a
+// TCP connection. Its deadline is independent of the Conn and the write half.
+//
+// Closing the read half does not affect writing. The Conn is closed once both
+// halves are closed. Every call returns the same ConnReader.
+func (c *Conn) Reader() *ConnReader {
+	c.initHalves()
+	return c.reader
+}
+
+// Writer returns the write half of the Conn, see Reader.
+func (c *Conn) Writer() *ConnWriter {
+	c.initHalves()
+	return c.writer
+}
+
+// closeHalf closes the Conn once both halves are closed.
+func (c *Conn) closeHalf() error {
+	if c.halvesOpen.Add(-1) == 0 {
+		return c.Close()
+	}
+	return nil
+}
+
+// Read reads the next message, as Conn.Read does. It fails with net.ErrClosed
+// after the read half is closed.
+func (r *ConnReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	return r.conn.read(p, r.deadline, r.closed)
+}
+
+// SetReadDeadline sets the deadline for future and pending Read calls on the
+// read half only.
+func (r *ConnReader) SetReadDeadline(t time.Time) error {
+	r.deadline.Set(t)
+	return nil
+}
+
+// Close closes the read half, unblocking any pending Read on it.
+func (r *ConnReader) Close() error {
+	err := net.ErrClosed
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		err = r.conn.closeHalf()
+	})
+	return err
+}
+
+// Write writes p, as Conn.Write does. It fails with net.ErrClosed after the
+// write half is closed.
+func (w *ConnWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	return w.conn.write(p, w.deadline)
+}
+
+// SetWriteDeadline sets the deadline for future Write calls on the write
+// half only.
+func (w *ConnWriter) SetWriteDeadline(t time.Time) error {
+	w.deadline.Set(t)
+	return nil
+}
+
+// Close closes the write half.
+func (w *ConnWriter) Close() error {
+	err := net.ErrClosed
+	w.closeOnce.Do(func() {
+		close(w.closed)
+		err = w.conn.closeHalf()
+	})
+	return err
+}
@@ -0,0 +1,85 @@
+package transportc
+
+import (
+	"sync"
+	"time"
+)
+
+// HandshakeInfo describes the time spent in each stage of establishing a Conn,
+// useful for comparing STUN/TURN providers and debugging slow setups.
+type HandshakeInfo struct {
+	// SignalRTT is the time from the offer being signaled to the answer
+	// being received. Always 0 on the answering (Listener) side.
+	SignalRTT time.Duration
+
+	// ICE is the time from the ICE agent being able to start connectivity
+	// checks, i.e., both descriptions being set, to the ICE being connected.
+	ICE time.Duration
+
+	// DTLS is the time from the ICE being connected to the DTLS handshake
+	// being complete.
+	DTLS time.Duration
+
+	// Total is the time from the start of Dial (on the Dialer) or the offer
+	// being read (on the Listener) to the DataChannel being open.
+	Total time.Duration
+
+	// Reused indicates the Conn is created on a reused PeerConnection. If so,
+	// SignalRTT, ICE and DTLS are the durations measured when the PeerConnection
+	// was established.
+	Reused bool
+}
+
+// handshakeTimer records the time of each stage of establishing a PeerConnection.
+// All methods are safe to call on a nil handshakeTimer.
+type handshakeTimer struct {
+	mutex          sync.Mutex
+	offerSent      time.Time
+	answerReceived time.Time
+	iceStarted     time.Time
+	iceConnected   time.Time
+	dtlsConnected  time.Time
+}
+
+func (ht *handshakeTimer) mark(stage *time.Time) {
+	if ht == nil {
+		return
+	}
+	ht.mutex.Lock()
+	defer ht.mutex.Unlock()
+	if stage.IsZero() {
+		*stage = currentClock().Now()
+	}
+}
+
+func (ht *handshakeTimer) markOfferSent()      { ht.mark(&ht.offerSent) }
+func (ht *handshakeTimer) markAnswerReceived() { ht.mark(&ht.answerReceived) }
+func (ht *handshakeTimer) markICEStarted()     { ht.mark(&ht.iceStarted) }
+func (ht *handshakeTimer) markICEConnected()   { ht.mark(&ht.iceConnected) }
+func (ht *handshakeTimer) markDTLSConnected()  { ht.mark(&ht.dtlsConnected) }
+
+// info builds the HandshakeInfo of a Conn which started establishing at start.
+func (ht *handshakeTimer) info(start time.Time, reused bool) HandshakeInfo {
+	info := HandshakeInfo{
+		Total:  clockSince(start),
+		Reused: reused,
+	}
+	if ht == nil {
+		return info
+	}
+
+	ht.mutex.Lock()
+	defer ht.mutex.Unlock()
+	info.SignalRTT = sinceIfBoth(ht.offerSent, ht.answerReceived)
+	info.ICE = sinceIfBoth(ht.iceStarted, ht.iceConnected)
+	info.DTLS = sinceIfBoth(ht.iceConnected, ht.dtlsConnected)
+	return info
+}
+
+// sinceIfBoth returns end - start if both are set, or 0 otherwise.
+func sinceIfBoth(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,100 @@
+package transportc
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ListenerHealth is a snapshot of the state of a Listener, suitable for
+// health-check and readiness probes.
+type ListenerHealth struct {
+	// Status is one of "new", "running", "suspended" and "stopped".
+	Status string `json:"status"`
+
+	// ActivePeerConnections is the number of PeerConnections maintained.
+	ActivePeerConnections int `json:"active_peer_connections"`
+
+	// AcceptBacklog is the number of Conns established but not yet Accepted.
+	AcceptBacklog int64 `json:"accept_backlog"`
+
+	// Overloaded reports whether the Listener stopped reading offers, as
+	// Config.ListenerMaxAcceptBacklog or Config.ListenerMaxPeerConnections
+	// is reached.
+	Overloaded bool `json:"overloaded"`
+
+	// RecoveredPanics is the number of panics recovered while handling peers.
+	// Each of them tore down only the PeerConnection of the offending peer.
+	RecoveredPanics uint64 `json:"recovered_panics"`
+
+	// DroppedEvents is the number of TransportEvents dropped as the channel
+	// returned by Events was full.
+	DroppedEvents uint64 `json:"dropped_events"`
+
+	// LastSignalError is the latest error returned by the Signal, if any.
+	LastSignalError     string    `json:"last_signal_error,omitempty"`
+	LastSignalErrorTime time.Time `json:"last_signal_error_time,omitempty"`
+}
+
+// Healthz returns the current ListenerHealth of the Listener.
+func (l *Listener) Healthz() ListenerHealth {
+	health := ListenerHealth{
+		Status:          listenerStatusString(atomic.LoadUint32(&l.runningStatus)),
+		AcceptBacklog:   int64(l.acceptQueue.len()),
+		RecoveredPanics: l.panics.Load(),
+		DroppedEvents:   l.events.dropped.Load(),
+		Overloaded:      l.overloaded(),
+	}
+
+	health.ActivePeerConnections = l.peers.len()
+
+	l.signalErrMutex.Lock()
+	if l.lastSignalErr != nil {
+		health.LastSignalError = l.lastSignalErr.Error()
+		health.LastSignalErrorTime = l.lastSignalErrTime
+	}
+	l.signalErrMutex.Unlock()
+
+	return health
+}
+
+// HealthzHandler returns an http.Handler serving the ListenerHealth as JSON.
+// It responds with 200 OK if the Listener is running, or 503 Service Unavailable
+// otherwise, so it can be used as both liveness and readiness probe.
+func (l *Listener) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		health := l.Healthz()
+
+		w.Header().Set("Content-Type", "application/json")
+		if health.Status == "running" {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health) // skipcq: GO-S1040
+	})
+}
+
+// setSignalErr records err as the latest error returned by the Signal.
+func (l *Listener) setSignalErr(err error) {
+	l.signalErrMutex.Lock()
+	defer l.signalErrMutex.Unlock()
+	l.lastSignalErr = err
+	l.lastSignalErrTime = time.Now()
+}
+
+func listenerStatusString(status ListenerRunningStatus) string {
+	switch status {
+	case LISTENER_NEW:
+		return "new"
+	case LISTENER_RUNNING:
+		return "running"
+	case LISTENER_SUSPENDED:
+		return "suspended"
+	case LISTENER_STOPPED:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,57 @@
+package transportc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ServeHTTP serves HTTP requests on the Conns accepted from the Listener with
+// handler. Both HTTP/1.1 and HTTP/2 over cleartext (h2c) are supported.
+//
+// ServeHTTP blocks until the Listener is closed.
+func ServeHTTP(l *Listener, handler http.Handler) error {
+	server := &http.Server{
+		Handler: h2c.NewHandler(handler, &http2.Server{}),
+	}
+	return server.Serve(NewStreamListener(l))
+}
+
+// HTTPTransport returns an http.Transport sending HTTP/1.1 requests over
+// DataChannels dialed by the Dialer, to be served by ServeHTTP.
+//
+// The network and address of every request are encoded into the label of
+// the DataChannel, see ProxyLabel.
+func (d *Dialer) HTTPTransport(opts ...DialOption) *http.Transport {
+	return &http.Transport{
+		DialContext: d.streamDialContext(opts),
+	}
+}
+
+// H2CTransport returns an http2.Transport sending HTTP/2 requests over
+// cleartext (h2c) over DataChannels dialed by the Dialer, to be served by
+// ServeHTTP. The URL of requests MUST use the http scheme.
+func (d *Dialer) H2CTransport(opts ...DialOption) *http2.Transport {
+	dialContext := d.streamDialContext(opts)
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialContext(ctx, network, addr)
+		},
+	}
+}
+
+func (d *Dialer) streamDialContext(opts []DialOption) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxyDialer := d.ProxyDialer(opts...)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := proxyDialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return NewStreamConn(conn), nil
+	}
+}
@@ -0,0 +1,410 @@
+package transportc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HTTP_SIGNAL_ANSWER_TIMEOUT = 30 * time.Second // how long HTTPSignalHandler holds a request waiting for the answer
+	HTTP_SIGNAL_POLL_INTERVAL  = time.Second      // how long HTTPSignalHandler.ReadOffer blocks without an offer
+	HTTP_SIGNAL_MAX_BODY_SIZE  = 64 * 1024        // max size of an offer or answer
+
+	httpSignalAMPPreOpen  = "<pre>"
+	httpSignalAMPPreClose = "</pre>"
+)
+
+var (
+	// ErrSignalDirection is returned by a Signal used in the direction it
+	// does not support, e.g., HTTPSignal by a Listener.
+	ErrSignalDirection = errors.New("signaling direction unsupported")
+)
+
+// HTTPSignalOption configures an HTTPSignal.
+type HTTPSignalOption func(*HTTPSignal)
+
+// WithDomainFront sends the requests of the HTTPSignal to front, e.g., a CDN
+// edge also serving an innocuous domain, with the host of the broker only in
+// the Host header, inside TLS. The CDN forwards them to the broker.
+func WithDomainFront(front string) HTTPSignalOption {
+	return func(s *HTTPSignal) {
+		s.front = front
+	}
+}
+
+// WithAMPCache sends the requests of the HTTPSignal through the AMP cache at
+// cacheURL, e.g., https://cdn.ampproject.org/, which fetches and relays the
+// answer of the broker. The offer is encoded in the path of a GET request, as
+// AMP caches forward no body, and the answer is armored in an AMP document.
+// May be combined with WithDomainFront to front the AMP cache.
+func WithAMPCache(cacheURL string) HTTPSignalOption {
+	return func(s *HTTPSignal) {
+		s.ampCache = cacheURL
+	}
+}
+
+// WithHTTPClient sends the requests of the HTTPSignal with client instead of
+// http.DefaultClient.
+func WithHTTPClient(client *http.Client) HTTPSignalOption {
+	return func(s *HTTPSignal) {
+		s.client = client
+	}
+}
+
+// HTTPSignal implements Signal for a Dialer by sending each offer in an HTTPS
+// request to a broker, e.g., an HTTPSignalHandler, and receiving the answer
+// in the response body. The request may be domain-fronted or relayed by an
+// AMP cache, a rendezvous proven in censored networks.
+//
+// Offer sends the request in the background and ReadAnswer does not block, it
+// returns ErrAnswerNotReady until the response is received. ReadOffer and
+// Answer fail with ErrSignalDirection.
+type HTTPSignal struct {
+	broker   *url.URL
+	front    string
+	ampCache string
+	client   *http.Client
+
+	mutex   sync.Mutex
+	answers map[uint64]*httpSignalAnswer // pending offers, by offerID
+}
+
+type httpSignalAnswer struct {
+	done   chan struct{} // closed once body or err is set
+	body   []byte
+	err    error
+	cancel context.CancelFunc
+}
+
+// NewHTTPSignal creates an HTTPSignal sending offers to the broker at
+// brokerURL.
+func NewHTTPSignal(brokerURL string, opts ...HTTPSignalOption) (*HTTPSignal, error) {
+	broker, err := url.Parse(brokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("httpsignal: %w", err)
+	}
+	s := &HTTPSignal{
+		broker:  broker,
+		client:  http.DefaultClient,
+		answers: make(map[uint64]*httpSignalAnswer),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Offer implements Signal.Offer.
+func (s *HTTPSignal) Offer(offer []byte) (uint64, error) {
+	req, err := s.newRequest(offer)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), HTTP_SIGNAL_ANSWER_TIMEOUT)
+	answer := &httpSignalAnswer{done: make(chan struct{}), cancel: cancel}
+	offerID := randomUint64()
+	s.mutex.Lock()
+	s.answers[offerID] = answer
+	s.mutex.Unlock()
+
+	go func() {
+		defer cancel()
+		answer.body, answer.err = s.roundTrip(req.WithContext(ctx))
+		close(answer.done)
+	}()
+	return offerID, nil
+}
+
+// ReadAnswer implements Signal.ReadAnswer.
+func (s *HTTPSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	answer, ok := s.answers[offerID]
+	if !ok {
+		return nil, ErrInvalidOfferID
+	}
+	select {
+	case <-answer.done:
+	default:
+		return nil, ErrAnswerNotReady
+	}
+	delete(s.answers, offerID)
+	if answer.err != nil {
+		return nil, fmt.Errorf("httpsignal: %w", answer.err)
+	}
+	return answer.body, nil
+}
+
+// ReadOffer implements Signal.ReadOffer. It always fails with
+// ErrSignalDirection.
+func (*HTTPSignal) ReadOffer() (uint64, []byte, error) {
+	return 0, nil, ErrSignalDirection
+}
+
+// Answer implements Signal.Answer. It always fails with ErrSignalDirection.
+func (*HTTPSignal) Answer(uint64, []byte) error {
+	return ErrSignalDirection
+}
+
+// Close cancels the requests of the offers whose answer is not read.
+func (s *HTTPSignal) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for offerID, answer := range s.answers {
+		answer.cancel()
+		delete(s.answers, offerID)
+	}
+	return nil
+}
+
+// newRequest creates the request carrying offer, as a POST to the broker, or
+// a GET to the AMP cache.
+func (s *HTTPSignal) newRequest(offer []byte) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	if s.ampCache != "" {
+		var ampURL string
+		ampURL, err = ampCacheURL(s.ampCache, s.broker, offer)
+		if err != nil {
+			return nil, fmt.Errorf("httpsignal: %w", err)
+		}
+		req, err = http.NewRequest(http.MethodGet, ampURL, nil)
+	} else {
+		req, err = http.NewRequest(http.MethodPost, s.broker.String(), bytes.NewReader(offer))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("httpsignal: %w", err)
+	}
+
+	if s.front != "" {
+		req.Host = req.URL.Host
+		req.URL.Host = s.front
+	}
+	return req, nil
+}
+
+// roundTrip sends req and returns the answer in the response.
+func (s *HTTPSignal) roundTrip(req *http.Request) ([]byte, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, HTTP_SIGNAL_MAX_BODY_SIZE))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("broker responded %s", resp.Status)
+	}
+	if s.ampCache != "" {
+		return ampDecode(body)
+	}
+	return body, nil
+}
+
+// HTTPSignalHandler implements Signal for a Listener as an http.Handler of
+// broker requests sent by HTTPSignal, either directly, domain-fronted or via
+// an AMP cache. Each request is held until the Listener answers the offer,
+// for up to HTTP_SIGNAL_ANSWER_TIMEOUT.
+//
+// A POST carries the offer in its body, and a GET the base64url-encoded
+// offer in the last segment of its path, as relayed by an AMP cache. The
+// answer is returned as is, or armored in an AMP document respectively.
+//
+// HTTPSignalHandler implements OfferExpirySignal, so the Listener does not
+// answer an offer its request no longer waits for. Offer and ReadAnswer fail
+// with ErrSignalDirection.
+type HTTPSignalHandler struct {
+	offers chan httpSignalOffer
+
+	mutex   sync.Mutex
+	pending map[uint64]httpSignalOffer // offers read and not answered, by offerID
+}
+
+type httpSignalOffer struct {
+	id      uint64
+	body    []byte
+	expiry  time.Time
+	answers chan []byte // buffered, never blocks Answer
+}
+
+// NewHTTPSignalHandler creates an HTTPSignalHandler.
+func NewHTTPSignalHandler() *HTTPSignalHandler {
+	return &HTTPSignalHandler{
+		offers:  make(chan httpSignalOffer),
+		pending: make(map[uint64]httpSignalOffer),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *HTTPSignalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	var err error
+	amp := r.Method == http.MethodGet
+	switch r.Method {
+	case http.MethodPost:
+		body, err = io.ReadAll(io.LimitReader(r.Body, HTTP_SIGNAL_MAX_BODY_SIZE))
+	case http.MethodGet:
+		body, err = base64.RawURLEncoding.DecodeString(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil || len(body) == 0 {
+		http.Error(w, "malformed offer", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), HTTP_SIGNAL_ANSWER_TIMEOUT)
+	defer cancel()
+	expiry, _ := ctx.Deadline()
+	offer := httpSignalOffer{
+		id:      randomUint64(),
+		body:    body,
+		expiry:  expiry,
+		answers: make(chan []byte, 1),
+	}
+
+	select {
+	case h.offers <- offer:
+	case <-ctx.Done():
+		http.Error(w, "no listener available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var answer []byte
+	select {
+	case answer = <-offer.answers:
+	case <-ctx.Done():
+		h.mutex.Lock()
+		delete(h.pending, offer.id)
+		h.mutex.Unlock()
+		http.Error(w, "offer not answered", http.StatusGatewayTimeout)
+		return
+	}
+
+	if amp {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(ampEncode(answer))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(answer)
+}
+
+// ReadOffer implements Signal.ReadOffer. It blocks for up to
+// HTTP_SIGNAL_POLL_INTERVAL, then returns ErrOfferNotReady.
+func (h *HTTPSignalHandler) ReadOffer() (uint64, []byte, error) {
+	timer := time.NewTimer(HTTP_SIGNAL_POLL_INTERVAL)
+	defer timer.Stop()
+
+	select {
+	case offer := <-h.offers:
+		h.mutex.Lock()
+		h.pending[offer.id] = offer
+		h.mutex.Unlock()
+		return offer.id, offer.body, nil
+	case <-timer.C:
+		return 0, nil, ErrOfferNotReady
+	}
+}
+
+// Answer implements Signal.Answer.
+func (h *HTTPSignalHandler) Answer(offerID uint64, answer []byte) error {
+	h.mutex.Lock()
+	offer, ok := h.pending[offerID]
+	delete(h.pending, offerID)
+	h.mutex.Unlock()
+
+	if !ok {
+		return ErrInvalidOfferID
+	}
+	offer.answers <- answer
+	return nil
+}
+
+// OfferExpiry implements OfferExpirySignal.OfferExpiry.
+func (h *HTTPSignalHandler) OfferExpiry(offerID uint64) time.Time {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.pending[offerID].expiry
+}
+
+// Offer implements Signal.Offer. It always fails with ErrSignalDirection.
+func (*HTTPSignalHandler) Offer([]byte) (uint64, error) {
+	return 0, ErrSignalDirection
+}
+
+// ReadAnswer implements Signal.ReadAnswer. It always fails with
+// ErrSignalDirection.
+func (*HTTPSignalHandler) ReadAnswer(uint64) ([]byte, error) {
+	return nil, ErrSignalDirection
+}
+
+// ampCacheURL returns the URL of the AMP cache at cacheURL fetching broker
+// with offer appended to its path, e.g.,
+// https://broker-example-com.cdn.ampproject.org/c/s/broker.example.com/amp/<offer>.
+func ampCacheURL(cacheURL string, broker *url.URL, offer []byte) (string, error) {
+	cache, err := url.Parse(cacheURL)
+	if err != nil {
+		return "", err
+	}
+	if broker.Scheme != "https" {
+		return "", fmt.Errorf("AMP cache requires an https broker, got %q", broker.Scheme)
+	}
+
+	// The subdomain of the broker on the cache, see
+	// https://developers.google.com/amp/cache/overview#amp-cache-url-format
+	subdomain := strings.ReplaceAll(broker.Hostname(), "-", "--")
+	subdomain = strings.ReplaceAll(subdomain, ".", "-")
+	cache.Host = subdomain + "." + cache.Host
+
+	cache.Path = "/c/s/" + broker.Host + strings.TrimSuffix(broker.Path, "/") + "/" + base64.RawURLEncoding.EncodeToString(offer)
+	return cache.String(), nil
+}
+
+// ampEncode armors answer in a minimal AMP document, which AMP caches relay,
+// as base64 in a pre element.
+func ampEncode(answer []byte) []byte {
+	var doc bytes.Buffer
+	doc.WriteString(`<!doctype html><html amp><head><meta charset="utf-8"><script async src="https://cdn.ampproject.org/v0.js"></script>`)
+	doc.WriteString(`<link rel="canonical" href="."><meta name="viewport" content="width=device-width">`)
+	doc.WriteString(`<style amp-boilerplate>body{visibility:hidden}</style><noscript><style amp-boilerplate>body{visibility:visible}</style></noscript></head><body>`)
+	doc.WriteString(httpSignalAMPPreOpen)
+	doc.WriteString(base64.StdEncoding.EncodeToString(answer))
+	doc.WriteString(httpSignalAMPPreClose)
+	doc.WriteString(`</body></html>`)
+	return doc.Bytes()
+}
+
+// ampDecode extracts the answer armored by ampEncode from doc.
+func ampDecode(doc []byte) ([]byte, error) {
+	start := bytes.Index(doc, []byte(httpSignalAMPPreOpen))
+	if start < 0 {
+		return nil, ErrMalformedSignal
+	}
+	armored := doc[start+len(httpSignalAMPPreOpen):]
+	end := bytes.Index(armored, []byte(httpSignalAMPPreClose))
+	if end < 0 {
+		return nil, ErrMalformedSignal
+	}
+	answer, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(armored[:end])), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedSignal, err)
+	}
+	return answer, nil
+}
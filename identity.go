@@ -0,0 +1,169 @@
+package transportc
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissingIdentity is returned when the remote peer is required to
+	// present an identity but its SDP is not signed.
+	ErrMissingIdentity = errors.New("remote SDP is not signed")
+
+	// ErrInvalidIdentity is returned when the signature of the remote SDP
+	// does not verify.
+	ErrInvalidIdentity = errors.New("remote SDP signature is invalid")
+
+	// ErrUnauthorizedPeer is returned when the remote SDP is signed by a
+	// key not in AllowedPeers.
+	ErrUnauthorizedPeer = errors.New("remote peer is not allowed")
+
+	// ErrOfferExpired is returned when a signed offer is expired, or issued
+	// in the future, beyond the tolerated clock skew, e.g., a captured offer
+	// replayed.
+	ErrOfferExpired = errors.New("signed offer expired")
+
+	// ErrMissingOfferExpiry is returned when a signed offer carries no
+	// expiry but Config.SignedOfferTTL is set on the Listener.
+	ErrMissingOfferExpiry = errors.New("signed offer has no expiry")
+)
+
+const (
+	// SIGNED_OFFER_CLOCK_SKEW_DEFAULT is the clock skew tolerated between
+	// the Dialer and the Listener unless Config.SignedOfferClockSkew is set.
+	SIGNED_OFFER_CLOCK_SKEW_DEFAULT = 30 * time.Second
+)
+
+const identityContext = "transportc identity v1"
+
+// signedEnvelope is the part of an envelope of SDP_ENVELOPE_VERSION 2 or
+// later bound by the signature besides the SDP, i.e., every field the remote
+// peer acts on.
+type signedEnvelope struct {
+	Version   uint8             `json:"v"`
+	Namespace string            `json:"ns"`
+	Restart   uint64            `json:"restart"`
+	Nonce     uint64            `json:"nonce"`
+	Trace     map[string]string `json:"trace"`
+	Label     string            `json:"label"`
+	Protocol  string            `json:"proto"`
+	Metadata  map[string]string `json:"meta"`
+	Ticket    string            `json:"tkt"`
+}
+
+// identityMessage builds the message signed by a peer's identity key.
+//
+// It binds the DTLS certificate fingerprint(s) and ICE username fragment(s)
+// in the SDP, i.e., the only values a man-in-the-middle on the signaling path
+// must replace in order to intercept the connection, and the issued-at and
+// expiry times of the envelope, if set. Since SDP_ENVELOPE_VERSION 2, the
+// other fields of the envelope are bound as well, so the signaling cannot
+// steer the offer into another namespace or forge its metadata.
+func identityMessage(envelope *sdpEnvelope) []byte {
+	msg := &bytes.Buffer{}
+	msg.WriteString(identityContext)
+	msg.WriteByte('\n')
+	msg.WriteString(envelope.Type.String())
+	for _, line := range strings.Split(envelope.SDP, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "a=fingerprint:") || strings.HasPrefix(line, "a=ice-ufrag:") {
+			msg.WriteByte('\n')
+			msg.WriteString(line)
+		}
+	}
+	if envelope.IssuedAt != 0 || envelope.Expiry != 0 { // not signed by peers predating them
+		fmt.Fprintf(msg, "\niat:%d\nexp:%d", envelope.IssuedAt, envelope.Expiry)
+	}
+	if envelope.Version >= 2 {
+		fields, _ := json.Marshal(signedEnvelope{ // maps are encoded with sorted keys
+			Version:   envelope.Version,
+			Namespace: envelope.Namespace,
+			Restart:   envelope.Restart,
+			Nonce:     envelope.Nonce,
+			Trace:     envelope.Trace,
+			Label:     envelope.Label,
+			Protocol:  envelope.Protocol,
+			Metadata:  envelope.Metadata,
+			Ticket:    envelope.Ticket,
+		})
+		msg.WriteString("\nenvelope:")
+		msg.Write(fields)
+	}
+	return msg.Bytes()
+}
+
+// signSessionDescription signs envelope with key, if set, and stores the
+// signature in envelope. If ttl is positive, the signature expires after ttl.
+// It MUST be called once all the other fields of envelope are set.
+func signSessionDescription(envelope *sdpEnvelope, key ed25519.PrivateKey, ttl time.Duration) {
+	if key == nil {
+		return
+	}
+	if ttl > 0 {
+		now := currentClock().Now()
+		envelope.IssuedAt = now.Unix()
+		envelope.Expiry = now.Add(ttl).Unix()
+	}
+	envelope.PublicKey = key.Public().(ed25519.PublicKey)
+	envelope.Signature = ed25519.Sign(key, identityMessage(envelope))
+}
+
+// verifySessionDescription verifies the signature in envelope, if any, and returns
+// the public key of the remote peer.
+//
+// If allowedPeers is not empty, the envelope MUST be signed by one of them.
+func verifySessionDescription(envelope *sdpEnvelope, allowedPeers []ed25519.PublicKey) (ed25519.PublicKey, error) {
+	if len(envelope.PublicKey) == 0 && len(envelope.Signature) == 0 {
+		if len(allowedPeers) > 0 {
+			return nil, ErrMissingIdentity
+		}
+		return nil, nil // unsigned and no identity required
+	}
+
+	if len(envelope.PublicKey) != ed25519.PublicKeySize || !ed25519.Verify(envelope.PublicKey, identityMessage(envelope), envelope.Signature) {
+		return nil, ErrInvalidIdentity
+	}
+
+	if len(allowedPeers) > 0 && !isAllowedPeer(allowedPeers, envelope.PublicKey) {
+		return nil, ErrUnauthorizedPeer
+	}
+
+	return envelope.PublicKey, nil
+}
+
+// verifyOfferExpiry checks the signed offer in envelope is neither expired
+// nor issued in the future, with skew tolerated. If required, a signed offer
+// MUST carry an expiry. Unsigned offers are not checked, as their timestamps
+// could be forged.
+func verifyOfferExpiry(envelope *sdpEnvelope, skew time.Duration, required bool) error {
+	if len(envelope.Signature) == 0 {
+		return nil
+	}
+	if envelope.Expiry == 0 {
+		if required {
+			return ErrMissingOfferExpiry
+		}
+		return nil
+	}
+
+	now := currentClock().Now()
+	if now.After(time.Unix(envelope.Expiry, 0).Add(skew)) || now.Add(skew).Before(time.Unix(envelope.IssuedAt, 0)) {
+		return ErrOfferExpired
+	}
+	return nil
+}
+
+// isAllowedPeer returns true if identity is one of allowedPeers.
+func isAllowedPeer(allowedPeers []ed25519.PublicKey, identity ed25519.PublicKey) bool {
+	for _, peer := range allowedPeers {
+		if peer.Equal(identity) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package transportc
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	IN_PROCESS_SIGNAL_OFFER_BUFFER  = 64
+	IN_PROCESS_SIGNAL_POLL_INTERVAL = time.Second
+)
+
+// InProcessSignal implements Signal between two peers in the same process,
+// e.g., in tests or local loopback tunnels. The offers and answers are passed
+// to the linked InProcessSignal as is, skipping the serialization entirely
+// when used by a Dialer and a Listener directly, i.e., not wrapped by a
+// SignalMiddleware.
+//
+// Offers submitted to one InProcessSignal of a pair are read from the other,
+// and vice versa, so each end may run Dialers and Listeners.
+type InProcessSignal struct {
+	peer *InProcessSignal
+
+	offers chan inProcessOffer // offers submitted to peer
+
+	answerMutex sync.Mutex
+	answers     map[uint64]chan signalMessage // pending offers, by offerID
+}
+
+type inProcessOffer struct {
+	id    uint64
+	offer signalMessage
+}
+
+// NewInProcessSignalPair creates two linked InProcessSignals, e.g., one for
+// the Dialer (offerer) and the other for the Listener (answerer).
+func NewInProcessSignalPair() (offerer, answerer *InProcessSignal) {
+	offerer = &InProcessSignal{
+		offers:  make(chan inProcessOffer, IN_PROCESS_SIGNAL_OFFER_BUFFER),
+		answers: make(map[uint64]chan signalMessage),
+	}
+	answerer = &InProcessSignal{
+		offers:  make(chan inProcessOffer, IN_PROCESS_SIGNAL_OFFER_BUFFER),
+		answers: make(map[uint64]chan signalMessage),
+	}
+	offerer.peer, answerer.peer = answerer, offerer
+	return offerer, answerer
+}
+
+// Offer implements Signal.Offer.
+// It submits the offer to the linked InProcessSignal.
+func (ips *InProcessSignal) Offer(offer []byte) (uint64, error) {
+	return ips.offerEnvelope(signalMessage{raw: offer})
+}
+
+// ReadOffer implements Signal.ReadOffer.
+// It blocks for up to IN_PROCESS_SIGNAL_POLL_INTERVAL before returning ErrOfferNotReady.
+func (ips *InProcessSignal) ReadOffer() (uint64, []byte, error) {
+	offerID, offer, err := ips.readOfferEnvelope()
+	if err != nil {
+		return 0, nil, err
+	}
+	offerBytes, err := offer.bytes()
+	if err != nil {
+		return 0, nil, err
+	}
+	return offerID, offerBytes, nil
+}
+
+// Answer implements Signal.Answer.
+// It submits the answer to the linked InProcessSignal.
+func (ips *InProcessSignal) Answer(offerID uint64, answer []byte) error {
+	return ips.answerEnvelope(offerID, signalMessage{raw: answer})
+}
+
+// ReadAnswer implements Signal.ReadAnswer.
+// It blocks until the answer associated with the offerID is submitted.
+func (ips *InProcessSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	answer, err := ips.readAnswerEnvelope(offerID)
+	if err != nil {
+		return nil, err
+	}
+	return answer.bytes()
+}
+
+func (ips *InProcessSignal) offerEnvelope(offer signalMessage) (uint64, error) {
+	answerChan := make(chan signalMessage, 1)
+
+	ips.answerMutex.Lock()
+	var id uint64
+	for {
+		id = randomUint64()
+		if _, ok := ips.answers[id]; !ok { // not found
+			break // okay to use this ID
+		}
+	}
+	ips.answers[id] = answerChan
+	ips.answerMutex.Unlock()
+
+	ips.peer.offers <- inProcessOffer{
+		id:    id,
+		offer: offer,
+	}
+	return id, nil
+}
+
+func (ips *InProcessSignal) readOfferEnvelope() (uint64, signalMessage, error) {
+	select {
+	case offer := <-ips.offers:
+		return offer.id, offer.offer, nil
+	case <-time.After(IN_PROCESS_SIGNAL_POLL_INTERVAL):
+		return 0, signalMessage{}, ErrOfferNotReady
+	}
+}
+
+func (ips *InProcessSignal) answerEnvelope(offerID uint64, answer signalMessage) error {
+	ips.peer.answerMutex.Lock()
+	answerChan, ok := ips.peer.answers[offerID]
+	ips.peer.answerMutex.Unlock()
+	if !ok {
+		return ErrInvalidOfferID
+	}
+
+	select {
+	case answerChan <- answer:
+		return nil
+	default:
+		return ErrInvalidOfferID // offerID already answered
+	}
+}
+
+func (ips *InProcessSignal) readAnswerEnvelope(offerID uint64) (signalMessage, error) {
+	ips.answerMutex.Lock()
+	answerChan, ok := ips.answers[offerID]
+	ips.answerMutex.Unlock()
+	if !ok {
+		return signalMessage{}, ErrInvalidOfferID
+	}
+
+	answer := <-answerChan
+	ips.answerMutex.Lock()
+	delete(ips.answers, offerID)
+	ips.answerMutex.Unlock()
+	return answer, nil
+}
@@ -0,0 +1,47 @@
+// Package broker implements transportc.SignalSession over a TCP connection
+// to a signaling broker, shared by the commands.
+package broker
+
+import (
+	"bufio"
+	"net"
+)
+
+// TCPSession implements transportc.SignalSession over a TCP connection to
+// the broker, with one message per line.
+type TCPSession struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Dial connects to the broker.
+func Dial(broker string) (*TCPSession, error) {
+	conn, err := net.Dial("tcp", broker)
+	if err != nil {
+		return nil, err
+	}
+	return &TCPSession{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}, nil
+}
+
+// Send implements transportc.SignalSession.Send.
+func (s *TCPSession) Send(msg []byte) error {
+	_, err := s.conn.Write(append(msg, '\n'))
+	return err
+}
+
+// Receive implements transportc.SignalSession.Receive.
+func (s *TCPSession) Receive() ([]byte, error) {
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	return line[:len(line)-1], nil
+}
+
+// Close closes the connection to the broker.
+func (s *TCPSession) Close() error {
+	return s.conn.Close()
+}
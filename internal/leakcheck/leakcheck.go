@@ -0,0 +1,85 @@
+// Package leakcheck measures the goroutines, file descriptors and heap of the
+// process, to check that closed Conns leave nothing behind, shared by the
+// soak command and the tests.
+package leakcheck
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Snapshot is the resource usage of the process at a point in time.
+type Snapshot struct {
+	Goroutines int
+	FDs        int    // -1 if not supported on this platform
+	HeapInuse  uint64 // after a GC
+}
+
+func (s Snapshot) String() string {
+	return fmt.Sprintf("goroutines=%d fds=%d heap_inuse=%dKiB", s.Goroutines, s.FDs, s.HeapInuse/1024)
+}
+
+// Take forces a GC and returns the resource usage of the process.
+func Take() Snapshot {
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return Snapshot{
+		Goroutines: runtime.NumGoroutine(),
+		FDs:        countFDs(),
+		HeapInuse:  mem.HeapInuse,
+	}
+}
+
+// countFDs returns the number of open file descriptors, or -1 if unknown.
+func countFDs() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if entries, err := os.ReadDir(dir); err == nil {
+			return len(entries) - 1 // the descriptor of dir itself
+		}
+	}
+	return -1
+}
+
+// Leaked returns an error describing the goroutines and file descriptors of
+// s beyond those of baseline, allowing slack goroutines, or nil if none. The
+// heap is not compared, as it grows with caches unrelated to leaks.
+func (s Snapshot) Leaked(baseline Snapshot, slack int) error {
+	if s.Goroutines > baseline.Goroutines+slack {
+		return fmt.Errorf("%d goroutines leaked: %s, baseline %s", s.Goroutines-baseline.Goroutines, s, baseline)
+	}
+	if s.FDs >= 0 && baseline.FDs >= 0 && s.FDs > baseline.FDs {
+		return fmt.Errorf("%d file descriptors leaked: %s, baseline %s", s.FDs-baseline.FDs, s, baseline)
+	}
+	return nil
+}
+
+// WaitSettled takes snapshots until nothing leaked beyond baseline, as
+// closed PeerConnections release their goroutines and sockets
+// asynchronously, or timeout. It returns the last snapshot and the leak, if
+// any.
+func WaitSettled(baseline Snapshot, slack int, timeout time.Duration) (Snapshot, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		s := Take()
+		err := s.Leaked(baseline, slack)
+		if err == nil || time.Now().After(deadline) {
+			return s, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Stacks returns the stacks of all goroutines, to find those leaked.
+func Stacks() string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
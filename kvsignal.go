@@ -0,0 +1,239 @@
+package transportc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KV_SIGNAL_DEFAULT_TTL   = time.Minute
+	KV_SIGNAL_POLL_INTERVAL = time.Second
+
+	kvSignalOfferPrefix  = "offer/"
+	kvSignalAnswerPrefix = "answer/"
+)
+
+var (
+	// ErrKVKeyExists is returned by KVStore.Create when the key already exists.
+	ErrKVKeyExists = errors.New("key exists")
+
+	// ErrKVKeyNotFound is returned by KVStore.Take when the key does not exist.
+	ErrKVKeyNotFound = errors.New("key not found")
+)
+
+// KVStore defines a key-value store with watches shared by the peers, e.g.,
+// the etcd or Consul KV of an existing control plane. See package etcdsignal
+// for an implementation backed by etcd, package s3signal for object storage
+// and package pastesignal for paste services.
+type KVStore interface {
+	// Create stores value under key with a TTL, after which the key is
+	// removed. It returns ErrKVKeyExists if the key already exists.
+	Create(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Take gets and deletes the value of key atomically, so a value is taken
+	// by a single caller. It returns ErrKVKeyNotFound if the key does not
+	// exist.
+	Take(ctx context.Context, key string) ([]byte, error)
+
+	// Keys returns the keys with prefix, oldest first.
+	Keys(ctx context.Context, prefix string) ([]string, error)
+
+	// Watch returns a channel receiving a value whenever a key with prefix is
+	// created, until ctx is done. Notifications may be coalesced.
+	Watch(ctx context.Context, prefix string) <-chan struct{}
+}
+
+// KVSignal implements Signal over a KVStore, so peers inside a cluster or a
+// service mesh signal through the etcd or Consul KV already deployed, without
+// any new infrastructure.
+//
+// Offers and answers are stored under the prefix with a TTL. Each offer is
+// taken by a single ReadOffer, even across Listeners. ReadOffer and
+// ReadAnswer watch the store for up to KV_SIGNAL_POLL_INTERVAL before
+// returning ErrOfferNotReady and ErrAnswerNotReady respectively.
+//
+// KVSignal implements OfferExpirySignal, so the Listener does not accept an
+// offer past its TTL.
+type KVSignal struct {
+	store  KVStore
+	prefix string
+	ttl    time.Duration
+
+	expiryMutex sync.Mutex
+	expiries    map[uint64]time.Time // offers read, by offerID
+}
+
+// NewKVSignal creates a KVSignal storing its state in store under prefix,
+// e.g., "transportc/". If ttl is zero, KV_SIGNAL_DEFAULT_TTL is used.
+func NewKVSignal(store KVStore, prefix string, ttl time.Duration) *KVSignal {
+	if ttl == 0 {
+		ttl = KV_SIGNAL_DEFAULT_TTL
+	}
+
+	return &KVSignal{
+		store:    store,
+		prefix:   prefix,
+		ttl:      ttl,
+		expiries: make(map[uint64]time.Time),
+	}
+}
+
+// Offer implements Signal.Offer.
+// It stores the offer under a new random offerID.
+func (ks *KVSignal) Offer(offer []byte) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), KV_SIGNAL_POLL_INTERVAL)
+	defer cancel()
+
+	for {
+		id := randomUint64()
+		err := ks.create(ctx, ks.key(kvSignalOfferPrefix, id), offer)
+		if errors.Is(err, ErrKVKeyExists) {
+			continue // offerID already used
+		}
+		if err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+}
+
+// ReadOffer implements Signal.ReadOffer.
+// It takes the oldest offer not expired, or returns ErrOfferNotReady if there
+// is none within KV_SIGNAL_POLL_INTERVAL.
+func (ks *KVSignal) ReadOffer() (uint64, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), KV_SIGNAL_POLL_INTERVAL)
+	defer cancel()
+
+	prefix := ks.prefix + kvSignalOfferPrefix
+	created := ks.store.Watch(ctx, prefix) // before listing, to not miss an offer
+	for {
+		keys, err := ks.store.Keys(ctx, prefix)
+		if err != nil && ctx.Err() == nil {
+			return 0, nil, fmt.Errorf("kvsignal: %w", err)
+		}
+
+		for _, key := range keys {
+			id, err := strconv.ParseUint(strings.TrimPrefix(key, prefix), 16, 64)
+			if err != nil {
+				continue
+			}
+
+			offer, createdAt, err := ks.take(ctx, key)
+			if errors.Is(err, ErrKVKeyNotFound) {
+				continue // taken by another reader
+			} else if err != nil {
+				return 0, nil, err
+			}
+
+			expiry := createdAt.Add(ks.ttl)
+			if time.Now().After(expiry) {
+				continue
+			}
+
+			ks.expiryMutex.Lock()
+			for offerID, expiry := range ks.expiries {
+				if time.Now().After(expiry) {
+					delete(ks.expiries, offerID) // never looked up
+				}
+			}
+			ks.expiries[id] = expiry
+			ks.expiryMutex.Unlock()
+			return id, offer, nil
+		}
+
+		select {
+		case <-created:
+		case <-ctx.Done():
+			return 0, nil, ErrOfferNotReady
+		}
+	}
+}
+
+// OfferExpiry implements OfferExpirySignal.OfferExpiry.
+// An offer expires once it is older than the TTL.
+func (ks *KVSignal) OfferExpiry(offerID uint64) time.Time {
+	ks.expiryMutex.Lock()
+	defer ks.expiryMutex.Unlock()
+
+	expiry := ks.expiries[offerID]
+	delete(ks.expiries, offerID)
+	return expiry
+}
+
+// Answer implements Signal.Answer.
+// It stores the answer to be read by ReadAnswer with the same offerID.
+func (ks *KVSignal) Answer(offerID uint64, answer []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), KV_SIGNAL_POLL_INTERVAL)
+	defer cancel()
+
+	err := ks.create(ctx, ks.key(kvSignalAnswerPrefix, offerID), answer)
+	if errors.Is(err, ErrKVKeyExists) {
+		return ErrInvalidOfferID // offerID already answered
+	}
+	return err
+}
+
+// ReadAnswer implements Signal.ReadAnswer.
+// It takes the answer associated with the offerID, or returns
+// ErrAnswerNotReady if there is none within KV_SIGNAL_POLL_INTERVAL.
+func (ks *KVSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), KV_SIGNAL_POLL_INTERVAL)
+	defer cancel()
+
+	key := ks.key(kvSignalAnswerPrefix, offerID)
+	created := ks.store.Watch(ctx, key)
+	for {
+		answer, createdAt, err := ks.take(ctx, key)
+		if err == nil {
+			if time.Since(createdAt) > ks.ttl {
+				return nil, ErrInvalidOfferID
+			}
+			return answer, nil
+		} else if !errors.Is(err, ErrKVKeyNotFound) {
+			return nil, err
+		}
+
+		select {
+		case <-created:
+		case <-ctx.Done():
+			return nil, ErrAnswerNotReady
+		}
+	}
+}
+
+func (ks *KVSignal) key(prefix string, id uint64) string {
+	return ks.prefix + prefix + strconv.FormatUint(id, 16)
+}
+
+// create stores data under key, prefixed with its creation time, so the age
+// of the value is known regardless of the clock of the store.
+func (ks *KVSignal) create(ctx context.Context, key string, data []byte) error {
+	value := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(value, uint64(time.Now().UnixNano()))
+	value = append(value, data...)
+
+	if err := ks.store.Create(ctx, key, value, ks.ttl); err != nil {
+		return fmt.Errorf("kvsignal: %w", err)
+	}
+	return nil
+}
+
+// take takes the value of key, returning the data and the creation time
+// stored by create.
+func (ks *KVSignal) take(ctx context.Context, key string) ([]byte, time.Time, error) {
+	value, err := ks.store.Take(ctx, key)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("kvsignal: %w", err)
+	}
+	if len(value) < 8 {
+		return nil, time.Time{}, fmt.Errorf("kvsignal: %w", ErrMalformedSignal)
+	}
+	createdAt := time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+	return value[8:], createdAt, nil
+}
@@ -0,0 +1,320 @@
+package transportc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	RESUME_POLL_INTERVAL = 100 * time.Millisecond
+)
+
+// restartablePeer is a PeerConnection of the Listener which the Dialer may ICE
+// restart, see Config.ListenerRestartTimeout.
+type restartablePeer struct {
+	source      int               // index of the Signal the offer was read from, see Config.ListenerSignals
+	offerID     uint64            // ID of the offer the PeerConnection was created from
+	fingerprint string            // DTLS fingerprint of the remote peer
+	identity    ed25519.PublicKey // identity of the remote peer, nil if unsigned
+
+	suspensions uint32 // incremented once disconnected, guarded by the mutex of the listenerPeer
+	suspended   bool
+}
+
+// Pause quiesces the timers of the Conn while the app is in the background:
+// the Conn is not closed for being idle, see Config.Timeout, and
+// OnBandwidthEstimate skips its estimates until Resume. Read and Write are
+// not affected.
+//
+// Dialer.Pause pauses all Conns dialed.
+func (c *Conn) Pause() {
+	c.paused.Store(true)
+}
+
+// Resume resumes the timers paused by Pause. The idle timeout starts over.
+func (c *Conn) Resume() {
+	c.idle.Store(false)
+	c.paused.Store(false)
+}
+
+// Pause quiesces the Dialer while the app is in the background, e.g., upon
+// onPause on Android or sceneDidEnterBackground on iOS for gomobile-based
+// clients.
+//
+// The PeerConnection and the signaling state are kept: the PeerConnection is
+// not torn down when disconnected, no offer is pre-gathered and all Conns
+// dialed are paused, see Conn.Pause, until Resume.
+func (d *Dialer) Pause() {
+	d.paused.Store(true)
+
+	d.connsMutex.Lock()
+	defer d.connsMutex.Unlock()
+	for conn := range d.conns {
+		conn.Pause()
+	}
+}
+
+// Resume resumes the Dialer paused by Pause. The ICE of the PeerConnection
+// is restarted via the Signal, so it recovers from the network changes
+// while in the background, then all Conns dialed are resumed.
+//
+// Resume returns once the PeerConnection is connected again. If the ICE
+// restart fails or ctx is done before, the PeerConnection is closed along
+// with all its Conns, and the next Dial creates a new one.
+//
+// The Listener MUST set Config.ListenerRestartTimeout to accept ICE restarts.
+// Without a Signal, the ICE is not restarted.
+func (d *Dialer) Resume(ctx context.Context) error {
+	// The mutex is not held during the ICE restart, so neither Dials nor the
+	// idle PeerConnection reaper wait for the signaling
+	d.mutex.Lock()
+	restarting := &dialerPeer{
+		peerConnection: d.peerConnection,
+		handshake:      d.handshake,
+		offerID:        d.offerID,
+	}
+	d.mutex.Unlock()
+
+	err := d.restartICE(ctx, restarting)
+	if err != nil && restarting.peerConnection != nil {
+		restarting.peerConnection.Close()
+	}
+
+	d.mutex.Lock()
+	if d.peerConnection == restarting.peerConnection && d.peerConnection != nil {
+		if err != nil {
+			d.peerConnection = nil
+		} else {
+			d.peerIdentity = restarting.peerIdentity
+			d.offerTicket = restarting.offerTicket
+			d.issuedTicket = restarting.issuedTicket
+		}
+	}
+	d.paused.Store(false)
+	d.mutex.Unlock()
+
+	d.connsMutex.Lock()
+	for conn := range d.conns {
+		conn.Resume()
+	}
+	d.connsMutex.Unlock()
+
+	if d.pool != nil {
+		d.pool.signalRefill()
+	}
+	return err
+}
+
+// trackConn keeps track of conn until closed, so it is paused along with the
+// Dialer.
+func (d *Dialer) trackConn(conn *Conn) {
+	d.connsMutex.Lock()
+	defer d.connsMutex.Unlock()
+
+	d.conns[conn] = struct{}{}
+	if timer, ok := d.idlePCTimers[conn.peerConnection]; ok {
+		timer.Stop() // no longer idle
+		delete(d.idlePCTimers, conn.peerConnection)
+	}
+	if d.paused.Load() {
+		conn.Pause()
+	}
+}
+
+// watchIdlePeerConnection closes peerConnection once idle for
+// idlePCTimeout, i.e., without any Conn dialed on it.
+//
+// Not thread-safe. Caller MUST hold connsMutex before calling this function.
+func (d *Dialer) watchIdlePeerConnection(peerConnection *webrtc.PeerConnection) {
+	if d.idlePCTimeout <= 0 || peerConnection == nil {
+		return
+	}
+	if _, ok := d.idlePCTimers[peerConnection]; ok {
+		return
+	}
+	for conn := range d.conns {
+		if conn.peerConnection == peerConnection {
+			return
+		}
+	}
+
+	var timer Timer
+	timer = currentClock().AfterFunc(d.idlePCTimeout, func() {
+		d.reapIdlePeerConnection(peerConnection, timer)
+	})
+	d.idlePCTimers[peerConnection] = timer
+}
+
+// reapIdlePeerConnection closes peerConnection if still idle since timer was
+// set, so the next Dial negotiates a new one if it was the PeerConnection of
+// Dial.
+func (d *Dialer) reapIdlePeerConnection(peerConnection *webrtc.PeerConnection, timer Timer) {
+	d.mutex.Lock() // no Dial may create a DataChannel on peerConnection meanwhile
+	d.connsMutex.Lock()
+	idle := d.idlePCTimers[peerConnection] == timer
+	if idle {
+		delete(d.idlePCTimers, peerConnection)
+	}
+	d.connsMutex.Unlock()
+	if idle && d.peerConnection == peerConnection {
+		if d.dialing > 0 {
+			idle = false // a Dial is opening a DataChannel on it
+		} else {
+			d.peerConnection = nil
+		}
+	}
+	d.mutex.Unlock()
+
+	if idle {
+		d.logger.Debugf("dialer: closing PeerConnection idle for %v", d.idlePCTimeout)
+		peerConnection.Close()
+		d.events.emit(TransportEvent{Type: EVENT_PC_IDLE})
+	}
+}
+
+// markPeerConnectionFailed records CLOSE_REASON_PEER_CONNECTION_FAILED for
+// the Conns dialed on peerConnection, before it is closed.
+func (d *Dialer) markPeerConnectionFailed(peerConnection *webrtc.PeerConnection) {
+	d.connsMutex.Lock()
+	defer d.connsMutex.Unlock()
+
+	for conn := range d.conns {
+		if conn.peerConnection == peerConnection {
+			conn.markCloseReason(CLOSE_REASON_PEER_CONNECTION_FAILED)
+		}
+	}
+}
+
+// restartICE renegotiates the PeerConnection of p with new ICE credentials
+// and waits until it is connected again.
+//
+// Not thread-safe. p MUST NOT be shared, see Resume.
+func (d *Dialer) restartICE(ctx context.Context, p *dialerPeer) error {
+	if p.peerConnection == nil || d.signal == nil || p.offerID == 0 {
+		return nil // nothing to restart
+	}
+	if p.peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return nil // the next Dial creates a new one
+	}
+
+	if err := d.gatherOffer(ctx, p.peerConnection, &webrtc.OfferOptions{ICERestart: true}); err != nil {
+		return err
+	}
+	offerID, err := d.signalOffer(ctx, p, p.offerID)
+	if err != nil {
+		return fmt.Errorf("dialer: failed to send ICE restart offer: %w", err)
+	}
+	if err := d.setAnswer(ctx, p, offerID); err != nil {
+		return fmt.Errorf("dialer: failed to set ICE restart answer: %w", err)
+	}
+
+	ticker := currentClock().NewTicker(RESUME_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		switch p.peerConnection.ConnectionState() {
+		case webrtc.PeerConnectionStateConnected:
+			d.events.emit(TransportEvent{Type: EVENT_ICE_RESTARTED})
+			return nil
+		case webrtc.PeerConnectionStateClosed:
+			return errors.New("dialer: PeerConnection closed during ICE restart")
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("dialer: context done before ICE restarted: %w", ctx.Err())
+		case <-ticker.C():
+		}
+	}
+}
+
+// suspendPeer keeps the PeerConnection of peer of id disconnected for up to
+// restartTimeout, pausing its Conns, before tearing it down.
+func (l *Listener) suspendPeer(id uint64, peer *listenerPeer) {
+	peer.mutex.Lock()
+	restart := peer.restart
+	if restart == nil || restart.suspended {
+		peer.mutex.Unlock()
+		return
+	}
+	restart.suspended = true
+	restart.suspensions++
+	suspension := restart.suspensions
+	peer.mutex.Unlock()
+
+	for _, conn := range peer.snapshot() {
+		conn.Pause()
+	}
+
+	currentClock().AfterFunc(l.restartTimeout, func() {
+		peer.mutex.Lock()
+		restarted := !restart.suspended || restart.suspensions != suspension
+		peer.mutex.Unlock()
+		if restarted || !l.peers.removeIf(id, peer) {
+			return // removed or restarted meanwhile
+		}
+		peer.peerConnection.Close()
+		l.logger.Infof("User session not restarted in %v, %d active sessions remain", l.restartTimeout, l.peers.len())
+	})
+}
+
+// resumePeer resumes the Conns of peer once connected again. It returns
+// false if the PeerConnection was not suspended.
+func (l *Listener) resumePeer(peer *listenerPeer) bool {
+	peer.mutex.Lock()
+	restart := peer.restart
+	if restart == nil || !restart.suspended {
+		peer.mutex.Unlock()
+		return false
+	}
+	restart.suspended = false
+	peer.mutex.Unlock()
+
+	for _, conn := range peer.snapshot() {
+		conn.Resume()
+	}
+	return true
+}
+
+// restartPeerConnection answers an ICE restart offer for the PeerConnection
+// created from the offer of ID restart read from the same Signal, see
+// Dialer.Resume. The remote peer MUST present the same DTLS fingerprint and
+// identity as in the first offer.
+func (l *Listener) restartPeerConnection(ctx context.Context, source int, offerID uint64, restart uint64, offer webrtc.SessionDescription, remoteIdentity ed25519.PublicKey) error {
+	var id uint64
+	var peer *restartablePeer
+	var peerConnection *webrtc.PeerConnection
+	l.peers.each(func(peerID uint64, p *listenerPeer) bool {
+		if restartable := p.restart; restartable != nil && restartable.source == source && restartable.offerID == restart {
+			id, peer, peerConnection = peerID, restartable, p.peerConnection
+			return false
+		}
+		return true
+	})
+
+	if peer == nil {
+		return fmt.Errorf("%w: no PeerConnection to restart for offer #%d", ErrUnknownPeer, restart)
+	}
+	if peer.fingerprint != dtlsFingerprint(&offer) || !bytes.Equal(peer.identity, remoteIdentity) {
+		return ErrUnauthorizedPeer
+	}
+
+	answer, err := l.gatherAnswer(ctx, peerConnection, offer, &handshakeTimer{}) // not reported after a restart
+	if err != nil {
+		return err
+	}
+	answerEnvelope := newSDPEnvelope(answer, "")
+	signSessionDescription(answerEnvelope, l.identityKey, 0)
+	if err := answerSignal(l.signals[source], offerID, signalMessage{envelope: answerEnvelope}); err != nil {
+		l.setSignalErr(err)
+		return err
+	}
+
+	l.events.emit(TransportEvent{Type: EVENT_ICE_RESTARTED, PeerID: id, OfferID: offerID})
+	return nil
+}
@@ -2,19 +2,17 @@ package transportc
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/json"
+	"crypto/ed25519"
 	"errors"
-	"math"
-	"math/big"
-	mrand "math/rand"
+	"fmt"
 	"net"
+	"runtime/debug"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gaukas/logging"
-	"github.com/gaukas/transportc/internal/utils"
 	"github.com/pion/webrtc/v3"
 )
 
@@ -29,78 +27,296 @@ const (
 
 const (
 	DEFAULT_ACCEPT_TIMEOUT = 10 * time.Second
+
+	// LISTENER_BACKPRESSURE_INTERVAL is how often an overloaded Listener
+	// checks whether it may read offers again.
+	LISTENER_BACKPRESSURE_INTERVAL = 100 * time.Millisecond
+)
+
+var (
+	// ErrUnknownPeer is returned when no PeerConnection of the given ID exists.
+	ErrUnknownPeer = errors.New("unknown peer")
+
+	// ErrInvalidCandidateIP is returned by Listener.SetHostCandidateIPs for a
+	// malformed IP.
+	ErrInvalidCandidateIP = errors.New("invalid candidate IP")
 )
 
+// Peer is a snapshot of a PeerConnection maintained by the Listener.
+type Peer struct {
+	// ID identifies the PeerConnection, see Conn.PeerID.
+	ID uint64
+
+	// State is the state of the PeerConnection.
+	State webrtc.PeerConnectionState
+
+	// Conns is the number of open Conns accepted from the PeerConnection.
+	Conns int
+
+	// Namespace is the namespace the PeerConnection is accepted in, see
+	// Listener.Namespace, or empty for the Listener itself.
+	Namespace string
+
+	// Identity is the identity public key of the remote peer, or nil
+	// if the remote peer did not sign its SDP.
+	Identity ed25519.PublicKey
+}
+
 // Listener listens for new PeerConnections and saves all incoming datachannel from peers for later use.
+//
+// The methods of Listener are safe to call from its callbacks, e.g.,
+// Config.ConnContext or the handlers of Handle, including ClosePeer on the
+// PeerConnection of the callback itself. No lock is held across the close
+// of a PeerConnection, so a peer being torn down never blocks the others.
 type Listener struct {
 	logger  logging.Logger
-	signal  Signal
+	signals []Signal // each polled by its own loop, see Config.ListenerSignals
 	timeout time.Duration
+	stats   *Stats
+	tracer  Tracer
+
+	gatherTimeout time.Duration
+
+	identityKey          ed25519.PrivateKey
+	allowedPeers         []ed25519.PublicKey
+	signedOfferTTL       time.Duration // expiry required on signed offers if non-zero, see Config.SignedOfferTTL
+	signedOfferClockSkew time.Duration
+
+	maxMessageSize    int
+	splitWrites       bool
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	maxBufferedAmount uint64
+	wireHandshake     bool
+	wireFeatures      WireFeatures
+	connContext       func(context.Context, *Conn) context.Context
+	newPacer          func() Pacer // see Config.NewPacer
+
+	dtlsRole DTLSRole
+	iceRole  ICERole // required, see Config.ListenerICERole
+
+	maxDataChannels int // max open DataChannels per PeerConnection, 0 for unlimited
+
+	// Backpressure, see overloaded
+	maxAcceptBacklog   int          // max Conns pending on Accept, 0 for unlimited
+	maxPeerConnections int          // max PeerConnections, 0 for unlimited
+	answering          atomic.Int32 // number of offers read and being answered
+
+	offerFilter func(OfferInfo) error // nil to answer all offers
+
+	restartTimeout time.Duration // see Config.ListenerRestartTimeout
+
+	recordTranscript bool // see Config.RecordTranscript
+
+	ticketKey          []byte        // nil if reconnect tickets are disabled, see Config.ListenerTicketKey
+	ticketTTL          time.Duration // see Config.ListenerTicketTTL
+	staticCertificates bool          // Config.Certificates set, so the tickets pin the fingerprint
+
+	routesMutex            sync.RWMutex
+	routes                 map[string]func(net.Conn) // protocol:handler pair
+	rejectUnknownProtocols bool
 
 	runningStatus ListenerRunningStatus // Initialized at creation. Atomic. Access via sync/atomic methods only
 
+	// Standby offers, see Config.ListenerStandbyOffers
+	standbySignal Signal
+	standbyOffers int
+	standbyTTL    time.Duration
+
 	// WebRTC configuration
-	settingEngine webrtc.SettingEngine
-	configuration webrtc.Configuration
+	settingEngine   webrtc.SettingEngine
+	configMutex     sync.Mutex // configMutex makes configuration thread-safe
+	configuration   webrtc.Configuration
+	icePairPolicy   ICEPairPolicy // applied to configuration, see ICEPairPolicy.configure
+	iceLite         bool
+	sdpBandwidth    *SDPBandwidth
+	sdpTransformIn  SDPTransform
+	sdpTransformOut SDPTransform
 
 	// WebRTC PeerConnection
-	mutex           sync.Mutex                        // mutex makes peerConnection thread-safe
-	peerConnections map[uint64]*webrtc.PeerConnection // PCID:PeerConnection pair
+	peers      peerRegistry          // PCID:listenerPeer pair, see peerRegistry for the locking rules
+	mutex      sync.Mutex            // mutex makes namespaces thread-safe
+	namespaces map[string]*namespace // name:namespace pair
+
+	// Conns pending on Accept
+	acceptQueue    *acceptQueue                     // Initialized at creation
+	acceptPriority func(label, protocol string) int // nil for equal priority
+	closed         chan bool                        // Initialized at creation
+
+	panics atomic.Uint64 // number of panics recovered
+
+	events *eventBus // Initialized at creation
 
-	// chan Conn for Accept
-	conns  chan net.Conn // Initialized at creation
-	closed chan bool     // Initialized at creation
+	// Health
+	signalErrMutex    sync.Mutex
+	lastSignalErr     error
+	lastSignalErrTime time.Time
 }
 
 // Accept accepts a new connection from the listener.
 //
 // It does not establish new connections.
 // These connections are from the pool filled automatically by acceptLoop.
+// Every DataChannel opened by a remote peer, including those opened later on
+// an already established PeerConnection, is accepted as a separate Conn.
 func (l *Listener) Accept() (net.Conn, error) {
-	// read next from conns
-	select {
-	case conn := <-l.conns:
-		if conn == nil {
-			return nil, errors.New("listener received nil connection")
+	// read next from acceptQueue, by priority
+	for {
+		if conn, ok := l.acceptQueue.pop(); ok {
+			return conn, nil
+		}
+		select {
+		case <-l.acceptQueue.ready:
+		case <-l.closed:
+			return nil, errors.New("closed listener can't accept new connections")
 		}
-		return conn, nil
-	case <-l.closed:
-		return nil, errors.New("closed listener can't accept new connections")
 	}
 }
 
+// AcceptWith accepts a Conn as Accept does, applying the DialOptions
+// meaningful to an accepted Conn, i.e., WithTag and WithConnContext. The
+// others are ignored.
+func (l *Listener) AcceptWith(opts ...DialOption) (net.Conn, error) {
+	options := &dialOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	accepted, err := l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := accepted.(*Conn)
+	if datagramConn, isDatagram := accepted.(*DatagramConn); isDatagram {
+		conn, ok = datagramConn.conn, true
+	}
+	if ok {
+		if options.tag != "" {
+			conn.SetTag(options.tag)
+		}
+		conn.closeOnContext(options.connCtx)
+	}
+	return accepted, nil
+}
+
+// Handle routes the Conns with the DataChannel protocol set to protocol, see
+// WithProtocol, to handler instead of Accept. Each handler is called in its own
+// goroutine, and a later call for the same protocol replaces the handler.
+//
+// Conns with a protocol not handled are surfaced via Accept, or closed if
+// Config.ListenerRejectUnknownProtocols is set. Routing happens before the
+// DataChannel is open, so rejected Conns never reach the application.
+func (l *Listener) Handle(protocol string, handler func(net.Conn)) {
+	l.routesMutex.Lock()
+	defer l.routesMutex.Unlock()
+	l.routes[protocol] = handler
+}
+
+// route returns the handler of protocol, or nil if the Conn is to be surfaced
+// via Accept. ok is false if the Conn is to be rejected.
+func (l *Listener) route(protocol string) (handler func(net.Conn), ok bool) {
+	l.routesMutex.RLock()
+	defer l.routesMutex.RUnlock()
+	handler, ok = l.routes[protocol]
+	return handler, ok || !l.rejectUnknownProtocols
+}
+
+// Events returns the channel of TransportEvents emitted by the Listener.
+//
+// Events are only emitted after the first call to Events, and are dropped
+// if not received fast enough to keep up with the buffer of EVENT_BUFFER_SIZE.
+func (l *Listener) Events() <-chan TransportEvent {
+	return l.events.subscribe()
+}
+
 // Close closes the listener and all peer connections
 func (l *Listener) Close() error {
 	if atomic.CompareAndSwapUint32(&l.runningStatus, LISTENER_RUNNING, LISTENER_STOPPED) || atomic.CompareAndSwapUint32(&l.runningStatus, LISTENER_SUSPENDED, LISTENER_STOPPED) {
+		var peers []*listenerPeer
+		l.peers.each(func(id uint64, _ *listenerPeer) bool {
+			if peer, ok := l.peers.remove(id); ok {
+				peers = append(peers, peer)
+			}
+			return true
+		})
+		for _, peer := range peers {
+			for _, conn := range peer.snapshot() {
+				conn.markCloseReason(CLOSE_REASON_LISTENER_CLOSED)
+			}
+			peer.peerConnection.Close()
+		}
+
 		l.mutex.Lock()
-		defer l.mutex.Unlock()
-		for _, pc := range l.peerConnections {
-			pc.Close()
+		for name, ns := range l.namespaces {
+			delete(l.namespaces, name)
+			ns.closeOnce.Do(func() { close(ns.closed) })
+			ns.acceptQueue.close()
 		}
-		l.peerConnections = make(map[uint64]*webrtc.PeerConnection) // clear map
-		// close(l.conns)
+		l.mutex.Unlock()
 		close(l.closed)
+		l.acceptQueue.close()
 		return nil
 	}
 	return errors.New("listener already stopped")
 }
 
-// Addr is unimplemented
+// Addr returns a placeholder address, as the Listener does not listen on
+// any single address. It is never nil.
 func (*Listener) Addr() net.Addr {
-	return nil
+	return &Addr{}
 }
 
 func (l *Listener) Start() error {
 	if atomic.CompareAndSwapUint32(&l.runningStatus, LISTENER_NEW, LISTENER_RUNNING) || atomic.CompareAndSwapUint32(&l.runningStatus, LISTENER_SUSPENDED, LISTENER_RUNNING) || atomic.CompareAndSwapUint32(&l.runningStatus, LISTENER_STOPPED, LISTENER_RUNNING) {
 		l.startAcceptLoop()
+		l.startStandby()
 		return nil
 	}
 	return errors.New("listener already started")
 }
 
+// UpdateICEServers replaces the ICE servers (STUN/TURN) used by the Listener.
+//
+// Only PeerConnections created afterwards are affected, so long-running
+// processes can rotate TURN credentials without being restarted.
+// ICE servers are always ignored in ICE-lite mode.
+func (l *Listener) UpdateICEServers(iceServers []webrtc.ICEServer) {
+	if l.iceLite {
+		return
+	}
+
+	l.configMutex.Lock()
+	defer l.configMutex.Unlock()
+	l.configuration.ICEServers = append([]webrtc.ICEServer(nil), iceServers...)
+}
+
+// SetHostCandidateIPs replaces the IPs advertised by the host candidates of
+// the answers, e.g., with the external IP of the node instead of the IP of
+// the container or pod, so the Listener is reachable without host networking.
+// Each of ips is either an external IP replacing every local IP, or a pair
+// "external/local" replacing the local IP only. If ips is empty, the local
+// IPs are advertised again. It overrides Config.IPs.
+//
+// The ports are advertised as bound, so they MUST be published as is, e.g.,
+// the Config.PortRange or the port of the Config.UDPMux mapped 1:1 by Docker
+// or a Kubernetes hostPort. Only PeerConnections created afterwards are
+// affected.
+func (l *Listener) SetHostCandidateIPs(ips []string) error {
+	for _, ip := range ips {
+		external, local, mapped := strings.Cut(ip, "/")
+		if net.ParseIP(external) == nil || (mapped && net.ParseIP(local) == nil) {
+			return fmt.Errorf("%w: %q", ErrInvalidCandidateIP, ip)
+		}
+	}
+
+	l.configMutex.Lock()
+	defer l.configMutex.Unlock()
+	return setHostCandidateIPs(&l.settingEngine, ips)
+}
+
 // startAcceptLoop() should be called before the first Accept() call.
 func (l *Listener) startAcceptLoop() {
-	if l.signal == nil {
+	if len(l.signals) == 0 {
 		return // nothing to do for manual signaling (nil)
 	}
 
@@ -108,77 +324,381 @@ func (l *Listener) startAcceptLoop() {
 		l.timeout = DEFAULT_ACCEPT_TIMEOUT
 	}
 
-	// Loop: accept new Offers from signal and establish new PeerConnections
-	go func() {
-		for atomic.LoadUint32(&l.runningStatus) != LISTENER_STOPPED { // Don't return unless STOPPED
-			for atomic.LoadUint32(&l.runningStatus) == LISTENER_RUNNING { // Only accept new Offers if RUNNING
-				// Accept new Offer from signal
-				offerID, offer, err := l.signal.ReadOffer()
-				if err != nil {
+	for source := range l.signals {
+		go l.acceptLoop(source)
+	}
+}
+
+// acceptLoop accepts new offers from the Signal of index source and
+// establishes new PeerConnections, until the Listener is STOPPED.
+func (l *Listener) acceptLoop(source int) {
+	signal := l.signals[source]
+	for atomic.LoadUint32(&l.runningStatus) != LISTENER_STOPPED { // Don't return unless STOPPED
+		for atomic.LoadUint32(&l.runningStatus) == LISTENER_RUNNING { // Only accept new Offers if RUNNING
+			// Leave offers in the signal while overloaded
+			if l.overloaded() {
+				time.Sleep(LISTENER_BACKPRESSURE_INTERVAL)
+				continue
+			}
+
+			// Accept new Offer from signal
+			offerID, offer, err := readSignalOffer(signal)
+			if err != nil {
+				if err != ErrOfferNotReady {
+					l.setSignalErr(err)
+				}
+				continue
+			}
+			// The read may block past the check above, hold the offer
+			// until the Listener is no longer overloaded
+			for l.overloaded() && atomic.LoadUint32(&l.runningStatus) != LISTENER_STOPPED {
+				time.Sleep(LISTENER_BACKPRESSURE_INTERVAL)
+			}
+			// Don't negotiate a stale offer, nor past its expiry
+			deadline := time.Now().Add(l.timeout)
+			if expiry := signalOfferExpiry(signal, offerID); !expiry.IsZero() {
+				if time.Now().After(expiry) {
+					l.logger.Debugf("listener: discarding offer #%d expired at %v", offerID, expiry)
 					continue
 				}
-				// Create new PeerConnection in a goroutine
-				go func() {
-					ctxTimeout, cancel := context.WithTimeout(context.Background(), l.timeout)
-					defer cancel()
-					err := l.nextPeerConnection(ctxTimeout, offerID, offer)
-					if err != nil {
-						return // ignore errors
-					}
-				}()
+				if expiry.Before(deadline) {
+					deadline = expiry
+				}
 			}
-			// sleep for a little while if new/suspended
-			time.Sleep(time.Second)
+			// Create new PeerConnection in a goroutine
+			l.answering.Add(1)
+			go func() {
+				defer l.answering.Add(-1)
+				defer l.recoverPanic(0)
+				ctxTimeout, cancel := context.WithDeadline(context.Background(), deadline)
+				defer cancel()
+				l.nextPeerConnection(ctxTimeout, source, offerID, offer) // failures reported as AcceptError
+			}()
 		}
-	}()
+		// sleep for a little while if new/suspended
+		time.Sleep(time.Second)
+	}
+}
+
+// overloaded reports whether the Listener should stop reading offers, as the
+// Conns pending on Accept or the PeerConnections reached their limit. Offers
+// being answered count as PeerConnections, so a burst of offers is not read
+// past the limit.
+func (l *Listener) overloaded() bool {
+	if l.maxAcceptBacklog > 0 && l.acceptQueue.len() >= l.maxAcceptBacklog {
+		return true
+	}
+	if l.maxPeerConnections > 0 {
+		return l.peers.len()+int(l.answering.Load()) >= l.maxPeerConnections
+	}
+	return false
 }
 
-func (l *Listener) nextPeerConnection(ctx context.Context, offerID uint64, offer []byte) error {
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(l.settingEngine))
+// nextPeerConnection answers offer of offerID, read from the Signal of index
+// source, with a new PeerConnection. A failure is returned and reported as an
+// AcceptError.
+func (l *Listener) nextPeerConnection(ctx context.Context, source int, offerID uint64, offer signalMessage) (err error) {
+	start := currentClock().Now()
+	l.events.emit(TransportEvent{Type: EVENT_OFFER_RECEIVED, OfferID: offerID})
+
+	stage := ACCEPT_STAGE_OFFER
+	var id uint64           // ID of the PeerConnection, once created
+	var settled atomic.Bool // the first Conn is accepted, or a failure reported
+	defer func() {
+		if err != nil && settled.CompareAndSwap(false, true) {
+			err = l.acceptFailed(offerID, id, stage, err)
+		}
+	}()
+
+	envelope, remoteIdentity, err := offer.open(webrtc.SDPTypeOffer, l.allowedPeers)
+	if err != nil {
+		return err
+	}
+	if err := verifyOfferExpiry(envelope, l.signedOfferClockSkew, l.signedOfferTTL != 0); err != nil {
+		return err
+	}
+	offerUnmarshal := envelope.SessionDescription
+	ctx = extractTrace(ctx, l.tracer, envelope.Trace)
+
+	if l.sdpTransformIn != nil {
+		offerUnmarshal, err = l.sdpTransformIn(offerUnmarshal)
+		if err != nil {
+			return err
+		}
+	}
+
+	if envelope.Restart != 0 {
+		stage = ACCEPT_STAGE_RESTART
+		return l.restartPeerConnection(ctx, source, offerID, envelope.Restart, offerUnmarshal, remoteIdentity)
+	}
+
+	// Ended once the first Conn is open, or the PeerConnection failed
+	ctx, acceptSpan := startSpan(ctx, l.tracer, SPAN_ACCEPT, TraceAttribute{Key: "transportc.offer_id", Value: offerID})
+	defer func() {
+		if err != nil {
+			acceptSpan.End(err)
+		}
+	}()
+
+	stage = ACCEPT_STAGE_ADMISSION
+	// A valid reconnect ticket skips the admission checks passed when issued
+	ticketed := l.verifyTicket(envelope, remoteIdentity)
+	ns, err := l.lookupNamespace(envelope.Namespace, remoteIdentity, ticketed)
+	if err != nil {
+		return err
+	}
+
+	if l.offerFilter != nil && !ticketed {
+		if err := l.offerFilter(OfferInfo{
+			Label:        envelope.Label,
+			Protocol:     envelope.Protocol,
+			Metadata:     envelope.Metadata,
+			Namespace:    envelope.Namespace,
+			PeerIdentity: remoteIdentity,
+		}); err != nil {
+			return fmt.Errorf("%w: %v", ErrOfferRejected, err)
+		}
+	}
+
+	// Take the DTLS role opposite to the one required by the Dialer, if any
+	stage = ACCEPT_STAGE_NEGOTIATION
+	l.configMutex.Lock()
+	settingEngine := l.settingEngine
+	l.configMutex.Unlock()
+	if l.iceRole == ICERoleControlling && iceLite(&offerUnmarshal) {
+		return ErrICERoleConflict // both in ICE-lite mode, the Dialer is controlling
+	}
+	if remoteRole := dtlsSetupRole(&offerUnmarshal); remoteRole != DTLSRoleAuto {
+		if remoteRole == l.dtlsRole {
+			return ErrDTLSRoleConflict
+		}
+		if remoteRole == DTLSRoleClient {
+			setAnsweringDTLSRole(&settingEngine, DTLSRoleServer)
+		} else {
+			setAnsweringDTLSRole(&settingEngine, DTLSRoleClient)
+		}
+	}
+
+	turn := withTURNTracker(&settingEngine, l.stats)
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(settingEngine))
+
+	l.configMutex.Lock()
+	configuration := l.icePairPolicy.configure(l.configuration)
+	l.configMutex.Unlock()
+
+	peerConnection, err := api.NewPeerConnection(configuration)
+	if err != nil {
+		return err
+	}
+	var transcript *transcriptRecorder
+	if l.recordTranscript {
+		transcript = newTranscriptRecorder(peerConnection)
+		transcript.setOffer(&offerUnmarshal)
+	}
+
+	handshake := &handshakeTimer{}
+	var restart *restartablePeer
+	if l.restartTimeout > 0 {
+		restart = &restartablePeer{
+			source:      source,
+			offerID:     offerID,
+			fingerprint: dtlsFingerprint(&offerUnmarshal),
+			identity:    remoteIdentity,
+		}
+	}
+	if ns != nil {
+		if err := l.admitNamespacePeer(ns); err != nil {
+			peerConnection.Close()
+			stage = ACCEPT_STAGE_ADMISSION
+			return err
+		}
+	}
+	id = l.servePeerConnection(peerConnection, newListenerPeer(peerConnection, ns, restart), turn, handshake, transcript, &pendingAccept{
+		offerID:  offerID,
+		start:    start,
+		span:     acceptSpan,
+		settled:  &settled,
+		metadata: envelope.Metadata,
+		identity: remoteIdentity,
+		ticketed: ticketed,
+		ns:       ns,
+	})
+	defer l.recoverPanic(id)
 
-	peerConnection, err := api.NewPeerConnection(l.configuration)
+	answer, err := l.gatherAnswer(ctx, peerConnection, offerUnmarshal, handshake)
 	if err != nil {
 		return err
 	}
+	transcript.setAnswer(answer)
+	stage = ACCEPT_STAGE_SIGNAL
+	answerEnvelope := newSDPEnvelope(answer, "")
+	answerEnvelope.Ticket = l.issueTicket(answerEnvelope, envelope.Namespace, remoteIdentity)
+	signSessionDescription(answerEnvelope, l.identityKey, 0)
+	_, signalSpan := startSpan(ctx, l.tracer, SPAN_SIGNAL)
+	err = answerSignal(l.signals[source], offerID, signalMessage{envelope: answerEnvelope})
+	signalSpan.End(err)
+	if err != nil {
+		l.setSignalErr(err)
+		return fmt.Errorf("listener: failed to signal local answer: %w", err)
+	}
+
+	return nil
+}
+
+// pendingAccept is what the Listener knows of the remote peer of a
+// PeerConnection being negotiated, reported along with its Conns.
+type pendingAccept struct {
+	offerID  uint64
+	start    time.Time
+	span     *traceSpan   // ended once the first Conn is open
+	settled  *atomic.Bool // the first Conn is accepted, or a failure reported
+	metadata map[string]string
+	identity ed25519.PublicKey
+	ticketed bool
+	ns       *namespace
+}
+
+// servePeerConnection registers peer of peerConnection, whether answering an
+// offer or offering in standby, and handles its state changes and
+// DataChannels, which are accepted as Conns. It returns the ID of the
+// PeerConnection.
+func (l *Listener) servePeerConnection(peerConnection *webrtc.PeerConnection, peer *listenerPeer, turn *turnTracker, handshake *handshakeTimer, transcript *transcriptRecorder, accept *pendingAccept) (id uint64) {
+	offerID, start, acceptSpan, settled := accept.offerID, accept.start, accept.span, accept.settled
+	metadata, remoteIdentity, ticketed, ns := accept.metadata, accept.identity, accept.ticketed, accept.ns
 
 	pcwg := &sync.WaitGroup{}
+	var dataChannelCount atomic.Uint32
+	var openDataChannels atomic.Int32
 
-	// Get a random ID
-	id := l.nextPCID()
-	l.mutex.Lock()
-	l.peerConnections[id] = peerConnection
-	l.mutex.Unlock()
+	id = l.nextPCID()
+	for !l.peers.add(id, peer) { // taken meanwhile
+		id = l.nextPCID()
+	}
+	l.events.emit(TransportEvent{Type: EVENT_PC_CREATED, PeerID: id, OfferID: offerID})
+	l.stats.observePeerConnection()
+
+	var iceObserved atomic.Bool // only the first outcome of the ICE is observed
+	peerConnection.OnICEConnectionStateChange(func(s webrtc.ICEConnectionState) {
+		defer l.recoverPanic(id)
+		transcript.record(TRANSCRIPT_ICE_STATE, s.String())
+		if s == webrtc.ICEConnectionStateConnected {
+			handshake.markICEConnected()
+			if iceObserved.CompareAndSwap(false, true) {
+				l.stats.observeICE(true)
+			}
+		} else if s == webrtc.ICEConnectionStateFailed {
+			l.events.emit(TransportEvent{Type: EVENT_ICE_FAILED, PeerID: id, OfferID: offerID})
+			if iceObserved.CompareAndSwap(false, true) {
+				l.stats.observeICE(false)
+			}
+		}
+	})
 
 	peerConnection.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		defer l.recoverPanic(id)
+		transcript.record(TRANSCRIPT_PC_STATE, s.String())
+		if s == webrtc.PeerConnectionStateClosed {
+			turn.close()
+		}
+		if s == webrtc.PeerConnectionStateFailed || s == webrtc.PeerConnectionStateClosed {
+			err := fmt.Errorf("listener: PeerConnection %s before accepted", s)
+			acceptSpan.End(err)
+			if settled.CompareAndSwap(false, true) {
+				l.acceptFailed(offerID, id, ACCEPT_STAGE_CONNECT, err)
+			}
+		}
 		// TODO: handle this better
-		if s > webrtc.PeerConnectionStateConnected {
-			l.mutex.Lock()
+		if (s == webrtc.PeerConnectionStateDisconnected || s == webrtc.PeerConnectionStateFailed) && l.restartTimeout > 0 {
+			l.suspendPeer(id, peer) // until ICE restarted by the Dialer
+		} else if s > webrtc.PeerConnectionStateConnected {
+			if s == webrtc.PeerConnectionStateFailed {
+				for _, conn := range peer.snapshot() {
+					conn.markCloseReason(CLOSE_REASON_PEER_CONNECTION_FAILED)
+				}
+			}
+			l.peers.removeIf(id, peer)
 			peerConnection.Close()
-			delete(l.peerConnections, id)
-			l.logger.Infof("User session closed, %d active sessions remain", len(l.peerConnections))
-			l.mutex.Unlock()
+			l.logger.Infof("User session closed, %d active sessions remain", l.peers.len())
 		} else if s == webrtc.PeerConnectionStateConnected {
-			l.mutex.Lock()
-			l.logger.Infof("User session created, %d active sessions in total", len(l.peerConnections))
-			l.mutex.Unlock()
-			go utils.DelayedExecution(l.timeout, func() {
+			if l.resumePeer(peer) {
+				return // connected again after an ICE restart
+			}
+			handshake.markDTLSConnected()
+			l.logger.Infof("User session created, %d active sessions in total", l.peers.len())
+			currentClock().AfterFunc(l.timeout, func() {
 				pcwg.Wait()
-				l.mutex.Lock()
-				peerConnection.Close()
 				l.logger.Infof("Closing user session due to idle... ")
-				delete(l.peerConnections, id)
-				l.mutex.Unlock()
+				l.peers.removeIf(id, peer)
+				peerConnection.Close()
 			})
 		}
 	})
 
 	peerConnection.OnDataChannel(func(d *webrtc.DataChannel) {
+		defer l.recoverPanic(id)
+
+		handler, ok := l.route(d.Protocol())
+		if !ok {
+			l.logger.Warnf("listener: rejecting %q for unknown protocol %q", d.Label(), d.Protocol())
+			d.Close()
+			return
+		}
+
+		// every DataChannel yields a Conn, unless the peer has too many open
+		if active := openDataChannels.Add(1); l.maxDataChannels > 0 && active > int32(l.maxDataChannels) {
+			openDataChannels.Add(-1)
+			l.logger.Warnf("listener: peer exceeded %d open DataChannels, rejecting %q", l.maxDataChannels, d.Label())
+			d.Close()
+			return
+		}
+
 		conn := NewConn(nil, CONN_DEFAULT_CONCURRENCY)
+		conn.maxMessageSize = l.maxMessageSize
+		conn.splitWrites = l.splitWrites
+		conn.readTimeout = l.readTimeout
+		conn.writeTimeout = l.writeTimeout
+		conn.maxBufferedAmount = l.maxBufferedAmount
+		conn.label = d.Label()
+		conn.protocol = d.Protocol()
+		conn.peerID = id
+
+		// the DataChannel is released once, by whichever closes first of the
+		// Conn and the DataChannel, and untracked if tracked by then
+		var trackMutex sync.Mutex
+		var tracked, released bool
+		release := func() {
+			trackMutex.Lock()
+			defer trackMutex.Unlock()
+			if released {
+				return
+			}
+			released = true
+			openDataChannels.Add(-1)
+			if tracked {
+				peer.removeConn(conn)
+				pcwg.Done()
+			}
+		}
+		conn.onClose = func() {
+			release()
+			l.events.emit(TransportEvent{Type: EVENT_CONN_CLOSED, PeerID: id, OfferID: offerID, Label: conn.label})
+		}
+
+		// the first DataChannel is established along with the PeerConnection
+		reused := dataChannelCount.Add(1) > 1
+		dataChannelStart := start
+		if reused {
+			dataChannelStart = currentClock().Now()
+		}
 
 		d.OnOpen(func() {
+			defer l.recoverPanic(id)
+			chaosDelayOpen()
 			// detach from wrapper
-			dc, err := d.Detach()
+			dc, err := detachDataChannel(d)
 			if err != nil {
+				l.acceptFailed(offerID, id, ACCEPT_STAGE_DATACHANNEL, err)
+				conn.closeWith(CLOSE_REASON_SETUP_FAILED)
 				return
 			} else {
 				conn.dataChannel = dc
@@ -189,6 +709,8 @@ func (l *Listener) nextPeerConnection(ctx context.Context, offerID uint64, offer
 						if ice := dtls.ICETransport(); ice != nil {
 							icePair, err := ice.GetSelectedCandidatePair()
 							if err != nil {
+								l.acceptFailed(offerID, id, ACCEPT_STAGE_DATACHANNEL, fmt.Errorf("failed to get selected ICE Candidate pair: %w", err))
+								conn.closeWith(CLOSE_REASON_SETUP_FAILED)
 								return
 							}
 							conn.localAddr = &Addr{
@@ -202,88 +724,200 @@ func (l *Listener) nextPeerConnection(ctx context.Context, offerID uint64, offer
 						}
 					}
 				}
+				unreliable := !d.Ordered() && (d.MaxRetransmits() != nil || d.MaxPacketLifeTime() != nil)
+				if l.wireHandshake && !unreliable {
+					if err := conn.wireHandshake(l.wireFeatures, time.Now().Add(WIRE_HANDSHAKE_TIMEOUT)); err != nil {
+						l.logger.Warnf("listener: %v", err)
+						l.acceptFailed(offerID, id, ACCEPT_STAGE_DATACHANNEL, err)
+						conn.closeWith(CLOSE_REASON_SETUP_FAILED)
+						return
+					}
+				}
+
+				conn.handshakeInfo = handshake.info(dataChannelStart, reused)
+				conn.peerIdentity = remoteIdentity
+				conn.offerMetadata = metadata
+				conn.reconnected = ticketed
+				conn.peerConnection = peerConnection
+				conn.turn = turn
+				conn.transcript = transcript
+				if l.newPacer != nil {
+					conn.SetPacer(l.newPacer())
+				}
+				conn.initContext(context.Background(), l.connContext)
+				conn.trackStats(l.stats)
 				go conn.idleloop(l.timeout)
+				trackMutex.Lock()
+				if released { // closed during the setup
+					trackMutex.Unlock()
+					return
+				}
+				tracked = true
 				pcwg.Add(1)
-				l.conns <- conn
+				peer.addConn(conn)
+				trackMutex.Unlock()
+				l.events.emit(TransportEvent{Type: EVENT_DC_OPENED, PeerID: id, OfferID: offerID, Label: conn.label})
+
+				var accepted net.Conn = conn
+				if unreliable {
+					accepted = NewDatagramConn(conn)
+				}
+				if !reused {
+					l.stats.observeAccept(clockSince(start))
+					acceptSpan.End(nil)
+					settled.Store(true)
+				}
+				if handler != nil {
+					go func() {
+						defer l.recoverPanic(id)
+						handler(accepted)
+					}()
+					return
+				}
+				priority := 0
+				if ticketed {
+					priority = TICKET_ACCEPT_PRIORITY
+				} else if l.acceptPriority != nil {
+					priority = l.acceptPriority(conn.label, conn.protocol)
+				}
+				if ns != nil {
+					ns.acceptQueue.push(accepted, priority)
+					return
+				}
+				l.acceptQueue.push(accepted, priority)
 			}
 		})
 
 		d.OnClose(func() {
+			defer l.recoverPanic(id)
 			// TODO: possibly tear down the PeerConnection if it is the last DataChannel?
-			conn.Close()
-			pcwg.Done()
+			conn.closeWith(CLOSE_REASON_REMOTE)
+			release() // if the Conn was closed before
 		})
 	})
+	return id
+}
 
-	var bChan chan bool = make(chan bool)
+// gatherAnswer sets offer as the remote description of peerConnection, then
+// creates a local answer and waits for the ICE gathering to complete. It
+// returns the answer to be signaled.
+func (l *Listener) gatherAnswer(ctx context.Context, peerConnection *webrtc.PeerConnection, offer webrtc.SessionDescription, handshake *handshakeTimer) (_ *webrtc.SessionDescription, err error) {
+	_, span := startSpan(ctx, l.tracer, SPAN_ICE_GATHER)
+	defer func() {
+		span.End(err)
+	}()
 
-	offerUnmarshal := webrtc.SessionDescription{} // skipcq: GO-W1027
-	err = json.Unmarshal(offer, &offerUnmarshal)
+	if err := peerConnection.SetRemoteDescription(offer); err != nil {
+		return nil, fmt.Errorf("listener: failed to set remote description: %w", err)
+	}
+	localDescription, err := peerConnection.CreateAnswer(nil)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("listener: failed to create local answer: %w", err)
 	}
 
-	err = peerConnection.SetRemoteDescription(offerUnmarshal)
-	if err != nil {
-		return err
+	// Create channel that is blocked until ICE Gathering is complete
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+
+	// Sets the LocalDescription, and starts our UDP listeners
+	if err := peerConnection.SetLocalDescription(localDescription); err != nil {
+		return nil, fmt.Errorf("listener: failed to set local description: %w", err)
+	}
+	handshake.markICEStarted()
+
+	err = waitForGathering(ctx, gatherComplete, l.gatherTimeout)
+	if err == ErrGatherTimeout {
+		l.logger.Warnf("listener: ICE gathering incomplete after %v, proceeding with partial candidates", l.gatherTimeout)
+	} else if err != nil {
+		return nil, fmt.Errorf("listener: context done before ICE gathering complete: %w", err)
 	}
 
-	// wait for local answer
-	go func(blockingChan chan bool) {
-		localDescription, err := peerConnection.CreateAnswer(nil)
+	return l.outgoingDescription(peerConnection.LocalDescription(), "local answer")
+}
+
+// outgoingDescription returns desc, named kind in errors, with the bandwidth
+// capped by Config.SDPBandwidth and transformed by
+// Config.SDPTransformOutgoing, if set.
+func (l *Listener) outgoingDescription(desc *webrtc.SessionDescription, kind string) (*webrtc.SessionDescription, error) {
+	if l.sdpBandwidth != nil {
+		capped, err := withSDPBandwidth(desc, l.sdpBandwidth)
 		if err != nil {
-			blockingChan <- false
+			return nil, fmt.Errorf("listener: failed to cap the bandwidth of %s: %w", kind, err)
 		}
-		// Create channel that is blocked until ICE Gathering is complete
-		gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
-
-		// Sets the LocalDescription, and starts our UDP listeners
-		err = peerConnection.SetLocalDescription(localDescription)
+		desc = capped
+	}
+	if l.sdpTransformOut != nil {
+		transformed, err := l.sdpTransformOut(*desc)
 		if err != nil {
-			blockingChan <- false
+			return nil, fmt.Errorf("listener: failed to transform %s: %w", kind, err)
 		}
-		<-gatherComplete
-		blockingChan <- true
-	}(bChan)
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case status := <-bChan:
-		if !status {
-			return errors.New("failed to create local answer")
+		desc = &transformed
+	}
+	return desc, nil
+}
+
+// recoverPanic recovers from a panic while handling a PeerConnection, so a
+// single misbehaving peer can't crash the Listener. The PeerConnection of id,
+// if any, is torn down. MUST be called via defer.
+func (l *Listener) recoverPanic(id uint64) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	l.panics.Add(1)
+	l.logger.Errorf("listener: recovered from panic: %v\n%s", r, debug.Stack())
+
+	if id == 0 {
+		return // no PeerConnection yet
+	}
+
+	if peer, ok := l.peers.remove(id); ok {
+		go peer.peerConnection.Close() // may be called from within a callback of peerConnection
+	}
+}
+
+// Peers returns a snapshot of all PeerConnections maintained by the Listener.
+func (l *Listener) Peers() []Peer {
+	peers := make([]Peer, 0, l.peers.len())
+	l.peers.each(func(id uint64, p *listenerPeer) bool {
+		conns := p.snapshot()
+		peer := Peer{
+			ID:    id,
+			State: p.peerConnection.ConnectionState(),
+			Conns: len(conns),
 		}
-		answer := peerConnection.LocalDescription()
-		// answer to JSON bytes
-		answerBytes, err := json.Marshal(answer)
-		if err != nil {
-			return err
+		if p.namespace != nil {
+			peer.Namespace = p.namespace.name
 		}
-		err = l.signal.Answer(offerID, answerBytes)
-		if err != nil {
-			return err
+		if len(conns) > 0 {
+			peer.Identity = conns[0].peerIdentity
 		}
+		peers = append(peers, peer)
+		return true
+	})
+	return peers
+}
+
+// ClosePeer closes all Conns accepted from the PeerConnection of id, with
+// CLOSE_REASON_PEER_CLOSED, then the PeerConnection itself.
+func (l *Listener) ClosePeer(id uint64) error {
+	peer, ok := l.peers.remove(id)
+	if !ok {
+		return ErrUnknownPeer
 	}
 
-	return nil
+	for _, conn := range peer.snapshot() {
+		conn.closeWith(CLOSE_REASON_PEER_CLOSED)
+	}
+	return peer.peerConnection.Close()
 }
 
-// randomize a uint64 for ID. Must not conflict with existing IDs.
+// randomize a uint64 for ID. Must not conflict with existing IDs. 0 is reserved.
 func (l *Listener) nextPCID() uint64 {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
-
 	var id uint64
 	for {
-		n := new(big.Int)
-		randID, err := rand.Int(rand.Reader, n.SetUint64(math.MaxUint64))
-		if err != nil { // fallback to math/rand if crypto/rand fails
-			id = mrand.Uint64() // skipcq: GSC-G404
-		} else {
-			id = randID.Uint64()
-		}
-
-		if _, ok := l.peerConnections[id]; !ok { // not found
+		id = randomUint64()
+		if _, ok := l.peers.get(id); !ok && id != 0 { // not found
 			break // okay to use this ID
 		}
 	}
@@ -0,0 +1,537 @@
+// Package mesh maintains an overlay of peers over transportc, turning the
+// point-to-point Conns of a Dialer and a Listener into a small overlay
+// network: peers are dialed and accepted, monitored by heartbeats or a
+// SWIM-style failure detector, and addressed by ID with SendTo and
+// Broadcast.
+package mesh
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mrand "math/rand" // skipcq: GSC-G404
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gaukas/logging"
+	"github.com/gaukas/transportc"
+)
+
+const (
+	PROTOCOL = "transportc-mesh" // the DataChannel protocol of the Conns between peers
+
+	HEARTBEAT_INTERVAL_DEFAULT = 5 * time.Second
+	PEER_TIMEOUT_DEFAULT       = 15 * time.Second // without any message from a peer
+	REDIAL_INTERVAL_DEFAULT    = 5 * time.Second
+	DIAL_TIMEOUT_DEFAULT       = 30 * time.Second
+	RECEIVE_BUFFER             = 256
+	MAX_MESSAGE_SIZE           = transportc.CONN_DEFAULT_MTU - 1
+	MAX_ID_SIZE                = 255
+
+	frameHello     byte = 0x01 // payload: the ID of the sender
+	frameData      byte = 0x02
+	frameHeartbeat byte = 0x03
+	frameSWIM      byte = 0x04 // payload: a message of the failure detector
+)
+
+var (
+	ErrNoDialer        = errors.New("mesh: no dialer or listener specified")
+	ErrUnknownPeer     = errors.New("mesh: unknown peer")
+	ErrMessageTooLarge = errors.New("mesh: message too large")
+	ErrMeshClosed      = errors.New("mesh: closed")
+	ErrSelfConnected   = errors.New("mesh: connected to itself")
+)
+
+// Config is the configuration for the Mesh.
+type Config struct {
+	// ID identifies this peer in the mesh. If empty, a random ID is used.
+	//
+	// IDs are claimed by each peer when connecting, and are only as
+	// trustworthy as the peers allowed, see transportc.Config.AllowedPeers.
+	ID string
+
+	// Dialer dials new peers, and Listener accepts them. Either may be nil,
+	// but not both. The Listener must be started by the caller.
+	Dialer   *transportc.Dialer
+	Listener *transportc.Listener
+
+	// MinPeers is the number of peers the Mesh keeps dialing for, every
+	// RedialInterval. If 0, peers are only dialed by Connect.
+	MinPeers int
+
+	// HeartbeatInterval is how often a heartbeat is sent to each peer, and
+	// PeerTimeout how long a peer is kept without any message from it.
+	// If 0, HEARTBEAT_INTERVAL_DEFAULT and PEER_TIMEOUT_DEFAULT are used.
+	HeartbeatInterval time.Duration
+	PeerTimeout       time.Duration
+
+	// RedialInterval is how often peers are dialed while fewer than
+	// MinPeers. If 0, REDIAL_INTERVAL_DEFAULT is used.
+	RedialInterval time.Duration
+
+	// OnPeerUp and OnPeerDown, if set, are called when a peer joins or
+	// leaves the Mesh.
+	OnPeerUp   func(peerID string)
+	OnPeerDown func(peerID string)
+
+	// FailureDetector enables a SWIM-style failure detector: each
+	// ProbeInterval a peer is probed with small messages over an
+	// unreliable Conn, and suspected if neither it nor other peers asked
+	// to probe it ack in time. A suspect refuting the suspicion within
+	// SuspectTimeout stays alive, otherwise it is declared dead and its
+	// Conn closed. Membership updates are gossiped on the probes, so
+	// Members also lists the peers not connected directly.
+	//
+	// If 0, PROBE_INTERVAL_DEFAULT, PROBE_TIMEOUT_DEFAULT and
+	// SUSPECT_TIMEOUT_DEFAULT are used. ProbeTimeout must be less than
+	// ProbeInterval.
+	FailureDetector bool
+	ProbeInterval   time.Duration
+	ProbeTimeout    time.Duration
+	SuspectTimeout  time.Duration
+
+	// OnMemberUp and OnMemberDown, if set, are called when a member is
+	// detected alive or dead by the failure detector.
+	OnMemberUp   func(memberID string)
+	OnMemberDown func(memberID string)
+
+	Logger logging.Logger
+}
+
+// Message is a message received from a peer.
+type Message struct {
+	From string
+	Data []byte
+}
+
+// Mesh maintains the Conns to a set of peers.
+type Mesh struct {
+	config   Config
+	id       string
+	received chan Message
+	swim     *swim // nil unless Config.FailureDetector
+
+	mutex  sync.Mutex
+	peers  map[string]*peer
+	closed bool
+
+	done   chan struct{}
+	ctx    context.Context // canceled on Close, to abort dials
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type peer struct {
+	id   string
+	conn net.Conn
+
+	writeMutex sync.Mutex
+	lastSeen   time.Time // guarded by Mesh.mutex
+
+	// probe is the unreliable Conn of the failure detector, used alone
+	// once a message from the peer is read from it. Guarded by Mesh.mutex.
+	probe          net.Conn
+	probeConfirmed bool
+}
+
+// NewMesh creates a Mesh accepting peers from the Listener, and dialing them
+// with the Dialer while fewer than MinPeers.
+func (c *Config) NewMesh() (*Mesh, error) {
+	if c.Dialer == nil && c.Listener == nil {
+		return nil, ErrNoDialer
+	}
+
+	config := *c
+	if config.ID == "" {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, fmt.Errorf("mesh: %w", err)
+		}
+		config.ID = hex.EncodeToString(b[:])
+	}
+	if len(config.ID) > MAX_ID_SIZE {
+		return nil, fmt.Errorf("mesh: ID longer than %d bytes", MAX_ID_SIZE)
+	}
+	if config.HeartbeatInterval == 0 {
+		config.HeartbeatInterval = HEARTBEAT_INTERVAL_DEFAULT
+	}
+	if config.PeerTimeout == 0 {
+		config.PeerTimeout = PEER_TIMEOUT_DEFAULT
+	}
+	if config.RedialInterval == 0 {
+		config.RedialInterval = REDIAL_INTERVAL_DEFAULT
+	}
+	if config.ProbeInterval == 0 {
+		config.ProbeInterval = PROBE_INTERVAL_DEFAULT
+	}
+	if config.ProbeTimeout == 0 {
+		config.ProbeTimeout = PROBE_TIMEOUT_DEFAULT
+	}
+	if config.SuspectTimeout == 0 {
+		config.SuspectTimeout = SUSPECT_TIMEOUT_DEFAULT
+	}
+	if config.FailureDetector && config.ProbeTimeout >= config.ProbeInterval {
+		return nil, errors.New("mesh: ProbeTimeout not less than ProbeInterval")
+	}
+	if config.Logger == nil {
+		config.Logger = logging.DefaultStderrLogger(logging.LOG_ERROR)
+	}
+
+	m := &Mesh{
+		config:   config,
+		id:       config.ID,
+		received: make(chan Message, RECEIVE_BUFFER),
+		peers:    make(map[string]*peer),
+		done:     make(chan struct{}),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	if config.FailureDetector {
+		m.swim = newSWIM(m)
+	}
+	if config.Listener != nil {
+		config.Listener.Handle(PROTOCOL, m.accept)
+		if m.swim != nil {
+			config.Listener.Handle(SWIM_PROTOCOL, m.swim.accept)
+		}
+	}
+
+	m.wg.Add(1)
+	go m.maintain()
+	if m.swim != nil {
+		m.wg.Add(1)
+		go m.swim.run()
+	}
+	return m, nil
+}
+
+// ID returns the ID of this peer.
+func (m *Mesh) ID() string {
+	return m.id
+}
+
+// Peers returns the IDs of the peers connected, sorted.
+func (m *Mesh) Peers() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ids := make([]string, 0, len(m.peers))
+	for id := range m.peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Connect dials a new peer and returns its ID once it joined the Mesh.
+func (m *Mesh) Connect(ctx context.Context) (string, error) {
+	if m.config.Dialer == nil {
+		return "", ErrNoDialer
+	}
+
+	conn, err := m.config.Dialer.DialContext(ctx, PROTOCOL, transportc.WithProtocol(PROTOCOL))
+	if err != nil {
+		return "", err
+	}
+	p, err := m.join(conn, true)
+	if err != nil {
+		return "", err
+	}
+	if m.swim != nil {
+		m.swim.dialProbe(ctx, p)
+	}
+	return p.id, nil
+}
+
+// SendTo sends msg to the peer of peerID.
+func (m *Mesh) SendTo(peerID string, msg []byte) error {
+	if len(msg) > MAX_MESSAGE_SIZE {
+		return ErrMessageTooLarge
+	}
+
+	m.mutex.Lock()
+	p, ok := m.peers[peerID]
+	m.mutex.Unlock()
+	if !ok {
+		return ErrUnknownPeer
+	}
+	return p.send(frameData, msg)
+}
+
+// Broadcast sends msg to all the peers, and returns the first error if any
+// failed.
+func (m *Mesh) Broadcast(msg []byte) error {
+	if len(msg) > MAX_MESSAGE_SIZE {
+		return ErrMessageTooLarge
+	}
+
+	m.mutex.Lock()
+	peers := make([]*peer, 0, len(m.peers))
+	for _, p := range m.peers {
+		peers = append(peers, p)
+	}
+	m.mutex.Unlock()
+
+	var firstErr error
+	for _, p := range peers {
+		if err := p.send(frameData, msg); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("mesh: send to %s: %w", p.id, err)
+		}
+	}
+	return firstErr
+}
+
+// Receive returns the next message received from any peer, blocking until
+// one is received, ctx is done or the Mesh is closed.
+func (m *Mesh) Receive(ctx context.Context) (Message, error) {
+	select {
+	case msg := <-m.received:
+		return msg, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-m.done:
+		return Message{}, ErrMeshClosed
+	}
+}
+
+// Close closes the Conns to all the peers. The Dialer and the Listener are
+// left open.
+func (m *Mesh) Close() error {
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return nil
+	}
+	m.closed = true
+	peers := m.peers
+	m.peers = make(map[string]*peer)
+	m.mutex.Unlock()
+
+	close(m.done)
+	m.cancel()
+	for _, p := range peers {
+		p.conn.Close()
+	}
+	m.wg.Wait()
+	return nil
+}
+
+// accept is the handler of the Conns of PROTOCOL accepted by the Listener.
+func (m *Mesh) accept(conn net.Conn) {
+	if _, err := m.join(conn, false); err != nil {
+		m.config.Logger.Debugf("mesh: failed to accept peer: %v", err)
+	}
+}
+
+// join exchanges hellos over conn, then adds the peer to the Mesh and starts
+// reading from it.
+func (m *Mesh) join(conn net.Conn, dialed bool) (*peer, error) {
+	p := &peer{conn: conn}
+	if err := p.send(frameHello, []byte(m.id)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(m.config.PeerTimeout))
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	n, err := conn.Read(buf)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if n < 2 || buf[0] != frameHello || n-1 > MAX_ID_SIZE {
+		conn.Close()
+		return nil, errors.New("mesh: malformed hello")
+	}
+	p.id = string(buf[1:n])
+	if p.id == m.id {
+		conn.Close()
+		return nil, ErrSelfConnected
+	}
+
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		conn.Close()
+		return nil, ErrMeshClosed
+	}
+	// If both peers dialed each other, the Conn dialed by the peer of lesser
+	// ID is kept by both.
+	if existing, ok := m.peers[p.id]; ok {
+		if dialed == (m.id > p.id) {
+			m.mutex.Unlock()
+			conn.Close()
+			return existing, nil
+		}
+		existing.conn.Close()
+	}
+	p.lastSeen = time.Now()
+	m.peers[p.id] = p
+	m.wg.Add(1) // before Close may wait
+	m.mutex.Unlock()
+
+	if m.config.OnPeerUp != nil {
+		m.config.OnPeerUp(p.id)
+	}
+	if m.swim != nil {
+		m.swim.peerUp(p)
+	}
+	go m.readLoop(p)
+	return p, nil
+}
+
+// readLoop reads the messages of p until its Conn fails, then removes it.
+func (m *Mesh) readLoop(p *peer) {
+	defer m.wg.Done()
+	defer m.leave(p)
+
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	for {
+		n, err := p.conn.Read(buf)
+		if err != nil {
+			m.config.Logger.Debugf("mesh: peer %s: %v", p.id, err)
+			return
+		}
+
+		m.mutex.Lock()
+		p.lastSeen = time.Now()
+		m.mutex.Unlock()
+
+		if n > 0 && buf[0] == frameSWIM && m.swim != nil {
+			m.swim.receive(p, buf[1:n])
+			continue
+		}
+		if n == 0 || buf[0] != frameData {
+			continue // heartbeats only refresh lastSeen
+		}
+		data := make([]byte, n-1)
+		copy(data, buf[1:n])
+		select {
+		case m.received <- Message{From: p.id, Data: data}:
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// leave removes p from the Mesh, unless replaced.
+func (m *Mesh) leave(p *peer) {
+	p.conn.Close()
+
+	m.mutex.Lock()
+	if p.probe != nil {
+		p.probe.Close()
+	}
+	current, ok := m.peers[p.id]
+	removed := ok && current == p
+	if removed {
+		delete(m.peers, p.id)
+	}
+	m.mutex.Unlock()
+
+	if removed && m.config.OnPeerDown != nil {
+		m.config.OnPeerDown(p.id)
+	}
+	if removed && m.swim != nil {
+		m.swim.peerDown(p)
+	}
+}
+
+// peer returns the peer of peerID, or nil if not connected.
+func (m *Mesh) peer(peerID string) *peer {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.peers[peerID]
+}
+
+// randomPeers returns up to n peers but except, in a random order.
+func (m *Mesh) randomPeers(n int, except *peer) []*peer {
+	m.mutex.Lock()
+	peers := make([]*peer, 0, len(m.peers))
+	for _, p := range m.peers {
+		if p != except {
+			peers = append(peers, p)
+		}
+	}
+	m.mutex.Unlock()
+
+	mrand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	if len(peers) > n {
+		peers = peers[:n]
+	}
+	return peers
+}
+
+// track adds a goroutine Close waits for, unless the Mesh is closed.
+func (m *Mesh) track() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return false
+	}
+	m.wg.Add(1)
+	return true
+}
+
+// maintain sends heartbeats, closes the peers timed out, and dials new peers
+// while fewer than MinPeers, until the Mesh is closed.
+func (m *Mesh) maintain() {
+	defer m.wg.Done()
+
+	heartbeat := time.NewTicker(m.config.HeartbeatInterval)
+	defer heartbeat.Stop()
+	redial := time.NewTicker(m.config.RedialInterval)
+	defer redial.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-heartbeat.C:
+			m.heartbeat()
+		case <-redial.C:
+			if m.config.Dialer == nil || len(m.Peers()) >= m.config.MinPeers {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(m.ctx, DIAL_TIMEOUT_DEFAULT)
+			if _, err := m.Connect(ctx); err != nil {
+				m.config.Logger.Debugf("mesh: failed to dial peer: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (m *Mesh) heartbeat() {
+	now := time.Now()
+	m.mutex.Lock()
+	peers := make([]*peer, 0, len(m.peers))
+	for _, p := range m.peers {
+		if now.Sub(p.lastSeen) > m.config.PeerTimeout {
+			p.conn.Close() // removed by its readLoop
+			continue
+		}
+		peers = append(peers, p)
+	}
+	m.mutex.Unlock()
+
+	for _, p := range peers {
+		p.send(frameHeartbeat, nil) // a failing peer is removed by its readLoop
+	}
+}
+
+// send sends a frame of type frameType with payload to the peer.
+func (p *peer) send(frameType byte, payload []byte) error {
+	frame := make([]byte, 1+len(payload))
+	frame[0] = frameType
+	copy(frame[1:], payload)
+
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	_, err := p.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,561 @@
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/bits"
+	mrand "math/rand" // skipcq: GSC-G404
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+const (
+	SWIM_PROTOCOL = "transportc-mesh-swim" // the DataChannel protocol of the unreliable Conns probing peers
+
+	PROBE_INTERVAL_DEFAULT  = time.Second
+	PROBE_TIMEOUT_DEFAULT   = 300 * time.Millisecond // before probing indirectly
+	SUSPECT_TIMEOUT_DEFAULT = 5 * time.Second        // before a suspect member is declared dead
+	DEAD_MEMBER_TTL         = time.Minute            // how long dead members are remembered
+	INDIRECT_PROBES         = 3                      // peers asked to probe a peer not acking
+	GOSSIP_MULTIPLIER       = 3                      // an update is piggybacked GOSSIP_MULTIPLIER*log2(members) times
+	MAX_GOSSIP_UPDATES      = 8                      // updates piggybacked on each probe
+	MAX_SYNC_UPDATES        = 64                     // updates per sync sent to a new peer
+
+	swimSync    uint8 = 0 // all the members known, sent to a new peer
+	swimPing    uint8 = 1
+	swimPingReq uint8 = 2 // asks to ping Target
+	swimAck     uint8 = 3
+)
+
+// MemberState is the state of a Member, as detected by the failure detector.
+type MemberState uint8
+
+const (
+	MEMBER_ALIVE   MemberState = iota
+	MEMBER_SUSPECT             // not acking probes, may refute until SuspectTimeout
+	MEMBER_DEAD
+)
+
+func (s MemberState) String() string {
+	switch s {
+	case MEMBER_ALIVE:
+		return "alive"
+	case MEMBER_SUSPECT:
+		return "suspect"
+	case MEMBER_DEAD:
+		return "dead"
+	default:
+		return "unknown"
+	}
+}
+
+// Member is a peer of the Mesh, connected or known from gossip.
+//
+// Incarnation is only increased by the member itself, to refute being
+// suspected.
+type Member struct {
+	ID          string      `json:"id"`
+	State       MemberState `json:"s"`
+	Incarnation uint32      `json:"i"`
+}
+
+// swimMessage is the envelope of every message of the failure detector.
+type swimMessage struct {
+	Type    uint8    `json:"t"`
+	From    string   `json:"f"`
+	Seq     uint32   `json:"q,omitempty"`
+	Target  string   `json:"x,omitempty"`
+	Updates []Member `json:"u,omitempty"` // gossip piggybacked
+}
+
+type member struct {
+	Member
+	changed time.Time // when State last changed
+	gossip  int       // times the update remains to be piggybacked
+}
+
+// relay is a ping sent on behalf of another peer, whose ack is relayed back.
+type relay struct {
+	to  *peer
+	seq uint32
+}
+
+// swim is a SWIM-style failure detector over the peers of a Mesh.
+//
+// Each ProbeInterval a peer is pinged, over an unreliable Conn of
+// SWIM_PROTOCOL if opened or the Conn of the peer otherwise. If not acked
+// within ProbeTimeout, up to INDIRECT_PROBES other peers are asked to ping
+// it. If still not acked, the peer is suspected, and declared dead after
+// SuspectTimeout unless it refutes the suspicion. Membership updates are
+// gossiped on the probes, so members not connected directly are known too.
+type swim struct {
+	m *Mesh
+
+	mutex       sync.Mutex
+	incarnation uint32
+	selfGossip  int // times the own state remains to be piggybacked
+	members     map[string]*member
+	seq         uint32
+	probes      map[uint32]chan struct{} // own probes waiting for an ack, by seq
+	relays      map[uint32]relay         // pings on behalf of other peers, by seq
+	order       []string                 // peers in probing order
+}
+
+func newSWIM(m *Mesh) *swim {
+	return &swim{
+		m:       m,
+		members: make(map[string]*member),
+		probes:  make(map[uint32]chan struct{}),
+		relays:  make(map[uint32]relay),
+	}
+}
+
+// Members returns the members known by the failure detector, neither dead
+// nor this peer, sorted by ID. It is nil if Config.FailureDetector is not
+// set.
+func (m *Mesh) Members() []Member {
+	if m.swim == nil {
+		return nil
+	}
+
+	s := m.swim
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	members := make([]Member, 0, len(s.members))
+	for _, mb := range s.members {
+		if mb.State != MEMBER_DEAD {
+			members = append(members, mb.Member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
+
+// run probes a peer every ProbeInterval, until the Mesh is closed.
+func (s *swim) run() {
+	defer s.m.wg.Done()
+
+	ticker := time.NewTicker(s.m.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.m.done:
+			return
+		case <-ticker.C:
+			s.expire()
+			if p := s.nextPeer(); p != nil {
+				s.probe(p)
+			}
+		}
+	}
+}
+
+// probe pings p, then asks other peers to ping it if not acked in time, and
+// suspects it if still not acked by the end of the ProbeInterval.
+func (s *swim) probe(p *peer) {
+	acked := make(chan struct{})
+	s.mutex.Lock()
+	s.seq++
+	seq := s.seq
+	s.probes[seq] = acked
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.probes, seq)
+		s.mutex.Unlock()
+	}()
+
+	s.send(p, swimMessage{Type: swimPing, Seq: seq})
+	timer := time.NewTimer(s.m.config.ProbeTimeout)
+	defer timer.Stop()
+	select {
+	case <-acked:
+		return
+	case <-s.m.done:
+		return
+	case <-timer.C:
+	}
+
+	for _, q := range s.m.randomPeers(INDIRECT_PROBES, p) {
+		s.send(q, swimMessage{Type: swimPingReq, Seq: seq, Target: p.id})
+	}
+	timer.Reset(s.m.config.ProbeInterval - s.m.config.ProbeTimeout)
+	select {
+	case <-acked:
+		return
+	case <-s.m.done:
+		return
+	case <-timer.C:
+	}
+
+	s.mutex.Lock()
+	mb, ok := s.members[p.id]
+	var incarnation uint32
+	if ok {
+		incarnation = mb.Incarnation
+	}
+	s.mutex.Unlock()
+	s.m.config.Logger.Debugf("mesh: peer %s not acking, suspected", p.id)
+	s.merge([]Member{{ID: p.id, State: MEMBER_SUSPECT, Incarnation: incarnation}})
+}
+
+// nextPeer returns the next peer to probe, in a random order renewed once
+// all the peers were probed.
+func (s *swim) nextPeer() *peer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for attempts := 0; attempts < 2; attempts++ {
+		for len(s.order) > 0 {
+			id := s.order[0]
+			s.order = s.order[1:]
+			if p := s.m.peer(id); p != nil {
+				return p
+			}
+		}
+		s.order = s.m.Peers()
+		mrand.Shuffle(len(s.order), func(i, j int) { s.order[i], s.order[j] = s.order[j], s.order[i] })
+	}
+	return nil
+}
+
+// expire declares dead the members suspected for longer than
+// SuspectTimeout, closing the Conns to those connected, and forgets the
+// members dead for longer than DEAD_MEMBER_TTL.
+func (s *swim) expire() {
+	now := time.Now()
+	var dead []Member
+	s.mutex.Lock()
+	for id, mb := range s.members {
+		switch {
+		case mb.State == MEMBER_SUSPECT && now.Sub(mb.changed) > s.m.config.SuspectTimeout:
+			dead = append(dead, Member{ID: id, State: MEMBER_DEAD, Incarnation: mb.Incarnation})
+		case mb.State == MEMBER_DEAD && now.Sub(mb.changed) > DEAD_MEMBER_TTL:
+			delete(s.members, id)
+		}
+	}
+	s.mutex.Unlock()
+
+	s.merge(dead)
+	for _, mb := range dead {
+		if p := s.m.peer(mb.ID); p != nil {
+			p.conn.Close() // removed by its readLoop
+		}
+	}
+}
+
+// peerUp adds p as an alive member if unknown, and sends it all the members
+// known.
+func (s *swim) peerUp(p *peer) {
+	s.merge([]Member{{ID: p.id, State: MEMBER_ALIVE}}) // ignored if known already
+
+	s.mutex.Lock()
+	updates := make([]Member, 0, len(s.members)+1)
+	updates = append(updates, Member{ID: s.m.id, State: MEMBER_ALIVE, Incarnation: s.incarnation})
+	for _, mb := range s.members {
+		updates = append(updates, mb.Member)
+	}
+	s.mutex.Unlock()
+
+	for len(updates) > 0 {
+		n := len(updates)
+		if n > MAX_SYNC_UPDATES {
+			n = MAX_SYNC_UPDATES
+		}
+		msg, err := json.Marshal(swimMessage{Type: swimSync, From: s.m.id, Updates: updates[:n]})
+		if err != nil {
+			return
+		}
+		if err := p.send(frameSWIM, msg); err != nil {
+			return
+		}
+		updates = updates[n:]
+	}
+}
+
+// peerDown suspects p, once its Conn is closed. The suspicion is refuted if
+// p is still alive and reachable through other peers.
+func (s *swim) peerDown(p *peer) {
+	s.mutex.Lock()
+	mb, ok := s.members[p.id]
+	s.mutex.Unlock()
+	if ok && mb.State == MEMBER_ALIVE {
+		s.merge([]Member{{ID: p.id, State: MEMBER_SUSPECT, Incarnation: mb.Incarnation}})
+	}
+}
+
+// merge applies the updates by their incarnation, refuting those suspecting
+// this peer, and calls OnMemberUp and OnMemberDown.
+func (s *swim) merge(updates []Member) {
+	var up, down []string
+	now := time.Now()
+
+	s.mutex.Lock()
+	retransmits := GOSSIP_MULTIPLIER * bits.Len(uint(len(s.members)+1))
+	for _, u := range updates {
+		if u.ID == "" || len(u.ID) > MAX_ID_SIZE {
+			continue
+		}
+		if u.ID == s.m.id {
+			if u.State != MEMBER_ALIVE && u.Incarnation >= s.incarnation {
+				s.incarnation = u.Incarnation + 1
+				s.selfGossip = retransmits
+			}
+			continue
+		}
+
+		mb, ok := s.members[u.ID]
+		if !ok {
+			if u.State == MEMBER_DEAD {
+				continue
+			}
+			s.members[u.ID] = &member{Member: u, changed: now, gossip: retransmits}
+			up = append(up, u.ID)
+			continue
+		}
+
+		switch u.State {
+		case MEMBER_ALIVE:
+			if u.Incarnation <= mb.Incarnation {
+				continue
+			}
+		case MEMBER_SUSPECT:
+			if mb.State == MEMBER_DEAD || u.Incarnation < mb.Incarnation ||
+				(u.Incarnation == mb.Incarnation && mb.State == MEMBER_SUSPECT) {
+				continue
+			}
+		case MEMBER_DEAD:
+			if mb.State == MEMBER_DEAD || u.Incarnation < mb.Incarnation {
+				continue
+			}
+		default:
+			continue
+		}
+
+		if mb.State == MEMBER_DEAD {
+			up = append(up, u.ID)
+		} else if u.State == MEMBER_DEAD {
+			down = append(down, u.ID)
+		}
+		if mb.State != u.State {
+			mb.changed = now
+		}
+		mb.Member = u
+		mb.gossip = retransmits
+	}
+	s.mutex.Unlock()
+
+	if s.m.config.OnMemberUp != nil {
+		for _, id := range up {
+			s.m.config.OnMemberUp(id)
+		}
+	}
+	if s.m.config.OnMemberDown != nil {
+		for _, id := range down {
+			s.m.config.OnMemberDown(id)
+		}
+	}
+}
+
+// piggyback returns the updates to gossip on the next message to p, the
+// least gossiped first. The state of p itself is always included if not
+// alive, so it may refute it.
+func (s *swim) piggyback(p *peer) []Member {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var updates []Member
+	if s.selfGossip > 0 {
+		s.selfGossip--
+		updates = append(updates, Member{ID: s.m.id, State: MEMBER_ALIVE, Incarnation: s.incarnation})
+	}
+	if mb, ok := s.members[p.id]; ok && mb.State != MEMBER_ALIVE {
+		updates = append(updates, mb.Member)
+	}
+
+	pending := make([]*member, 0, len(s.members))
+	for _, mb := range s.members {
+		if mb.gossip > 0 && mb.ID != p.id {
+			pending = append(pending, mb)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].gossip > pending[j].gossip })
+	for _, mb := range pending {
+		if len(updates) >= MAX_GOSSIP_UPDATES {
+			break
+		}
+		mb.gossip--
+		updates = append(updates, mb.Member)
+	}
+	return updates
+}
+
+// send sends msg to p with gossip piggybacked, over its unreliable Conn
+// once confirmed, or over its Conn otherwise.
+func (s *swim) send(p *peer, msg swimMessage) {
+	msg.From = s.m.id
+	msg.Updates = s.piggyback(p)
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	s.m.mutex.Lock()
+	probe, confirmed := p.probe, p.probeConfirmed
+	s.m.mutex.Unlock()
+	if probe != nil {
+		probe.Write(msgBytes) // lost messages are the point of probing
+	}
+	if !confirmed {
+		p.send(frameSWIM, msgBytes) // a failing peer is removed by its readLoop
+	}
+}
+
+// receive handles msgBytes received from p.
+func (s *swim) receive(p *peer, msgBytes []byte) {
+	var msg swimMessage
+	if err := json.Unmarshal(msgBytes, &msg); err != nil || msg.From != p.id {
+		return
+	}
+	s.handle(p, msg)
+}
+
+func (s *swim) handle(p *peer, msg swimMessage) {
+	s.merge(msg.Updates)
+
+	switch msg.Type {
+	case swimPing:
+		s.send(p, swimMessage{Type: swimAck, Seq: msg.Seq})
+	case swimPingReq:
+		if msg.Target == s.m.id {
+			s.send(p, swimMessage{Type: swimAck, Seq: msg.Seq})
+			return
+		}
+		target := s.m.peer(msg.Target)
+		if target == nil {
+			return // not connected, the peer asked others too
+		}
+		s.mutex.Lock()
+		s.seq++
+		seq := s.seq
+		s.relays[seq] = relay{to: p, seq: msg.Seq}
+		s.mutex.Unlock()
+		time.AfterFunc(s.m.config.ProbeInterval, func() {
+			s.mutex.Lock()
+			delete(s.relays, seq)
+			s.mutex.Unlock()
+		})
+		s.send(target, swimMessage{Type: swimPing, Seq: seq})
+	case swimAck:
+		s.mutex.Lock()
+		if acked, ok := s.probes[msg.Seq]; ok {
+			delete(s.probes, msg.Seq)
+			s.mutex.Unlock()
+			close(acked)
+			return
+		}
+		r, ok := s.relays[msg.Seq]
+		delete(s.relays, msg.Seq)
+		s.mutex.Unlock()
+		if ok {
+			s.send(r.to, swimMessage{Type: swimAck, Seq: r.seq})
+		}
+	}
+}
+
+// accept is the handler of the Conns of SWIM_PROTOCOL accepted by the
+// Listener.
+func (s *swim) accept(conn net.Conn) {
+	if !s.m.track() {
+		conn.Close()
+		return
+	}
+	s.readProbe(conn, nil)
+}
+
+// dialProbe dials an unreliable Conn to p, used once p is heard from over
+// it. Probes fall back to the Conn of p if it fails.
+func (s *swim) dialProbe(ctx context.Context, p *peer) {
+	conn, err := s.m.config.Dialer.DialDatagramContext(ctx, SWIM_PROTOCOL, transportc.WithProtocol(SWIM_PROTOCOL))
+	if err != nil {
+		s.m.config.Logger.Debugf("mesh: failed to dial probes to peer %s: %v", p.id, err)
+		return
+	}
+
+	s.m.mutex.Lock()
+	if s.m.closed || s.m.peers[p.id] != p || p.probe != nil {
+		s.m.mutex.Unlock()
+		conn.Close()
+		return
+	}
+	p.probe = conn
+	s.m.wg.Add(1) // before Close may wait
+	s.m.mutex.Unlock()
+
+	go s.readProbe(conn, p)
+}
+
+// readProbe reads the messages of an unreliable Conn, attaching it to the
+// peer they come from. If dialedTo is set, conn is closed once a message
+// from any other peer is read, e.g., if the Dialer did not reuse the
+// PeerConnection of dialedTo.
+func (s *swim) readProbe(conn net.Conn, dialedTo *peer) {
+	defer s.m.wg.Done()
+	defer conn.Close()
+
+	var attached *peer
+	defer func() {
+		if attached == nil {
+			return
+		}
+		s.m.mutex.Lock()
+		if attached.probe == conn {
+			attached.probe = nil
+			attached.probeConfirmed = false
+		}
+		s.m.mutex.Unlock()
+	}()
+
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	for {
+		n, err := conn.Read(buf)
+		if errors.Is(err, transportc.ErrMalformedDatagram) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		var msg swimMessage
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			continue
+		}
+
+		s.m.mutex.Lock()
+		p := s.m.peers[msg.From]
+		if dialedTo != nil && p != dialedTo {
+			s.m.mutex.Unlock()
+			return
+		}
+		if p == nil {
+			s.m.mutex.Unlock()
+			continue // not joined yet
+		}
+		if p.probe != nil && p.probe != conn {
+			p.probe.Close() // replaced
+		}
+		p.probe = conn
+		p.probeConfirmed = true
+		attached = p
+		s.m.mutex.Unlock()
+
+		s.handle(p, msg)
+	}
+}
@@ -0,0 +1,194 @@
+package transportc
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrUnknownNamespace is returned when an offer is signaled to a namespace
+	// not registered on the Listener, see Listener.Namespace.
+	ErrUnknownNamespace = errors.New("unknown namespace")
+
+	// ErrNamespaceFull is returned when an offer is signaled to a namespace
+	// already maintaining its max number of PeerConnections.
+	ErrNamespaceFull = errors.New("namespace is full")
+)
+
+// NamespaceOption configures a namespace of a Listener.
+type NamespaceOption func(*namespace)
+
+// WithNamespaceAllowedPeers only allows remote peers signing their SDP with
+// one of allowedPeers into the namespace, in addition to Config.AllowedPeers.
+func WithNamespaceAllowedPeers(allowedPeers ...ed25519.PublicKey) NamespaceOption {
+	return func(ns *namespace) {
+		ns.allowedPeers = allowedPeers
+	}
+}
+
+// WithNamespaceMaxPeerConnections limits the number of PeerConnections
+// maintained at once in the namespace. 0 for unlimited.
+func WithNamespaceMaxPeerConnections(maxPeerConnections int) NamespaceOption {
+	return func(ns *namespace) {
+		ns.maxPeerConnections = maxPeerConnections
+	}
+}
+
+// namespace is a virtual listener sharing the Signal and the ICE/DTLS stack
+// of a Listener, with its own Accept queue, limits and allowed peers.
+type namespace struct {
+	listener *Listener
+	name     string
+
+	allowedPeers       []ed25519.PublicKey
+	maxPeerConnections int
+	peers              atomic.Int32 // PeerConnections admitted and not removed yet
+
+	acceptQueue *acceptQueue
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+// Namespace registers a namespace on the Listener and returns the
+// net.Listener accepting the Conns dialed into it, i.e., by Dialers with
+// Config.Namespace set to name. This allows multiple tenants to share a
+// single Listener and Signal.
+//
+// Offers to a namespace not registered are rejected. If the namespace is
+// already registered, it is returned and opts are ignored. An empty name
+// is the Listener itself.
+//
+// Closing the returned net.Listener unregisters the namespace and closes
+// all its PeerConnections.
+func (l *Listener) Namespace(name string, opts ...NamespaceOption) net.Listener {
+	if name == "" {
+		return l
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if ns, ok := l.namespaces[name]; ok {
+		return ns
+	}
+
+	ns := &namespace{
+		listener:    l,
+		name:        name,
+		acceptQueue: newAcceptQueue(),
+		closed:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ns)
+	}
+	l.namespaces[name] = ns
+	return ns
+}
+
+// lookupNamespace returns the namespace of name, or nil for the Listener
+// itself, if the remote peer of identity is allowed into it or ticketed, see
+// Config.ListenerTicketKey.
+func (l *Listener) lookupNamespace(name string, identity ed25519.PublicKey, ticketed bool) (*namespace, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	l.mutex.Lock()
+	ns, ok := l.namespaces[name]
+	l.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownNamespace, name)
+	}
+
+	if len(ns.allowedPeers) > 0 && !ticketed {
+		if identity == nil {
+			return nil, ErrMissingIdentity
+		}
+		if !isAllowedPeer(ns.allowedPeers, identity) {
+			return nil, ErrUnauthorizedPeer
+		}
+	}
+	return ns, nil
+}
+
+// admitNamespacePeer checks if a new PeerConnection can be added to ns, and
+// counts it in if so. It is counted out once removed from the peerRegistry.
+func (l *Listener) admitNamespacePeer(ns *namespace) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.namespaces[ns.name] != ns {
+		return fmt.Errorf("%w: %q", ErrUnknownNamespace, ns.name) // closed meanwhile
+	}
+
+	if ns.maxPeerConnections > 0 && int(ns.peers.Load()) >= ns.maxPeerConnections {
+		return fmt.Errorf("%w: %q", ErrNamespaceFull, ns.name)
+	}
+	ns.peers.Add(1)
+	return nil
+}
+
+// Accept accepts the next Conn dialed into the namespace.
+func (ns *namespace) Accept() (net.Conn, error) {
+	for {
+		if conn, ok := ns.acceptQueue.pop(); ok {
+			return conn, nil
+		}
+		select {
+		case <-ns.acceptQueue.ready:
+		case <-ns.closed:
+			return nil, net.ErrClosed
+		}
+	}
+}
+
+// Close unregisters the namespace and closes all its PeerConnections.
+func (ns *namespace) Close() error {
+	l := ns.listener
+
+	l.mutex.Lock()
+	if l.namespaces[ns.name] == ns {
+		delete(l.namespaces, ns.name)
+	}
+	l.mutex.Unlock()
+
+	// no PeerConnection is admitted into ns from now on
+	var peers []*listenerPeer
+	l.peers.each(func(id uint64, peer *listenerPeer) bool {
+		if peer.namespace == ns {
+			if peer, ok := l.peers.remove(id); ok {
+				peers = append(peers, peer)
+			}
+		}
+		return true
+	})
+
+	closed := false
+	ns.closeOnce.Do(func() {
+		close(ns.closed)
+		closed = true
+	})
+	if !closed {
+		return net.ErrClosed
+	}
+	ns.acceptQueue.close()
+
+	for _, peer := range peers {
+		for _, conn := range peer.snapshot() {
+			conn.closeWith(CLOSE_REASON_LISTENER_CLOSED)
+		}
+	}
+	for _, peer := range peers {
+		peer.peerConnection.Close()
+	}
+	return nil
+}
+
+// Addr returns a placeholder address, as the Listener does.
+func (*namespace) Addr() net.Addr {
+	return &Addr{}
+}
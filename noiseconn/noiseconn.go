@@ -0,0 +1,253 @@
+// Package noiseconn secures a Conn with a post-connect Noise XX handshake
+// (Noise_XX_25519_ChaChaPoly_BLAKE2s), providing mutual authentication by
+// static keys and a second layer of encryption independent of DTLS.
+//
+// It is intended for message-oriented Conns such as transportc.Conn, where
+// each Write is delivered to the remote peer as one message by a single Read.
+package noiseconn
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/flynn/noise"
+)
+
+const (
+	// MAX_MESSAGE_SIZE is the maximum size of a Noise message.
+	MAX_MESSAGE_SIZE = 65535
+
+	// MAX_PLAINTEXT_SIZE is the maximum plaintext carried by one Noise message.
+	// Larger writes are split into multiple messages, smaller if the underlying
+	// Conn bounds its messages, see transportc.Config.MaxMessageSize.
+	MAX_PLAINTEXT_SIZE = MAX_MESSAGE_SIZE - AEAD_TAG_SIZE
+
+	// AEAD_TAG_SIZE is the size of the authentication tag of a Noise message.
+	AEAD_TAG_SIZE = 16
+)
+
+var cipherSuite = noise.NewCipherSuite(noise.DH25519, noise.CipherChaChaPoly, noise.HashBLAKE2s)
+
+var (
+	// ErrUnauthorizedPeer is returned when the remote static key is not in AllowedPeers.
+	ErrUnauthorizedPeer = errors.New("noiseconn: remote peer is not allowed")
+
+	// ErrNoStaticKeypair is returned when the Config has no StaticKeypair.
+	ErrNoStaticKeypair = errors.New("noiseconn: static keypair required")
+
+	// ErrBrokenConn is returned by Write once a previous Write failed after
+	// encrypting a message, as the nonces of the peers are out of sync.
+	ErrBrokenConn = errors.New("noiseconn: conn broken by a failed write")
+)
+
+// Keypair is a Curve25519 keypair identifying a peer.
+type Keypair = noise.DHKey
+
+// GenerateKeypair generates a new random Keypair.
+func GenerateKeypair() (Keypair, error) {
+	return cipherSuite.GenerateKeypair(rand.Reader)
+}
+
+// Config is the configuration for the Noise handshake.
+type Config struct {
+	// StaticKeypair is the long-term keypair identifying this peer.
+	StaticKeypair Keypair
+
+	// AllowedPeers, if set, restricts the remote peer to those whose static
+	// public key is in the list. Otherwise, any peer completing the handshake
+	// is accepted and its static public key is available via Conn.PeerStatic.
+	AllowedPeers [][]byte
+
+	// Prologue, if set, MUST be identical on both peers and is authenticated
+	// by the handshake, e.g., an application name and version.
+	Prologue []byte
+}
+
+// Conn is a net.Conn secured by Noise. Each Write of up to MAX_PLAINTEXT_SIZE
+// bytes is sent as one encrypted message over the underlying Conn.
+type Conn struct {
+	net.Conn
+
+	peerStatic []byte
+
+	writeMutex   sync.Mutex
+	send         *noise.CipherState
+	maxPlaintext int   // of a message, see messageSizer
+	writeErr     error // set once broken, see ErrBrokenConn
+
+	readMutex sync.Mutex
+	recv      *noise.CipherState
+	readBuf   []byte // decrypted but not yet read
+	msgBuf    []byte
+}
+
+// Client performs the Noise XX handshake as the initiator over conn.
+//
+// If ctx has a deadline, it is applied to conn during the handshake.
+func Client(ctx context.Context, conn net.Conn, config *Config) (*Conn, error) {
+	return handshake(ctx, conn, config, true)
+}
+
+// Server performs the Noise XX handshake as the responder over conn.
+//
+// If ctx has a deadline, it is applied to conn during the handshake.
+func Server(ctx context.Context, conn net.Conn, config *Config) (*Conn, error) {
+	return handshake(ctx, conn, config, false)
+}
+
+func handshake(ctx context.Context, conn net.Conn, config *Config, initiator bool) (*Conn, error) {
+	if config.StaticKeypair.Private == nil {
+		return nil, ErrNoStaticKeypair
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	hs, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:   cipherSuite,
+		Random:        rand.Reader,
+		Pattern:       noise.HandshakeXX,
+		Initiator:     initiator,
+		Prologue:      config.Prologue,
+		StaticKeypair: config.StaticKeypair,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// XX: -> e; <- e, ee, s, es; -> s, se
+	var cs1, cs2 *noise.CipherState
+	buf := make([]byte, MAX_MESSAGE_SIZE+1)
+	for i := 0; cs1 == nil; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if (i%2 == 0) == initiator { // our turn to write
+			var msg []byte
+			msg, cs1, cs2, err = hs.WriteMessage(nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := conn.Write(msg); err != nil {
+				return nil, err
+			}
+		} else {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			_, cs1, cs2, err = hs.ReadMessage(nil, buf[:n])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	peerStatic := hs.PeerStatic()
+	if len(config.AllowedPeers) > 0 {
+		allowed := false
+		for _, peer := range config.AllowedPeers {
+			if bytes.Equal(peer, peerStatic) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, ErrUnauthorizedPeer
+		}
+	}
+
+	c := &Conn{
+		Conn:         conn,
+		peerStatic:   peerStatic,
+		maxPlaintext: MAX_PLAINTEXT_SIZE,
+		msgBuf:       make([]byte, MAX_MESSAGE_SIZE+1),
+	}
+	if sizer, ok := conn.(messageSizer); ok && sizer.MaxMessageSize() < MAX_MESSAGE_SIZE && sizer.MaxMessageSize() > AEAD_TAG_SIZE {
+		c.maxPlaintext = sizer.MaxMessageSize() - AEAD_TAG_SIZE
+	}
+	if initiator {
+		c.send, c.recv = cs1, cs2
+	} else {
+		c.send, c.recv = cs2, cs1
+	}
+	return c, nil
+}
+
+// messageSizer is a Conn bounding the size of its messages, e.g.,
+// transportc.Conn.
+type messageSizer interface {
+	MaxMessageSize() int
+}
+
+// PeerStatic returns the static public key of the remote peer.
+func (c *Conn) PeerStatic() []byte {
+	return c.peerStatic
+}
+
+// Read reads decrypted data from the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	if len(c.readBuf) == 0 {
+		n, err := c.Conn.Read(c.msgBuf)
+		if err != nil {
+			return 0, err
+		}
+		plaintext, err := c.recv.Decrypt(nil, nil, c.msgBuf[:n])
+		if err != nil {
+			return 0, err
+		}
+		c.readBuf = plaintext
+	}
+
+	n := copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write encrypts p and writes it to the connection, split into multiple
+// messages if p is longer than MAX_PLAINTEXT_SIZE, or than the max message
+// size of the underlying Conn minus AEAD_TAG_SIZE.
+//
+// Once a message failed to be written, the Conn is broken and Write returns
+// ErrBrokenConn.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > c.maxPlaintext {
+			chunk = chunk[:c.maxPlaintext]
+		}
+
+		msg, err := c.send.Encrypt(nil, nil, chunk)
+		if err != nil {
+			c.writeErr = ErrBrokenConn
+			return written, err
+		}
+		if _, err := c.Conn.Write(msg); err != nil {
+			c.writeErr = ErrBrokenConn // the nonce is used, the remote peer expects the next one
+			return written, err
+		}
+
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
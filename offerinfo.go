@@ -0,0 +1,47 @@
+package transportc
+
+import (
+	"crypto/ed25519"
+	"errors"
+)
+
+var (
+	// ErrOfferRejected is returned when Config.ListenerOfferFilter rejects
+	// an offer.
+	ErrOfferRejected = errors.New("offer rejected")
+)
+
+// OfferInfo is what a Listener learns of an offer before negotiating its
+// PeerConnection, see Config.ListenerOfferFilter.
+//
+// Label, Protocol and Metadata are only submitted by a Dialer dialing with
+// WithOfferMetadata. Like the namespace, they are not covered by the
+// signature of Config.IdentityKey.
+type OfferInfo struct {
+	Label    string            // label of the DataChannel dialed with the offer
+	Protocol string            // protocol of the DataChannel dialed with the offer, see WithProtocol
+	Metadata map[string]string // application metadata
+
+	Namespace    string            // see Config.Namespace
+	PeerIdentity ed25519.PublicKey // nil if the offer is not signed
+}
+
+// WithOfferMetadata submits the label and protocol of the dialed Conn, along
+// with metadata, in the offer of the PeerConnection created for it, so the
+// Listener may route or reject it before the negotiation, see
+// Config.ListenerOfferFilter and Conn.OfferMetadata.
+//
+// It has no effect if the Conn is dialed on a PeerConnection already
+// negotiated, see Config.ReusePeerConnection.
+func WithOfferMetadata(metadata map[string]string) DialOption {
+	return func(o *dialOptions) {
+		o.submitOffer = true
+		o.metadata = metadata
+	}
+}
+
+// OfferMetadata returns the metadata the Dialer submitted in the offer of the
+// PeerConnection of an accepted Conn, see WithOfferMetadata, or nil.
+func (c *Conn) OfferMetadata() map[string]string {
+	return c.offerMetadata
+}
@@ -0,0 +1,111 @@
+// Package oteltrace implements transportc.Tracer with OpenTelemetry, so the
+// Dial, the signaling, the ICE gathering and the Accept of each PeerConnection
+// show up as spans in distributed traces.
+//
+// The trace of the Dialer is carried in its offers, so the spans of the
+// Listener join the trace of the Dial if both peers set a Tracer.
+package oteltrace
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gaukas/transportc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// INSTRUMENTATION_NAME is the name of the tracer created by NewTracer
+	// from the global TracerProvider.
+	INSTRUMENTATION_NAME = "github.com/gaukas/transportc"
+)
+
+// Tracer is a transportc.Tracer and transportc.TracePropagator starting
+// OpenTelemetry spans.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewTracer returns a Tracer of the global TracerProvider and
+// TextMapPropagator, see otel.SetTracerProvider and
+// otel.SetTextMapPropagator.
+func NewTracer() *Tracer {
+	return &Tracer{
+		tracer:     otel.Tracer(INSTRUMENTATION_NAME),
+		propagator: otel.GetTextMapPropagator(),
+	}
+}
+
+// NewTracerWith returns a Tracer starting spans with tracer and carrying the
+// trace in offers with propagator. If propagator is nil, the trace is not
+// carried.
+func NewTracerWith(tracer trace.Tracer, propagator propagation.TextMapPropagator) *Tracer {
+	return &Tracer{
+		tracer:     tracer,
+		propagator: propagator,
+	}
+}
+
+// Start implements transportc.Tracer.Start.
+func (t *Tracer) Start(ctx context.Context, name string, attributes ...transportc.TraceAttribute) (context.Context, transportc.Span) {
+	kvs := make([]attribute.KeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		kvs = append(kvs, keyValue(a))
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(kvs...))
+	return ctx, otelSpan{span}
+}
+
+// Inject implements transportc.TracePropagator.Inject.
+func (t *Tracer) Inject(ctx context.Context) map[string]string {
+	if t.propagator == nil {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract implements transportc.TracePropagator.Extract.
+func (t *Tracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if t.propagator == nil {
+		return ctx
+	}
+	return t.propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// keyValue converts a, with uint64 values such as offer IDs as decimal
+// strings, as OpenTelemetry has no unsigned attributes.
+func keyValue(a transportc.TraceAttribute) attribute.KeyValue {
+	switch v := a.Value.(type) {
+	case string:
+		return attribute.String(a.Key, v)
+	case bool:
+		return attribute.Bool(a.Key, v)
+	case int:
+		return attribute.Int(a.Key, v)
+	case uint64:
+		return attribute.String(a.Key, strconv.FormatUint(v, 10))
+	default:
+		return attribute.String(a.Key, fmt.Sprint(v))
+	}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+// End implements transportc.Span.End.
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,100 @@
+package transportc
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// PACER_SAMPLE_INTERVAL is the minimum interval between the throughput
+// samples passed to a Pacer, so writing small messages in a burst does not
+// sample over intervals too short to be meaningful.
+const PACER_SAMPLE_INTERVAL = 100 * time.Millisecond
+
+// Pacer paces the messages written to a Conn, e.g., to plug an adaptive
+// pacing algorithm such as a BBR-like estimator into the write path. See
+// Conn.SetPacer and Config.NewPacer.
+//
+// Pace is called before each message is written, including each message of
+// a Write split by Config.SplitLargeWrites, with the size of the message and
+// the estimate of the bandwidth, sampled at most every PACER_SAMPLE_INTERVAL
+// with the BufferedAmount up to date. The message is written once the
+// returned delay elapses, or right away if it is not positive. The delay is
+// cut short by the write deadline or by closing the Conn, and does not count
+// toward Config.DefaultWriteTimeout.
+//
+// Pace MUST be safe for concurrent use if the Conn is written concurrently.
+type Pacer interface {
+	Pace(size int, estimate BandwidthEstimate) (delay time.Duration)
+}
+
+// PacerFunc adapts a function to a Pacer.
+type PacerFunc func(size int, estimate BandwidthEstimate) time.Duration
+
+// Pace implements Pacer.
+func (f PacerFunc) Pace(size int, estimate BandwidthEstimate) time.Duration {
+	return f(size, estimate)
+}
+
+// connPacer is the Pacer of a Conn along with its bandwidth samples.
+type connPacer struct {
+	pacer Pacer
+
+	mutex    sync.Mutex
+	sampler  bandwidthSampler
+	sampled  time.Time
+	estimate BandwidthEstimate // last sampled
+}
+
+// SetPacer sets the Pacer of the Conn, replacing Config.NewPacer, or removes
+// it if pacer is nil. The throughput passed to pacer is sampled from the call.
+func (c *Conn) SetPacer(pacer Pacer) {
+	if pacer == nil {
+		c.pacer.Store(nil)
+		return
+	}
+
+	p := &connPacer{pacer: pacer, sampled: currentClock().Now()}
+	p.sampler.sample(c.peerConnection, p.sampled) // baseline
+	c.pacer.Store(p)
+}
+
+// pace waits for the delay returned by the Pacer of the Conn, if any, before
+// writing a message of size bytes, until dl is exceeded.
+func (c *Conn) pace(size int, dl *ioDeadline) error {
+	p := c.pacer.Load()
+	if p == nil {
+		return nil
+	}
+
+	delay := p.pacer.Pace(size, p.sample(c))
+	if delay <= 0 {
+		return nil
+	}
+	timer := currentClock().NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-dl.Done():
+		return &WriteError{Kind: WRITE_ERROR_DEADLINE, Err: os.ErrDeadlineExceeded}
+	case <-c.done:
+		return &WriteError{Kind: WRITE_ERROR_CLOSED, Err: net.ErrClosed}
+	}
+}
+
+// sample returns the BandwidthEstimate of c, sampled again if the last sample
+// is older than PACER_SAMPLE_INTERVAL.
+func (p *connPacer) sample(c *Conn) BandwidthEstimate {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if now := currentClock().Now(); now.Sub(p.sampled) >= PACER_SAMPLE_INTERVAL {
+		p.estimate = p.sampler.sample(c.peerConnection, p.sampled)
+		p.sampled = now
+	}
+	estimate := p.estimate
+	estimate.BufferedAmount = c.bufferedAmount()
+	return estimate
+}
@@ -0,0 +1,172 @@
+package pastesignal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	GITHUB_API_URL = "https://api.github.com"
+
+	gistMaxResponseSize = 16 * 1024 * 1024
+)
+
+// GistConfig configures a Gist.
+type GistConfig struct {
+	// GistID is the ID of the gist holding the pastes, which must exist and
+	// be editable with Token, e.g., a secret gist created for the purpose.
+	GistID string
+
+	// Token is a GitHub token with the gist scope.
+	Token string
+
+	// APIURL is the URL of the GitHub API. If empty, GITHUB_API_URL is used.
+	APIURL string
+
+	// HTTPClient sends the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// Gist is a Provider storing each paste as a file of a single GitHub gist,
+// named after the paste.
+type Gist struct {
+	gistURL string
+	token   string
+	client  *http.Client
+}
+
+// gist is the representation of a gist in the GitHub API.
+type gist struct {
+	Files map[string]*gistFile `json:"files"`
+}
+
+type gistFile struct {
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+	RawURL    string `json:"raw_url,omitempty"`
+}
+
+// NewGist creates a Gist from config.
+func NewGist(config *GistConfig) *Gist {
+	g := &Gist{
+		gistURL: strings.TrimSuffix(config.APIURL, "/") + "/gists/" + config.GistID,
+		token:   config.Token,
+		client:  config.HTTPClient,
+	}
+	if config.APIURL == "" {
+		g.gistURL = GITHUB_API_URL + "/gists/" + config.GistID
+	}
+	if g.client == nil {
+		g.client = http.DefaultClient
+	}
+	return g
+}
+
+// Create implements Provider.Create.
+// It adds a file of name to the gist.
+func (g *Gist) Create(ctx context.Context, name, content string) error {
+	return g.update(ctx, map[string]*gistFile{name: {Content: content}})
+}
+
+// List implements Provider.List.
+// The files of a gist have no creation time.
+func (g *Gist) List(ctx context.Context) ([]Paste, error) {
+	var current gist
+	if err := g.do(ctx, http.MethodGet, g.gistURL, nil, &current); err != nil {
+		return nil, err
+	}
+
+	pastes := make([]Paste, 0, len(current.Files))
+	for name := range current.Files {
+		pastes = append(pastes, Paste{ID: name, Name: name})
+	}
+	return pastes, nil
+}
+
+// Read implements Provider.Read.
+func (g *Gist) Read(ctx context.Context, id string) (string, error) {
+	var current gist
+	if err := g.do(ctx, http.MethodGet, g.gistURL, nil, &current); err != nil {
+		return "", err
+	}
+
+	file, ok := current.Files[id]
+	if !ok || file == nil {
+		return "", ErrPasteNotFound
+	}
+	if !file.Truncated {
+		return file.Content, nil
+	}
+
+	// content of large files is only served raw
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.RawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gist: GET %s: %s", file.RawURL, resp.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, gistMaxResponseSize))
+	return string(content), err
+}
+
+// Delete implements Provider.Delete.
+// It removes the file of id from the gist.
+func (g *Gist) Delete(ctx context.Context, id string) error {
+	err := g.update(ctx, map[string]*gistFile{id: nil}) // a null file is deleted
+	if err == errGistUnprocessable {
+		return ErrPasteNotFound // the GitHub API refuses to delete missing files
+	}
+	return err
+}
+
+var errGistUnprocessable = fmt.Errorf("gist: %s", http.StatusText(http.StatusUnprocessableEntity))
+
+// update updates the files of the gist.
+func (g *Gist) update(ctx context.Context, files map[string]*gistFile) error {
+	body, err := json.Marshal(gist{Files: files})
+	if err != nil {
+		return err
+	}
+	return g.do(ctx, http.MethodPatch, g.gistURL, body, nil)
+}
+
+// do sends an authenticated request to the GitHub API, decoding the response
+// into v if not nil.
+func (g *Gist) do(ctx context.Context, method, url string, body []byte, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnprocessableEntity:
+		return errGistUnprocessable
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("gist: %s %s: %s", method, url, resp.Status)
+	case v == nil:
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, gistMaxResponseSize)).Decode(v)
+}
@@ -0,0 +1,240 @@
+// Package pastesignal implements transportc.KVStore with paste services,
+// e.g., GitHub Gist, so peers rendezvous through a dead drop on a ubiquitous
+// web service, with no broker of their own.
+//
+// A paste service is plugged in as a Provider, a small adapter creating,
+// listing, reading and deleting the pastes of an account or a collection with
+// its token. See Gist for the adapter of GitHub Gist.
+package pastesignal
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+const (
+	// DEFAULT_POLL_INTERVAL is how often a Store lists the pastes at most, as
+	// paste services are rate limited.
+	DEFAULT_POLL_INTERVAL = 5 * time.Second
+)
+
+var (
+	// ErrPasteNotFound is returned by a Provider reading or deleting a paste
+	// that does not exist.
+	ErrPasteNotFound = errors.New("paste not found")
+)
+
+// Paste is a paste listed by a Provider.
+type Paste struct {
+	ID      string    // the ID of the paste in the service, to read or delete it
+	Name    string    // the name given on Create, e.g., the title or the filename
+	Created time.Time // the creation time, or the zero time if unknown
+}
+
+// Provider is the adapter of a paste service. The pastes are text, and are
+// named by a Store with the characters of unpadded base64url only.
+type Provider interface {
+	// Create creates a paste of name with content.
+	Create(ctx context.Context, name, content string) error
+
+	// List returns the pastes.
+	List(ctx context.Context) ([]Paste, error)
+
+	// Read returns the content of the paste of id, or ErrPasteNotFound.
+	Read(ctx context.Context, id string) (string, error)
+
+	// Delete deletes the paste of id, or returns ErrPasteNotFound.
+	Delete(ctx context.Context, id string) error
+}
+
+// Store is a transportc.KVStore over a Provider. Each key is a paste, named
+// after the key and holding the value encoded in base64.
+//
+// Paste services have neither conditional creates nor atomic deletes, so two
+// Listeners polling the same Provider may both read an offer. Only the first
+// answer is kept, the other Listener fails to answer with
+// transportc.ErrInvalidOfferID.
+type Store struct {
+	provider     Provider
+	pollInterval time.Duration
+
+	mutex  sync.Mutex
+	pastes map[string]Paste // by key, as of listed
+	keys   []string         // oldest first
+	listed time.Time
+}
+
+// NewStore creates a Store over provider listing the pastes at most once per
+// pollInterval. If pollInterval is zero, DEFAULT_POLL_INTERVAL is used.
+func NewStore(provider Provider, pollInterval time.Duration) *Store {
+	if pollInterval == 0 {
+		pollInterval = DEFAULT_POLL_INTERVAL
+	}
+
+	return &Store{
+		provider:     provider,
+		pollInterval: pollInterval,
+	}
+}
+
+// NewSignal returns a transportc.KVSignal storing its state as pastes of
+// provider under prefix, see transportc.NewKVSignal.
+func NewSignal(provider Provider, prefix string, ttl time.Duration) *transportc.KVSignal {
+	return transportc.NewKVSignal(NewStore(provider, 0), prefix, ttl)
+}
+
+// Create implements transportc.KVStore.Create.
+// It lists the pastes to not create an existing key twice. The TTL is left to
+// the paste service, if it has any.
+func (s *Store) Create(ctx context.Context, key string, value []byte, _ time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.list(ctx, true); err != nil {
+		return err
+	}
+	if _, ok := s.pastes[key]; ok {
+		return transportc.ErrKVKeyExists
+	}
+
+	err := s.provider.Create(ctx, base64.RawURLEncoding.EncodeToString([]byte(key)), base64.StdEncoding.EncodeToString(value))
+	s.listed = time.Time{} // list the new paste next time
+	if err != nil {
+		return fmt.Errorf("pastesignal: %w", err)
+	}
+	return nil
+}
+
+// Take implements transportc.KVStore.Take.
+// It reads then deletes the paste of key, which is not atomic.
+func (s *Store) Take(ctx context.Context, key string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.list(ctx, false); err != nil {
+		return nil, err
+	}
+	paste, ok := s.pastes[key]
+	if !ok {
+		return nil, transportc.ErrKVKeyNotFound
+	}
+	s.forget(key)
+
+	content, err := s.provider.Read(ctx, paste.ID)
+	if errors.Is(err, ErrPasteNotFound) {
+		return nil, transportc.ErrKVKeyNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("pastesignal: %w", err)
+	}
+	value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+	if err != nil {
+		return nil, fmt.Errorf("pastesignal: %w", err)
+	}
+
+	err = s.provider.Delete(ctx, paste.ID)
+	if errors.Is(err, ErrPasteNotFound) {
+		return nil, transportc.ErrKVKeyNotFound // taken by another reader
+	} else if err != nil {
+		return nil, fmt.Errorf("pastesignal: %w", err)
+	}
+	return value, nil
+}
+
+// Keys implements transportc.KVStore.Keys.
+// The pastes are listed at most once per poll interval.
+func (s *Store) Keys(ctx context.Context, prefix string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.list(ctx, false); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, key := range s.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Watch implements transportc.KVStore.Watch.
+// Paste services have no watches, so it lists the pastes every poll interval,
+// notifying while there are any under prefix.
+func (s *Store) Watch(ctx context.Context, prefix string) <-chan struct{} {
+	notify := make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			keys, err := s.Keys(ctx, prefix)
+			if err != nil || len(keys) == 0 {
+				continue
+			}
+			select {
+			case notify <- struct{}{}:
+			default: // a notification is already pending
+			}
+		}
+	}()
+	return notify
+}
+
+// list lists the pastes of the Provider, unless listed within the poll
+// interval and not fresh. s.mutex must be held.
+func (s *Store) list(ctx context.Context, fresh bool) error {
+	if !fresh && time.Since(s.listed) < s.pollInterval {
+		return nil
+	}
+
+	pastes, err := s.provider.List(ctx)
+	if err != nil {
+		return fmt.Errorf("pastesignal: %w", err)
+	}
+	sort.SliceStable(pastes, func(i, j int) bool {
+		return pastes[i].Created.Before(pastes[j].Created)
+	})
+
+	s.pastes = make(map[string]Paste, len(pastes))
+	s.keys = s.keys[:0]
+	for _, paste := range pastes {
+		key, err := base64.RawURLEncoding.DecodeString(paste.Name)
+		if err != nil {
+			continue // not created by a Store
+		}
+		if _, ok := s.pastes[string(key)]; ok {
+			continue // created twice, the oldest is kept
+		}
+		s.pastes[string(key)] = paste
+		s.keys = append(s.keys, string(key))
+	}
+	s.listed = time.Now()
+	return nil
+}
+
+// forget removes key from the pastes listed. s.mutex must be held.
+func (s *Store) forget(key string) {
+	delete(s.pastes, key)
+	for i := range s.keys {
+		if s.keys[i] == key {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			break
+		}
+	}
+}
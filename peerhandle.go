@@ -0,0 +1,135 @@
+package transportc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+var (
+	// ErrPeerHandleWithoutSignal is returned by Dialer.DialPeer if no Signal
+	// is configured.
+	ErrPeerHandleWithoutSignal = errors.New("dialing a peer requires a Signal")
+
+	// ErrPeerHandleClosed is returned by a Dial on a closed PeerHandle.
+	ErrPeerHandleClosed = errors.New("peer handle closed")
+)
+
+const (
+	DIAL_PEER_POLL_INTERVAL = 50 * time.Millisecond
+)
+
+// PeerHandle is a PeerConnection dialed by Dialer.DialPeer, on which the
+// caller dials Conns, and later adds media tracks, sharing the same ICE and
+// DTLS transports.
+//
+// Unlike the PeerConnection of Dialer.Dial, it is never replaced: once it
+// fails or is closed, following Dials fail. It is owned by the caller and not
+// closed along with the Dialer.
+type PeerHandle struct {
+	dialer *Dialer
+	peer   dialerPeer
+}
+
+// DialPeer negotiates a new PeerConnection with the remote peer via the
+// Signal and waits until it is connected, without opening any Conn yet.
+func (d *Dialer) DialPeer(ctx context.Context) (handle *PeerHandle, err error) {
+	if d.signal == nil {
+		return nil, ErrPeerHandleWithoutSignal
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ctx, span := startSpan(ctx, d.tracer, SPAN_DIAL)
+	defer func() {
+		span.End(err)
+	}()
+
+	handle = &PeerHandle{dialer: d}
+	p := &handle.peer
+	p.dedicated = true
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pregathered, err := d.acquirePeerConnection(p)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			p.peerConnection.Close()
+			p.peerConnection = nil
+		}
+	}()
+
+	// Without a DataChannel, the offer would lack the SCTP media section
+	if !pregathered {
+		if err = createPregatherDataChannel(p.peerConnection); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = d.negotiatePeerConnection(ctx, p, pregathered); err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(DIAL_PEER_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		switch p.peerConnection.ConnectionState() {
+		case webrtc.PeerConnectionStateConnected:
+			d.storeTicket(p.issuedTicket)
+			return handle, nil
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			return nil, errors.New("dialer: PeerConnection failed to connect")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("dialer: context done before PeerConnection connected: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dial dials a Conn over the PeerConnection of h, see Dialer.Dial.
+func (h *PeerHandle) Dial(label string, opts ...DialOption) (net.Conn, error) {
+	return h.DialContext(context.Background(), label, opts...)
+}
+
+// DialContext dials a Conn over the PeerConnection of h using the provided
+// context, see Dialer.DialContext.
+func (h *PeerHandle) DialContext(ctx context.Context, label string, opts ...DialOption) (net.Conn, error) {
+	conn, err := h.dialer.dialPeer(ctx, &h.peer, label, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// PeerConnection returns the PeerConnection of h, e.g., to add media tracks.
+// Tracks added after DialPeer need a renegotiation, which the Signal exchange
+// does not carry yet. It returns nil once h is closed.
+func (h *PeerHandle) PeerConnection() *webrtc.PeerConnection {
+	h.peer.mutex.Lock()
+	defer h.peer.mutex.Unlock()
+	return h.peer.peerConnection
+}
+
+// Close closes the PeerConnection of h and with it all the Conns dialed on it.
+func (h *PeerHandle) Close() error {
+	h.peer.mutex.Lock()
+	defer h.peer.mutex.Unlock()
+	if h.peer.peerConnection == nil {
+		return nil
+	}
+	err := h.peer.peerConnection.Close()
+	h.peer.peerConnection = nil
+	return err
+}
@@ -0,0 +1,125 @@
+package transportc
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// listenerPeer is a PeerConnection maintained by the Listener, along with the
+// Conns accepted from it.
+type listenerPeer struct {
+	peerConnection *webrtc.PeerConnection
+	namespace      *namespace       // nil for the Listener itself
+	restart        *restartablePeer // nil unless restartTimeout is set
+
+	mutex sync.Mutex         // guards conns and restart
+	conns map[*Conn]struct{} // accepted Conns
+}
+
+func newListenerPeer(peerConnection *webrtc.PeerConnection, ns *namespace, restart *restartablePeer) *listenerPeer {
+	return &listenerPeer{
+		peerConnection: peerConnection,
+		namespace:      ns,
+		restart:        restart,
+		conns:          make(map[*Conn]struct{}),
+	}
+}
+
+func (p *listenerPeer) addConn(conn *Conn) {
+	p.mutex.Lock()
+	p.conns[conn] = struct{}{}
+	p.mutex.Unlock()
+}
+
+func (p *listenerPeer) removeConn(conn *Conn) {
+	p.mutex.Lock()
+	delete(p.conns, conn)
+	p.mutex.Unlock()
+}
+
+// snapshot returns the Conns accepted from p, to be called into without
+// holding the mutex of p.
+func (p *listenerPeer) snapshot() []*Conn {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	conns := make([]*Conn, 0, len(p.conns))
+	for conn := range p.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// peerRegistry is the PCID:listenerPeer registry of a Listener.
+//
+// It is built on sync.Map rather than a Listener-wide mutex, as the
+// callbacks of pion may run on the goroutine of PeerConnection.Close, e.g.,
+// OnICEConnectionStateChange, and would deadlock on a mutex held by the
+// caller of Close. The Listener follows two rules to keep all its callbacks
+// reentrant:
+//   - the mutex of a listenerPeer only guards its own fields, and is never
+//     held while calling into pion or a Conn;
+//   - PeerConnection.Close is only called once removed from the registry,
+//     without holding any lock.
+//
+// So any callback of a PeerConnection may look up, remove or close peers,
+// including its own, and is never blocked by another PeerConnection.
+type peerRegistry struct {
+	peers sync.Map // uint64:*listenerPeer
+	size  atomic.Int64
+}
+
+// add registers peer under id. It returns false if id is taken.
+func (r *peerRegistry) add(id uint64, peer *listenerPeer) bool {
+	if _, loaded := r.peers.LoadOrStore(id, peer); loaded {
+		return false
+	}
+	r.size.Add(1)
+	return true
+}
+
+func (r *peerRegistry) get(id uint64) (*listenerPeer, bool) {
+	peer, ok := r.peers.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return peer.(*listenerPeer), true
+}
+
+// remove unregisters the peer of id and returns it, if any. Only one of
+// concurrent calls for the same id gets the peer.
+func (r *peerRegistry) remove(id uint64) (*listenerPeer, bool) {
+	peer, ok := r.peers.LoadAndDelete(id)
+	if !ok {
+		return nil, false
+	}
+	r.size.Add(-1)
+	p := peer.(*listenerPeer)
+	if p.namespace != nil {
+		p.namespace.peers.Add(-1)
+	}
+	return p, true
+}
+
+// removeIf unregisters the peer of id if it is still peer.
+func (r *peerRegistry) removeIf(id uint64, peer *listenerPeer) bool {
+	if p, ok := r.get(id); !ok || p != peer {
+		return false
+	}
+	_, ok := r.remove(id)
+	return ok
+}
+
+// each calls f for each peer registered, until f returns false. Peers
+// added or removed meanwhile may or may not be visited.
+func (r *peerRegistry) each(f func(id uint64, peer *listenerPeer) bool) {
+	r.peers.Range(func(id, peer interface{}) bool {
+		return f(id.(uint64), peer.(*listenerPeer))
+	})
+}
+
+func (r *peerRegistry) len() int {
+	return int(r.size.Load())
+}
@@ -0,0 +1,326 @@
+package transportc
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	PEX_PROTOCOL      = "transportc-pex" // the DataChannel protocol of peer exchange Conns, see WithProtocol
+	PEX_OFFER_BUFFER  = 64
+	PEX_POLL_INTERVAL = time.Second
+	PEX_ROUTE_TTL     = time.Minute // how long answers are routed back to the offerer
+	PEX_MAX_ENDPOINTS = 256         // max broker endpoints known
+
+	pexMaxEndpointSize = 2048
+
+	pexTypeEndpoints = "endpoints"
+	pexTypeOffer     = "offer"
+	pexTypeAnswer    = "answer"
+)
+
+var (
+	// ErrPEXNoPeers is returned by PeerExchange.Offer when no peer exchange
+	// Conn is served.
+	ErrPEXNoPeers = errors.New("no peer to exchange with")
+)
+
+// pexMessage is the envelope of every message exchanged over a peer
+// exchange Conn.
+type pexMessage struct {
+	Type      string   `json:"t"`           // "endpoints", "offer" or "answer"
+	Endpoints []string `json:"e,omitempty"` // broker endpoints known
+	ID        uint64   `json:"id,omitempty"`
+	Hops      uint8    `json:"h,omitempty"` // times the offer was forwarded
+	Body      []byte   `json:"b,omitempty"` // SDP offer or answer
+}
+
+// pexPeer is a peer exchange Conn served.
+type pexPeer struct {
+	conn       net.Conn
+	writeMutex sync.Mutex
+}
+
+func (p *pexPeer) send(msg pexMessage) error {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	_, err = p.conn.Write(msgBytes)
+	return err
+}
+
+type pexRoute struct {
+	from     *pexPeer    // the peer the offer came from, nil for own offers
+	answered bool        // an answer was sent to from
+	answer   chan []byte // the answer to an own offer
+	expires  time.Time
+}
+
+// PeerExchange is an optional in-band protocol between connected peers to
+// grow a mesh without central signaling for every edge.
+//
+// Peers share the broker endpoints they know, e.g., URLs of HTTPSignal
+// brokers, gossiping the new ones to their other peers. A PeerExchange is
+// also a Signal over the peer exchange Conns: offers are sent to all the
+// peers, which may answer them with a Listener, and forward them to their own
+// peers up to maxHops times so peers not connected yet find each other. The
+// answers are routed back along the path of the offer.
+//
+// Conns are served with Serve, e.g., dialed with WithProtocol(PEX_PROTOCOL)
+// and routed by Listener.Handle(PEX_PROTOCOL, px.Handle).
+//
+// ReadOffer blocks for up to PEX_POLL_INTERVAL before returning
+// ErrOfferNotReady. ReadAnswer does not block, it returns ErrAnswerNotReady
+// instead.
+type PeerExchange struct {
+	maxHops uint8
+
+	mutex     sync.Mutex
+	endpoints map[string]bool
+	peers     map[*pexPeer]bool
+	routes    map[uint64]*pexRoute // offers sent or received, by offerID
+
+	offers chan offer
+}
+
+// NewPeerExchange creates a PeerExchange sharing endpoints, and forwarding
+// the offers received up to maxHops times. If maxHops is zero, offers are
+// only exchanged between directly connected peers.
+func NewPeerExchange(maxHops uint8, endpoints ...string) *PeerExchange {
+	px := &PeerExchange{
+		maxHops:   maxHops,
+		endpoints: make(map[string]bool),
+		peers:     make(map[*pexPeer]bool),
+		routes:    make(map[uint64]*pexRoute),
+		offers:    make(chan offer, PEX_OFFER_BUFFER),
+	}
+	px.addEndpoints(endpoints)
+	return px
+}
+
+// Endpoints returns the broker endpoints known, shared by the peers or added
+// with AddEndpoints, sorted.
+func (px *PeerExchange) Endpoints() []string {
+	px.mutex.Lock()
+	defer px.mutex.Unlock()
+
+	endpoints := make([]string, 0, len(px.endpoints))
+	for endpoint := range px.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// AddEndpoints adds broker endpoints, shared with all the peers.
+func (px *PeerExchange) AddEndpoints(endpoints ...string) {
+	if added := px.addEndpoints(endpoints); len(added) > 0 {
+		px.broadcast(pexMessage{Type: pexTypeEndpoints, Endpoints: added}, nil)
+	}
+}
+
+// Handle serves conn, then closes it. It is the handler of Listener.Handle.
+func (px *PeerExchange) Handle(conn net.Conn) {
+	px.Serve(conn) // returns once conn fails, e.g., closed by the peer
+	conn.Close()
+}
+
+// Serve exchanges with the peer over conn, until conn fails or is closed.
+func (px *PeerExchange) Serve(conn net.Conn) error {
+	peer := &pexPeer{conn: conn}
+	px.mutex.Lock()
+	px.peers[peer] = true
+	px.mutex.Unlock()
+	defer func() {
+		px.mutex.Lock()
+		delete(px.peers, peer)
+		px.mutex.Unlock()
+	}()
+
+	if endpoints := px.Endpoints(); len(endpoints) > 0 {
+		if err := peer.send(pexMessage{Type: pexTypeEndpoints, Endpoints: endpoints}); err != nil {
+			return err
+		}
+	}
+
+	decoder := json.NewDecoder(NewStreamConn(conn)) // messages may exceed the buffer of the decoder
+	for {
+		var msg pexMessage
+		if err := decoder.Decode(&msg); err != nil {
+			return err
+		}
+		px.receive(peer, msg)
+	}
+}
+
+// Offer implements Signal.Offer.
+// It sends the offer to all the peers under a new random offerID.
+func (px *PeerExchange) Offer(offerBody []byte) (uint64, error) {
+	route := &pexRoute{answer: make(chan []byte, 1), expires: time.Now().Add(PEX_ROUTE_TTL)}
+
+	px.mutex.Lock()
+	if len(px.peers) == 0 {
+		px.mutex.Unlock()
+		return 0, ErrPEXNoPeers
+	}
+	px.pruneRoutes()
+	var id uint64
+	for {
+		id = randomUint64()
+		if _, ok := px.routes[id]; !ok {
+			break
+		}
+	}
+	px.routes[id] = route
+	px.mutex.Unlock()
+
+	px.broadcast(pexMessage{Type: pexTypeOffer, ID: id, Body: offerBody}, nil)
+	return id, nil
+}
+
+// ReadOffer implements Signal.ReadOffer.
+// It blocks for up to PEX_POLL_INTERVAL before returning ErrOfferNotReady.
+func (px *PeerExchange) ReadOffer() (uint64, []byte, error) {
+	select {
+	case o := <-px.offers:
+		return o.id, o.body, nil
+	case <-time.After(PEX_POLL_INTERVAL):
+		return 0, nil, ErrOfferNotReady
+	}
+}
+
+// Answer implements Signal.Answer.
+// It sends the answer back to the peer the offer came from.
+func (px *PeerExchange) Answer(offerID uint64, answer []byte) error {
+	px.mutex.Lock()
+	route, ok := px.routes[offerID]
+	if !ok || route.from == nil || route.answered {
+		px.mutex.Unlock()
+		return ErrInvalidOfferID
+	}
+	route.answered = true
+	px.mutex.Unlock()
+
+	return route.from.send(pexMessage{Type: pexTypeAnswer, ID: offerID, Body: answer})
+}
+
+// ReadAnswer implements Signal.ReadAnswer.
+// It returns the first answer received from any peer.
+func (px *PeerExchange) ReadAnswer(offerID uint64) ([]byte, error) {
+	px.mutex.Lock()
+	route, ok := px.routes[offerID]
+	px.mutex.Unlock()
+	if !ok || route.answer == nil {
+		return nil, ErrInvalidOfferID
+	}
+
+	select {
+	case answer := <-route.answer:
+		px.mutex.Lock()
+		delete(px.routes, offerID)
+		px.mutex.Unlock()
+		return answer, nil
+	default:
+		return nil, ErrAnswerNotReady
+	}
+}
+
+// receive handles msg received from peer.
+func (px *PeerExchange) receive(peer *pexPeer, msg pexMessage) {
+	switch msg.Type {
+	case pexTypeEndpoints:
+		if added := px.addEndpoints(msg.Endpoints); len(added) > 0 {
+			px.broadcast(pexMessage{Type: pexTypeEndpoints, Endpoints: added}, peer) // gossip the new ones only
+		}
+	case pexTypeOffer:
+		px.mutex.Lock()
+		px.pruneRoutes()
+		if _, ok := px.routes[msg.ID]; ok {
+			px.mutex.Unlock()
+			return // seen already, e.g., forwarded in a loop
+		}
+		px.routes[msg.ID] = &pexRoute{from: peer, expires: time.Now().Add(PEX_ROUTE_TTL)}
+		px.mutex.Unlock()
+
+		select {
+		case px.offers <- offer{id: msg.ID, body: msg.Body}:
+		default: // drop the offer if nobody is reading
+		}
+		if msg.Hops < px.maxHops {
+			msg.Hops++
+			px.broadcast(msg, peer)
+		}
+	case pexTypeAnswer:
+		px.mutex.Lock()
+		route, ok := px.routes[msg.ID]
+		var from *pexPeer
+		if ok && route.from != nil && !route.answered {
+			route.answered = true
+			from = route.from
+		}
+		px.mutex.Unlock()
+
+		if ok && route.answer != nil {
+			select {
+			case route.answer <- msg.Body:
+			default: // answered by another peer already
+			}
+		} else if from != nil {
+			from.send(msg) // forward along the path of the offer
+		}
+	}
+}
+
+// broadcast sends msg to all the peers but except.
+func (px *PeerExchange) broadcast(msg pexMessage, except *pexPeer) {
+	px.mutex.Lock()
+	peers := make([]*pexPeer, 0, len(px.peers))
+	for peer := range px.peers {
+		if peer != except {
+			peers = append(peers, peer)
+		}
+	}
+	px.mutex.Unlock()
+
+	for _, peer := range peers {
+		peer.send(msg) // a failing peer stops being served
+	}
+}
+
+// addEndpoints adds endpoints up to PEX_MAX_ENDPOINTS, and returns those not
+// known before.
+func (px *PeerExchange) addEndpoints(endpoints []string) []string {
+	px.mutex.Lock()
+	defer px.mutex.Unlock()
+
+	var added []string
+	for _, endpoint := range endpoints {
+		if len(px.endpoints) >= PEX_MAX_ENDPOINTS {
+			break
+		}
+		if endpoint == "" || len(endpoint) > pexMaxEndpointSize || px.endpoints[endpoint] {
+			continue
+		}
+		px.endpoints[endpoint] = true
+		added = append(added, endpoint)
+	}
+	return added
+}
+
+// pruneRoutes removes the expired routes. px.mutex must be held.
+func (px *PeerExchange) pruneRoutes() {
+	now := time.Now()
+	for id, route := range px.routes {
+		if now.After(route.expires) {
+			delete(px.routes, id)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+//go:build !js
+
+package transportc
+
+import (
+	"github.com/pion/datachannel"
+	"github.com/pion/logging"
+	"github.com/pion/webrtc/v3"
+)
+
+// buildNetworkSettings applies the ICE gathering options of the Config to
+// settingEngine.
+func (c *Config) buildNetworkSettings(settingEngine *webrtc.SettingEngine) error {
+	if c.IPs != nil {
+		settingEngine.SetNAT1To1IPs(c.IPs.IPs, c.IPs.Type)
+	}
+
+	if c.PortRange != nil {
+		err := settingEngine.SetEphemeralUDPPortRange(c.PortRange.Min, c.PortRange.Max)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.UDPMux != nil {
+		settingEngine.SetICEUDPMux(c.UDPMux)
+	}
+
+	if c.TCPMux != nil {
+		settingEngine.SetICETCPMux(c.TCPMux)
+	}
+
+	if c.CandidateNetworkTypes != nil {
+		settingEngine.SetNetworkTypes(c.CandidateNetworkTypes)
+	} else if c.TCPMux != nil { // pion gathers UDP candidates only by default
+		settingEngine.SetNetworkTypes([]webrtc.NetworkType{
+			webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6,
+			webrtc.NetworkTypeTCP4, webrtc.NetworkTypeTCP6,
+		})
+	}
+
+	if c.InterfaceFilter != nil {
+		settingEngine.SetInterfaceFilter(c.InterfaceFilter)
+	}
+
+	if c.IPFilter != nil || len(c.LocalIPs) > 0 {
+		settingEngine.SetIPFilter(c.buildIPFilter())
+	}
+
+	if c.ICETimeouts != nil {
+		timeouts := c.ICETimeouts.withDefaults()
+		if err := timeouts.validate(); err != nil {
+			return err
+		}
+		settingEngine.SetICETimeouts(timeouts.Disconnected, timeouts.Failed, timeouts.KeepAlive)
+	}
+
+	switch c.ICEPairPolicy {
+	case ICE_PAIR_POLICY_PREFER_HOST:
+		settingEngine.SetSrflxAcceptanceMinWait(ICE_PREFER_HOST_SRFLX_WAIT)
+		settingEngine.SetPrflxAcceptanceMinWait(ICE_PREFER_HOST_PRFLX_WAIT)
+		settingEngine.SetRelayAcceptanceMinWait(ICE_PREFER_HOST_RELAY_WAIT)
+	case ICE_PAIR_POLICY_PREFER_RELAY:
+		settingEngine.SetRelayAcceptanceMinWait(0)
+	case ICE_PAIR_POLICY_PREFER_LOWEST_RTT:
+		settingEngine.SetHostAcceptanceMinWait(0)
+		settingEngine.SetSrflxAcceptanceMinWait(0)
+		settingEngine.SetPrflxAcceptanceMinWait(0)
+		settingEngine.SetRelayAcceptanceMinWait(0)
+	}
+
+	return nil
+}
+
+// setSCTPMaxReceiveBufferSize sets the SCTP receive window of the
+// PeerConnections, see Config.SCTPMaxReceiveBufferSize.
+func setSCTPMaxReceiveBufferSize(settingEngine *webrtc.SettingEngine, size uint32) error {
+	settingEngine.SetSCTPMaxReceiveBufferSize(size)
+	return nil
+}
+
+// setHostCandidateIPs advertises ips in place of the local IPs of the host
+// candidates, see Listener.SetHostCandidateIPs.
+func setHostCandidateIPs(settingEngine *webrtc.SettingEngine, ips []string) error {
+	settingEngine.SetNAT1To1IPs(ips, webrtc.ICECandidateTypeHost)
+	return nil
+}
+
+// buildListenerSettings applies the Listener-only options of the Config to
+// settingEngine and configuration.
+func (c *Config) buildListenerSettings(settingEngine *webrtc.SettingEngine, configuration *webrtc.Configuration) error {
+	settingEngine.SetAnsweringDTLSRole(c.ListenerDTLSRole) // ignore if any error
+
+	if c.listenerICELite() {
+		settingEngine.SetLite(true)
+		configuration.ICEServers = nil // only host candidates are used
+	}
+
+	if c.ListenerICECredentials != nil {
+		if c.UDPMux != nil {
+			return ErrICECredentialsWithUDPMux
+		}
+		if c.TCPMux != nil {
+			return ErrICECredentialsWithTCPMux
+		}
+		if err := c.ListenerICECredentials.validate(); err != nil {
+			return err
+		}
+		settingEngine.SetICECredentials(c.ListenerICECredentials.UsernameFragment, c.ListenerICECredentials.Password)
+	}
+
+	return nil
+}
+
+// setAnsweringDTLSRole sets the DTLS role taken when answering an offer.
+func setAnsweringDTLSRole(settingEngine *webrtc.SettingEngine, role DTLSRole) {
+	settingEngine.SetAnsweringDTLSRole(role) // ignore if any error
+}
+
+// detachDataChannel detaches the pion datachannel from d, once open.
+func detachDataChannel(d *webrtc.DataChannel) (datachannel.ReadWriteCloser, error) {
+	return d.Detach()
+}
+
+// sctpTransportStats returns the bytes sent and received on the SCTP
+// association of peerConnection.
+func sctpTransportStats(peerConnection *webrtc.PeerConnection) (sent, received uint64) {
+	if stats, ok := peerConnection.GetStats()["sctpTransport"].(webrtc.TransportStats); ok {
+		return stats.BytesSent, stats.BytesReceived
+	}
+	return 0, 0
+}
+
+// withTURNTracker sets the LoggerFactory of settingEngine to a new
+// turnTracker forwarding to the LoggerFactory set, if any.
+func withTURNTracker(settingEngine *webrtc.SettingEngine, stats *Stats) *turnTracker {
+	base := settingEngine.LoggerFactory
+	if base == nil {
+		base = logging.NewDefaultLoggerFactory()
+	}
+	t := &turnTracker{base: base, stats: stats}
+	settingEngine.LoggerFactory = t
+	return t
+}
+
+// relayedCandidates returns the addresses of the local relay candidates of
+// peerConnection, and whether its selected candidate pair is relayed.
+func relayedCandidates(peerConnection *webrtc.PeerConnection) (relayedAddrs []*Addr, relayed bool) {
+	for _, s := range peerConnection.GetStats() {
+		if candidate, ok := s.(webrtc.ICECandidateStats); ok && candidate.Type == webrtc.StatsTypeLocalCandidate && candidate.CandidateType == webrtc.ICECandidateTypeRelay && !candidate.Deleted {
+			relayedAddrs = append(relayedAddrs, &Addr{Hostname: candidate.IP, Port: uint16(candidate.Port)})
+		}
+	}
+	if sctp := peerConnection.SCTP(); sctp != nil {
+		if dtls := sctp.Transport(); dtls != nil {
+			if ice := dtls.ICETransport(); ice != nil {
+				if pair, err := ice.GetSelectedCandidatePair(); err == nil && pair != nil && pair.Local != nil {
+					relayed = pair.Local.Typ == webrtc.ICECandidateTypeRelay
+				}
+			}
+		}
+	}
+	return relayedAddrs, relayed
+}
+
+// onSelectedCandidatePairChange sets the handler called once the selected
+// candidate pair of peerConnection changes.
+func onSelectedCandidatePairChange(peerConnection *webrtc.PeerConnection, f func(*webrtc.ICECandidatePair)) {
+	if sctp := peerConnection.SCTP(); sctp != nil {
+		if dtls := sctp.Transport(); dtls != nil {
+			if ice := dtls.ICETransport(); ice != nil {
+				ice.OnSelectedCandidatePairChange(f)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+//go:build js
+
+package transportc
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pion/datachannel"
+	"github.com/pion/webrtc/v3"
+)
+
+// Under GOOS=js, pion wraps the browser's RTCPeerConnection and RTCDataChannel
+// via syscall/js. The browser owns ICE and DTLS, so the options tuning them
+// fail with ErrUnsupportedPlatform instead of being silently ignored.
+
+// Certificate is not supported under GOOS=js, where the browser generates
+// the DTLS certificates. See Config.Certificates.
+type Certificate struct{}
+
+// setCertificates is a no-op, buildNetworkSettings rejects certificates.
+func setCertificates(*webrtc.Configuration, []Certificate) {}
+
+// buildNetworkSettings fails with ErrUnsupportedPlatform if any ICE
+// gathering option is set, as the browser gathers the ICE candidates.
+func (c *Config) buildNetworkSettings(*webrtc.SettingEngine) error {
+	switch {
+	case c.IPs != nil:
+		return unsupportedOption("IPs")
+	case c.PortRange != nil:
+		return unsupportedOption("PortRange")
+	case c.UDPMux != nil:
+		return unsupportedOption("UDPMux")
+	case c.TCPMux != nil:
+		return unsupportedOption("TCPMux")
+	case c.CandidateNetworkTypes != nil:
+		return unsupportedOption("CandidateNetworkTypes")
+	case c.InterfaceFilter != nil:
+		return unsupportedOption("InterfaceFilter")
+	case c.IPFilter != nil:
+		return unsupportedOption("IPFilter")
+	case len(c.LocalIPs) > 0:
+		return unsupportedOption("LocalIPs")
+	case c.ICETimeouts != nil:
+		return unsupportedOption("ICETimeouts")
+	case c.ICEPairPolicy != ICE_PAIR_POLICY_DEFAULT && c.ICEPairPolicy != ICE_PAIR_POLICY_PREFER_RELAY:
+		return unsupportedOption("ICEPairPolicy")
+	case len(c.Certificates) > 0:
+		return unsupportedOption("Certificates")
+	}
+	return nil
+}
+
+// setSCTPMaxReceiveBufferSize fails with ErrUnsupportedPlatform, as the
+// browser runs the SCTP association.
+func setSCTPMaxReceiveBufferSize(*webrtc.SettingEngine, uint32) error {
+	return unsupportedOption("SCTPMaxReceiveBufferSize")
+}
+
+// setHostCandidateIPs fails with ErrUnsupportedPlatform, as the browser
+// gathers the ICE candidates.
+func setHostCandidateIPs(*webrtc.SettingEngine, []string) error {
+	return fmt.Errorf("%w: Listener.SetHostCandidateIPs", ErrUnsupportedPlatform)
+}
+
+// buildListenerSettings fails with ErrUnsupportedPlatform if any ICE or DTLS
+// option of the Listener is set.
+func (c *Config) buildListenerSettings(*webrtc.SettingEngine, *webrtc.Configuration) error {
+	switch {
+	case c.ListenerDTLSRole != 0 && c.ListenerDTLSRole != DTLSRoleAuto:
+		return unsupportedOption("ListenerDTLSRole")
+	case c.ListenerICELite:
+		return unsupportedOption("ListenerICELite")
+	case c.ListenerICERole == ICERoleControlling:
+		return unsupportedOption("ListenerICERole")
+	case c.ListenerICECredentials != nil:
+		return unsupportedOption("ListenerICECredentials")
+	}
+	return nil
+}
+
+func unsupportedOption(option string) error {
+	return fmt.Errorf("%w: Config.%s", ErrUnsupportedPlatform, option)
+}
+
+// setAnsweringDTLSRole is a no-op, as the browser takes the DTLS role
+// opposite to the one required by the offer on its own (RFC5763, Section 5).
+func setAnsweringDTLSRole(*webrtc.SettingEngine, DTLSRole) {}
+
+// detachDataChannel wraps d, backed by the browser's RTCDataChannel, as a
+// datachannel.ReadWriteCloser. It is used in place of the detached
+// datachannel of pion, which blocks the browser's event loop until each
+// message is read and fails to read a message larger than the read buffer.
+func detachDataChannel(d *webrtc.DataChannel) (datachannel.ReadWriteCloser, error) {
+	dc := &jsDataChannel{
+		dataChannel: d,
+		messages:    make(chan webrtc.DataChannelMessage, CONN_DEFAULT_CONCURRENCY),
+		closed:      make(chan struct{}),
+	}
+	d.OnMessage(func(msg webrtc.DataChannelMessage) {
+		select {
+		case dc.messages <- msg:
+		case <-dc.closed:
+		}
+	})
+	return dc, nil
+}
+
+// sctpTransportStats returns zeros, as the browser only exposes the stats
+// asynchronously via RTCPeerConnection.getStats.
+func sctpTransportStats(*webrtc.PeerConnection) (sent, received uint64) {
+	return 0, 0
+}
+
+// jsDataChannel implements datachannel.ReadWriteCloser over a DataChannel
+// backed by the browser's RTCDataChannel.
+type jsDataChannel struct {
+	dataChannel *webrtc.DataChannel
+	messages    chan webrtc.DataChannelMessage
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+// Read implements io.Reader.
+func (dc *jsDataChannel) Read(p []byte) (int, error) {
+	n, _, err := dc.ReadDataChannel(p)
+	return n, err
+}
+
+// ReadDataChannel implements datachannel.Reader. As with pion's datachannel,
+// it fails with io.ErrShortBuffer if p is too small for the next message.
+func (dc *jsDataChannel) ReadDataChannel(p []byte) (int, bool, error) {
+	select {
+	case <-dc.closed:
+		return 0, false, io.EOF
+	case msg := <-dc.messages:
+		if len(p) < len(msg.Data) {
+			return 0, false, io.ErrShortBuffer
+		}
+		return copy(p, msg.Data), msg.IsString, nil
+	}
+}
+
+// Write implements io.Writer.
+func (dc *jsDataChannel) Write(p []byte) (int, error) {
+	return dc.WriteDataChannel(p, false)
+}
+
+// WriteDataChannel implements datachannel.Writer.
+func (dc *jsDataChannel) WriteDataChannel(p []byte, isString bool) (int, error) {
+	select {
+	case <-dc.closed:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+
+	var err error
+	if isString {
+		err = dc.dataChannel.SendText(string(p))
+	} else {
+		err = dc.dataChannel.Send(p)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// BufferedAmount returns the bytes queued in the RTCDataChannel, see
+// Conn.EstimatedBandwidth.
+func (dc *jsDataChannel) BufferedAmount() uint64 {
+	return dc.dataChannel.BufferedAmount()
+}
+
+// SetBufferedAmountLowThreshold sets the threshold of OnBufferedAmountLow,
+// see Conn.SetWriteBuffer.
+func (dc *jsDataChannel) SetBufferedAmountLowThreshold(th uint64) {
+	dc.dataChannel.SetBufferedAmountLowThreshold(th)
+}
+
+// OnBufferedAmountLow sets the handler called once the bytes queued in the
+// RTCDataChannel drop to the threshold.
+func (dc *jsDataChannel) OnBufferedAmountLow(f func()) {
+	dc.dataChannel.OnBufferedAmountLow(f)
+}
+
+// Close implements io.Closer.
+func (dc *jsDataChannel) Close() error {
+	dc.closeOnce.Do(func() {
+		close(dc.closed)
+	})
+	return dc.dataChannel.Close()
+}
+
+// withTURNTracker returns nil, as the browser allocates on the TURN servers
+// without exposing the allocations.
+func withTURNTracker(*webrtc.SettingEngine, *Stats) *turnTracker {
+	return nil
+}
+
+// relayedCandidates returns nothing, as the browser does not expose the
+// candidates.
+func relayedCandidates(*webrtc.PeerConnection) ([]*Addr, bool) {
+	return nil, false
+}
+
+// onSelectedCandidatePairChange does nothing, as the browser does not expose
+// the selected candidate pair.
+func onSelectedCandidatePairChange(*webrtc.PeerConnection, func(*webrtc.ICECandidatePair)) {}
@@ -0,0 +1,221 @@
+package transportc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	PREGATHER_TTL_DEFAULT = time.Minute
+
+	// PREGATHER_DATACHANNEL_ID is the stream ID of the negotiated DataChannel
+	// created on pre-gathered PeerConnections and those of PeerHandles, to get
+	// the offer to include the SCTP media section before the label of the
+	// first Conn is known.
+	// Being negotiated out-of-band, it is never surfaced to the Listener.
+	PREGATHER_DATACHANNEL_ID uint16 = 65534
+)
+
+// pregathered is a PeerConnection with its offer set as the local
+// description and the ICE gathering complete, ready to be signaled.
+type pregathered struct {
+	peerConnection *webrtc.PeerConnection
+	handshake      *handshakeTimer
+	expiry         time.Time
+}
+
+// offerPool keeps up to size pregathered PeerConnections for a Dialer, so
+// Dial only waits for the answer instead of the ICE gathering as well.
+// All methods are safe to call on a nil offerPool.
+type offerPool struct {
+	dialer *Dialer
+	size   int
+	ttl    time.Duration
+
+	mutex      sync.Mutex
+	ready      []*pregathered
+	generation uint64 // incremented on invalidation
+
+	refill chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newOfferPool(dialer *Dialer, size int, ttl time.Duration) *offerPool {
+	if ttl == 0 {
+		ttl = PREGATHER_TTL_DEFAULT
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &offerPool{
+		dialer: dialer,
+		size:   size,
+		ttl:    ttl,
+		refill: make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go p.worker()
+	return p
+}
+
+// get returns a pregathered PeerConnection, or nil if none is ready.
+func (p *offerPool) get() *pregathered {
+	if p == nil {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	defer p.signalRefill()
+
+	for len(p.ready) > 0 {
+		pg := p.ready[0]
+		p.ready = p.ready[1:]
+		if currentClock().Now().Before(pg.expiry) {
+			return pg
+		}
+		pg.peerConnection.Close()
+	}
+	return nil
+}
+
+// invalidate discards all pregathered PeerConnections, including those
+// being gathered.
+func (p *offerPool) invalidate() {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.generation++
+	p.closeReady()
+	p.signalRefill()
+}
+
+// close stops the worker and discards all pregathered PeerConnections.
+func (p *offerPool) close() {
+	if p == nil {
+		return
+	}
+
+	p.cancel()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closeReady()
+}
+
+func (p *offerPool) worker() {
+	ticker := currentClock().NewTicker(p.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		if !p.dialer.paused.Load() { // don't gather in the background
+			p.fill()
+		}
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-p.refill:
+		case <-ticker.C():
+		}
+	}
+}
+
+// fill prunes the expired PeerConnections and gathers new ones until
+// size PeerConnections are ready.
+func (p *offerPool) fill() {
+	p.mutex.Lock()
+	now := currentClock().Now()
+	ready := p.ready[:0]
+	for _, pg := range p.ready {
+		if now.Before(pg.expiry) {
+			ready = append(ready, pg)
+		} else {
+			pg.peerConnection.Close()
+		}
+	}
+	p.ready = ready
+	p.mutex.Unlock()
+
+	for {
+		p.mutex.Lock()
+		full := len(p.ready) >= p.size
+		generation := p.generation
+		p.mutex.Unlock()
+		if full || p.ctx.Err() != nil {
+			return
+		}
+
+		pg, err := p.gather()
+		if err != nil {
+			p.dialer.logger.Warnf("dialer: failed to pre-gather PeerConnection: %v", err)
+			return // retry on next refill or tick
+		}
+
+		p.mutex.Lock()
+		if generation != p.generation || p.ctx.Err() != nil {
+			pg.peerConnection.Close() // invalidated during gathering
+		} else {
+			p.ready = append(p.ready, pg)
+		}
+		p.mutex.Unlock()
+	}
+}
+
+func (p *offerPool) gather() (*pregathered, error) {
+	peerConnection, handshake, err := p.dialer.newPeerConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createPregatherDataChannel(peerConnection); err != nil {
+		peerConnection.Close()
+		return nil, err
+	}
+
+	if err := p.dialer.gatherOffer(p.ctx, peerConnection, nil); err != nil {
+		peerConnection.Close()
+		return nil, err
+	}
+
+	return &pregathered{
+		peerConnection: peerConnection,
+		handshake:      handshake,
+		expiry:         currentClock().Now().Add(p.ttl),
+	}, nil
+}
+
+// createPregatherDataChannel creates the negotiated DataChannel of
+// PREGATHER_DATACHANNEL_ID on peerConnection.
+func createPregatherDataChannel(peerConnection *webrtc.PeerConnection) error {
+	negotiated := true
+	id := PREGATHER_DATACHANNEL_ID
+	_, err := peerConnection.CreateDataChannel("", &webrtc.DataChannelInit{
+		Negotiated: &negotiated,
+		ID:         &id,
+	})
+	return err
+}
+
+// closeReady closes all pregathered PeerConnections. Caller MUST hold the mutex.
+func (p *offerPool) closeReady() {
+	for _, pg := range p.ready {
+		pg.peerConnection.Close()
+	}
+	p.ready = nil
+}
+
+func (p *offerPool) signalRefill() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,139 @@
+package transportc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Preset bundles sensible values of Config for a common workload, so new
+// users get good behavior without learning every field:
+//
+//	config := &transportc.Config{Signal: signal}
+//	transportc.PRESET_LOW_LATENCY.Apply(config)
+//
+// Presets only set fields of the platform-independent Config, and build
+// with GOOS=js as well.
+type Preset uint8
+
+const (
+	// PRESET_LOW_LATENCY minimizes the time to dial and the queuing delay:
+	// a pre-gathered PeerConnection is kept ready, the ICE gathering is
+	// bounded, Conns share the PeerConnection, and a Write fails fast with a
+	// temporary WriteError instead of queuing behind a slow peer. Messages
+	// which are stale once lost are better sent over Dialer.DialDatagram.
+	PRESET_LOW_LATENCY Preset = iota + 1
+
+	// PRESET_BULK maximizes the throughput of large transfers: writes larger
+	// than the max message size are split instead of failing, Conns share
+	// the PeerConnection, and a Write stalled by a dead peer eventually
+	// closes the Conn.
+	PRESET_BULK
+
+	// PRESET_COVERT limits what the connection reveals of the peers: a single
+	// PeerConnection bundling every Conn is kept for long, so fewer
+	// handshakes are observed, and only relayed candidates are used if a TURN
+	// server is configured, so neither peer learns the address of the other.
+	// The wire handshake, which is identifiable on the wire, is left disabled.
+	//
+	// The messages are neither padded nor shaped, and the keepalives of the
+	// ICE agent are left to pion, see Config.ICETimeouts and Config.NewPacer.
+	PRESET_COVERT
+
+	// PRESET_UDP_BLOCKED keeps working on networks blocking UDP entirely:
+	// only relayed candidates are used if a TURN server over TCP or TLS is
+	// configured, e.g., "turns:turn.example.com:443?transport=tcp", the ICE
+	// gathering does not wait for STUN servers never answering, and Conns
+	// share the PeerConnection, and so the TURN allocation. A Listener SHOULD
+	// set Config.TCPMux as well, for clients connecting over ICE-TCP.
+	PRESET_UDP_BLOCKED
+)
+
+const (
+	PRESET_LOW_LATENCY_GATHER_TIMEOUT      = 2 * time.Second
+	PRESET_LOW_LATENCY_MAX_BUFFERED_AMOUNT = 256 * 1024
+	PRESET_BULK_WRITE_TIMEOUT              = 30 * time.Second
+	PRESET_COVERT_TIMEOUT                  = 5 * time.Minute
+	PRESET_UDP_BLOCKED_GATHER_TIMEOUT      = 5 * time.Second
+)
+
+func (p Preset) String() string {
+	switch p {
+	case PRESET_LOW_LATENCY:
+		return "LowLatency"
+	case PRESET_BULK:
+		return "Bulk"
+	case PRESET_COVERT:
+		return "Covert"
+	case PRESET_UDP_BLOCKED:
+		return "UDPBlocked"
+	default:
+		return "Unknown"
+	}
+}
+
+// Apply sets the fields of c bundled by p. Only fields left zero are set, so
+// non-zero values set explicitly win, whether set before or after Apply.
+func (p Preset) Apply(c *Config) {
+	switch p {
+	case PRESET_LOW_LATENCY:
+		if c.PreGatherPoolSize == 0 {
+			c.PreGatherPoolSize = 1
+		}
+		if c.GatherTimeout == 0 {
+			c.GatherTimeout = PRESET_LOW_LATENCY_GATHER_TIMEOUT
+		}
+		if c.MaxBufferedAmount == 0 {
+			c.MaxBufferedAmount = PRESET_LOW_LATENCY_MAX_BUFFERED_AMOUNT
+		}
+		if c.BundlePolicy == webrtc.BundlePolicy(webrtc.Unknown) {
+			c.BundlePolicy = webrtc.BundlePolicyMaxBundle
+		}
+		c.ReusePeerConnection = true
+	case PRESET_BULK:
+		c.SplitLargeWrites = true
+		if c.DefaultWriteTimeout == 0 {
+			c.DefaultWriteTimeout = PRESET_BULK_WRITE_TIMEOUT
+		}
+		c.ReusePeerConnection = true
+	case PRESET_COVERT:
+		if c.Timeout == 0 {
+			c.Timeout = PRESET_COVERT_TIMEOUT
+		}
+		if c.BundlePolicy == webrtc.BundlePolicy(webrtc.Unknown) {
+			c.BundlePolicy = webrtc.BundlePolicyMaxBundle
+		}
+		if c.WebRTCConfiguration.ICETransportPolicy == webrtc.ICETransportPolicyAll && hasTURNServer(c.WebRTCConfiguration.ICEServers, false) {
+			c.WebRTCConfiguration.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+		}
+		c.ReusePeerConnection = true
+	case PRESET_UDP_BLOCKED:
+		if c.GatherTimeout == 0 {
+			c.GatherTimeout = PRESET_UDP_BLOCKED_GATHER_TIMEOUT
+		}
+		if c.WebRTCConfiguration.ICETransportPolicy == webrtc.ICETransportPolicyAll && hasTURNServer(c.WebRTCConfiguration.ICEServers, true) {
+			c.WebRTCConfiguration.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+		}
+		c.ReusePeerConnection = true
+	}
+}
+
+// hasTURNServer reports whether any of iceServers is a TURN server, over TCP
+// or TLS if tcpOnly.
+func hasTURNServer(iceServers []webrtc.ICEServer, tcpOnly bool) bool {
+	for _, server := range iceServers {
+		for _, url := range server.URLs {
+			switch {
+			case !strings.HasPrefix(url, "turn:") && !strings.HasPrefix(url, "turns:"):
+			case !tcpOnly:
+				return true
+			case strings.HasPrefix(url, "turns:") && !strings.Contains(url, "transport=udp"): // TLS, unless DTLS
+				return true
+			case strings.Contains(url, "transport=tcp"):
+				return true
+			}
+		}
+	}
+	return false
+}
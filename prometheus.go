@@ -0,0 +1,95 @@
+package transportc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PROMETHEUS_NAMESPACE prefixes the names of all metrics served by
+// Stats.PrometheusHandler.
+const PROMETHEUS_NAMESPACE = "transportc"
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PrometheusHandler returns an http.Handler serving the Stats in the
+// Prometheus text exposition format, so they can be scraped without
+// depending on the Prometheus client library.
+//
+// The statistics of Conns are labeled by their tag. The accept latency is a
+// histogram in seconds, see ListenerStats.AcceptLatency.
+func (s *Stats) PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		s.writePrometheus(bw)
+		bw.Flush()
+	})
+}
+
+func (s *Stats) writePrometheus(w io.Writer) {
+	tags := s.Tags()
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+
+	tagMetrics := []struct {
+		name, kind, help string
+		value            func(TagStats) string
+	}{
+		{"conns_active", "gauge", "Conns currently open.", func(ts TagStats) string { return strconv.FormatInt(ts.ActiveConns, 10) }},
+		{"conns_total", "counter", "Conns ever opened.", func(ts TagStats) string { return strconv.FormatUint(ts.TotalConns, 10) }},
+		{"read_bytes_total", "counter", "Bytes read from Conns.", func(ts TagStats) string { return strconv.FormatUint(ts.BytesRead, 10) }},
+		{"written_bytes_total", "counter", "Bytes written to Conns.", func(ts TagStats) string { return strconv.FormatUint(ts.BytesWritten, 10) }},
+	}
+	for _, metric := range tagMetrics {
+		writePrometheusHeader(w, metric.name, metric.kind, metric.help)
+		for _, tag := range names {
+			fmt.Fprintf(w, "%s_%s{tag=\"%s\"} %s\n", PROMETHEUS_NAMESPACE, metric.name, prometheusLabelEscaper.Replace(tag), metric.value(tags[tag]))
+		}
+	}
+
+	writePrometheusHeader(w, "conns_closed_total", "counter", "Conns closed, by the reason they closed for.")
+	for _, tag := range names {
+		for reason := CLOSE_REASON_LOCAL; reason < closeReasonCount; reason++ {
+			if closed, ok := tags[tag].ClosedConns[reason]; ok {
+				fmt.Fprintf(w, "%s_conns_closed_total{tag=\"%s\",reason=\"%s\"} %d\n", PROMETHEUS_NAMESPACE, prometheusLabelEscaper.Replace(tag), reason, closed)
+			}
+		}
+	}
+
+	listener := s.Listener()
+	writePrometheusHeader(w, "listener_accept_latency_seconds", "histogram", "Time from an offer being read to its first Conn being accepted.")
+	for _, bucket := range listener.AcceptLatency.Buckets {
+		fmt.Fprintf(w, "%s_listener_accept_latency_seconds_bucket{le=\"%s\"} %d\n", PROMETHEUS_NAMESPACE, strconv.FormatFloat(bucket.UpperBound.Seconds(), 'g', -1, 64), bucket.Count)
+	}
+	fmt.Fprintf(w, "%s_listener_accept_latency_seconds_bucket{le=\"+Inf\"} %d\n", PROMETHEUS_NAMESPACE, listener.AcceptLatency.Count)
+	fmt.Fprintf(w, "%s_listener_accept_latency_seconds_sum %s\n", PROMETHEUS_NAMESPACE, strconv.FormatFloat(listener.AcceptLatency.Sum.Seconds(), 'g', -1, 64))
+	fmt.Fprintf(w, "%s_listener_accept_latency_seconds_count %d\n", PROMETHEUS_NAMESPACE, listener.AcceptLatency.Count)
+
+	writePrometheusCounter(w, "listener_peer_connections_total", "PeerConnections created for offers.", listener.PeerConnections)
+	writePrometheusCounter(w, "listener_ice_connected_total", "PeerConnections whose ICE first connected.", listener.ICEConnected)
+	writePrometheusCounter(w, "listener_ice_failed_total", "PeerConnections whose ICE failed before connecting.", listener.ICEFailed)
+
+	turn := s.TURN()
+	writePrometheusHeader(w, "turn_allocations_active", "gauge", "TURN allocations currently held.")
+	fmt.Fprintf(w, "%s_turn_allocations_active %d\n", PROMETHEUS_NAMESPACE, turn.ActiveAllocations)
+	writePrometheusCounter(w, "turn_allocations_total", "TURN allocations ever made.", turn.TotalAllocations)
+	writePrometheusCounter(w, "turn_refresh_failures_total", "Refreshes of TURN allocations failed.", turn.RefreshFailures)
+	writePrometheusCounter(w, "turn_permission_refresh_failures_total", "Refreshes of TURN permissions failed.", turn.PermissionRefreshFailures)
+}
+
+func writePrometheusHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", PROMETHEUS_NAMESPACE, name, help, PROMETHEUS_NAMESPACE, name, kind)
+}
+
+func writePrometheusCounter(w io.Writer, name, help string, value uint64) {
+	writePrometheusHeader(w, name, "counter", help)
+	fmt.Fprintf(w, "%s_%s %d\n", PROMETHEUS_NAMESPACE, name, value)
+}
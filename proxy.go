@@ -0,0 +1,76 @@
+package transportc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"golang.org/x/net/proxy"
+)
+
+const (
+	PROXY_LABEL_PREFIX = "proxy:"
+)
+
+var (
+	// ErrNotProxyLabel is returned when parsing a DataChannel label not
+	// created by a ProxyDialer.
+	ErrNotProxyLabel = errors.New("not a proxy label")
+)
+
+// ProxyDialer adapts a Dialer to the proxy.Dialer and proxy.ContextDialer
+// interfaces of golang.org/x/net/proxy, so the transport can be chained like
+// any other dialer.
+//
+// The target network and address are encoded into the label of the DataChannel,
+// to be recovered by the remote peer with ParseProxyLabel.
+type ProxyDialer struct {
+	dialer *Dialer
+	opts   []DialOption
+}
+
+var (
+	_ proxy.Dialer        = (*ProxyDialer)(nil)
+	_ proxy.ContextDialer = (*ProxyDialer)(nil)
+)
+
+// ProxyDialer returns a ProxyDialer dialing with the Dialer and opts.
+func (d *Dialer) ProxyDialer(opts ...DialOption) *ProxyDialer {
+	return &ProxyDialer{
+		dialer: d,
+		opts:   opts,
+	}
+}
+
+// Dial connects to addr on the named network through the remote peer.
+//
+// Internally calls DialContext with context.Background().
+func (p *ProxyDialer) Dial(network, addr string) (net.Conn, error) {
+	return p.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to addr on the named network through the remote peer
+// using the provided context.
+func (p *ProxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return p.dialer.DialContext(ctx, ProxyLabel(network, addr), p.opts...)
+}
+
+// ProxyLabel encodes the network and address into a DataChannel label.
+func ProxyLabel(network, addr string) string {
+	return PROXY_LABEL_PREFIX + network + ":" + addr
+}
+
+// ParseProxyLabel decodes the network and address from a DataChannel label
+// created by ProxyLabel, e.g., the Label of an accepted Conn.
+func ParseProxyLabel(label string) (network, addr string, err error) {
+	if !strings.HasPrefix(label, PROXY_LABEL_PREFIX) {
+		return "", "", ErrNotProxyLabel
+	}
+
+	network, addr, ok := strings.Cut(strings.TrimPrefix(label, PROXY_LABEL_PREFIX), ":")
+	if !ok || network == "" || addr == "" {
+		return "", "", ErrNotProxyLabel
+	}
+	return network, addr, nil
+}
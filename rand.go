@@ -0,0 +1,62 @@
+package transportc
+
+import (
+	"crypto/rand"
+	"math"
+	"math/big"
+	mrand "math/rand"
+	"sync"
+)
+
+var (
+	deterministicRandMutex sync.Mutex
+	deterministicRand      *mrand.Rand // replaces all randomness if set, see WithDeterministicRand
+)
+
+// WithDeterministicRand replaces the randomness of the package, i.e., the IDs
+// of offers and PeerConnections and the jitter of backoffs, with a sequence
+// seeded by seed, so integration tests and simulations are reproducible. It
+// affects the whole package until the returned function is called.
+//
+// The sequence is only reproducible if the calls consuming it are made in the
+// same order. It MUST NOT be used in production, as the IDs become predictable.
+func WithDeterministicRand(seed int64) (restore func()) {
+	deterministicRandMutex.Lock()
+	defer deterministicRandMutex.Unlock()
+
+	previous := deterministicRand
+	deterministicRand = mrand.New(mrand.NewSource(seed)) // skipcq: GSC-G404
+	return func() {
+		deterministicRandMutex.Lock()
+		defer deterministicRandMutex.Unlock()
+		deterministicRand = previous
+	}
+}
+
+// randomUint64 returns a random uint64 from crypto/rand,
+// falling back to math/rand if crypto/rand fails.
+func randomUint64() uint64 {
+	deterministicRandMutex.Lock()
+	defer deterministicRandMutex.Unlock()
+	if deterministicRand != nil {
+		return deterministicRand.Uint64()
+	}
+
+	n := new(big.Int)
+	randID, err := rand.Int(rand.Reader, n.SetUint64(math.MaxUint64))
+	if err != nil { // fallback to math/rand if crypto/rand fails
+		return mrand.Uint64() // skipcq: GSC-G404
+	}
+	return randID.Uint64()
+}
+
+// randomInt63n returns a pseudo-random int64 in [0, n) from math/rand, for
+// jitter.
+func randomInt63n(n int64) int64 {
+	deterministicRandMutex.Lock()
+	defer deterministicRandMutex.Unlock()
+	if deterministicRand != nil {
+		return deterministicRand.Int63n(n)
+	}
+	return mrand.Int63n(n) // skipcq: GSC-G404
+}
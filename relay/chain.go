@@ -0,0 +1,304 @@
+package relay
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gaukas/logging"
+	"github.com/gaukas/transportc"
+)
+
+const (
+	CHAIN_PROTOCOL        = "transportc-chain" // the DataChannel protocol of the Conns to chain through, see transportc.WithProtocol
+	CHAIN_LABEL_DEFAULT   = "chain"
+	CHAIN_REQUEST_TIMEOUT = 10 * time.Second // to read the request once a Conn is accepted
+	CHAIN_MAX_HOPS        = 8
+)
+
+var (
+	ErrNoHops         = errors.New("relay: no hop specified")
+	ErrTooManyHops    = errors.New("relay: too many hops")
+	ErrUnknownTarget  = errors.New("relay: unknown target")
+	ErrChainRefused   = errors.New("relay: chain refused")
+	ErrMalformedChain = errors.New("relay: malformed chain request")
+	ErrChainNoDialers = errors.New("relay: no dialers specified")
+	ErrChainIdentity  = errors.New("relay: target identity mismatch")
+)
+
+// Hop asks the peer reached so far to dial Target, presenting Token for
+// its authorization.
+//
+// If Identity is set, Target must present it at signaling, see
+// transportc.Config.IdentityKey, and DialOnion verifies the onion layer of
+// Target with it.
+type Hop struct {
+	Target   string            `json:"target"`
+	Token    []byte            `json:"token,omitempty"`
+	Identity ed25519.PublicKey `json:"identity,omitempty"`
+}
+
+// chainRequest is the CONNECT-style message sent first over a Conn of
+// CHAIN_PROTOCOL.
+type chainRequest struct {
+	Hop
+	Label    string   `json:"label,omitempty"`    // of the Conn to the last target
+	Protocol string   `json:"protocol,omitempty"` // of the Conn to the last target
+	Next     []Hop    `json:"next,omitempty"`     // the hops after Target
+	Keys     [][]byte `json:"keys,omitempty"`     // onion keys of this hop and the next ones, see DialOnion
+}
+
+// chainResponse answers a chainRequest, once the Conn to the last target
+// is established or failed.
+type chainResponse struct {
+	Error  string       `json:"error,omitempty"`
+	Layers []onionHello `json:"layers,omitempty"` // of this hop and the next ones
+}
+
+// ChainConfig is the configuration for the Chain.
+type ChainConfig struct {
+	// Dialers are the Dialers of the targets the Chain may dial, by the
+	// name requested in Hop.Target.
+	Dialers map[string]*transportc.Dialer
+
+	// Authorize, if set, is called for each request received over conn
+	// to dial target, and refuses it by returning an error. The error is
+	// reported to the requester.
+	Authorize func(conn net.Conn, target string, token []byte) error
+
+	// IdentityKey, if set, signs the onion layers negotiated with the
+	// Chain, see DialOnion. It should be the transportc.Config.IdentityKey
+	// of the Listener, so the requester can verify it. If not set, onion
+	// requests are refused.
+	IdentityKey ed25519.PrivateKey
+
+	// DialTimeout is the timeout for connecting to the target, including
+	// the following hops. If 0, DIAL_TIMEOUT_DEFAULT is used.
+	DialTimeout time.Duration
+
+	Logger logging.Logger
+}
+
+// Chain lets the peers connected to it dial through it to the targets of
+// its Dialers, e.g., peers unreachable from their own network, splicing the
+// Conns together. Requests may chain through several peers, each one
+// authorizing its own Hop.
+//
+// Conns are served with Handle, e.g., routed by
+// Listener.Handle(CHAIN_PROTOCOL, chain.Handle), and dialed with DialChain.
+type Chain struct {
+	dialers     map[string]*transportc.Dialer
+	authorize   func(conn net.Conn, target string, token []byte) error
+	identityKey ed25519.PrivateKey
+	dialTimeout time.Duration
+	logger      logging.Logger
+}
+
+// NewChain creates a new Chain dialing with the Dialers of the config.
+func (c *ChainConfig) NewChain() (*Chain, error) {
+	if len(c.Dialers) == 0 {
+		return nil, ErrChainNoDialers
+	}
+
+	if c.Logger == nil {
+		c.Logger = logging.DefaultStderrLogger(logging.LOG_ERROR)
+	}
+
+	if c.DialTimeout == 0 {
+		c.DialTimeout = DIAL_TIMEOUT_DEFAULT
+	}
+
+	return &Chain{
+		dialers:     c.Dialers,
+		authorize:   c.Authorize,
+		identityKey: c.IdentityKey,
+		dialTimeout: c.DialTimeout,
+		logger:      c.Logger,
+	}, nil
+}
+
+// Handle reads the request from conn, dials its target and splices both
+// Conns until either is closed, then closes conn. It is the handler of
+// Listener.Handle.
+//
+// If the request negotiates an onion layer, the layer is removed from the
+// messages read from conn and added to those written to it.
+func (ch *Chain) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	req, err := readChainRequest(conn)
+	if err != nil {
+		ch.logger.Debugf("relay: %v", err)
+		return
+	}
+
+	target, resp, layer, err := ch.dial(conn, req)
+	if err != nil {
+		ch.logger.Debugf("relay: failed to chain to %s: %v", req.Target, err)
+		writeChainResponse(conn, chainResponse{Error: err.Error()}) // skipcq: GO-S1040
+		return
+	}
+	defer target.Close()
+
+	if err := writeChainResponse(conn, resp); err != nil {
+		return
+	}
+	if layer != nil {
+		spliceOnion(conn, target, layer)
+		return
+	}
+	if err := transportc.Splice(conn, target); err != nil {
+		ch.logger.Debugf("relay: chain to %s closed: %v", req.Target, err)
+	}
+}
+
+// dial authorizes req received over conn, then dials its target and
+// forwards the following hops. If req has onion keys, the layer of this hop
+// is negotiated too.
+func (ch *Chain) dial(conn net.Conn, req chainRequest) (target net.Conn, resp chainResponse, layer *onionLayer, err error) {
+	dialer, ok := ch.dialers[req.Target]
+	if !ok {
+		return nil, resp, nil, ErrUnknownTarget
+	}
+	if ch.authorize != nil {
+		if err := ch.authorize(conn, req.Target, req.Token); err != nil {
+			return nil, resp, nil, err
+		}
+	}
+	if len(req.Keys) > 0 && ch.identityKey == nil {
+		return nil, resp, nil, ErrOnionUnsupported
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ch.dialTimeout)
+	defer cancel()
+
+	if len(req.Next) == 0 {
+		label := req.Label
+		if label == "" {
+			label = CHAIN_LABEL_DEFAULT
+		}
+		target, err = dialer.DialContext(ctx, label, transportc.WithProtocol(req.Protocol))
+	} else {
+		var nextKeys [][]byte
+		if len(req.Keys) > 0 {
+			nextKeys = req.Keys[1:]
+		}
+		target, resp, err = dialChain(ctx, dialer, req.Label, req.Protocol, req.Next, nextKeys)
+	}
+	if err != nil {
+		return nil, resp, nil, err
+	}
+
+	identity := peerIdentity(target)
+	if len(req.Identity) > 0 && !req.Identity.Equal(identity) {
+		target.Close()
+		return nil, resp, nil, ErrChainIdentity
+	}
+
+	if len(req.Keys) > 0 {
+		var hello onionHello
+		hello, layer, err = respondOnion(ch.identityKey, req.Keys[0])
+		if err != nil {
+			target.Close()
+			return nil, resp, nil, err
+		}
+		hello.Identity = identity
+		resp.Layers = append([]onionHello{hello}, resp.Layers...)
+	}
+	return target, resp, layer, nil
+}
+
+// DialChain dials the peer of dialer, then through each of the hops in turn
+// to the target of the last one, and returns the Conn spliced to the Conn
+// of label and protocol dialed by the last hop.
+//
+// If a hop refuses to chain, the returned error wraps ErrChainRefused.
+func DialChain(ctx context.Context, dialer *transportc.Dialer, label, protocol string, hops ...Hop) (net.Conn, error) {
+	if len(hops) == 0 {
+		return nil, ErrNoHops
+	}
+	if len(hops) > CHAIN_MAX_HOPS {
+		return nil, ErrTooManyHops
+	}
+	conn, _, err := dialChain(ctx, dialer, label, protocol, hops, nil)
+	return conn, err
+}
+
+func dialChain(ctx context.Context, dialer *transportc.Dialer, label, protocol string, hops []Hop, keys [][]byte) (net.Conn, chainResponse, error) {
+	var resp chainResponse
+	conn, err := dialer.DialContext(ctx, CHAIN_PROTOCOL, transportc.WithProtocol(CHAIN_PROTOCOL))
+	if err != nil {
+		return nil, resp, err
+	}
+
+	req := chainRequest{Hop: hops[0], Label: label, Protocol: protocol, Next: hops[1:], Keys: keys}
+	reqBytes, err := json.Marshal(req)
+	if err == nil {
+		_, err = conn.Write(reqBytes)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, resp, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	n, err := conn.Read(buf)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, resp, err
+	}
+
+	if err := json.Unmarshal(buf[:n], &resp); err != nil {
+		conn.Close()
+		return nil, resp, ErrMalformedChain
+	}
+	if resp.Error != "" {
+		conn.Close()
+		return nil, resp, fmt.Errorf("%w by the hop to %s: %s", ErrChainRefused, hops[0].Target, resp.Error)
+	}
+	return conn, resp, nil
+}
+
+func readChainRequest(conn net.Conn) (chainRequest, error) {
+	var req chainRequest
+
+	conn.SetReadDeadline(time.Now().Add(CHAIN_REQUEST_TIMEOUT))
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	n, err := conn.Read(buf)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return req, err
+	}
+
+	if err := json.Unmarshal(buf[:n], &req); err != nil || req.Target == "" || len(req.Next) >= CHAIN_MAX_HOPS ||
+		(len(req.Keys) > 0 && len(req.Keys) != len(req.Next)+1) {
+		return req, ErrMalformedChain
+	}
+	return req, nil
+}
+
+func writeChainResponse(conn net.Conn, resp chainResponse) error {
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(respBytes)
+	return err
+}
+
+// peerIdentity returns the identity presented at signaling by the peer of
+// conn, if any.
+func peerIdentity(conn net.Conn) ed25519.PublicKey {
+	if c, ok := conn.(*transportc.Conn); ok {
+		return c.PeerIdentity()
+	}
+	return nil
+}
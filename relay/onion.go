@@ -0,0 +1,379 @@
+package relay
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// ONION_MAX_PLAINTEXT_SIZE is the maximum plaintext carried by one
+	// message of an onion Conn, leaving room for the layers of
+	// CHAIN_MAX_HOPS relays and the target. Larger writes are split into
+	// multiple messages.
+	ONION_MAX_PLAINTEXT_SIZE = transportc.CONN_DEFAULT_MTU - (CHAIN_MAX_HOPS+1)*chacha20poly1305.Overhead
+
+	onionContext = "transportc onion v1"
+)
+
+var (
+	ErrOnionUnsupported = errors.New("relay: onion layers not supported by hop")
+	ErrOnionIdentity    = errors.New("relay: no identity to verify the onion layer")
+	ErrOnionSignature   = errors.New("relay: invalid onion layer signature")
+	ErrOnionDecrypt     = errors.New("relay: failed to decrypt onion layer")
+)
+
+// onionHello is the ephemeral key of a hop for an onion layer, signed by
+// its identity key.
+type onionHello struct {
+	Key       []byte            `json:"key"`
+	Signature []byte            `json:"sig,omitempty"`
+	Identity  ed25519.PublicKey `json:"identity,omitempty"` // of the peer dialed by the hop, if any
+}
+
+// onionLayer encrypts the messages of one hop, forward from the dialer and
+// backward to it, each with its own key and counter nonce.
+type onionLayer struct {
+	forward, backward onionCipher
+}
+
+type onionCipher struct {
+	mutex sync.Mutex
+	aead  cipher.AEAD
+	seq   uint64
+}
+
+func (c *onionCipher) nonce() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[chacha20poly1305.NonceSize-8:], c.seq)
+	c.seq++
+	return nonce
+}
+
+func (c *onionCipher) seal(p []byte) []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.aead.Seal(nil, c.nonce(), p, nil)
+}
+
+func (c *onionCipher) open(p []byte) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	plaintext, err := c.aead.Open(nil, c.nonce(), p, nil)
+	if err != nil {
+		return nil, ErrOnionDecrypt
+	}
+	return plaintext, nil
+}
+
+// newOnionLayer derives the keys of a layer from the ephemeral keys of the
+// dialer and the hop.
+func newOnionLayer(shared, dialerKey, hopKey []byte) (*onionLayer, error) {
+	salt := append(append([]byte{}, dialerKey...), hopKey...)
+	keys := make([]byte, 2*chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(onionContext)), keys); err != nil {
+		return nil, err
+	}
+
+	forward, err := chacha20poly1305.New(keys[:chacha20poly1305.KeySize])
+	if err != nil {
+		return nil, err
+	}
+	backward, err := chacha20poly1305.New(keys[chacha20poly1305.KeySize:])
+	if err != nil {
+		return nil, err
+	}
+	return &onionLayer{forward: onionCipher{aead: forward}, backward: onionCipher{aead: backward}}, nil
+}
+
+func onionSignedMessage(dialerKey, hopKey []byte) []byte {
+	msg := append([]byte(onionContext+"\n"), dialerKey...)
+	return append(msg, hopKey...)
+}
+
+func generateOnionKey() (private, public []byte, err error) {
+	private = make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(private); err != nil {
+		return nil, nil, err
+	}
+	public, err = curve25519.X25519(private, curve25519.Basepoint)
+	return private, public, err
+}
+
+// respondOnion answers the ephemeral key of a dialer with a signed one, and
+// returns the layer negotiated.
+func respondOnion(identityKey ed25519.PrivateKey, dialerKey []byte) (onionHello, *onionLayer, error) {
+	private, public, err := generateOnionKey()
+	if err != nil {
+		return onionHello{}, nil, err
+	}
+	shared, err := curve25519.X25519(private, dialerKey)
+	if err != nil {
+		return onionHello{}, nil, err
+	}
+	layer, err := newOnionLayer(shared, dialerKey, public)
+	if err != nil {
+		return onionHello{}, nil, err
+	}
+	return onionHello{Key: public, Signature: ed25519.Sign(identityKey, onionSignedMessage(dialerKey, public))}, layer, nil
+}
+
+// completeOnion verifies the answer of a hop of identity to an ephemeral
+// key, and returns the layer negotiated.
+func completeOnion(identity ed25519.PublicKey, private, public []byte, hello onionHello) (*onionLayer, error) {
+	if len(identity) != ed25519.PublicKeySize {
+		return nil, ErrOnionIdentity
+	}
+	if !ed25519.Verify(identity, onionSignedMessage(public, hello.Key), hello.Signature) {
+		return nil, ErrOnionSignature
+	}
+	shared, err := curve25519.X25519(private, hello.Key)
+	if err != nil {
+		return nil, err
+	}
+	return newOnionLayer(shared, public, hello.Key)
+}
+
+// DialOnion is DialChain with a layer of encryption negotiated with each of
+// the hops and with the target of the last one, so the hops relay messages
+// they cannot read. Every message is encrypted by the dialer once per
+// layer, and each hop removes its own layer forward and adds it backward.
+//
+// The layers are negotiated with ephemeral X25519 keys and authenticated by
+// the identity keys presented at signaling: the first hop is verified with
+// the identity of the peer of dialer, and the following ones with
+// Hop.Identity, or if not set, the identity reported by the previous hop.
+// The hops must set ChainConfig.IdentityKey, and the target must accept the
+// Conn with AcceptOnion.
+func DialOnion(ctx context.Context, dialer *transportc.Dialer, label, protocol string, hops ...Hop) (net.Conn, error) {
+	if len(hops) == 0 {
+		return nil, ErrNoHops
+	}
+	if len(hops) > CHAIN_MAX_HOPS {
+		return nil, ErrTooManyHops
+	}
+
+	privates := make([][]byte, len(hops))
+	publics := make([][]byte, len(hops))
+	for i := range hops {
+		var err error
+		if privates[i], publics[i], err = generateOnionKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, resp, err := dialChain(ctx, dialer, label, protocol, hops, publics)
+	if err != nil {
+		return nil, err
+	}
+	oc := &onionConn{Conn: conn, dialer: true}
+	if len(resp.Layers) != len(hops) {
+		conn.Close()
+		return nil, ErrMalformedChain
+	}
+
+	identity := peerIdentity(conn)
+	for i, hello := range resp.Layers {
+		layer, err := completeOnion(identity, privates[i], publics[i], hello)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		oc.layers = append(oc.layers, layer)
+
+		identity = hops[i].Identity
+		if len(identity) == 0 {
+			identity = hello.Identity
+		}
+	}
+
+	// the layer of the target is negotiated through the layers of the hops
+	private, public, err := generateOnionKey()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	hello, err := exchangeOnionHello(oc, onionHello{Key: public}, true)
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	layer, err := completeOnion(identity, private, public, hello)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	oc.layers = append(oc.layers, layer)
+	return oc, nil
+}
+
+// AcceptOnion negotiates the onion layer of the target over a Conn dialed
+// by DialOnion, signing it with identityKey, the transportc.Config.IdentityKey
+// of the Listener having accepted conn.
+func AcceptOnion(conn net.Conn, identityKey ed25519.PrivateKey) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(CHAIN_REQUEST_TIMEOUT))
+	defer conn.SetDeadline(time.Time{})
+
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	var dialerHello onionHello
+	if err := json.Unmarshal(buf[:n], &dialerHello); err != nil {
+		return nil, ErrMalformedChain
+	}
+
+	hello, layer, err := respondOnion(identityKey, dialerHello.Key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := exchangeOnionHello(conn, hello, false); err != nil {
+		return nil, err
+	}
+	return &onionConn{Conn: conn, layers: []*onionLayer{layer}}, nil
+}
+
+// exchangeOnionHello writes hello over conn, and if read is set, reads the
+// hello of the peer.
+func exchangeOnionHello(conn net.Conn, hello onionHello, read bool) (onionHello, error) {
+	var peerHello onionHello
+	helloBytes, err := json.Marshal(hello)
+	if err != nil {
+		return peerHello, err
+	}
+	if _, err := conn.Write(helloBytes); err != nil || !read {
+		return peerHello, err
+	}
+
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return peerHello, err
+	}
+	if err := json.Unmarshal(buf[:n], &peerHello); err != nil {
+		return peerHello, ErrMalformedChain
+	}
+	return peerHello, nil
+}
+
+// onionConn encrypts the messages of a message-oriented Conn with layers,
+// outermost first. The dialer adds all the layers to the messages written
+// and removes them from the messages read; the target, with a single layer,
+// does the opposite.
+type onionConn struct {
+	net.Conn
+	layers []*onionLayer
+	dialer bool
+
+	readMutex sync.Mutex
+	readBuf   []byte
+}
+
+// Write splits p into messages of up to ONION_MAX_PLAINTEXT_SIZE.
+func (oc *onionConn) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > ONION_MAX_PLAINTEXT_SIZE {
+			chunk = chunk[:ONION_MAX_PLAINTEXT_SIZE]
+		}
+
+		msg := chunk
+		for i := len(oc.layers) - 1; i >= 0; i-- {
+			if oc.dialer {
+				msg = oc.layers[i].forward.seal(msg)
+			} else {
+				msg = oc.layers[i].backward.seal(msg)
+			}
+		}
+		if _, err := oc.Conn.Write(msg); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Read reads one message. Like transportc.Conn, it returns io.ErrShortBuffer
+// if p is too small for the message, which is truncated.
+func (oc *onionConn) Read(p []byte) (n int, err error) {
+	oc.readMutex.Lock()
+	defer oc.readMutex.Unlock()
+
+	if oc.readBuf == nil {
+		oc.readBuf = make([]byte, transportc.CONN_DEFAULT_MTU)
+	}
+	n, err = oc.Conn.Read(oc.readBuf)
+	if err != nil {
+		return 0, err
+	}
+
+	msg := oc.readBuf[:n]
+	for _, layer := range oc.layers {
+		if oc.dialer {
+			msg, err = layer.backward.open(msg)
+		} else {
+			msg, err = layer.forward.open(msg)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n = copy(p, msg)
+	if n < len(msg) {
+		return n, io.ErrShortBuffer
+	}
+	return n, nil
+}
+
+// spliceOnion is splice removing layer from the messages read from
+// upstream, and adding it to those written to it.
+func spliceOnion(upstream, downstream net.Conn, layer *onionLayer) {
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- copyOnion(downstream, upstream, layer.forward.open)
+	}()
+	go func() {
+		errChan <- copyOnion(upstream, downstream, func(p []byte) ([]byte, error) {
+			return layer.backward.seal(p), nil
+		})
+	}()
+	<-errChan // tear down both directions once either is done, by the deferred Closes
+}
+
+func copyOnion(dst, src net.Conn, transform func([]byte) ([]byte, error)) error {
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	for {
+		n, err := src.Read(buf)
+		if err != nil {
+			return err
+		}
+		msg, err := transform(buf[:n])
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Write(msg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+)
+
+// PROXY protocol v2, see https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt
+var proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	proxyV2CmdLocal = 0x20 // version 2, LOCAL
+	proxyV2CmdProxy = 0x21 // version 2, PROXY
+
+	proxyV2FamUnspec   = 0x00
+	proxyV2FamTCPOver4 = 0x11
+	proxyV2FamTCPOver6 = 0x21
+)
+
+// proxyHeaderV2 builds a PROXY protocol v2 header for a connection from src to dst.
+//
+// The relayed datachannel is a reliable stream, so it is always announced as TCP
+// regardless of the transport used by ICE. If either address can't be resolved
+// to an IP address (e.g. an mDNS hostname), a LOCAL header is built instead so
+// the backend falls back to the address of the relay.
+func proxyHeaderV2(src, dst net.Addr) []byte {
+	srcIP, srcPort, srcOK := splitAddr(src)
+	dstIP, dstPort, dstOK := splitAddr(dst)
+
+	header := make([]byte, 0, 16+36)
+	header = append(header, proxyV2Signature...)
+
+	switch {
+	case srcOK && dstOK && srcIP.To4() != nil && dstIP.To4() != nil:
+		header = append(header, proxyV2CmdProxy, proxyV2FamTCPOver4)
+		header = binary.BigEndian.AppendUint16(header, 12)
+		header = append(header, srcIP.To4()...)
+		header = append(header, dstIP.To4()...)
+	case srcOK && dstOK:
+		header = append(header, proxyV2CmdProxy, proxyV2FamTCPOver6)
+		header = binary.BigEndian.AppendUint16(header, 36)
+		header = append(header, srcIP.To16()...)
+		header = append(header, dstIP.To16()...)
+	default:
+		header = append(header, proxyV2CmdLocal, proxyV2FamUnspec)
+		return binary.BigEndian.AppendUint16(header, 0)
+	}
+
+	header = binary.BigEndian.AppendUint16(header, srcPort)
+	return binary.BigEndian.AppendUint16(header, dstPort)
+}
+
+func splitAddr(addr net.Addr) (net.IP, uint16, bool) {
+	if addr == nil {
+		return nil, 0, false
+	}
+
+	host, portStr, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, 0, false
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0, false
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	return ip, uint16(port), true
+}
@@ -0,0 +1,120 @@
+// Package relay forwards Conns accepted from a transportc.Listener
+// (or any net.Listener) to a TCP backend, or chains them to other peers.
+package relay
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gaukas/logging"
+	"github.com/gaukas/transportc"
+)
+
+const (
+	DIAL_TIMEOUT_DEFAULT = 10 * time.Second
+)
+
+// Config is the configuration for the Relay.
+type Config struct {
+	// Backend is the address of the TCP backend to forward Conns to.
+	Backend string
+
+	// DialTimeout is the timeout for connecting to the Backend.
+	// If 0, DIAL_TIMEOUT_DEFAULT is used.
+	DialTimeout time.Duration
+
+	Logger logging.Logger
+
+	// ProxyProtocol indicates whether to emit a PROXY protocol v2 header on
+	// each connection to the Backend, carrying the remote ICE address of the
+	// relayed Conn so the Backend sees the true client address.
+	ProxyProtocol bool
+}
+
+// Relay accepts Conns from a net.Listener and forwards each of them to
+// a TCP backend.
+type Relay struct {
+	listener      net.Listener
+	backend       string
+	dialTimeout   time.Duration
+	logger        logging.Logger
+	proxyProtocol bool
+
+	wg sync.WaitGroup
+}
+
+var (
+	ErrNoBackend = errors.New("relay: no backend specified")
+)
+
+// NewRelay creates a new Relay serving Conns from the given net.Listener.
+func (c *Config) NewRelay(listener net.Listener) (*Relay, error) {
+	if c.Backend == "" {
+		return nil, ErrNoBackend
+	}
+
+	if c.Logger == nil {
+		c.Logger = logging.DefaultStderrLogger(logging.LOG_ERROR)
+	}
+
+	if c.DialTimeout == 0 {
+		c.DialTimeout = DIAL_TIMEOUT_DEFAULT
+	}
+
+	return &Relay{
+		listener:      listener,
+		backend:       c.Backend,
+		dialTimeout:   c.DialTimeout,
+		logger:        c.Logger,
+		proxyProtocol: c.ProxyProtocol,
+	}, nil
+}
+
+// Serve accepts Conns from the listener and forwards them to the backend
+// until the listener fails to Accept. It always returns a non-nil error.
+func (r *Relay) Serve() error {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.handle(conn)
+		}()
+	}
+}
+
+// Close closes the listener and waits for all relayed Conns to finish.
+func (r *Relay) Close() error {
+	err := r.listener.Close()
+	r.wg.Wait()
+	return err
+}
+
+func (r *Relay) handle(conn net.Conn) {
+	defer conn.Close()
+
+	backendConn, err := net.DialTimeout("tcp", r.backend, r.dialTimeout)
+	if err != nil {
+		r.logger.Errorf("relay: failed to dial backend %s: %v", r.backend, err)
+		return
+	}
+	defer backendConn.Close()
+
+	if r.proxyProtocol {
+		header := proxyHeaderV2(conn.RemoteAddr(), conn.LocalAddr())
+		if _, err := backendConn.Write(header); err != nil {
+			r.logger.Errorf("relay: failed to write PROXY header: %v", err)
+			return
+		}
+	}
+
+	if err := transportc.Splice(conn, backendConn); err != nil {
+		r.logger.Debugf("relay: connection closed: %v", err)
+	}
+}
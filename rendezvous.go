@@ -0,0 +1,157 @@
+package transportc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+
+	"github.com/pion/webrtc/v3"
+)
+
+var (
+	// ErrRendezvousWithoutSignal is returned by Config.Rendezvous if no
+	// Signal is configured.
+	ErrRendezvousWithoutSignal = errors.New("rendezvous requires a Signal")
+)
+
+type rendezvousOffer struct {
+	id      uint64
+	message signalMessage
+}
+
+// Rendezvous establishes a Conn with a remote peer calling Rendezvous at the
+// same time, for P2P topologies where neither peer is a designated Listener.
+//
+// Both peers offer a PeerConnection, each with a random nonce, and read the
+// offer of the other. The glare is resolved deterministically: the peer with
+// the greater nonce is the offerer, and the other abandons its own offer to
+// answer. An offer of a Dialer, i.e., without nonce, is always answered, and
+// the offer is answered by a Listener as usual, so a peer calling Rendezvous
+// also connects with a designated Dialer or Listener.
+//
+// The Signal MUST deliver the offers of each peer to the other only, e.g., as
+// the InProcessSignals returned by NewInProcessSignalPair, or a broker routing
+// offers by peer.
+//
+// The Conn returned holds its own PeerConnection, closed along with it.
+func (c *Config) Rendezvous(ctx context.Context, label string) (net.Conn, error) {
+	if c.Signal == nil {
+		return nil, ErrRendezvousWithoutSignal
+	}
+
+	dialer, err := c.NewDialer()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := c.NewListener()
+	if err != nil {
+		dialer.Close()
+		return nil, err
+	}
+	// The Listener is not started, as the offers are read below
+	atomic.StoreUint32(&listener.runningStatus, LISTENER_RUNNING)
+	if listener.timeout == 0 {
+		listener.timeout = DEFAULT_ACCEPT_TIMEOUT
+	}
+
+	nonce := randomUint64()
+	dialer.rendezvousNonce = nonce
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	dialCtx, cancelDial := context.WithCancel(ctx)
+	defer cancelDial()
+	dialed := make(chan dialResult, 1)
+	go func() {
+		conn, err := dialer.DialContext(dialCtx, label)
+		dialed <- dialResult{conn, err}
+	}()
+
+	offers := make(chan rendezvousOffer)
+	go func() {
+		for ctx.Err() == nil {
+			offerID, message, err := readSignalOffer(c.Signal)
+			if err != nil {
+				continue
+			}
+			select {
+			case offers <- rendezvousOffer{offerID, message}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			dialer.Close()
+			listener.Close()
+			return nil, ctx.Err()
+		case result := <-dialed:
+			listener.Close()
+			if result.err != nil {
+				dialer.Close()
+				return nil, result.err
+			}
+			go closeAfter(result.conn, dialer.Close)
+			return result.conn, nil
+		case offer := <-offers:
+			envelope, _, err := offer.message.open(webrtc.SDPTypeOffer, c.AllowedPeers)
+			if err != nil {
+				dialer.logger.Debugf("rendezvous: discarding offer #%d: %v", offer.id, err)
+				continue
+			}
+			if envelope.Nonce != 0 && envelope.Nonce <= nonce {
+				continue // ours to offer, or our own offer
+			}
+
+			// Abandon our offer to answer, unless already answered
+			cancelDial()
+			if result := <-dialed; result.err == nil {
+				listener.Close()
+				go closeAfter(result.conn, dialer.Close)
+				return result.conn, nil
+			}
+			dialer.Close()
+
+			conn, err := listener.answerRendezvous(ctx, offer)
+			if err != nil {
+				listener.Close()
+				return nil, err
+			}
+			go closeAfter(conn, listener.Close)
+			return conn, nil
+		}
+	}
+}
+
+// answerRendezvous answers offer and returns the first Conn accepted.
+func (l *Listener) answerRendezvous(ctx context.Context, offer rendezvousOffer) (net.Conn, error) {
+	if err := l.nextPeerConnection(ctx, 0, offer.id, offer.message); err != nil { // the Signal of the Config
+		return nil, err
+	}
+	for {
+		if conn, ok := l.acceptQueue.pop(); ok {
+			return conn, nil
+		}
+		select {
+		case <-l.acceptQueue.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// closeAfter calls closeFunc once conn is closed.
+func closeAfter(conn net.Conn, closeFunc func() error) {
+	if c, ok := conn.(*Conn); ok {
+		<-c.Done()
+	}
+	closeFunc()
+}
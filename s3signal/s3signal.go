@@ -0,0 +1,428 @@
+// Package s3signal implements transportc.KVStore with S3-compatible object
+// storage, so loosely coupled peers signal through a bucket as a dead drop,
+// e.g., on an endpoint of a popular cloud provider too costly to block.
+//
+// Offers and answers are objects under a prefix, polled by the peers. Objects
+// never read are removed by a lifecycle rule of the bucket, see
+// Store.PutExpiration, and ignored by transportc.KVSignal once older than its
+// TTL.
+//
+// Requests are signed with AWS Signature Version 4, without any SDK.
+package s3signal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5" // skipcq: GSC-G501
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+const (
+	DEFAULT_POLL_INTERVAL = time.Second
+	MAX_OBJECT_SIZE       = 64 * 1024 // max size of an offer or answer
+
+	amzDateFormat  = "20060102T150405Z"
+	amzScopeFormat = "20060102"
+	amzAlgorithm   = "AWS4-HMAC-SHA256"
+	amzService     = "s3"
+)
+
+var (
+	// ErrMissingBucket is returned by NewStore if the Config has no
+	// Endpoint or Bucket.
+	ErrMissingBucket = errors.New("s3signal: endpoint and bucket required")
+)
+
+// Config configures a Store.
+type Config struct {
+	// Endpoint is the URL of the S3-compatible service, e.g.,
+	// https://s3.us-east-1.amazonaws.com.
+	Endpoint string
+
+	// Bucket is the name of the bucket, which must exist.
+	Bucket string
+
+	// PathStyle addresses the bucket in the path of the Endpoint instead of
+	// as a subdomain of it, as required by most self-hosted services.
+	PathStyle bool
+
+	// Region is the region in the signature of requests. If empty,
+	// "us-east-1" is used.
+	Region string
+
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials
+	// signing the requests. Requests are sent unsigned if AccessKeyID is
+	// empty, e.g., to a bucket writable by anyone.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// HTTPClient sends the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// PollInterval is how often Watch lists the objects. If zero,
+	// DEFAULT_POLL_INTERVAL is used.
+	PollInterval time.Duration
+}
+
+// Store is a transportc.KVStore over an S3-compatible bucket.
+//
+// S3 has no atomic get-and-delete, so two Listeners polling the same prefix
+// may both read an offer. Only the first answer is stored, the other Listener
+// fails to answer with transportc.ErrInvalidOfferID.
+type Store struct {
+	bucketURL    *url.URL
+	region       string
+	accessKeyID  string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+	pollInterval time.Duration
+}
+
+// NewStore creates a Store from config.
+func NewStore(config *Config) (*Store, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, ErrMissingBucket
+	}
+
+	bucketURL, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3signal: %w", err)
+	}
+	if config.PathStyle {
+		bucketURL.Path = strings.TrimSuffix(bucketURL.Path, "/") + "/" + config.Bucket
+	} else {
+		bucketURL.Host = config.Bucket + "." + bucketURL.Host
+	}
+
+	s := &Store{
+		bucketURL:    bucketURL,
+		region:       config.Region,
+		accessKeyID:  config.AccessKeyID,
+		secretKey:    config.SecretAccessKey,
+		sessionToken: config.SessionToken,
+		client:       config.HTTPClient,
+		pollInterval: config.PollInterval,
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+	if s.pollInterval == 0 {
+		s.pollInterval = DEFAULT_POLL_INTERVAL
+	}
+	return s, nil
+}
+
+// NewSignal returns a transportc.KVSignal storing its state in the bucket of
+// config under prefix, see transportc.NewKVSignal.
+func NewSignal(config *Config, prefix string, ttl time.Duration) (*transportc.KVSignal, error) {
+	s, err := NewStore(config)
+	if err != nil {
+		return nil, err
+	}
+	return transportc.NewKVSignal(s, prefix, ttl), nil
+}
+
+// Create implements transportc.KVStore.Create.
+// It puts the object with If-None-Match, so an existing object is not
+// overwritten. The TTL is left to the lifecycle rule of the bucket.
+func (s *Store) Create(ctx context.Context, key string, value []byte, _ time.Duration) error {
+	resp, err := s.do(ctx, http.MethodPut, key, nil, value, http.Header{
+		"If-None-Match": []string{"*"},
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return transportc.ErrKVKeyExists
+	default:
+		return statusError(http.MethodPut, key, resp)
+	}
+}
+
+// Take implements transportc.KVStore.Take.
+// It gets then deletes the object, which is not atomic.
+func (s *Store) Take(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, transportc.ErrKVKeyNotFound
+	default:
+		return nil, statusError(http.MethodGet, key, resp)
+	}
+
+	value, err := io.ReadAll(io.LimitReader(resp.Body, MAX_OBJECT_SIZE))
+	if err != nil {
+		return nil, fmt.Errorf("s3signal: %w", err)
+	}
+
+	resp, err = s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return nil, statusError(http.MethodDelete, key, resp)
+	}
+	return value, nil
+}
+
+// listBucketResult is the response of ListObjectsV2.
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Keys implements transportc.KVStore.Keys.
+// The keys are sorted by the last modification of their object.
+func (s *Store) Keys(ctx context.Context, prefix string) ([]string, error) {
+	var result listBucketResult
+	query := url.Values{
+		"list-type": []string{"2"},
+		"prefix":    []string{prefix},
+	}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, statusError(http.MethodGet, prefix, resp)
+		}
+
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3signal: %w", err)
+		}
+
+		result.Contents = append(result.Contents, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+
+	sort.SliceStable(result.Contents, func(i, j int) bool {
+		return result.Contents[i].LastModified.Before(result.Contents[j].LastModified)
+	})
+	keys := make([]string, 0, len(result.Contents))
+	for _, object := range result.Contents {
+		keys = append(keys, object.Key)
+	}
+	return keys, nil
+}
+
+// Watch implements transportc.KVStore.Watch.
+// S3 has no watches, so it lists the objects under prefix every
+// PollInterval, notifying while there are any.
+func (s *Store) Watch(ctx context.Context, prefix string) <-chan struct{} {
+	notify := make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			keys, err := s.Keys(ctx, prefix)
+			if err != nil || len(keys) == 0 {
+				continue
+			}
+			select {
+			case notify <- struct{}{}:
+			default: // a notification is already pending
+			}
+		}
+	}()
+	return notify
+}
+
+// PutExpiration sets the lifecycle configuration of the bucket to expire the
+// objects under prefix after days, so offers and answers never read don't
+// accumulate. It replaces any lifecycle configuration of the bucket.
+func (s *Store) PutExpiration(ctx context.Context, prefix string, days int) error {
+	body := []byte("<LifecycleConfiguration><Rule><ID>transportc</ID><Filter><Prefix>" +
+		xmlEscape(prefix) + "</Prefix></Filter><Status>Enabled</Status><Expiration><Days>" +
+		strconv.Itoa(days) + "</Days></Expiration></Rule></LifecycleConfiguration>")
+	sum := md5.Sum(body) // skipcq: GSC-G401
+	resp, err := s.do(ctx, http.MethodPut, "", url.Values{"lifecycle": []string{""}}, body, http.Header{
+		"Content-Md5": []string{base64.StdEncoding.EncodeToString(sum[:])},
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(http.MethodPut, "?lifecycle", resp)
+	}
+	return nil
+}
+
+// do sends a request for the object of key, or for the bucket if key is
+// empty, signed if the Store has credentials.
+func (s *Store) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := *s.bucketURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3signal: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.accessKeyID != "" {
+		s.sign(req, body, time.Now().UTC())
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3signal: %w", err)
+	}
+	return resp, nil
+}
+
+// sign signs req with AWS Signature Version 4.
+func (s *Store) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	// sign the host and all the x-amz-* headers
+	headers := map[string]string{"host": req.URL.Host}
+	names := []string{"host"}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := now.Format(amzScopeFormat) + "/" + s.region + "/" + amzService + "/aws4_request"
+	stringToSign := amzAlgorithm + "\n" + now.Format(amzDateFormat) + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format(amzScopeFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, amzService)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", amzAlgorithm+" Credential="+s.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by key, as required by the signature.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes all but the unreserved characters of s, and '/'
+// unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s)) // never fails writing to a strings.Builder
+	return b.String()
+}
+
+func statusError(method, key string, resp *http.Response) error {
+	return fmt.Errorf("s3signal: %s %s: %s", method, key, resp.Status)
+}
@@ -0,0 +1,485 @@
+package transportc
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	MAX_SIGNAL_MESSAGE_SIZE = 64 * 1024 // size limit of an offer or answer received
+	MAX_SIGNAL_JSON_DEPTH   = 8
+	MAX_SDP_LINES           = 1024
+
+	// SDP_ENVELOPE_VERSION is the version of the JSON envelope of the offers
+	// and answers sent. Envelopes of a later version are rejected as
+	// malformed, and those without version are read as of version 1.
+	//
+	// Since version 2, the signature of an envelope binds all its fields, see
+	// Config.IdentityKey.
+	SDP_ENVELOPE_VERSION = 2
+)
+
+var (
+	// ErrMalformedSignal is returned when an offer or answer received via
+	// Signal fails validation.
+	ErrMalformedSignal = errors.New("malformed signaling message")
+
+	// ErrDTLSRoleConflict is returned when both peers require the same DTLS role.
+	ErrDTLSRoleConflict = errors.New("both peers require the same DTLS role")
+
+	// ErrICERoleConflict is returned when the ICE role a peer would take, as
+	// per RFC8445, Section 6.1.1, is not the one it requires, see
+	// Config.DialerICERole and Config.ListenerICERole.
+	ErrICERoleConflict = errors.New("ICE role conflicts with the required one")
+
+	// ErrAnswerMismatch is returned when an answer received via Signal is
+	// inconsistent with the offer, e.g., injected by the broker or meant for
+	// another offer.
+	ErrAnswerMismatch = errors.New("answer inconsistent with offer")
+
+	// ErrFingerprintNotPinned is returned when the DTLS fingerprint of an
+	// answer is not one of Config.DialerPinnedFingerprints.
+	ErrFingerprintNotPinned = errors.New("DTLS fingerprint not pinned")
+)
+
+// SDPTransform rewrites a SessionDescription, e.g., to rewrite candidate addresses
+// for split-horizon NAT, strip lines or inject bandwidth attributes.
+//
+// The returned SessionDescription replaces the input. Returning an error aborts
+// the negotiation of the PeerConnection.
+type SDPTransform func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error)
+
+// SDPBandwidth caps the bandwidth advertised in the application media
+// section of the local SDP, i.e., of the DataChannels, so well-behaved remote
+// peers don't send beyond it. pion does not enforce the caps it receives.
+// Zero fields are left as generated.
+type SDPBandwidth struct {
+	// AS is the application-specific maximum in kbps, advertised as b=AS
+	// (RFC4566, Section 5.8).
+	AS uint64
+
+	// TIAS is the transport independent maximum in bps, advertised as b=TIAS
+	// (RFC3890).
+	TIAS uint64
+
+	// MaxMessageSize is the max size of the messages the remote peer may
+	// send, advertised as a=max-message-size (RFC8841, Section 6).
+	MaxMessageSize uint64
+}
+
+// sdpEnvelope is the JSON object exchanged via Signal. It is compatible with the
+// JSON encoding of webrtc.SessionDescription, with optional fields appended.
+type sdpEnvelope struct {
+	webrtc.SessionDescription
+
+	// Version of the envelope, 0 if sent by a peer predating SDP_ENVELOPE_VERSION
+	Version uint8 `json:"v,omitempty"`
+
+	// Peer identity, see Config.IdentityKey
+	PublicKey ed25519.PublicKey `json:"pk,omitempty"`
+	Signature []byte            `json:"sig,omitempty"`
+
+	// Issued-at and expiry times of the signature in Unix seconds, see
+	// Config.SignedOfferTTL
+	IssuedAt int64 `json:"iat,omitempty"`
+	Expiry   int64 `json:"exp,omitempty"`
+
+	// Namespace of the Listener to connect to, see Config.Namespace
+	Namespace string `json:"ns,omitempty"`
+
+	// Restart is the ID of the offer the PeerConnection was created from,
+	// if the offer is an ICE restart, see Dialer.Resume
+	Restart uint64 `json:"restart,omitempty"`
+
+	// Nonce resolving the glare if the offer is of a rendezvous, see
+	// Config.Rendezvous
+	Nonce uint64 `json:"nonce,omitempty"`
+
+	// Trace of the Dialer, see TracePropagator
+	Trace map[string]string `json:"trace,omitempty"`
+
+	// Label and protocol of the DataChannel dialed with the offer, and
+	// application metadata, see WithOfferMetadata
+	Label    string            `json:"label,omitempty"`
+	Protocol string            `json:"proto,omitempty"`
+	Metadata map[string]string `json:"meta,omitempty"`
+
+	// Reconnect ticket, submitted by the Dialer in an offer or issued by the
+	// Listener in an answer, see Config.ListenerTicketKey
+	Ticket string `json:"tkt,omitempty"`
+}
+
+// newSDPEnvelope wraps desc to be signaled to namespace. It is signed by
+// signSessionDescription once all its fields are set.
+func newSDPEnvelope(desc *webrtc.SessionDescription, namespace string) *sdpEnvelope {
+	return &sdpEnvelope{
+		SessionDescription: *desc,
+		Version:            SDP_ENVELOPE_VERSION,
+		Namespace:          namespace,
+	}
+}
+
+// signalMessage is an offer or answer exchanged via Signal, either serialized
+// or, if the Signal is an envelopeSignal, as is.
+type signalMessage struct {
+	raw      []byte
+	envelope *sdpEnvelope
+}
+
+// bytes returns the serialized message.
+func (m signalMessage) bytes() ([]byte, error) {
+	if m.envelope == nil {
+		return m.raw, nil
+	}
+	return json.Marshal(m.envelope)
+}
+
+// open decodes and validates the message as a SessionDescription of sdpType,
+// unless not serialized, and verifies the identity of the remote peer against
+// allowedPeers.
+//
+// It returns the public key of the remote peer if the SessionDescription is signed.
+func (m signalMessage) open(sdpType webrtc.SDPType, allowedPeers []ed25519.PublicKey) (*sdpEnvelope, ed25519.PublicKey, error) {
+	envelope := m.envelope
+	if envelope == nil {
+		var err error
+		envelope, err = parseEnvelope(m.raw, sdpType)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if envelope.Type != sdpType {
+		return nil, nil, fmt.Errorf("%w: expected %s, got %s", ErrMalformedSignal, sdpType, envelope.Type)
+	}
+
+	peerIdentity, err := verifySessionDescription(envelope, allowedPeers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return envelope, peerIdentity, nil
+}
+
+// ParseSessionDescription decodes a SessionDescription of sdpType received via
+// Signal and validates it before it may be passed to pion.
+//
+// The message MUST NOT exceed MAX_SIGNAL_MESSAGE_SIZE or nest JSON deeper than
+// MAX_SIGNAL_JSON_DEPTH, and the SDP MUST be well-formed with at least one media
+// section, a DTLS fingerprint and ICE credentials. Otherwise, an error wrapping
+// ErrMalformedSignal is returned.
+func ParseSessionDescription(data []byte, sdpType webrtc.SDPType) (webrtc.SessionDescription, error) {
+	envelope, err := parseEnvelope(data, sdpType)
+	if err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	return envelope.SessionDescription, nil
+}
+
+func parseEnvelope(data []byte, sdpType webrtc.SDPType) (*sdpEnvelope, error) {
+	if len(data) > MAX_SIGNAL_MESSAGE_SIZE {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the size limit", ErrMalformedSignal, len(data))
+	}
+
+	if err := checkJSONDepth(data, MAX_SIGNAL_JSON_DEPTH); err != nil {
+		return nil, err
+	}
+
+	envelope := &sdpEnvelope{}
+	if err := json.Unmarshal(data, envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedSignal, err)
+	}
+	if envelope.Version > SDP_ENVELOPE_VERSION {
+		return nil, fmt.Errorf("%w: unsupported envelope version %d", ErrMalformedSignal, envelope.Version)
+	}
+
+	if err := validateSDP(&envelope.SessionDescription, sdpType); err != nil {
+		return nil, err
+	}
+
+	return envelope, nil
+}
+
+// checkJSONDepth returns an error if data is not valid JSON or nests
+// objects and arrays deeper than maxDepth.
+func checkJSONDepth(data []byte, maxDepth int) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformedSignal, err)
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("%w: JSON nested too deep", ErrMalformedSignal)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+// validateSDP checks desc is a sane SessionDescription of sdpType.
+func validateSDP(desc *webrtc.SessionDescription, sdpType webrtc.SDPType) error {
+	if desc.Type != sdpType {
+		return fmt.Errorf("%w: expected %s, got %s", ErrMalformedSignal, sdpType, desc.Type)
+	}
+
+	if strings.IndexByte(desc.SDP, 0) >= 0 {
+		return fmt.Errorf("%w: SDP contains NUL", ErrMalformedSignal)
+	}
+
+	if strings.Count(desc.SDP, "\n") > MAX_SDP_LINES {
+		return fmt.Errorf("%w: SDP has too many lines", ErrMalformedSignal)
+	}
+
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedSignal, err)
+	}
+
+	if len(parsed.MediaDescriptions) == 0 {
+		return fmt.Errorf("%w: SDP has no media section", ErrMalformedSignal)
+	}
+
+	for _, attr := range []string{"fingerprint", "ice-ufrag", "ice-pwd"} {
+		if _, ok := parsed.Attribute(attr); ok {
+			continue
+		}
+		found := false
+		for _, media := range parsed.MediaDescriptions {
+			if _, ok := media.Attribute(attr); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: SDP has no %s", ErrMalformedSignal, attr)
+		}
+	}
+
+	return nil
+}
+
+// validateAnswer checks answer is consistent with offer before it is applied:
+// the same media sections in the same order, a single DTLS fingerprint and a
+// single pair of valid ICE credentials, none reflected from offer. If pinned
+// is not empty, the DTLS fingerprint MUST be one of pinned.
+//
+// offer may be nil, in which case only the answer itself is checked.
+func validateAnswer(offer, answer *webrtc.SessionDescription, pinned []string) error {
+	parsedAnswer, err := answer.Unmarshal()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedSignal, err)
+	}
+
+	fingerprints := sdpAttributeValues(parsedAnswer, "fingerprint", normalizeFingerprint)
+	if len(fingerprints) != 1 {
+		return fmt.Errorf("%w: %d distinct DTLS fingerprints", ErrAnswerMismatch, len(fingerprints))
+	}
+	ufrags := sdpAttributeValues(parsedAnswer, "ice-ufrag", nil)
+	pwds := sdpAttributeValues(parsedAnswer, "ice-pwd", nil)
+	if len(ufrags) != 1 || len(pwds) != 1 {
+		return fmt.Errorf("%w: inconsistent ICE credentials", ErrAnswerMismatch)
+	}
+	credentials := ICECredentials{UsernameFragment: ufrags[0], Password: pwds[0]}
+	if err := credentials.validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrAnswerMismatch, err)
+	}
+
+	if offer != nil {
+		parsedOffer, err := offer.Unmarshal()
+		if err != nil {
+			return err
+		}
+
+		if len(parsedAnswer.MediaDescriptions) != len(parsedOffer.MediaDescriptions) {
+			return fmt.Errorf("%w: %d media sections answered for %d offered", ErrAnswerMismatch, len(parsedAnswer.MediaDescriptions), len(parsedOffer.MediaDescriptions))
+		}
+		for i, offered := range parsedOffer.MediaDescriptions {
+			answered := parsedAnswer.MediaDescriptions[i]
+			offeredMid, _ := offered.Attribute("mid")
+			answeredMid, _ := answered.Attribute("mid")
+			if answered.MediaName.Media != offered.MediaName.Media || answeredMid != offeredMid {
+				return fmt.Errorf("%w: media section #%d is %s %q, %s %q offered", ErrAnswerMismatch, i, answered.MediaName.Media, answeredMid, offered.MediaName.Media, offeredMid)
+			}
+		}
+
+		for _, fingerprint := range sdpAttributeValues(parsedOffer, "fingerprint", normalizeFingerprint) {
+			if fingerprint == fingerprints[0] {
+				return fmt.Errorf("%w: DTLS fingerprint reflected from the offer", ErrAnswerMismatch)
+			}
+		}
+		for _, ufrag := range sdpAttributeValues(parsedOffer, "ice-ufrag", nil) {
+			if ufrag == ufrags[0] {
+				return fmt.Errorf("%w: ICE credentials reflected from the offer", ErrAnswerMismatch)
+			}
+		}
+	}
+
+	if len(pinned) == 0 {
+		return nil
+	}
+	for _, fingerprint := range pinned {
+		if normalizeFingerprint(fingerprint) == fingerprints[0] {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrFingerprintNotPinned, fingerprints[0])
+}
+
+// sdpAttributeValues returns the distinct values of the attribute key at the
+// session and media levels of desc, normalized by normalize if not nil.
+func sdpAttributeValues(desc *sdp.SessionDescription, key string, normalize func(string) string) []string {
+	var values []string
+	add := func(attributes []sdp.Attribute) {
+		for _, attr := range attributes {
+			if attr.Key != key {
+				continue
+			}
+			value := strings.TrimSpace(attr.Value)
+			if normalize != nil {
+				value = normalize(value)
+			}
+			if !containsString(values, value) {
+				values = append(values, value)
+			}
+		}
+	}
+
+	add(desc.Attributes)
+	for _, media := range desc.MediaDescriptions {
+		add(media.Attributes)
+	}
+	return values
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeFingerprint returns fingerprint, e.g., "sha-256 AB:CD:...", in
+// lowercase with single spaces, so fingerprints can be compared.
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.Join(strings.Fields(fingerprint), " "))
+}
+
+// dtlsSetupRole returns the DTLS role announced by the a=setup attribute of
+// desc (RFC5763, Section 5), or DTLSRoleAuto for actpass or if absent.
+func dtlsSetupRole(desc *webrtc.SessionDescription) DTLSRole {
+	for _, line := range strings.Split(desc.SDP, "\n") {
+		switch strings.TrimSpace(line) {
+		case "a=setup:active":
+			return DTLSRoleClient
+		case "a=setup:passive":
+			return DTLSRoleServer
+		}
+	}
+	return DTLSRoleAuto
+}
+
+// iceLite returns whether desc announces the ICE-lite mode with the session
+// level a=ice-lite attribute (RFC8839, Section 5.3).
+func iceLite(desc *webrtc.SessionDescription) bool {
+	for _, line := range strings.Split(desc.SDP, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "m=") {
+			return false // session level only
+		}
+		if line == "a=ice-lite" {
+			return true
+		}
+	}
+	return false
+}
+
+// dtlsFingerprint returns the first a=fingerprint attribute of desc, which
+// identifies the DTLS certificate of the peer, or an empty string if absent.
+func dtlsFingerprint(desc *webrtc.SessionDescription) string {
+	for _, line := range strings.Split(desc.SDP, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "a=fingerprint:") {
+			return strings.ToLower(strings.TrimPrefix(line, "a=fingerprint:"))
+		}
+	}
+	return ""
+}
+
+// withDTLSSetupRole returns a copy of desc announcing role instead of actpass.
+func withDTLSSetupRole(desc *webrtc.SessionDescription, role DTLSRole) *webrtc.SessionDescription {
+	setup := "a=setup:active"
+	if role == DTLSRoleServer {
+		setup = "a=setup:passive"
+	}
+
+	result := *desc
+	result.SDP = strings.ReplaceAll(desc.SDP, "a=setup:actpass", setup)
+	return &result
+}
+
+// withSDPBandwidth returns a copy of desc advertising bandwidth in its
+// application media sections, replacing the values generated.
+func withSDPBandwidth(desc *webrtc.SessionDescription, bandwidth *SDPBandwidth) (*webrtc.SessionDescription, error) {
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media != "application" {
+			continue
+		}
+		media.Bandwidth = withBandwidth(media.Bandwidth, "AS", bandwidth.AS)
+		media.Bandwidth = withBandwidth(media.Bandwidth, "TIAS", bandwidth.TIAS)
+		if bandwidth.MaxMessageSize != 0 {
+			attributes := media.Attributes[:0]
+			for _, attribute := range media.Attributes {
+				if attribute.Key != "max-message-size" {
+					attributes = append(attributes, attribute)
+				}
+			}
+			media.Attributes = append(attributes, sdp.NewAttribute("max-message-size", strconv.FormatUint(bandwidth.MaxMessageSize, 10)))
+		}
+	}
+
+	marshaled, err := parsed.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	result := *desc
+	result.SDP = string(marshaled)
+	return &result, nil
+}
+
+// withBandwidth returns bandwidths with the one of bandwidthType set to value,
+// unless zero.
+func withBandwidth(bandwidths []sdp.Bandwidth, bandwidthType string, value uint64) []sdp.Bandwidth {
+	if value == 0 {
+		return bandwidths
+	}
+	result := bandwidths[:0]
+	for _, bandwidth := range bandwidths {
+		if bandwidth.Type != bandwidthType {
+			result = append(result, bandwidth)
+		}
+	}
+	return append(result, sdp.Bandwidth{Type: bandwidthType, Bandwidth: value})
+}
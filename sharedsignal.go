@@ -0,0 +1,264 @@
+package transportc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	SHARED_SIGNAL_OFFER_BUFFER  = 64
+	SHARED_SIGNAL_POLL_INTERVAL = time.Second
+
+	// SHARED_SIGNAL_ANSWER_EXPIRY is how long an offer awaits its answer
+	// without ReadAnswer being called before it is forgotten, e.g., once the
+	// Dial it was sent by is canceled.
+	SHARED_SIGNAL_ANSWER_EXPIRY = 5 * SHARED_SIGNAL_POLL_INTERVAL
+)
+
+var (
+	// ErrSignalSessionClosed is returned by SharedSignal when the underlying
+	// SignalSession is closed or failed.
+	ErrSignalSessionClosed = errors.New("signal session closed")
+)
+
+// SignalSession defines a bidirectional message-oriented session to a broker,
+// e.g., a single WebSocket connection.
+//
+// Messages sent by Send are expected to be delivered by the broker to the
+// SignalSession(s) of the remote peer(s), and vice versa.
+type SignalSession interface {
+	// Send sends a message to the broker.
+	Send(msg []byte) error
+
+	// Receive blocks until the next message is received from the broker.
+	// Any error returned is considered fatal to the session.
+	Receive() ([]byte, error)
+}
+
+// sharedSignalMessage is the envelope of every message exchanged over the
+// SignalSession by SharedSignal.
+type sharedSignalMessage struct {
+	Type string `json:"t"`  // "offer" or "answer"
+	ID   uint64 `json:"id"` // correlation ID, generated by the offerer
+	Body []byte `json:"b"`  // SDP offer or answer
+}
+
+const (
+	sharedSignalTypeOffer  = "offer"
+	sharedSignalTypeAnswer = "answer"
+)
+
+// SharedSignal implements Signal by multiplexing the offer/answer exchanges
+// of multiple Dialer and Listener instances over one SignalSession.
+//
+// Each offer is tagged with a random correlation ID which is used as the offerID
+// and echoed back by the answerer, so answers are dispatched to the matching
+// ReadAnswer call regardless of how many exchanges are in flight.
+//
+// A SharedSignal is safe for concurrent use and the same instance SHOULD be
+// set as the Signal of all the Dialers and Listeners sharing the session.
+type SharedSignal struct {
+	session   SignalSession
+	sendMutex sync.Mutex // serializes Send calls on session
+
+	offers chan offer
+
+	answerMutex sync.Mutex
+	answers     map[uint64]*pendingAnswer // pending offers, by correlation ID
+
+	closed chan bool
+	err    error // set before closed is closed
+}
+
+// pendingAnswer is the answer awaited by an offer sent over the SharedSignal.
+type pendingAnswer struct {
+	answer chan []byte
+	expiry time.Time // extended by each ReadAnswer, see SHARED_SIGNAL_ANSWER_EXPIRY
+}
+
+// NewSharedSignal creates a new SharedSignal over the given SignalSession and
+// starts receiving messages from it.
+func NewSharedSignal(session SignalSession) *SharedSignal {
+	ss := &SharedSignal{
+		session: session,
+		offers:  make(chan offer, SHARED_SIGNAL_OFFER_BUFFER),
+		answers: make(map[uint64]*pendingAnswer),
+		closed:  make(chan bool),
+	}
+	go ss.receiveLoop()
+	return ss
+}
+
+// Offer implements Signal.Offer.
+// It tags the offer with a new correlation ID and sends it over the session.
+func (ss *SharedSignal) Offer(offerBody []byte) (uint64, error) {
+	pending := &pendingAnswer{
+		answer: make(chan []byte, 1),
+		expiry: currentClock().Now().Add(SHARED_SIGNAL_ANSWER_EXPIRY),
+	}
+
+	ss.answerMutex.Lock()
+	ss.expireAnswers()
+	var id uint64
+	for {
+		id = randomUint64()
+		if _, ok := ss.answers[id]; !ok { // not found
+			break // okay to use this ID
+		}
+	}
+	ss.answers[id] = pending
+	ss.answerMutex.Unlock()
+
+	err := ss.send(sharedSignalMessage{
+		Type: sharedSignalTypeOffer,
+		ID:   id,
+		Body: offerBody,
+	})
+	if err != nil {
+		ss.answerMutex.Lock()
+		delete(ss.answers, id)
+		ss.answerMutex.Unlock()
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// ReadOffer implements Signal.ReadOffer.
+// It blocks for up to SHARED_SIGNAL_POLL_INTERVAL before returning ErrOfferNotReady.
+func (ss *SharedSignal) ReadOffer() (uint64, []byte, error) {
+	select {
+	case offer := <-ss.offers:
+		return offer.id, offer.body, nil
+	case <-ss.closed:
+		return 0, nil, ss.err
+	case <-time.After(SHARED_SIGNAL_POLL_INTERVAL):
+		return 0, nil, ErrOfferNotReady
+	}
+}
+
+// Answer implements Signal.Answer.
+// It sends the answer over the session tagged with the correlation ID of the offer.
+func (ss *SharedSignal) Answer(offerID uint64, answer []byte) error {
+	return ss.send(sharedSignalMessage{
+		Type: sharedSignalTypeAnswer,
+		ID:   offerID,
+		Body: answer,
+	})
+}
+
+// ReadAnswer implements Signal.ReadAnswer.
+// It blocks for up to SHARED_SIGNAL_POLL_INTERVAL before returning
+// ErrAnswerNotReady. An offer not polled by ReadAnswer for
+// SHARED_SIGNAL_ANSWER_EXPIRY is forgotten, and ErrInvalidOfferID is returned.
+func (ss *SharedSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	ss.answerMutex.Lock()
+	ss.expireAnswers()
+	pending, ok := ss.answers[offerID]
+	if ok {
+		pending.expiry = currentClock().Now().Add(SHARED_SIGNAL_ANSWER_EXPIRY)
+	}
+	ss.answerMutex.Unlock()
+	if !ok {
+		return nil, ErrInvalidOfferID
+	}
+
+	select {
+	case answer := <-pending.answer:
+		ss.answerMutex.Lock()
+		delete(ss.answers, offerID)
+		ss.answerMutex.Unlock()
+		return answer, nil
+	case <-ss.closed:
+		return nil, ss.err
+	case <-time.After(SHARED_SIGNAL_POLL_INTERVAL):
+		return nil, ErrAnswerNotReady
+	}
+}
+
+// PendingOffers returns the number of offers sent and awaiting their answer,
+// not expired.
+func (ss *SharedSignal) PendingOffers() int {
+	ss.answerMutex.Lock()
+	defer ss.answerMutex.Unlock()
+
+	ss.expireAnswers()
+	return len(ss.answers)
+}
+
+// expireAnswers forgets the offers past their expiry.
+//
+// Not thread-safe. Caller MUST hold answerMutex before calling this function.
+func (ss *SharedSignal) expireAnswers() {
+	now := currentClock().Now()
+	for id, pending := range ss.answers {
+		if now.After(pending.expiry) {
+			delete(ss.answers, id)
+		}
+	}
+}
+
+// Err returns the error which caused the session to close, or nil if
+// the session is still active.
+func (ss *SharedSignal) Err() error {
+	select {
+	case <-ss.closed:
+		return ss.err
+	default:
+		return nil
+	}
+}
+
+func (ss *SharedSignal) send(msg sharedSignalMessage) error {
+	select {
+	case <-ss.closed:
+		return ss.err
+	default:
+	}
+
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	ss.sendMutex.Lock()
+	defer ss.sendMutex.Unlock()
+	return ss.session.Send(msgBytes)
+}
+
+func (ss *SharedSignal) receiveLoop() {
+	for {
+		msgBytes, err := ss.session.Receive()
+		if err != nil {
+			ss.err = fmt.Errorf("%w: %v", ErrSignalSessionClosed, err)
+			close(ss.closed)
+			return
+		}
+
+		var msg sharedSignalMessage
+		if err := json.Unmarshal(msgBytes, &msg); err != nil {
+			continue // ignore malformed messages
+		}
+
+		switch msg.Type {
+		case sharedSignalTypeOffer:
+			select {
+			case ss.offers <- offer{id: msg.ID, body: msg.Body}:
+			default: // drop the offer if nobody is reading
+			}
+		case sharedSignalTypeAnswer:
+			ss.answerMutex.Lock()
+			pending, ok := ss.answers[msg.ID]
+			ss.answerMutex.Unlock()
+			if ok {
+				select {
+				case pending.answer <- msg.Body:
+				default: // duplicate answer
+				}
+			}
+		}
+	}
+}
@@ -1,11 +1,7 @@
 package transportc
 
 import (
-	"crypto/rand"
 	"errors"
-	"math"
-	"math/big"
-	mrand "math/rand"
 	"sync"
 	"time"
 )
@@ -50,6 +46,93 @@ type Signal interface {
 	ReadAnswer(offerID uint64) ([]byte, error)
 }
 
+// OfferExpirySignal is implemented by Signals attaching an expiry to each
+// offer, e.g., the TTL of the offer on the broker. The Listener discards the
+// offers read after their expiry, and caps the time spent accepting an offer
+// by its expiry, so stale offers pulled from queues aren't negotiated.
+type OfferExpirySignal interface {
+	Signal
+
+	// OfferExpiry returns the expiry of the offer of offerID returned by
+	// ReadOffer, or the zero time if unknown. It is called once per offer,
+	// right after ReadOffer.
+	OfferExpiry(offerID uint64) time.Time
+}
+
+// signalOfferExpiry returns the expiry of the offer of offerID if signal is an
+// OfferExpirySignal, or the zero time otherwise.
+func signalOfferExpiry(signal Signal, offerID uint64) time.Time {
+	if es, ok := signal.(OfferExpirySignal); ok {
+		return es.OfferExpiry(offerID)
+	}
+	return time.Time{}
+}
+
+// envelopeSignal is implemented by Signals passing offers and answers between
+// peers in the same process as is, without serialization.
+type envelopeSignal interface {
+	offerEnvelope(offer signalMessage) (offerID uint64, err error)
+	readOfferEnvelope() (offerID uint64, offer signalMessage, err error)
+	answerEnvelope(offerID uint64, answer signalMessage) error
+	readAnswerEnvelope(offerID uint64) (signalMessage, error)
+}
+
+// signalOffer submits offer via signal, serializing it unless signal is an
+// envelopeSignal.
+func signalOffer(signal Signal, offer signalMessage) (uint64, error) {
+	if es, ok := signal.(envelopeSignal); ok {
+		return es.offerEnvelope(offer)
+	}
+
+	offerBytes, err := offer.bytes()
+	if err != nil {
+		return 0, err
+	}
+	return signal.Offer(offerBytes)
+}
+
+// readSignalOffer reads the next offer via signal.
+func readSignalOffer(signal Signal) (offerID uint64, offer signalMessage, err error) {
+	if es, ok := signal.(envelopeSignal); ok {
+		offerID, offer, err = es.readOfferEnvelope()
+	} else {
+		var offerBytes []byte
+		offerID, offerBytes, err = signal.ReadOffer()
+		offer = signalMessage{raw: offerBytes}
+	}
+	if err == nil && chaosDropSignal() {
+		return 0, signalMessage{}, ErrOfferNotReady
+	}
+	return offerID, offer, err
+}
+
+// answerSignal submits answer via signal, serializing it unless signal is an
+// envelopeSignal.
+func answerSignal(signal Signal, offerID uint64, answer signalMessage) error {
+	if chaosDropSignal() {
+		return nil
+	}
+	if es, ok := signal.(envelopeSignal); ok {
+		return es.answerEnvelope(offerID, answer)
+	}
+
+	answerBytes, err := answer.bytes()
+	if err != nil {
+		return err
+	}
+	return signal.Answer(offerID, answerBytes)
+}
+
+// readSignalAnswer reads the answer associated with the offerID via signal.
+func readSignalAnswer(signal Signal, offerID uint64) (signalMessage, error) {
+	if es, ok := signal.(envelopeSignal); ok {
+		return es.readAnswerEnvelope(offerID)
+	}
+
+	answerBytes, err := signal.ReadAnswer(offerID)
+	return signalMessage{raw: answerBytes}, err
+}
+
 // DebugSignal implements a minimalistic signaling method used for debugging purposes.
 type DebugSignal struct {
 	offers      chan offer
@@ -73,14 +156,7 @@ func NewDebugSignal(bufferSize int) *DebugSignal {
 // Offer implements Signal.Offer.
 // It writes the SDP offer to offers channel.
 func (ds *DebugSignal) Offer(offerBody []byte) (uint64, error) {
-	var id uint64
-	n := new(big.Int)
-	randID, err := rand.Int(rand.Reader, n.SetUint64(math.MaxUint64))
-	if err != nil { // fallback to math/rand if crypto/rand fails
-		id = mrand.Uint64() // skipcq: GSC-G404
-	} else {
-		id = randID.Uint64()
-	}
+	id := randomUint64()
 
 	ds.offers <- offer{
 		id:   id,
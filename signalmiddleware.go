@@ -0,0 +1,337 @@
+package transportc
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gaukas/logging"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var (
+	// ErrInvalidSignalKey is returned by EncryptSignal when the key is not
+	// chacha20poly1305.KeySize bytes long.
+	ErrInvalidSignalKey = errors.New("invalid signal encryption key")
+)
+
+// SignalMiddleware wraps a Signal to add a cross-cutting behavior, such as
+// logging or retrying, independent of the signaling backend.
+type SignalMiddleware func(Signal) Signal
+
+// ChainSignal wraps signal with middlewares. The first middleware is the
+// outermost, i.e., it is called first by the Dialer or Listener.
+func ChainSignal(signal Signal, middlewares ...SignalMiddleware) Signal {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		signal = middlewares[i](signal)
+	}
+	return signal
+}
+
+// isSignalNotReady returns true if err is an expected error of a polling Signal.
+func isSignalNotReady(err error) bool {
+	return errors.Is(err, ErrOfferNotReady) || errors.Is(err, ErrAnswerNotReady)
+}
+
+// LoggingSignal logs every call to the Signal at debug level, and every
+// failure at warning level.
+func LoggingSignal(logger logging.Logger) SignalMiddleware {
+	return func(next Signal) Signal {
+		return &loggingSignal{next: next, logger: logger}
+	}
+}
+
+type loggingSignal struct {
+	next   Signal
+	logger logging.Logger
+}
+
+func (s *loggingSignal) Offer(offer []byte) (uint64, error) {
+	offerID, err := s.next.Offer(offer)
+	if err != nil {
+		s.logger.Warnf("signal: Offer of %d bytes failed: %v", len(offer), err)
+	} else {
+		s.logger.Debugf("signal: Offer #%d of %d bytes", offerID, len(offer))
+	}
+	return offerID, err
+}
+
+func (s *loggingSignal) ReadOffer() (uint64, []byte, error) {
+	offerID, offer, err := s.next.ReadOffer()
+	if err != nil {
+		if !isSignalNotReady(err) {
+			s.logger.Warnf("signal: ReadOffer failed: %v", err)
+		}
+	} else {
+		s.logger.Debugf("signal: ReadOffer #%d of %d bytes", offerID, len(offer))
+	}
+	return offerID, offer, err
+}
+
+func (s *loggingSignal) OfferExpiry(offerID uint64) time.Time {
+	return signalOfferExpiry(s.next, offerID)
+}
+
+func (s *loggingSignal) Answer(offerID uint64, answer []byte) error {
+	err := s.next.Answer(offerID, answer)
+	if err != nil {
+		s.logger.Warnf("signal: Answer #%d of %d bytes failed: %v", offerID, len(answer), err)
+	} else {
+		s.logger.Debugf("signal: Answer #%d of %d bytes", offerID, len(answer))
+	}
+	return err
+}
+
+func (s *loggingSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	answer, err := s.next.ReadAnswer(offerID)
+	if err != nil {
+		if !isSignalNotReady(err) {
+			s.logger.Warnf("signal: ReadAnswer #%d failed: %v", offerID, err)
+		}
+	} else {
+		s.logger.Debugf("signal: ReadAnswer #%d of %d bytes", offerID, len(answer))
+	}
+	return answer, err
+}
+
+// RetrySignal retries a failed Offer, Answer or ReadAnswer up to attempts
+// times in total, doubling the wait between attempts starting from backoff.
+//
+// ReadOffer is never retried, as the Listener polls it anyway. Neither are
+// ErrOfferNotReady, ErrAnswerNotReady and ErrInvalidOfferID, which retrying
+// can't fix.
+func RetrySignal(attempts int, backoff time.Duration) SignalMiddleware {
+	return func(next Signal) Signal {
+		return &retrySignal{next: next, attempts: attempts, backoff: backoff}
+	}
+}
+
+type retrySignal struct {
+	next     Signal
+	attempts int
+	backoff  time.Duration
+}
+
+func (s *retrySignal) retry(f func() error) error {
+	wait := s.backoff
+	for i := 1; ; i++ {
+		err := f()
+		if err == nil || i >= s.attempts || isSignalNotReady(err) || errors.Is(err, ErrInvalidOfferID) {
+			return err
+		}
+		clockSleep(wait)
+		wait *= 2
+	}
+}
+
+func (s *retrySignal) Offer(offer []byte) (offerID uint64, err error) {
+	err = s.retry(func() error {
+		offerID, err = s.next.Offer(offer)
+		return err
+	})
+	return offerID, err
+}
+
+func (s *retrySignal) ReadOffer() (uint64, []byte, error) {
+	return s.next.ReadOffer()
+}
+
+func (s *retrySignal) OfferExpiry(offerID uint64) time.Time {
+	return signalOfferExpiry(s.next, offerID)
+}
+
+func (s *retrySignal) Answer(offerID uint64, answer []byte) error {
+	return s.retry(func() error {
+		return s.next.Answer(offerID, answer)
+	})
+}
+
+func (s *retrySignal) ReadAnswer(offerID uint64) (answer []byte, err error) {
+	err = s.retry(func() error {
+		answer, err = s.next.ReadAnswer(offerID)
+		return err
+	})
+	return answer, err
+}
+
+// RateLimitSignal limits the offers sent by Offer and read by ReadOffer to
+// one per interval on average, allowing bursts of up to burst offers.
+//
+// Offer blocks until it is allowed to proceed. ReadOffer returns
+// ErrOfferNotReady instead, leaving the offers queued in the Signal.
+func RateLimitSignal(interval time.Duration, burst int) SignalMiddleware {
+	return func(next Signal) Signal {
+		return &rateLimitSignal{
+			next:     next,
+			interval: interval,
+			burst:    burst,
+			tokens:   float64(burst),
+			last:     currentClock().Now(),
+		}
+	}
+}
+
+type rateLimitSignal struct {
+	next     Signal
+	interval time.Duration
+	burst    int
+
+	mutex  sync.Mutex // protects tokens and last
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token if available. Otherwise, it returns the time until the
+// next token is available.
+func (s *rateLimitSignal) take() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := currentClock().Now()
+	s.tokens += float64(now.Sub(s.last)) / float64(s.interval)
+	if s.tokens > float64(s.burst) {
+		s.tokens = float64(s.burst)
+	}
+	s.last = now
+
+	if s.tokens >= 1 {
+		s.tokens--
+		return 0
+	}
+	return time.Duration((1 - s.tokens) * float64(s.interval))
+}
+
+// refund returns a token taken.
+func (s *rateLimitSignal) refund() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens++
+}
+
+func (s *rateLimitSignal) Offer(offer []byte) (uint64, error) {
+	for wait := s.take(); wait > 0; wait = s.take() {
+		clockSleep(wait)
+	}
+	return s.next.Offer(offer)
+}
+
+func (s *rateLimitSignal) ReadOffer() (uint64, []byte, error) {
+	if wait := s.take(); wait > 0 {
+		return 0, nil, ErrOfferNotReady
+	}
+	offerID, offer, err := s.next.ReadOffer()
+	if err != nil {
+		s.refund() // no offer read
+	}
+	return offerID, offer, err
+}
+
+func (s *rateLimitSignal) OfferExpiry(offerID uint64) time.Time {
+	return signalOfferExpiry(s.next, offerID)
+}
+
+func (s *rateLimitSignal) Answer(offerID uint64, answer []byte) error {
+	return s.next.Answer(offerID, answer)
+}
+
+func (s *rateLimitSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	return s.next.ReadAnswer(offerID)
+}
+
+// EncryptSignal encrypts and authenticates the offers and answers with
+// XChaCha20-Poly1305 under a pre-shared key, so the signaling backend can
+// neither read nor tamper with them. Each answer is bound to its offerID.
+//
+// The key MUST be chacha20poly1305.KeySize bytes long and shared by both
+// peers. Messages failing to decrypt are rejected with an error wrapping
+// ErrMalformedSignal.
+func EncryptSignal(key []byte) (SignalMiddleware, error) {
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, ErrInvalidSignalKey
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next Signal) Signal {
+		return &encryptedSignal{next: next, aead: aead}
+	}, nil
+}
+
+type encryptedSignal struct {
+	next Signal
+	aead cipher.AEAD
+}
+
+var encryptedSignalOfferAD = []byte("offer")
+
+// encryptedSignalAnswerAD binds an answer to offerID.
+func encryptedSignalAnswerAD(offerID uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte("answer"), offerID)
+}
+
+func (s *encryptedSignal) seal(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(plaintext)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func (s *encryptedSignal) open(ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < s.aead.NonceSize()+s.aead.Overhead() {
+		return nil, fmt.Errorf("%w: encrypted message too short", ErrMalformedSignal)
+	}
+	nonce, ciphertext := ciphertext[:s.aead.NonceSize()], ciphertext[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedSignal, err)
+	}
+	return plaintext, nil
+}
+
+func (s *encryptedSignal) Offer(offer []byte) (uint64, error) {
+	sealed, err := s.seal(offer, encryptedSignalOfferAD)
+	if err != nil {
+		return 0, err
+	}
+	return s.next.Offer(sealed)
+}
+
+func (s *encryptedSignal) ReadOffer() (uint64, []byte, error) {
+	offerID, sealed, err := s.next.ReadOffer()
+	if err != nil {
+		return 0, nil, err
+	}
+	offer, err := s.open(sealed, encryptedSignalOfferAD)
+	if err != nil {
+		return 0, nil, err
+	}
+	return offerID, offer, nil
+}
+
+func (s *encryptedSignal) OfferExpiry(offerID uint64) time.Time {
+	return signalOfferExpiry(s.next, offerID)
+}
+
+func (s *encryptedSignal) Answer(offerID uint64, answer []byte) error {
+	sealed, err := s.seal(answer, encryptedSignalAnswerAD(offerID))
+	if err != nil {
+		return err
+	}
+	return s.next.Answer(offerID, sealed)
+}
+
+func (s *encryptedSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	sealed, err := s.next.ReadAnswer(offerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(sealed, encryptedSignalAnswerAD(offerID))
+}
@@ -0,0 +1,152 @@
+package transportc
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// spliceBufferPool pools the buffers of Splice, each large enough for a
+// message of a Conn so messages are copied whole.
+var spliceBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, CONN_DEFAULT_MTU)
+		return &buf
+	},
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// SpliceStats counts the bytes copied by Splice in each direction. It may be
+// read while Splice is running, e.g., to export metrics.
+type SpliceStats struct {
+	AToB atomic.Uint64 // bytes read from a and written to b
+	BToA atomic.Uint64 // bytes read from b and written to a
+}
+
+// SpliceOption configures Splice.
+type SpliceOption func(*spliceOptions)
+
+type spliceOptions struct {
+	stats       *SpliceStats
+	idleTimeout time.Duration
+}
+
+// WithSpliceStats counts the bytes copied into stats.
+func WithSpliceStats(stats *SpliceStats) SpliceOption {
+	return func(o *spliceOptions) {
+		o.stats = stats
+	}
+}
+
+// WithSpliceIdleTimeout closes both net.Conns once nothing is copied in
+// either direction for timeout.
+func WithSpliceIdleTimeout(timeout time.Duration) SpliceOption {
+	return func(o *spliceOptions) {
+		o.idleTimeout = timeout
+	}
+}
+
+// Splice copies between a and b in both directions until both are done, then
+// closes both. Each Read is written by a single Write, so the messages of a
+// Conn are relayed whole.
+//
+// Once a direction reads io.EOF, the half-close is propagated with
+// CloseWrite if both net.Conns support it, e.g., *net.TCPConn, and the other
+// direction goes on. Otherwise, e.g., for a Conn whose DataChannel cannot be
+// half-closed, both directions end. Any other error ends both directions,
+// and the first one is returned.
+func Splice(a, b net.Conn, opts ...SpliceOption) error {
+	options := &spliceOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	var aToB, bToA *atomic.Uint64
+	if options.stats != nil {
+		aToB, bToA = &options.stats.AToB, &options.stats.BToA
+	}
+
+	var closing atomic.Bool // errors are expected once closing
+	var closeOnce sync.Once
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			closing.Store(true)
+			a.Close()
+			b.Close()
+		})
+	}
+	defer closeBoth()
+
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+	if options.idleTimeout > 0 {
+		var idleTimer *time.Timer
+		idleTimer = time.AfterFunc(options.idleTimeout, func() {
+			idle := time.Since(time.Unix(0, lastActive.Load()))
+			if idle >= options.idleTimeout {
+				closeBoth()
+				return
+			}
+			idleTimer.Reset(options.idleTimeout - idle)
+		})
+		defer idleTimer.Stop()
+	}
+
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- spliceCopy(b, a, aToB, &lastActive)
+	}()
+	go func() {
+		errChan <- spliceCopy(a, b, bToA, &lastActive)
+	}()
+
+	var firstErr error
+	for i := 0; i < 2; i++ {
+		err := <-errChan
+		if err == nil {
+			continue // half-closed
+		}
+		if err != io.EOF && firstErr == nil && !closing.Load() {
+			firstErr = err
+		}
+		closeBoth() // unblocks the other direction
+	}
+	return firstErr
+}
+
+// spliceCopy copies from src to dst until src reads io.EOF, then
+// half-closes dst and returns nil if both support it, or returns io.EOF
+// otherwise.
+func spliceCopy(dst, src net.Conn, counter *atomic.Uint64, lastActive *atomic.Int64) error {
+	bufPtr := spliceBufferPool.Get().(*[]byte)
+	defer spliceBufferPool.Put(bufPtr)
+	buf := *bufPtr
+
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if counter != nil {
+				counter.Add(uint64(n))
+			}
+			lastActive.Store(time.Now().UnixNano())
+		}
+		if err == io.EOF {
+			dstCW, dstOK := dst.(closeWriter)
+			_, srcOK := src.(closeWriter)
+			if !dstOK || !srcOK {
+				return io.EOF
+			}
+			return dstCW.CloseWrite()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Package sshtunnel runs SSH (golang.org/x/crypto/ssh) clients and servers
+// over Conns, e.g., for remote administration of hosts behind NATs.
+//
+// Both peers send keepalives at an interval shorter than the idle timeout of
+// transportc.Conn, so an idle SSH connection is kept open and a dead peer is
+// detected without waiting for SCTP to give up retransmitting.
+package sshtunnel
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	KEEPALIVE_INTERVAL_DEFAULT  = 5 * time.Second // half of transportc.DEFAULT_ACCEPT_TIMEOUT
+	KEEPALIVE_COUNT_MAX_DEFAULT = 3
+
+	// KEEPALIVE_REQUEST is the global request sent as keepalive, as OpenSSH does.
+	// Peers reply with a failure to unknown requests, which is sufficient.
+	KEEPALIVE_REQUEST = "keepalive@openssh.com"
+)
+
+// Config is the configuration for SSH over Conns.
+type Config struct {
+	// KeepaliveInterval is the interval between keepalives. It SHOULD be shorter
+	// than transportc.Config.Timeout of both peers.
+	// If 0, KEEPALIVE_INTERVAL_DEFAULT is used. If negative, no keepalive is sent.
+	KeepaliveInterval time.Duration
+
+	// KeepaliveCountMax is the number of consecutive keepalives without reply
+	// before the SSH connection is closed.
+	// If 0, KEEPALIVE_COUNT_MAX_DEFAULT is used.
+	KeepaliveCountMax int
+
+	// Clock drives the keepalives, e.g., a transportc.FakeClock in tests.
+	// If nil, transportc.SystemClock is used.
+	Clock transportc.Clock
+}
+
+// Dial dials a Conn with the Dialer and runs an SSH client over it.
+func (c *Config) Dial(ctx context.Context, d *transportc.Dialer, label string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := d.DialContext(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := c.Client(ctx, conn, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// Client runs an SSH client over conn.
+//
+// If ctx has a deadline, it is applied to conn during the handshake.
+func (c *Config) Client(ctx context.Context, conn net.Conn, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	var sshConn ssh.Conn
+	var chans <-chan ssh.NewChannel
+	var reqs <-chan *ssh.Request
+	err := handshake(ctx, conn, func(stream net.Conn) (err error) {
+		sshConn, chans, reqs, err = ssh.NewClientConn(stream, conn.RemoteAddr().String(), clientConfig)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go c.keepalive(sshConn)
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// Server runs an SSH server over conn. As with ssh.NewServerConn, the
+// requests and channels returned MUST be serviced.
+//
+// If ctx has a deadline, it is applied to conn during the handshake.
+func (c *Config) Server(ctx context.Context, conn net.Conn, serverConfig *ssh.ServerConfig) (*ssh.ServerConn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+	var sshConn *ssh.ServerConn
+	var chans <-chan ssh.NewChannel
+	var reqs <-chan *ssh.Request
+	err := handshake(ctx, conn, func(stream net.Conn) (err error) {
+		sshConn, chans, reqs, err = ssh.NewServerConn(stream, serverConfig)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	go c.keepalive(sshConn)
+	return sshConn, chans, reqs, nil
+}
+
+// handshake runs fn over conn with stream semantics, bounded by ctx.
+func handshake(ctx context.Context, conn net.Conn, fn func(stream net.Conn) error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	// SSH packets may be split over messages
+	if err := fn(transportc.NewStreamConn(conn)); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	return nil
+}
+
+// keepalive sends keepalives over sshConn until it is closed, and closes it if
+// KeepaliveCountMax consecutive keepalives are not replied.
+func (c *Config) keepalive(sshConn ssh.Conn) {
+	interval := c.KeepaliveInterval
+	if interval == 0 {
+		interval = KEEPALIVE_INTERVAL_DEFAULT
+	} else if interval < 0 {
+		return
+	}
+
+	countMax := c.KeepaliveCountMax
+	if countMax == 0 {
+		countMax = KEEPALIVE_COUNT_MAX_DEFAULT
+	}
+
+	clock := c.Clock
+	if clock == nil {
+		clock = transportc.SystemClock
+	}
+
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for range ticker.C() {
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := sshConn.SendRequest(KEEPALIVE_REQUEST, true, nil)
+			replied <- err
+		}()
+
+		timeout := clock.NewTimer(interval)
+		select {
+		case err := <-replied:
+			timeout.Stop()
+			if err != nil {
+				return // closed
+			}
+			missed = 0
+		case <-timeout.C():
+			missed++
+			if missed >= countMax {
+				sshConn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package transportc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// STANDBY_TTL_DEFAULT is how long a standby offer is published before
+	// being replaced by a fresh one, see Config.ListenerStandbyTTL.
+	STANDBY_TTL_DEFAULT = 5 * time.Minute
+
+	STANDBY_POLL_INTERVAL  = 100 * time.Millisecond // of the answer to a standby offer
+	STANDBY_RETRY_INTERVAL = time.Second            // after failing to publish a standby offer
+)
+
+var (
+	// ErrStandbyWithoutSignal is returned by Config.NewListener if
+	// ListenerStandbyOffers is set without ListenerStandbySignal, and by
+	// Dialer.DialStandby if no Signal is configured.
+	ErrStandbyWithoutSignal = errors.New("standby offers require a Signal")
+)
+
+// startStandby starts publishing Config.ListenerStandbyOffers standby offers.
+func (l *Listener) startStandby() {
+	if l.timeout == 0 {
+		l.timeout = DEFAULT_ACCEPT_TIMEOUT
+	}
+	for i := 0; i < l.standbyOffers; i++ {
+		go l.standbyLoop()
+	}
+}
+
+// standbyLoop keeps a standby offer published on the standby Signal, replaced
+// once answered or expired, until the Listener is STOPPED.
+func (l *Listener) standbyLoop() {
+	for atomic.LoadUint32(&l.runningStatus) != LISTENER_STOPPED {
+		// Only publish if RUNNING, and not overloaded as acceptLoop
+		if atomic.LoadUint32(&l.runningStatus) != LISTENER_RUNNING || l.overloaded() {
+			time.Sleep(LISTENER_BACKPRESSURE_INTERVAL)
+			continue
+		}
+		if err := l.standbyOffer(); err != nil {
+			l.logger.Warnf("listener: %v", err)
+			time.Sleep(STANDBY_RETRY_INTERVAL)
+		}
+	}
+}
+
+// standbyOffer publishes the offer of a new PeerConnection on the standby
+// Signal, then serves the PeerConnection as an answered one once its answer is
+// read, see servePeerConnection. The PeerConnection is closed if not answered
+// within the standby TTL, or once the Listener is STOPPED.
+func (l *Listener) standbyOffer() (err error) {
+	l.configMutex.Lock()
+	settingEngine := l.settingEngine
+	configuration := l.icePairPolicy.configure(l.configuration)
+	l.configMutex.Unlock()
+
+	turn := withTURNTracker(&settingEngine, l.stats)
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(settingEngine))
+	peerConnection, err := api.NewPeerConnection(configuration)
+	if err != nil {
+		return fmt.Errorf("listener: failed to create standby PeerConnection: %w", err)
+	}
+	var transcript *transcriptRecorder
+	if l.recordTranscript {
+		transcript = newTranscriptRecorder(peerConnection)
+	}
+	served := false
+	defer func() {
+		if !served {
+			peerConnection.Close()
+		}
+	}()
+
+	// Without a DataChannel, the offer would lack the SCTP media section
+	if err := createPregatherDataChannel(peerConnection); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.standbyTTL)
+	defer cancel()
+	handshake := &handshakeTimer{}
+	offer, err := l.gatherStandbyOffer(ctx, peerConnection, handshake)
+	if err != nil {
+		return err
+	}
+	envelope := newSDPEnvelope(offer, "")
+	signSessionDescription(envelope, l.identityKey, l.standbyTTL)
+	offerID, err := signalOffer(l.standbySignal, signalMessage{envelope: envelope})
+	if err != nil {
+		return fmt.Errorf("listener: failed to signal standby offer: %w", err)
+	}
+	handshake.markOfferSent()
+	transcript.setOffer(offer)
+
+	message, err := readSignalAnswer(l.standbySignal, offerID)
+	for err == ErrAnswerNotReady && ctx.Err() == nil && atomic.LoadUint32(&l.runningStatus) != LISTENER_STOPPED {
+		time.Sleep(STANDBY_POLL_INTERVAL)
+		message, err = readSignalAnswer(l.standbySignal, offerID)
+	}
+	if err == ErrAnswerNotReady {
+		return nil // expired or stopped, replaced by a fresh offer if still RUNNING
+	} else if err != nil {
+		return fmt.Errorf("listener: failed to read answer to standby offer #%d: %w", offerID, err)
+	}
+	start := time.Now()
+	handshake.markAnswerReceived()
+	l.events.emit(TransportEvent{Type: EVENT_OFFER_RECEIVED, OfferID: offerID})
+
+	envelope, remoteIdentity, err := message.open(webrtc.SDPTypeAnswer, l.allowedPeers)
+	if err != nil {
+		return l.acceptFailed(offerID, 0, ACCEPT_STAGE_OFFER, err)
+	}
+	answer := envelope.SessionDescription
+	if l.sdpTransformIn != nil {
+		if answer, err = l.sdpTransformIn(answer); err != nil {
+			return l.acceptFailed(offerID, 0, ACCEPT_STAGE_OFFER, err)
+		}
+	}
+	if err := validateAnswer(peerConnection.LocalDescription(), &answer, nil); err != nil {
+		return l.acceptFailed(offerID, 0, ACCEPT_STAGE_NEGOTIATION, err)
+	}
+
+	_, acceptSpan := startSpan(context.Background(), l.tracer, SPAN_ACCEPT, TraceAttribute{Key: "transportc.offer_id", Value: offerID})
+	var settled atomic.Bool
+	peer := newListenerPeer(peerConnection, nil, nil) // not restartable, as the Dialer does not own the offer
+	id := l.servePeerConnection(peerConnection, peer, turn, handshake, transcript, &pendingAccept{
+		offerID:  offerID,
+		start:    start,
+		span:     acceptSpan,
+		settled:  &settled,
+		identity: remoteIdentity,
+	})
+	served = true
+
+	if err := peerConnection.SetRemoteDescription(answer); err != nil {
+		err = fmt.Errorf("listener: failed to set remote description: %w", err)
+		acceptSpan.End(err)
+		l.peers.removeIf(id, peer)
+		peerConnection.Close()
+		if settled.CompareAndSwap(false, true) {
+			return l.acceptFailed(offerID, id, ACCEPT_STAGE_NEGOTIATION, err)
+		}
+		return err
+	}
+	handshake.markICEStarted()
+	transcript.setAnswer(&answer)
+	return nil
+}
+
+// gatherStandbyOffer creates a local offer on peerConnection and waits for
+// the ICE gathering to complete. It returns the offer to be signaled.
+func (l *Listener) gatherStandbyOffer(ctx context.Context, peerConnection *webrtc.PeerConnection, handshake *handshakeTimer) (_ *webrtc.SessionDescription, err error) {
+	_, span := startSpan(ctx, l.tracer, SPAN_ICE_GATHER)
+	defer func() {
+		span.End(err)
+	}()
+
+	localDescription, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("listener: failed to create standby offer: %w", err)
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(localDescription); err != nil {
+		return nil, fmt.Errorf("listener: failed to set local description: %w", err)
+	}
+
+	err = waitForGathering(ctx, gatherComplete, l.gatherTimeout)
+	if err == ErrGatherTimeout {
+		l.logger.Warnf("listener: ICE gathering incomplete after %v, proceeding with partial candidates", l.gatherTimeout)
+	} else if err != nil {
+		return nil, fmt.Errorf("listener: context done before ICE gathering complete: %w", err)
+	}
+	return l.outgoingDescription(peerConnection.LocalDescription(), "standby offer")
+}
+
+// DialStandby dials a Conn over a PeerConnection offered in standby by a
+// Listener, see Config.ListenerStandbyOffers, read from the Signal of the
+// Dialer, e.g., an offer-pool style broker. Having gathered its candidates
+// beforehand, the Listener only waits for the answer, so the Conn is open
+// after one signaling exchange and the DTLS handshake.
+//
+// Expired offers are skipped. The PeerConnection is dedicated to the Conn and
+// closed along with it. Config.ReusePeerConnection does not apply.
+func (d *Dialer) DialStandby(ctx context.Context, label string, opts ...DialOption) (conn net.Conn, err error) {
+	if d.signal == nil {
+		return nil, ErrStandbyWithoutSignal
+	}
+
+	ctx, span := startSpan(ctx, d.tracer, SPAN_DIAL, TraceAttribute{Key: "transportc.label", Value: label})
+	defer func() {
+		span.End(err)
+	}()
+
+	// The PeerHandle owns the PeerConnection until closed with the Conn
+	handle := &PeerHandle{dialer: d}
+	p := &handle.peer
+	p.dedicated = true
+	if err := d.answerStandby(ctx, p); err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	conn, err = d.dialPeer(ctx, p, label, nil, opts)
+	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+	go closeAfter(conn, handle.Close)
+	return conn, nil
+}
+
+// answerStandby reads the next standby offer not expired via the Signal,
+// answers it with a new PeerConnection set to p, and waits until connected.
+func (d *Dialer) answerStandby(ctx context.Context, p *dialerPeer) error {
+	var offerID uint64
+	var envelope *sdpEnvelope
+	for {
+		id, message, err := readSignalOffer(d.signal)
+		if err == ErrOfferNotReady {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("dialer: context done before standby offer received: %w", ctx.Err())
+			case <-time.After(DIAL_PEER_POLL_INTERVAL):
+			}
+			continue
+		} else if err != nil {
+			return fmt.Errorf("dialer: failed to read standby offer: %w", err)
+		}
+
+		if expiry := signalOfferExpiry(d.signal, id); !expiry.IsZero() && time.Now().After(expiry) {
+			d.logger.Debugf("dialer: discarding standby offer #%d expired at %v", id, expiry)
+			continue
+		}
+		e, remoteIdentity, err := message.open(webrtc.SDPTypeOffer, d.allowedPeers)
+		if err != nil {
+			d.logger.Debugf("dialer: discarding standby offer #%d: %v", id, err)
+			continue
+		}
+		if err := verifyOfferExpiry(e, SIGNED_OFFER_CLOCK_SKEW_DEFAULT, false); err != nil {
+			d.logger.Debugf("dialer: discarding standby offer #%d: %v", id, err)
+			continue
+		}
+		offerID, envelope, p.peerIdentity = id, e, remoteIdentity
+		break
+	}
+
+	offer := envelope.SessionDescription
+	if d.sdpTransformIn != nil {
+		var err error
+		if offer, err = d.sdpTransformIn(offer); err != nil {
+			return fmt.Errorf("dialer: failed to transform standby offer: %w", err)
+		}
+	}
+
+	peerConnection, handshake, err := d.newPeerConnection()
+	if err != nil {
+		return err
+	}
+	p.mutex.Lock()
+	p.peerConnection, p.handshake, p.offerID = peerConnection, handshake, offerID
+	p.mutex.Unlock()
+
+	answer, err := d.gatherStandbyAnswer(ctx, peerConnection, offer)
+	if err != nil {
+		return err
+	}
+	answerEnvelope := newSDPEnvelope(answer, "")
+	signSessionDescription(answerEnvelope, d.identityKey, 0)
+	if err := answerSignal(d.signal, offerID, signalMessage{envelope: answerEnvelope}); err != nil {
+		return fmt.Errorf("dialer: failed to signal answer to standby offer: %w", err)
+	}
+	transcript := d.transcript(peerConnection)
+	transcript.setOffer(&offer)
+	transcript.setAnswer(answer)
+
+	ticker := time.NewTicker(DIAL_PEER_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		switch peerConnection.ConnectionState() {
+		case webrtc.PeerConnectionStateConnected:
+			return nil
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			return errors.New("dialer: PeerConnection failed to connect")
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("dialer: context done before PeerConnection connected: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// gatherStandbyAnswer sets offer as the remote description of
+// peerConnection, then creates a local answer and waits for the ICE
+// gathering to complete. It returns the answer to be signaled.
+func (d *Dialer) gatherStandbyAnswer(ctx context.Context, peerConnection *webrtc.PeerConnection, offer webrtc.SessionDescription) (_ *webrtc.SessionDescription, err error) {
+	_, span := startSpan(ctx, d.tracer, SPAN_ICE_GATHER)
+	defer func() {
+		span.End(err)
+	}()
+
+	if err := peerConnection.SetRemoteDescription(offer); err != nil {
+		return nil, fmt.Errorf("dialer: failed to set remote description: %w", err)
+	}
+	localDescription, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("dialer: failed to create local answer: %w", err)
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(localDescription); err != nil {
+		return nil, fmt.Errorf("dialer: failed to set local description: %w", err)
+	}
+
+	err = waitForGathering(ctx, gatherComplete, d.gatherTimeout)
+	if err == ErrGatherTimeout {
+		d.logger.Warnf("dialer: ICE gathering incomplete after %v, proceeding with partial candidates", d.gatherTimeout)
+	} else if err != nil {
+		return nil, fmt.Errorf("dialer: context done before ICE gathering complete: %w", err)
+	}
+
+	answer := peerConnection.LocalDescription()
+	if d.sdpBandwidth != nil {
+		if answer, err = withSDPBandwidth(answer, d.sdpBandwidth); err != nil {
+			return nil, fmt.Errorf("dialer: failed to cap the bandwidth of local answer: %w", err)
+		}
+	}
+	if d.sdpTransformOut != nil {
+		transformedAnswer, err := d.sdpTransformOut(*answer)
+		if err != nil {
+			return nil, fmt.Errorf("dialer: failed to transform local answer: %w", err)
+		}
+		answer = &transformedAnswer
+	}
+	return answer, nil
+}
@@ -0,0 +1,276 @@
+package transportc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ACCEPT_LATENCY_BUCKETS are the upper bounds of the buckets of
+// ListenerStats.AcceptLatency.
+var ACCEPT_LATENCY_BUCKETS = [...]time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// Stats aggregates the statistics of Conns created by the Dialers and
+// Listeners it is configured for. Conns are grouped by their tags, with
+// untagged Conns grouped under the empty tag "".
+//
+// One Stats may be shared by multiple Dialers and Listeners.
+type Stats struct {
+	mutex sync.Mutex
+	tags  map[string]*tagCounters
+
+	listener listenerCounters
+	turn     turnCounters
+}
+
+// TagStats is a snapshot of the statistics of all Conns with the same tag.
+type TagStats struct {
+	ActiveConns  int64  // Conns currently open
+	TotalConns   uint64 // Conns ever opened
+	BytesRead    uint64
+	BytesWritten uint64
+
+	// ClosedConns counts the Conns closed by CloseReason, see
+	// Conn.CloseReason. Reasons without Conns are omitted.
+	ClosedConns map[CloseReason]uint64
+}
+
+// ListenerStats is a snapshot of the statistics of the PeerConnections
+// answered by Listeners, to monitor the health of the Signal and of the
+// STUN/TURN servers.
+type ListenerStats struct {
+	// AcceptLatency is the histogram of the time from an offer being read to
+	// its first Conn being accepted, i.e., queued for Accept or passed to a
+	// handler. Conns on reused PeerConnections are not observed.
+	AcceptLatency Histogram
+
+	PeerConnections uint64 // PeerConnections created for offers
+	ICEConnected    uint64 // PeerConnections whose ICE first connected
+	ICEFailed       uint64 // PeerConnections whose ICE failed before connecting
+}
+
+// ICEFailureRate returns the ratio of PeerConnections whose ICE failed to
+// those whose ICE either connected or failed, or 0 if none did.
+func (ls ListenerStats) ICEFailureRate() float64 {
+	if total := ls.ICEConnected + ls.ICEFailed; total > 0 {
+		return float64(ls.ICEFailed) / float64(total)
+	}
+	return 0
+}
+
+// TURNStats is a snapshot of the statistics of the TURN allocations of the
+// PeerConnections of Dialers and Listeners, to audit the allocations on paid
+// TURN servers. See Conn.TURNState for the state of each allocation.
+type TURNStats struct {
+	ActiveAllocations         int64  // allocations currently held
+	TotalAllocations          uint64 // allocations ever made
+	RefreshFailures           uint64 // refreshes of allocations failed
+	PermissionRefreshFailures uint64 // refreshes of permissions failed
+}
+
+// Histogram is a snapshot of the distribution of durations.
+type Histogram struct {
+	Buckets []HistogramBucket // cumulative, in ascending order of UpperBound
+	Count   uint64            // number of observations, including above the last bucket
+	Sum     time.Duration     // sum of observations
+}
+
+// HistogramBucket counts the observations less than or equal to UpperBound.
+type HistogramBucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+type listenerCounters struct {
+	acceptLatency   latencyHistogram
+	peerConnections atomic.Uint64
+	iceConnected    atomic.Uint64
+	iceFailed       atomic.Uint64
+}
+
+// latencyHistogram counts observations into ACCEPT_LATENCY_BUCKETS.
+type latencyHistogram struct {
+	counts [len(ACCEPT_LATENCY_BUCKETS) + 1]atomic.Uint64 // non-cumulative, the last one above all buckets
+	sum    atomic.Int64
+}
+
+type turnCounters struct {
+	activeAllocations         atomic.Int64
+	totalAllocations          atomic.Uint64
+	refreshFailures           atomic.Uint64
+	permissionRefreshFailures atomic.Uint64
+}
+
+type tagCounters struct {
+	activeConns  atomic.Int64
+	totalConns   atomic.Uint64
+	bytesRead    atomic.Uint64
+	bytesWritten atomic.Uint64
+	closedConns  [closeReasonCount]atomic.Uint64 // by CloseReason
+}
+
+// NewStats creates a new empty Stats.
+func NewStats() *Stats {
+	return &Stats{
+		tags: make(map[string]*tagCounters),
+	}
+}
+
+// Tag returns the statistics of Conns with the given tag.
+func (s *Stats) Tag(tag string) TagStats {
+	s.mutex.Lock()
+	counters, ok := s.tags[tag]
+	s.mutex.Unlock()
+	if !ok {
+		return TagStats{}
+	}
+	return counters.snapshot()
+}
+
+// Tags returns the statistics of Conns of every tag ever seen.
+func (s *Stats) Tags() map[string]TagStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tags := make(map[string]TagStats, len(s.tags))
+	for tag, counters := range s.tags {
+		tags[tag] = counters.snapshot()
+	}
+	return tags
+}
+
+// Listener returns the statistics of the PeerConnections answered by all
+// Listeners configured with the Stats.
+func (s *Stats) Listener() ListenerStats {
+	return ListenerStats{
+		AcceptLatency:   s.listener.acceptLatency.snapshot(),
+		PeerConnections: s.listener.peerConnections.Load(),
+		ICEConnected:    s.listener.iceConnected.Load(),
+		ICEFailed:       s.listener.iceFailed.Load(),
+	}
+}
+
+// TURN returns the statistics of the TURN allocations of all Dialers and
+// Listeners configured with the Stats.
+func (s *Stats) TURN() TURNStats {
+	return TURNStats{
+		ActiveAllocations:         s.turn.activeAllocations.Load(),
+		TotalAllocations:          s.turn.totalAllocations.Load(),
+		RefreshFailures:           s.turn.refreshFailures.Load(),
+		PermissionRefreshFailures: s.turn.permissionRefreshFailures.Load(),
+	}
+}
+
+// observeAccept records the latency of a Conn accepted on a new
+// PeerConnection. All observe methods are safe to call on a nil Stats.
+func (s *Stats) observeAccept(latency time.Duration) {
+	if s != nil {
+		s.listener.acceptLatency.observe(latency)
+	}
+}
+
+func (s *Stats) observePeerConnection() {
+	if s != nil {
+		s.listener.peerConnections.Add(1)
+	}
+}
+
+// observeICE records whether the ICE of a PeerConnection connected or failed.
+func (s *Stats) observeICE(connected bool) {
+	if s == nil {
+		return
+	}
+	if connected {
+		s.listener.iceConnected.Add(1)
+	} else {
+		s.listener.iceFailed.Add(1)
+	}
+}
+
+// observeTURNAllocation records a TURN allocation made or released.
+func (s *Stats) observeTURNAllocation(allocated bool) {
+	if s == nil {
+		return
+	}
+	if allocated {
+		s.turn.activeAllocations.Add(1)
+		s.turn.totalAllocations.Add(1)
+	} else {
+		s.turn.activeAllocations.Add(-1)
+	}
+}
+
+// observeTURNRefreshFailure records a failed refresh of a TURN allocation or
+// of its permissions.
+func (s *Stats) observeTURNRefreshFailure(permission bool) {
+	if s == nil {
+		return
+	}
+	if permission {
+		s.turn.permissionRefreshFailures.Add(1)
+	} else {
+		s.turn.refreshFailures.Add(1)
+	}
+}
+
+func (s *Stats) counters(tag string) *tagCounters {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	counters, ok := s.tags[tag]
+	if !ok {
+		counters = &tagCounters{}
+		s.tags[tag] = counters
+	}
+	return counters
+}
+
+func (tc *tagCounters) snapshot() TagStats {
+	ts := TagStats{
+		ActiveConns:  tc.activeConns.Load(),
+		TotalConns:   tc.totalConns.Load(),
+		BytesRead:    tc.bytesRead.Load(),
+		BytesWritten: tc.bytesWritten.Load(),
+	}
+	for reason := range tc.closedConns {
+		if closed := tc.closedConns[reason].Load(); closed > 0 {
+			if ts.ClosedConns == nil {
+				ts.ClosedConns = make(map[CloseReason]uint64)
+			}
+			ts.ClosedConns[CloseReason(reason)] = closed
+		}
+	}
+	return ts
+}
+
+func (h *latencyHistogram) observe(latency time.Duration) {
+	i := 0
+	for i < len(ACCEPT_LATENCY_BUCKETS) && latency > ACCEPT_LATENCY_BUCKETS[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(latency))
+}
+
+func (h *latencyHistogram) snapshot() Histogram {
+	histogram := Histogram{
+		Buckets: make([]HistogramBucket, len(ACCEPT_LATENCY_BUCKETS)),
+		Sum:     time.Duration(h.sum.Load()),
+	}
+	for i, upperBound := range ACCEPT_LATENCY_BUCKETS {
+		histogram.Count += h.counts[i].Load()
+		histogram.Buckets[i] = HistogramBucket{UpperBound: upperBound, Count: histogram.Count}
+	}
+	histogram.Count += h.counts[len(ACCEPT_LATENCY_BUCKETS)].Load()
+	return histogram
+}
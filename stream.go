@@ -0,0 +1,54 @@
+package transportc
+
+import (
+	"net"
+)
+
+// NewStreamListener wraps the Listener to accept Conns with stream semantics,
+// see NewStreamConn.
+func NewStreamListener(l *Listener) net.Listener {
+	return &streamListener{l}
+}
+
+type streamListener struct {
+	*Listener
+}
+
+func (l *streamListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamConn(conn), nil
+}
+
+// NewStreamConn wraps a Conn with stream semantics: the remainder of a message
+// not fitting in the buffer passed to Read is kept for the next Read, as
+// expected by stream-oriented protocols such as HTTP, instead of failing with
+// io.ErrShortBuffer.
+func NewStreamConn(conn net.Conn) net.Conn {
+	return &streamConn{
+		Conn: conn,
+		buf:  make([]byte, CONN_DEFAULT_MTU),
+	}
+}
+
+type streamConn struct {
+	net.Conn
+	buf     []byte
+	pending []byte // remainder of the last message read
+}
+
+func (c *streamConn) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		n, err := c.Conn.Read(c.buf)
+		if err != nil {
+			return 0, err
+		}
+		c.pending = c.buf[:n]
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
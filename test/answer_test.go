@@ -0,0 +1,131 @@
+package transportc_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestDialerPinnedFingerprints(t *testing.T) {
+	certificate, err := transportc.GenerateCertificate(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := transportc.CertificateFingerprint(certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := transportc.GenerateCertificate(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFingerprint, err := transportc.CertificateFingerprint(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		pinned  []string
+		wantErr error
+	}{
+		{"pinned", []string{otherFingerprint, strings.ToLower(fingerprint)}, nil},
+		{"not pinned", []string{otherFingerprint}, transportc.ErrFingerprintNotPinned},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			signal := transportc.NewDebugSignal(8)
+			listener, err := (&transportc.Config{
+				Signal:       signal,
+				Certificates: []transportc.Certificate{*certificate},
+			}).NewListener()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			listener.Start()
+
+			dialer, err := (&transportc.Config{
+				Signal:                   signal,
+				DialerPinnedFingerprints: tc.pinned,
+			}).NewDialer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dialer.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel() // cancel the context to make sure it is done
+
+			conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+			if tc.wantErr == nil {
+				if err != nil {
+					t.Fatalf("DialContext error: %v", err)
+				}
+				conn.Close()
+			} else if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("DialContext returned %v, expected %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// Negative Test for Dialer.DialContext with answers tampered by the signaling
+func TestDialerRejectsInconsistentAnswer(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tamper func(sdp string) string
+	}{
+		{
+			name: "mid",
+			tamper: func(sdp string) string {
+				return strings.Replace(sdp, "a=mid:0", "a=mid:1", 1)
+			},
+		},
+		{
+			name: "extra media section",
+			tamper: func(sdp string) string {
+				return sdp + "m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\nc=IN IP4 0.0.0.0\r\na=mid:1\r\n"
+			},
+		},
+		{
+			name: "second fingerprint",
+			tamper: func(sdp string) string {
+				return strings.Replace(sdp, "a=mid:0\r\n", "a=mid:0\r\na=fingerprint:sha-256 00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF\r\n", 1)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			signal := transportc.NewDebugSignal(8)
+			listener, err := (&transportc.Config{Signal: signal}).NewListener()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			listener.Start()
+
+			dialer, err := (&transportc.Config{
+				Signal: signal,
+				SDPTransformIncoming: func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+					desc.SDP = tc.tamper(desc.SDP)
+					return desc, nil
+				},
+			}).NewDialer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dialer.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel() // cancel the context to make sure it is done
+
+			if _, err := dialer.DialContext(ctx, "RANDOM_LABEL"); !errors.Is(err, transportc.ErrAnswerMismatch) {
+				t.Fatalf("DialContext returned %v, expected ErrAnswerMismatch", err)
+			}
+		})
+	}
+}
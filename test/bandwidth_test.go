@@ -0,0 +1,87 @@
+package transportc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestConnEstimatedBandwidth(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	estimates := make(chan transportc.BandwidthEstimate, 16)
+	sConn.(*transportc.Conn).OnBandwidthEstimate(100*time.Millisecond, func(estimate transportc.BandwidthEstimate) {
+		select {
+		case estimates <- estimate:
+		default:
+		}
+	})
+
+	conn := cConn.(*transportc.Conn)
+	conn.EstimatedBandwidth() // reset the sampling interval
+
+	buf := make([]byte, 1024)
+	go func() {
+		for {
+			if _, err := sConn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	msg := make([]byte, 1024)
+	for i := 0; i < 256; i++ {
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	if estimate := conn.EstimatedBandwidth(); estimate.SendRate <= 0 || estimate.Interval <= 0 {
+		t.Fatalf("unexpected BandwidthEstimate of the sender: %+v", estimate)
+	}
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case estimate := <-estimates:
+			if estimate.ReceiveRate > 0 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("OnBandwidthEstimate never reported the received data")
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package transportc_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestLoadOrGenerateCertificate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cert.pem")
+
+	certificate, err := transportc.LoadOrGenerateCertificate(path)
+	if err != nil {
+		t.Fatalf("LoadOrGenerateCertificate error: %v", err)
+	}
+	if certificate.Expires().Before(time.Now().Add(transportc.CERTIFICATE_DEFAULT_VALIDITY - time.Hour)) {
+		t.Fatalf("certificate expires at %v, too early", certificate.Expires())
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Fatalf("certificate saved with permissions %o, expected 600", perm)
+		}
+	}
+
+	loaded, err := transportc.LoadOrGenerateCertificate(path)
+	if err != nil {
+		t.Fatalf("LoadOrGenerateCertificate error: %v", err)
+	}
+
+	fingerprint, err := transportc.CertificateFingerprint(certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedFingerprint, err := transportc.CertificateFingerprint(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprint != loadedFingerprint {
+		t.Fatalf("fingerprint changed from %s to %s", fingerprint, loadedFingerprint)
+	}
+	if !strings.HasPrefix(fingerprint, "sha-256 ") {
+		t.Fatalf("unexpected fingerprint %s", fingerprint)
+	}
+}
+
+func TestLoadCertificateExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cert.pem")
+
+	certificate, err := transportc.GenerateCertificate(-time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transportc.SaveCertificate(path, certificate); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := transportc.LoadCertificate(path); !errors.Is(err, webrtc.ErrCertificateExpired) {
+		t.Fatalf("LoadCertificate returned %v, expected ErrCertificateExpired", err)
+	}
+}
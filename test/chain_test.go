@@ -0,0 +1,218 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/relay"
+)
+
+var errBadToken = errors.New("bad token")
+
+// Positive Test for a Conn from A to C through B, where C is only
+// reachable by B.
+func TestChain(t *testing.T) {
+	// B dials C
+	signalBC := transportc.NewDebugSignal(8)
+	listenerC, err := (&transportc.Config{Signal: signalBC}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listenerC.Close()
+	listenerC.Start()
+
+	dialerB, err := (&transportc.Config{Signal: signalBC}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialerB.Close()
+
+	chain, err := (&relay.ChainConfig{
+		Dialers: map[string]*transportc.Dialer{"C": dialerB},
+		Authorize: func(_ net.Conn, _ string, token []byte) error {
+			if string(token) != "secret" {
+				return errBadToken
+			}
+			return nil
+		},
+	}).NewChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A dials B
+	signalAB := transportc.NewDebugSignal(8)
+	listenerB, err := (&transportc.Config{Signal: signalAB}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listenerB.Close()
+	listenerB.Handle(relay.CHAIN_PROTOCOL, chain.Handle)
+	listenerB.Start()
+
+	dialerA, err := (&transportc.Config{Signal: signalAB}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialerA.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	if _, err := relay.DialChain(ctx, dialerA, "", "", relay.Hop{Target: "C", Token: []byte("guess")}); !errors.Is(err, relay.ErrChainRefused) {
+		t.Fatalf("DialChain with a bad token returned %v, expected ErrChainRefused", err)
+	}
+	if _, err := relay.DialChain(ctx, dialerA, "", "", relay.Hop{Target: "D", Token: []byte("secret")}); !errors.Is(err, relay.ErrChainRefused) {
+		t.Fatalf("DialChain to an unknown target returned %v, expected ErrChainRefused", err)
+	}
+
+	cConn, err := relay.DialChain(ctx, dialerA, "RANDOM_LABEL", "", relay.Hop{Target: "C", Token: []byte("secret")})
+	if err != nil {
+		t.Fatalf("DialChain error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listenerC.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+	if label := sConn.(*transportc.Conn).Label(); label != "RANDOM_LABEL" {
+		t.Fatalf("Conn accepted by C has label %q, expected RANDOM_LABEL", label)
+	}
+
+	// messages are spliced whole, both ways
+	msg := bytes.Repeat([]byte("chain"), 4096)
+	if _, err := cConn.Write(msg); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	n, err := sConn.Read(buf)
+	if err != nil || !bytes.Equal(buf[:n], msg) {
+		t.Fatalf("Read %d bytes, %v, expected the %d bytes written", n, err, len(msg))
+	}
+	if _, err := sConn.Write([]byte("reply")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	n, err = cConn.Read(buf)
+	if err != nil || string(buf[:n]) != "reply" {
+		t.Fatalf("Read %q, %v, expected reply", buf[:n], err)
+	}
+}
+
+// Positive Test for a Conn from A to C through B, with onion layers B
+// cannot read.
+func TestOnion(t *testing.T) {
+	publicB, privateB, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicC, privateC, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// B dials C
+	signalBC := transportc.NewDebugSignal(8)
+	listenerC, err := (&transportc.Config{Signal: signalBC, IdentityKey: privateC}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listenerC.Close()
+	listenerC.Start()
+
+	dialerB, err := (&transportc.Config{Signal: signalBC}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialerB.Close()
+
+	chain, err := (&relay.ChainConfig{
+		Dialers:     map[string]*transportc.Dialer{"C": dialerB},
+		IdentityKey: privateB,
+	}).NewChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A dials B
+	signalAB := transportc.NewDebugSignal(8)
+	listenerB, err := (&transportc.Config{Signal: signalAB, IdentityKey: privateB}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listenerB.Close()
+	listenerB.Handle(relay.CHAIN_PROTOCOL, chain.Handle)
+	listenerB.Start()
+
+	dialerA, err := (&transportc.Config{Signal: signalAB, AllowedPeers: []ed25519.PublicKey{publicB}}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialerA.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	// B checks the identity of C
+	if _, err := relay.DialOnion(ctx, dialerA, "", "", relay.Hop{Target: "C", Identity: publicB}); !errors.Is(err, relay.ErrChainRefused) {
+		t.Fatalf("DialOnion to a wrong identity returned %v, expected ErrChainRefused", err)
+	}
+	if _, err := listenerC.Accept(); err != nil { // the Conn dialed by B
+		t.Fatalf("Accept error: %v", err)
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		sConn, err := listenerC.Accept()
+		if err != nil {
+			t.Errorf("Accept error: %v", err)
+			close(accepted)
+			return
+		}
+		oConn, err := relay.AcceptOnion(sConn, privateC)
+		if err != nil {
+			t.Errorf("AcceptOnion error: %v", err)
+			sConn.Close()
+			close(accepted)
+			return
+		}
+		accepted <- oConn
+	}()
+
+	cConn, err := relay.DialOnion(ctx, dialerA, "RANDOM_LABEL", "", relay.Hop{Target: "C", Identity: publicC})
+	if err != nil {
+		t.Fatalf("DialOnion error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, ok := <-accepted
+	if !ok {
+		t.FailNow()
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	msg := bytes.Repeat([]byte("onion"), 4096)
+	if _, err := cConn.Write(msg); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	n, err := sConn.Read(buf)
+	if err != nil || !bytes.Equal(buf[:n], msg) {
+		t.Fatalf("Read %d bytes, %v, expected the %d bytes written", n, err, len(msg))
+	}
+	if _, err := sConn.Write([]byte("reply")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	n, err = cConn.Read(buf)
+	if err != nil || string(buf[:n]) != "reply" {
+		t.Fatalf("Read %q, %v, expected reply", buf[:n], err)
+	}
+}
@@ -0,0 +1,161 @@
+//go:build transportc_chaos
+
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// Positive Test for the invariants of Dialer, Listener and Conn under injected
+// faults, run with:
+//
+//	go test -race -tags transportc_chaos -run TestChaos ./test/
+func TestChaosInvariants(t *testing.T) {
+	defer transportc.EnableChaos(transportc.ChaosConfig{
+		WriteFailureRate: 0.05,
+		OpenDelayMax:     300 * time.Millisecond,
+		SignalDropRate:   0.15,
+		Seed:             time.Now().UnixNano(),
+	})()
+
+	stats := transportc.NewStats()
+	signal := transportc.NewDebugSignal(64)
+	config := &transportc.Config{
+		Signal: signal,
+		Stats:  stats,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Start()
+
+	var echoes sync.WaitGroup
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			echoes.Add(1)
+			go func() {
+				defer echoes.Done()
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					if _, err := conn.Write(buf[:n]); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	const dialers, dialsPerDialer = 8, 4
+	const dialTimeout = 3 * time.Second
+	var wg sync.WaitGroup
+	errChan := make(chan error, dialers*dialsPerDialer)
+	for i := 0; i < dialers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dialer, err := config.NewDialer()
+			if err != nil {
+				errChan <- err
+				return
+			}
+			defer dialer.Close()
+
+			for j := 0; j < dialsPerDialer; j++ {
+				if err := chaosDialEcho(dialer, fmt.Sprintf("chaos-%d-%d", i, j), dialTimeout); err != nil {
+					errChan <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errChan)
+	for err := range errChan {
+		t.Error(err)
+	}
+
+	listener.Close()
+	echoes.Wait()
+
+	// every Conn and PeerConnection is torn down
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		active := stats.Tag("").ActiveConns
+		agents := countICEAgentGoroutines()
+		if active == 0 && agents == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d Conns and %d ICE agents left after closing everything", active, agents)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	injected := transportc.ChaosInjected()
+	if injected.OpenDelays == 0 || injected.SignalDrops == 0 {
+		t.Fatalf("faults not injected: %+v", injected)
+	}
+	t.Logf("faults injected: %+v, Conns: %+v", injected, stats.Tag(""))
+}
+
+// chaosDialEcho dials label and echoes a few messages, returning an error only
+// if an invariant is broken: Dial returns within its timeout with either a
+// Conn or an error, and each echo either succeeds, or fails with an error
+// within its deadline.
+func chaosDialEcho(dialer *transportc.Dialer, label string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, label)
+	if elapsed := time.Since(start); elapsed > timeout+time.Second {
+		return fmt.Errorf("%s: DialContext returned after %v, beyond its timeout", label, elapsed)
+	}
+	if (conn == nil) == (err == nil) {
+		return fmt.Errorf("%s: DialContext returned Conn %v and error %v", label, conn, err)
+	}
+	if err != nil {
+		return nil // dropped signaling
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1024)
+	for i := 0; i < 8; i++ {
+		msg := []byte(fmt.Sprintf("%s #%d", label, i))
+		if _, err := conn.Write(msg); err != nil {
+			var writeErr *transportc.WriteError
+			if !errors.As(err, &writeErr) {
+				return fmt.Errorf("%s: Write failed with %T, expected a WriteError", label, err)
+			}
+			return nil
+		}
+
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil // the echo failed to write
+		}
+		if !bytes.Equal(buf[:n], msg) {
+			return fmt.Errorf("%s: read %q, expected %q", label, buf[:n], msg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package transportc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := transportc.NewFakeClock(start)
+
+	timer := clock.NewTimer(2 * time.Second)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+	fired := make(chan time.Time, 1)
+	clock.AfterFunc(3*time.Second, func() { fired <- clock.Now() })
+	stopped := clock.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Fatal("Stop of a pending Timer should return true")
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case now := <-ticker.C():
+		if !now.Equal(start.Add(time.Second)) {
+			t.Fatalf("ticked at %v, expected %v", now, start.Add(time.Second))
+		}
+	default:
+		t.Fatal("Ticker not ticked")
+	}
+	select {
+	case <-timer.C():
+		t.Fatal("Timer fired early")
+	case <-stopped.C():
+		t.Fatal("stopped Timer fired")
+	default:
+	}
+
+	clock.Advance(2 * time.Second)
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("Timer not fired")
+	}
+	select {
+	case now := <-fired:
+		if !now.Equal(start.Add(3 * time.Second)) {
+			t.Fatalf("AfterFunc called at %v, expected %v", now, start.Add(3*time.Second))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("AfterFunc not called")
+	}
+	if timer.Stop() {
+		t.Fatal("Stop of a fired Timer should return false")
+	}
+	if clock.Pending() != 1 { // the Ticker
+		t.Fatalf("%d pending, expected 1", clock.Pending())
+	}
+}
+
+func TestConnIdleTimeoutWithClock(t *testing.T) {
+	clock := transportc.NewFakeClock(time.Now())
+	defer transportc.WithClock(clock)()
+
+	// an idle timeout never reached in real time
+	config := &transportc.Config{
+		Signal:  transportc.NewDebugSignal(8),
+		Timeout: time.Hour,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	// the Conn is idle for a full timeout once ticked twice
+	for i := 0; i < 10; i++ {
+		clock.Advance(config.Timeout)
+		select {
+		case <-cConn.(*transportc.Conn).Done():
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	t.Fatal("Conn not closed for being idle")
+}
@@ -0,0 +1,300 @@
+package transportc_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// compatPinnedRef is the git revision of the previous version the wire
+// format MUST stay compatible with, overridden by TRANSPORTC_COMPAT_REF.
+const compatPinnedRef = "426c7567f2253ac424bd95df161426af3604df30"
+
+// buildCompatPeer builds testdata/compatpeer against the source of ref, with
+// the modules in the module cache only. It skips t if ref can't be built
+// offline, e.g., out of a git checkout.
+func buildCompatPeer(t *testing.T, ref string) string {
+	dir := t.TempDir()
+	root, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		t.Skipf("not in a git checkout: %v", err)
+	}
+
+	// git archive leaves the checkout untouched, unlike git worktree
+	src := filepath.Join(dir, "transportc")
+	if err := os.Mkdir(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "transportc.tar")
+	if out, err := exec.Command("git", "-C", strings.TrimSpace(string(root)), "archive", "--output", archive, ref).CombinedOutput(); err != nil {
+		t.Skipf("git archive %s failed: %v: %s", ref, err, out)
+	}
+	if out, err := exec.Command("tar", "-xf", archive, "-C", src).CombinedOutput(); err != nil {
+		t.Skipf("tar failed: %v: %s", err, out)
+	}
+
+	peer := filepath.Join(dir, "compatpeer")
+	if err := os.Mkdir(peer, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	program, err := os.ReadFile(filepath.Join("testdata", "compatpeer", "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := os.ReadFile(filepath.Join(src, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goMod := fmt.Sprintf("module compatpeer\n\ngo 1.19\n\nrequire github.com/gaukas/transportc v0.0.0\n\nreplace github.com/gaukas/transportc => %s\n", src)
+	for name, content := range map[string][]byte{"main.go": program, "go.sum": sum, "go.mod": []byte(goMod)} {
+		if err := os.WriteFile(filepath.Join(peer, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	build := exec.Command("go", "build", "-o", "compatpeer", ".")
+	build.Dir = peer
+	build.Env = append(os.Environ(), "GOPROXY=off", "GOFLAGS=-mod=mod", "GOWORK=off")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("building compatpeer against %s failed, e.g., missing modules offline: %v: %s", ref, err, out)
+	}
+	return filepath.Join(peer, "compatpeer")
+}
+
+// compatSignal implements transportc.Signal over the stdin and stdout of a
+// compatpeer process, see testdata/compatpeer.
+type compatSignal struct {
+	stdin  io.Writer
+	offers chan compatOffer
+
+	mutex   sync.Mutex
+	nextID  uint64
+	answers map[uint64][]byte
+}
+
+type compatOffer struct {
+	id  uint64
+	sdp []byte
+}
+
+func startCompatPeer(t *testing.T, binary, role string) *compatSignal {
+	cmd := exec.Command(binary, role)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close() // compatpeer exits once stdin is closed
+		done := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			cmd.Process.Kill()
+			<-done
+		}
+	})
+
+	s := &compatSignal{
+		stdin:   stdin,
+		offers:  make(chan compatOffer, 8),
+		nextID:  1,
+		answers: make(map[uint64][]byte),
+	}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 1<<20), 1<<20)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 3 {
+				continue // not a signal, e.g., a log line
+			}
+			id, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			sdp, err := base64.StdEncoding.DecodeString(fields[2])
+			if err != nil {
+				continue
+			}
+			switch fields[0] {
+			case "offer":
+				s.offers <- compatOffer{id: id, sdp: sdp}
+			case "answer":
+				s.mutex.Lock()
+				s.answers[id] = sdp
+				s.mutex.Unlock()
+			}
+		}
+	}()
+	return s
+}
+
+func (s *compatSignal) write(kind string, id uint64, sdp []byte) error {
+	_, err := fmt.Fprintf(s.stdin, "%s %d %s\n", kind, id, base64.StdEncoding.EncodeToString(sdp))
+	return err
+}
+
+func (s *compatSignal) Offer(sdp []byte) (uint64, error) {
+	s.mutex.Lock()
+	id := s.nextID
+	s.nextID++
+	s.mutex.Unlock()
+	return id, s.write("offer", id, sdp)
+}
+
+func (s *compatSignal) ReadOffer() (uint64, []byte, error) {
+	select {
+	case o := <-s.offers:
+		return o.id, o.sdp, nil
+	case <-time.After(time.Second):
+		return 0, nil, transportc.ErrOfferNotReady
+	}
+}
+
+func (s *compatSignal) Answer(id uint64, sdp []byte) error {
+	return s.write("answer", id, sdp)
+}
+
+func (s *compatSignal) ReadAnswer(id uint64) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	answer, ok := s.answers[id]
+	if !ok {
+		return nil, transportc.ErrAnswerNotReady
+	}
+	delete(s.answers, id)
+	return answer, nil
+}
+
+// compatConfig enables the in-band features compatible with a peer unaware
+// of them. Config.WireHandshake is not, and is left disabled.
+func compatConfig(signal transportc.Signal) *transportc.Config {
+	return &transportc.Config{
+		Signal:           signal,
+		SplitLargeWrites: true,
+		ICETimeouts: &transportc.ICETimeouts{
+			Disconnected: 3 * time.Second,
+			Failed:       5 * time.Second,
+			KeepAlive:    500 * time.Millisecond,
+		},
+	}
+}
+
+// checkCompatEcho checks that conn, connected to a compatpeer, echoes small
+// messages, large writes split in multiple messages, and messages after an
+// idle period kept alive by ICE.
+func checkCompatEcho(t *testing.T, conn net.Conn) {
+	echo := func(payload []byte) {
+		t.Helper()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		if _, err := conn.Write(payload); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		received := make([]byte, 0, len(payload))
+		buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+		for len(received) < len(payload) {
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("Read error after %d of %d bytes: %v", len(received), len(payload), err)
+			}
+			received = append(received, buf[:n]...)
+		}
+		if !bytes.Equal(received, payload) {
+			t.Fatalf("echoed %d bytes differing from the %d bytes written", len(received), len(payload))
+		}
+	}
+
+	echo([]byte("Hello, World!"))
+
+	// Fragmentation: split by SplitLargeWrites, echoed message by message
+	large := make([]byte, 3*transportc.CONN_DEFAULT_MTU+1234)
+	rand.Read(large)
+	echo(large)
+
+	// Keepalive: idle for longer than ICETimeouts.Disconnected
+	time.Sleep(6 * time.Second)
+	echo([]byte("Still there?"))
+}
+
+// Positive Test for the wire compatibility between this version and the
+// previous version pinned by compatPinnedRef, in both directions.
+func TestWireCompatibility(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a previous version in a subprocess")
+	}
+	ref := os.Getenv("TRANSPORTC_COMPAT_REF")
+	if ref == "" {
+		ref = compatPinnedRef
+	}
+	binary := buildCompatPeer(t, ref)
+
+	t.Run("NewDialerOldListener", func(t *testing.T) {
+		signal := startCompatPeer(t, binary, "listen")
+		dialer, err := compatConfig(signal).NewDialer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dialer.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel() // cancel the context to make sure it is done
+		conn, err := dialer.DialContext(ctx, "compat")
+		if err != nil {
+			t.Fatalf("DialContext error: %v", err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+		checkCompatEcho(t, conn)
+	})
+
+	t.Run("OldDialerNewListener", func(t *testing.T) {
+		signal := startCompatPeer(t, binary, "dial")
+		listener, err := compatConfig(signal).NewListener()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		listener.Start()
+
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			if conn, err := listener.Accept(); err == nil {
+				accepted <- conn
+			}
+		}()
+		var conn net.Conn
+		select {
+		case conn = <-accepted:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Accept timed out")
+		}
+		defer conn.Close() // skipcq: GO-S2307
+		checkCompatEcho(t, conn)
+	})
+}
@@ -1,10 +1,17 @@
 package transportc_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -509,3 +516,689 @@ func benchmarkMultiConnReuse(b *testing.B, pktSize int, multi int) {
 	listener.Close()
 	b.Logf("%d Reused Connections, %dKB Test, %d round(s) each, Bw: %dMB/s, Lat: %dus", multi, pktSize/1024, 10000/multi, bw.Load()/1024, lat.Load()/uint64(multi))
 }
+
+func TestConnHandshakeInfo(t *testing.T) {
+	config := &transportc.Config{
+		Signal:              transportc.NewDebugSignal(8),
+		ReusePeerConnection: true,
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	info := cConn.(*transportc.Conn).HandshakeInfo()
+	if info.Reused || info.Total <= 0 || info.SignalRTT <= 0 || info.Total < info.SignalRTT {
+		t.Fatalf("Unexpected HandshakeInfo for first Conn: %+v", info)
+	}
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	if info := sConn.(*transportc.Conn).HandshakeInfo(); info.Reused || info.Total <= 0 {
+		t.Fatalf("Unexpected HandshakeInfo for accepted Conn: %+v", info)
+	}
+
+	cConn2, err := dialer.DialContext(ctx, "RANDOM_LABEL_2")
+	if err != nil {
+		t.Fatalf("Second DialContext error: %v", err)
+	}
+	defer cConn2.Close() // skipcq: GO-S2307
+
+	info2 := cConn2.(*transportc.Conn).HandshakeInfo()
+	if !info2.Reused || info2.SignalRTT != info.SignalRTT {
+		t.Fatalf("Unexpected HandshakeInfo for reused Conn: %+v", info2)
+	}
+}
+
+func TestConnMaxMessageSize(t *testing.T) {
+	config := &transportc.Config{
+		Signal:         transportc.NewDebugSignal(8),
+		MaxMessageSize: 1024,
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	splitConfig := *config
+	splitConfig.SplitLargeWrites = true
+	splitDialer, err := splitConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer splitDialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	msg := make([]byte, 2048)
+	rand.Read(msg)
+
+	if _, err := cConn.Write(msg); !errors.Is(err, transportc.ErrMessageTooLarge) {
+		t.Fatalf("Write should fail with ErrMessageTooLarge, got %v", err)
+	}
+
+	cConnSplit, err := splitDialer.DialContext(ctx, "RANDOM_LABEL_SPLIT")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConnSplit.Close() // skipcq: GO-S2307
+
+	if n, err := cConnSplit.Write(msg); err != nil || n != len(msg) {
+		t.Fatalf("Write error: %v, %d bytes written", err, n)
+	}
+
+	// Accept both Conns and find the one receiving the split messages
+	var recv []byte
+	for i := 0; i < 2 && len(recv) < len(msg); i++ {
+		sConn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept error: %v", err)
+		}
+		defer sConn.Close() // skipcq: GO-S2307
+
+		sConn.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 2048)
+		for len(recv) < len(msg) {
+			n, err := sConn.Read(buf)
+			if err != nil {
+				break
+			}
+			if n > 1024 {
+				t.Fatalf("Read a message of %d bytes exceeding MaxMessageSize", n)
+			}
+			recv = append(recv, buf[:n]...)
+		}
+	}
+
+	if !bytes.Equal(msg, recv) {
+		t.Fatal("Read returned wrong message")
+	}
+}
+
+func TestNewDialerInvalidMaxMessageSize(t *testing.T) {
+	config := &transportc.Config{
+		MaxMessageSize: transportc.CONN_DEFAULT_MTU + 1,
+	}
+
+	if _, err := config.NewDialer(); err != transportc.ErrInvalidMaxMessageSize {
+		t.Fatalf("NewDialer should fail with ErrInvalidMaxMessageSize, got %v", err)
+	}
+}
+
+// Negative Test for Config.MaxMessageSize on the Listener only: a message
+// received larger than it closes the Conn with CLOSE_REASON_MESSAGE_TOO_LARGE
+func TestConnReadMessageTooLarge(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	listener, err := (&transportc.Config{
+		Signal:         signal,
+		MaxMessageSize: 1024,
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	if size := cConn.(*transportc.Conn).MaxMessageSize(); size != transportc.CONN_DEFAULT_MTU {
+		t.Fatalf("MaxMessageSize of the dialed Conn is %d, expected CONN_DEFAULT_MTU", size)
+	}
+	if size := sConn.(*transportc.Conn).MaxMessageSize(); size != 1024 {
+		t.Fatalf("MaxMessageSize of the accepted Conn is %d, expected 1024", size)
+	}
+
+	if _, err := cConn.Write(make([]byte, 1024)); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if _, err := cConn.Write(make([]byte, 2048)); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := sConn.Read(buf); err != nil || n != 1024 {
+		t.Fatalf("Read %d bytes, %v, expected a message of 1024 bytes", n, err)
+	}
+	if _, err := sConn.Read(buf); err != io.EOF {
+		t.Fatalf("Read of a message larger than MaxMessageSize returned %v, expected io.EOF", err)
+	}
+	if reason := sConn.(*transportc.Conn).CloseReason(); reason != transportc.CLOSE_REASON_MESSAGE_TOO_LARGE {
+		t.Fatalf("CloseReason is %v, expected %v", reason, transportc.CLOSE_REASON_MESSAGE_TOO_LARGE)
+	}
+}
+
+func TestConnDefaultReadTimeout(t *testing.T) {
+	config := &transportc.Config{
+		Signal:             transportc.NewDebugSignal(8),
+		DefaultReadTimeout: 500 * time.Millisecond,
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	buf := make([]byte, 16)
+
+	// Read times out without any deadline set
+	start := time.Now()
+	if _, err := sConn.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read returned %v, expected os.ErrDeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Read timed out after %v, expected 500ms", elapsed)
+	}
+
+	// A read deadline overrides the default timeout
+	sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	go func() {
+		time.Sleep(time.Second)
+		cConn.Write([]byte("Hello"))
+	}()
+	if n, err := sConn.Read(buf); err != nil || string(buf[:n]) != "Hello" {
+		t.Fatalf("Read returned %q, %v", buf[:n], err)
+	}
+}
+
+// countConnGoroutines returns the number of goroutines running the read or
+// idle loop of a Conn.
+func countConnGoroutines() int {
+	buf := make([]byte, 1<<20)
+	stacks := string(buf[:runtime.Stack(buf, true)])
+	return strings.Count(stacks, "transportc.(*Conn).readloop") + strings.Count(stacks, "transportc.(*Conn).idleloop")
+}
+
+func TestConnCloseLeak(t *testing.T) {
+	config := &transportc.Config{
+		Signal:  transportc.NewDebugSignal(8),
+		Timeout: time.Minute,
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+
+	// Block a Read, so the readloop of sConn is running
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := sConn.Read(make([]byte, 16))
+		readErr <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	before := countConnGoroutines()
+
+	// The remote peer never closes cConn
+	sConn.Close()
+
+	select {
+	case <-sConn.(*transportc.Conn).Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Conn not torn down after Close")
+	}
+
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Fatal("pending Read should fail after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending Read not unblocked by Close")
+	}
+
+	// readloop and idleloop of sConn
+	deadline := time.Now().Add(2 * time.Second)
+	for countConnGoroutines() > before-2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d Conn goroutines remain after Close, expected at most %d", countConnGoroutines(), before-2)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestConnStringMessage(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	conn := cConn.(*transportc.Conn)
+	if _, err := conn.WriteMessage([]byte("text"), true); err != nil {
+		t.Fatalf("WriteMessage error: %v", err)
+	}
+	if _, err := conn.Write([]byte("binary")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+
+	buf := make([]byte, 16)
+	for _, expected := range []struct {
+		msg      string
+		isString bool
+	}{{"text", true}, {"binary", false}} {
+		n, isString, err := sConn.(*transportc.Conn).ReadMessage(buf)
+		if err != nil {
+			t.Fatalf("ReadMessage error: %v", err)
+		}
+		if string(buf[:n]) != expected.msg || isString != expected.isString {
+			t.Fatalf("ReadMessage returned %q with isString %v, expected %q with %v", buf[:n], isString, expected.msg, expected.isString)
+		}
+	}
+}
+
+func TestConnWriteError(t *testing.T) {
+	config := &transportc.Config{
+		Signal:            transportc.NewDebugSignal(8),
+		MaxBufferedAmount: 1,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	// A full buffer is temporary
+	msg := make([]byte, 16384)
+	var writeErr *transportc.WriteError
+	for i := 0; i < 1000 && writeErr == nil; i++ {
+		if _, err := cConn.Write(msg); err != nil && !errors.As(err, &writeErr) {
+			t.Fatalf("Write returned %v, expected a WriteError", err)
+		}
+	}
+	if writeErr == nil || writeErr.Kind != transportc.WRITE_ERROR_BUFFER_FULL || !errors.Is(writeErr, transportc.ErrWriteBufferFull) {
+		t.Fatalf("Write returned %v, expected WRITE_ERROR_BUFFER_FULL", writeErr)
+	}
+	if writeErr.Timeout() || !writeErr.Temporary() {
+		t.Fatal("WRITE_ERROR_BUFFER_FULL should be temporary and not a timeout")
+	}
+
+	// An exceeded deadline is a temporary timeout
+	sConn.SetWriteDeadline(time.Now().Add(-time.Second))
+	_, err = sConn.Write([]byte("Hello"))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() || !netErr.Temporary() || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Write returned %v, expected a temporary timeout", err)
+	}
+
+	// A closed Conn is permanent
+	sConn.Close()
+	_, err = sConn.Write([]byte("Hello"))
+	if !errors.As(err, &netErr) || netErr.Timeout() || netErr.Temporary() || !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Write returned %v, expected a permanent net.ErrClosed", err)
+	}
+}
+
+// TestConnCloseEOF checks that the remote peer reads the messages written
+// before Close, then io.EOF, instead of waiting for the PeerConnection to time
+// out. The PeerConnection is reused, so it is kept open.
+func TestConnCloseEOF(t *testing.T) {
+	config := &transportc.Config{
+		Signal:              transportc.NewDebugSignal(8),
+		ReusePeerConnection: true,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	for _, closer := range []string{"dialer", "listener"} {
+		cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+		if err != nil {
+			t.Fatalf("DialContext error: %v", err)
+		}
+		defer cConn.Close() // skipcq: GO-S2307
+
+		sConn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept error: %v", err)
+		}
+		defer sConn.Close() // skipcq: GO-S2307
+
+		local, remote := cConn, sConn
+		if closer == "listener" {
+			local, remote = sConn, cConn
+		}
+
+		for i := 0; i < 3; i++ {
+			if _, err := local.Write([]byte("bye" + strconv.Itoa(i))); err != nil {
+				t.Fatalf("Write error: %v", err)
+			}
+		}
+		if err := local.Close(); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond) // let the close reach the remote peer first
+
+		remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 16)
+		for i := 0; i < 3; i++ {
+			n, err := remote.Read(buf)
+			if err != nil || string(buf[:n]) != "bye"+strconv.Itoa(i) {
+				t.Fatalf("Read after the %s closed returned %q, %v, expected the messages written before Close", closer, buf[:n], err)
+			}
+		}
+		if _, err := remote.Read(buf); err != io.EOF {
+			t.Fatalf("Read after the %s closed returned %v, expected io.EOF", closer, err)
+		}
+	}
+}
+
+// Positive Test for Conn.SetReadBuffer and Conn.SetWriteBuffer: a reader not
+// reading makes the writer block once both buffers and the SCTP receive window
+// are full, then all messages written are received in order.
+func TestConnSetReadWriteBuffer(t *testing.T) {
+	config := &transportc.Config{
+		Signal:                   transportc.NewDebugSignal(8),
+		SCTPMaxReceiveBufferSize: 128 * 1024,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	if err := cConn.(*transportc.Conn).SetWriteBuffer(64 * 1024); err != nil {
+		t.Fatalf("SetWriteBuffer error: %v", err)
+	}
+	if err := sConn.(*transportc.Conn).SetReadBuffer(32 * 1024); err != nil {
+		t.Fatalf("SetReadBuffer error: %v", err)
+	}
+
+	// Nothing is read yet, so a Write eventually blocks until its deadline
+	msg := make([]byte, 16384)
+	var written int
+	cConn.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	for ; written < 1000; written++ {
+		msg[0] = byte(written)
+		if _, err = cConn.Write(msg); err != nil {
+			break
+		}
+	}
+	var writeErr *transportc.WriteError
+	if !errors.As(err, &writeErr) || writeErr.Kind != transportc.WRITE_ERROR_DEADLINE {
+		t.Fatalf("Write returned %v after %d messages, expected WRITE_ERROR_DEADLINE", err, written)
+	}
+
+	buf := make([]byte, 16384)
+	sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < written; i++ {
+		n, err := sConn.Read(buf)
+		if err != nil {
+			t.Fatalf("Read error: %v", err)
+		}
+		if n != len(msg) || buf[0] != byte(i) {
+			t.Fatalf("Read message %d of %d bytes, expected message %d of %d bytes", buf[0], n, byte(i), len(msg))
+		}
+	}
+}
+
+// Negative Test for Conn.SetReadBuffer and Conn.SetWriteBuffer with a
+// negative size
+func TestConnSetBufferInvalid(t *testing.T) {
+	conn := transportc.NewConn(nil, transportc.CONN_DEFAULT_CONCURRENCY)
+	if err := conn.SetReadBuffer(-1); !errors.Is(err, transportc.ErrInvalidBufferSize) {
+		t.Fatalf("SetReadBuffer returned %v, expected ErrInvalidBufferSize", err)
+	}
+	if err := conn.SetWriteBuffer(-1); !errors.Is(err, transportc.ErrInvalidBufferSize) {
+		t.Fatalf("SetWriteBuffer returned %v, expected ErrInvalidBufferSize", err)
+	}
+}
+
+// Positive Test for Conn.StartReader: a Conn never read from does not read
+// from its datachannel, until StartReader observes the remote peer closing it
+func TestConnStartReader(t *testing.T) {
+	config := &transportc.Config{
+		Signal:              transportc.NewDebugSignal(8),
+		ReusePeerConnection: true, // keeps the PeerConnection open once the Conn is closed
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer accepted.Close() // skipcq: GO-S2307
+	sConn := accepted.(*transportc.Conn)
+
+	if _, err := cConn.Write([]byte("Hello")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	cConn.Close()
+
+	// Nothing reads the datachannel yet
+	time.Sleep(500 * time.Millisecond)
+	if reason := sConn.CloseReason(); reason != transportc.CLOSE_REASON_NONE {
+		t.Fatalf("CloseReason is %v before reading, expected %v", reason, transportc.CLOSE_REASON_NONE)
+	}
+
+	sConn.StartReader()
+	sConn.StartReader() // no-op
+	deadline := time.Now().Add(5 * time.Second)
+	for sConn.CloseReason() != transportc.CLOSE_REASON_REMOTE {
+		if time.Now().After(deadline) {
+			t.Fatalf("CloseReason is %v after StartReader, expected %v", sConn.CloseReason(), transportc.CLOSE_REASON_REMOTE)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The messages received before are still read
+	buf := make([]byte, 64)
+	sConn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := sConn.Read(buf); err != nil || string(buf[:n]) != "Hello" {
+		t.Fatalf("Read %q, %v, expected %q", buf[:n], err, "Hello")
+	}
+	if _, err := sConn.Read(buf); err != io.EOF {
+		t.Fatalf("Read returned %v, expected io.EOF", err)
+	}
+}
@@ -0,0 +1,140 @@
+package transportc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+type contextKey string
+
+func TestConnContext(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	listener, err := (&transportc.Config{
+		Signal: signal,
+		ConnContext: func(ctx context.Context, conn *transportc.Conn) context.Context {
+			return context.WithValue(ctx, contextKey("claims"), "listener:"+conn.Label())
+		},
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(context.WithValue(ctx, contextKey("trace"), "TRACE_ID"), "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	// the values of the dial context are carried, but not its cancellation
+	cCtx := cConn.(*transportc.Conn).Context()
+	if trace := cCtx.Value(contextKey("trace")); trace != "TRACE_ID" {
+		t.Fatalf("dialed Conn context carries %v, expected TRACE_ID", trace)
+	}
+	if conn, ok := transportc.ConnFromContext(cCtx); !ok || conn != cConn {
+		t.Fatal("ConnFromContext should return the dialed Conn")
+	}
+
+	sCtx := sConn.(*transportc.Conn).Context()
+	if claims := sCtx.Value(contextKey("claims")); claims != "listener:RANDOM_LABEL" {
+		t.Fatalf("accepted Conn context carries %v, expected the value of ConnContext", claims)
+	}
+	if conn, ok := transportc.ConnFromContext(sCtx); !ok || conn != sConn {
+		t.Fatal("ConnFromContext should return the accepted Conn")
+	}
+
+	cancel()
+	if cCtx.Err() != nil {
+		t.Fatal("dialed Conn context should outlive the dial context")
+	}
+
+	sConn.Close()
+	select {
+	case <-sCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("accepted Conn context should be canceled once the Conn is closed")
+	}
+}
+
+// Positive Test for WithConnContext, closing the dialed and accepted Conns
+// once their contexts are done.
+func TestWithConnContext(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	listener, err := (&transportc.Config{Signal: signal}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	dialCtx, dialCancel := context.WithCancel(context.Background())
+	defer dialCancel()
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL", transportc.WithConnContext(dialCtx))
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	acceptCtx, acceptCancel := context.WithCancel(context.Background())
+	defer acceptCancel()
+	sConn, err := listener.AcceptWith(transportc.WithConnContext(acceptCtx), transportc.WithTag("accepted"))
+	if err != nil {
+		t.Fatalf("AcceptWith error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+	if tag := sConn.(*transportc.Conn).Tag(); tag != "accepted" {
+		t.Fatalf("accepted Conn tagged %q, expected accepted", tag)
+	}
+
+	// the dial context is done, the Conn is not
+	cancel()
+	if _, err := cConn.Write([]byte("Hello")); err != nil {
+		t.Fatalf("Write error after the dial context is done: %v", err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		conn   net.Conn
+		cancel context.CancelFunc
+	}{{"dialed", cConn, dialCancel}, {"accepted", sConn, acceptCancel}} {
+		c.cancel()
+		conn := c.conn.(*transportc.Conn)
+		select {
+		case <-conn.Context().Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%s Conn should be closed once its context is done", c.name)
+		}
+		if reason := conn.CloseReason(); reason != transportc.CLOSE_REASON_CONTEXT_DONE {
+			t.Fatalf("%s Conn CloseReason is %v, expected %v", c.name, reason, transportc.CLOSE_REASON_CONTEXT_DONE)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package transportc_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestDatagramConn(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialDatagramContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialDatagramContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	sConn, ok := conn.(*transportc.DatagramConn)
+	if !ok {
+		t.Fatalf("Accept returned %T, expected *transportc.DatagramConn", conn)
+	}
+	if _, ok := conn.(interface {
+		ReadMessage([]byte) (int, bool, error)
+	}); ok {
+		t.Fatal("DatagramConn exposes ReadMessage, which skips the datagram header")
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = cConn.Write([]byte(fmt.Sprintf("Hello%d", i)))
+		if err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+	}
+
+	buf := make([]byte, 1024)
+	for i := 0; i < 3; i++ {
+		n, info, err := sConn.ReadDatagram(buf)
+		if err != nil {
+			t.Fatalf("ReadDatagram error: %v", err)
+		}
+		if string(buf[:n]) != fmt.Sprintf("Hello%d", info.Seq) {
+			t.Fatalf("ReadDatagram returned %s for Seq %d", string(buf[:n]), info.Seq)
+		}
+	}
+
+	stats := sConn.Stats()
+	if stats.Received != 3 {
+		t.Fatalf("Stats.Received is %d, expected 3", stats.Received)
+	}
+}
+
+// Positive Test for DatagramConn.Stats with gaps, reordering and duplicates.
+func TestDatagramConnStats(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	for _, tc := range []struct {
+		name    string
+		seqs    []uint32
+		dropped []uint32 // DatagramInfo.Dropped of each message
+		late    []bool   // DatagramInfo.Late of each message
+		stats   transportc.DatagramStats
+	}{
+		{
+			name:    "InOrder",
+			seqs:    []uint32{0, 1, 2},
+			dropped: []uint32{0, 0, 0},
+			late:    []bool{false, false, false},
+			stats:   transportc.DatagramStats{Received: 3},
+		},
+		{
+			name:    "Gap",
+			seqs:    []uint32{0, 3, 4},
+			dropped: []uint32{0, 2, 0},
+			late:    []bool{false, false, false},
+			stats:   transportc.DatagramStats{Received: 3, Dropped: 2},
+		},
+		{
+			name:    "Reordered",
+			seqs:    []uint32{0, 2, 1},
+			dropped: []uint32{0, 1, 0},
+			late:    []bool{false, false, true},
+			stats:   transportc.DatagramStats{Received: 3, Late: 1},
+		},
+		{
+			name:    "Duplicate",
+			seqs:    []uint32{0, 1, 1},
+			dropped: []uint32{0, 0, 0},
+			late:    []bool{false, false, false},
+			stats:   transportc.DatagramStats{Received: 3},
+		},
+		{
+			name:    "DuplicateAfterGap",
+			seqs:    []uint32{0, 2, 2},
+			dropped: []uint32{0, 1, 0},
+			late:    []bool{false, false, false},
+			stats:   transportc.DatagramStats{Received: 3, Dropped: 1},
+		},
+		{
+			name:    "ReorderedDuplicate",
+			seqs:    []uint32{0, 3, 1, 1},
+			dropped: []uint32{0, 2, 0, 0},
+			late:    []bool{false, false, true, false},
+			stats:   transportc.DatagramStats{Received: 4, Dropped: 1, Late: 1},
+		},
+		{
+			name:    "BeforeFirst",
+			seqs:    []uint32{5, 6, 3},
+			dropped: []uint32{0, 0, 0},
+			late:    []bool{false, false, false},
+			stats:   transportc.DatagramStats{Received: 3},
+		},
+		{
+			name:    "Wraparound",
+			seqs:    []uint32{1<<32 - 2, 1, 0},
+			dropped: []uint32{0, 2, 0},
+			late:    []bool{false, false, true},
+			stats:   transportc.DatagramStats{Received: 3, Dropped: 1, Late: 1},
+		},
+		{
+			name:    "BeyondReorderWindow",
+			seqs:    []uint32{0, transportc.DATAGRAM_REORDER_WINDOW + 1, 1},
+			dropped: []uint32{0, transportc.DATAGRAM_REORDER_WINDOW, 0},
+			late:    []bool{false, false, true},
+			stats:   transportc.DatagramStats{Received: 3, Dropped: transportc.DATAGRAM_REORDER_WINDOW, Late: 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel() // cancel the context to make sure it is done
+
+			// A reliable and ordered Conn delivers the datagrams as written
+			cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+			if err != nil {
+				t.Fatalf("DialContext error: %v", err)
+			}
+			defer cConn.Close() // skipcq: GO-S2307
+
+			conn, err := listener.Accept()
+			if err != nil {
+				t.Fatalf("Accept error: %v", err)
+			}
+			defer conn.Close() // skipcq: GO-S2307
+			sConn := transportc.NewDatagramConn(conn.(*transportc.Conn))
+
+			for _, seq := range tc.seqs {
+				msg := make([]byte, transportc.DATAGRAM_HEADER_SIZE+1)
+				binary.BigEndian.PutUint32(msg[0:4], seq)
+				binary.BigEndian.PutUint64(msg[4:transportc.DATAGRAM_HEADER_SIZE], uint64(time.Now().UnixNano()))
+				if _, err := cConn.Write(msg); err != nil {
+					t.Fatalf("Write error: %v", err)
+				}
+			}
+
+			buf := make([]byte, 1024)
+			for i, seq := range tc.seqs {
+				_, info, err := sConn.ReadDatagram(buf)
+				if err != nil {
+					t.Fatalf("ReadDatagram error: %v", err)
+				}
+				if info.Seq != seq || info.Dropped != tc.dropped[i] || info.Late != tc.late[i] {
+					t.Fatalf("ReadDatagram #%d returned Seq %d, Dropped %d, Late %v, expected %d, %d, %v", i, info.Seq, info.Dropped, info.Late, seq, tc.dropped[i], tc.late[i])
+				}
+			}
+
+			stats := sConn.Stats()
+			stats.LastAge = 0
+			if stats != tc.stats {
+				t.Fatalf("Stats is %+v, expected %+v", stats, tc.stats)
+			}
+		})
+	}
+}
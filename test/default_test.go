@@ -0,0 +1,67 @@
+package transportc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// Positive Test for Dial and Listen with default Configs: the Dialer created
+// by Dial, along with its pre-gathered PeerConnection, is closed with the Conn
+func TestDialListen(t *testing.T) {
+	agents := countICEAgentGoroutines()
+
+	signal := transportc.NewDebugSignal(8)
+	listener, err := transportc.Listen(signal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := transportc.Dial(ctx, signal, "RANDOM_LABEL", transportc.WithConfig(transportc.PRESET_LOW_LATENCY.Apply))
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	msg := []byte("Hello, World!")
+	if _, err := cConn.Write(msg); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, 64)
+	sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := sConn.Read(buf)
+	if err != nil || string(buf[:n]) != string(msg) {
+		t.Fatalf("Read %q, %v, expected %q", buf[:n], err, msg)
+	}
+
+	// Only the PeerConnection of the Listener may be left
+	cConn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for countICEAgentGoroutines() > agents+1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d ICE agents still running after the Conn closed, expected at most %d", countICEAgentGoroutines(), agents+1)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Negative Test for Listen with an invalid Config
+func TestListenInvalidConfig(t *testing.T) {
+	_, err := transportc.Listen(transportc.NewDebugSignal(8), func(c *transportc.Config) {
+		c.MaxMessageSize = -1
+	})
+	if err == nil {
+		t.Fatal("Listen succeeded with a negative MaxMessageSize")
+	}
+}
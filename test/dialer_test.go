@@ -2,11 +2,19 @@ package transportc_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gaukas/transportc"
+	"github.com/pion/webrtc/v3"
 )
 
 // Negative Test for Dialer.DialContext with an expired context
@@ -68,6 +76,88 @@ func TestDialContextWithoutPeer(t *testing.T) {
 	}
 }
 
+// Negative Test for Dialer.DialContext failing to handle the answer, which
+// MUST return the underlying error
+func TestDialContextAnswerError(t *testing.T) {
+	errTransform := errors.New("transform failed")
+	signal := transportc.NewDebugSignal(8)
+
+	listener, err := (&transportc.Config{Signal: signal}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{
+		Signal: signal,
+		SDPTransformIncoming: func(webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+			return webrtc.SessionDescription{}, errTransform
+		},
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	_, err = dialer.DialContext(ctx, "RANDOM_LABEL")
+	if !errors.Is(err, errTransform) {
+		t.Fatalf("DialContext returned %v, expected the error of SDPTransformIncoming", err)
+	}
+}
+
+// Negative Test for Config.OpenTimeout, with the ICE candidates stripped from
+// both descriptions so the handshake never completes
+func TestDialContextOpenTimeout(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	listener, err := (&transportc.Config{Signal: signal}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	stripCandidates := func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+		var lines []string
+		for _, line := range strings.Split(desc.SDP, "\r\n") {
+			if !strings.HasPrefix(line, "a=candidate:") {
+				lines = append(lines, line)
+			}
+		}
+		desc.SDP = strings.Join(lines, "\r\n")
+		return desc, nil
+	}
+	dialer, err := (&transportc.Config{
+		Signal:               signal,
+		OpenTimeout:          time.Second,
+		SDPTransformIncoming: stripCandidates,
+		SDPTransformOutgoing: stripCandidates,
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	timeStart := time.Now()
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if conn != nil {
+		conn.Close()
+	}
+	if !errors.Is(err, transportc.ErrOpenTimeout) {
+		t.Fatalf("DialContext returned %v, expected ErrOpenTimeout", err)
+	}
+	if elapsed := time.Since(timeStart); elapsed > 5*time.Second {
+		t.Fatalf("DialContext returned after %v, expected to fail fast", elapsed)
+	}
+}
+
 // Positive Test for Dialer.DialContext with a default answering peer to connect to
 func TestDialContext(t *testing.T) {
 	config := &transportc.Config{
@@ -209,3 +299,893 @@ func BenchmarkSingleDialerDialing(b *testing.B) {
 		c.Close()
 	}
 }
+
+// Positive Test for Dialer.DialContext with SDPTransform set on both sides
+func TestDialContextWithSDPTransform(t *testing.T) {
+	var transformed atomic.Int32
+	transform := func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+		transformed.Add(1)
+		desc.SDP = strings.ReplaceAll(desc.SDP, "\r\na=extmap-allow-mixed", "")
+		return desc, nil
+	}
+
+	config := &transportc.Config{
+		Signal:               transportc.NewDebugSignal(8),
+		SDPTransformIncoming: transform,
+		SDPTransformOutgoing: transform,
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	// offer: outgoing + incoming, answer: outgoing + incoming
+	if n := transformed.Load(); n != 4 {
+		t.Fatalf("SDPTransform called %d times, expected 4", n)
+	}
+}
+
+// Positive Test for Dialer.DialContext with SDPBandwidth set on both sides,
+// advertising the caps in both the offer and the answer
+func TestDialContextWithSDPBandwidth(t *testing.T) {
+	var received []string
+	var mutex sync.Mutex
+	record := func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+		mutex.Lock()
+		received = append(received, desc.SDP)
+		mutex.Unlock()
+		return desc, nil
+	}
+
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+		SDPBandwidth: &transportc.SDPBandwidth{
+			AS:             512,
+			TIAS:           500000,
+			MaxMessageSize: 65536,
+		},
+		SDPTransformIncoming: record,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("received %d SDPs, expected the offer and the answer", len(received))
+	}
+	for _, desc := range received {
+		for _, line := range []string{"b=AS:512\r\n", "b=TIAS:500000\r\n", "a=max-message-size:65536\r\n"} {
+			if strings.Count(desc, line) != 1 {
+				t.Fatalf("SDP does not advertise %q once:\n%s", strings.TrimSpace(line), desc)
+			}
+		}
+	}
+}
+
+// Positive Test for Dialer.DialContext with an unreachable STUN server and GatherTimeout set
+func TestDialContextWithGatherTimeout(t *testing.T) {
+	config := &transportc.Config{
+		Signal:        transportc.NewDebugSignal(8),
+		GatherTimeout: 500 * time.Millisecond,
+		WebRTCConfiguration: webrtc.Configuration{
+			ICEServers: []webrtc.ICEServer{
+				{URLs: []string{"stun:192.0.2.1:3478"}}, // TEST-NET-1, unreachable
+			},
+		},
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	conn.Close()
+}
+
+func TestDialContextWithDTLSRole(t *testing.T) {
+	for _, role := range []transportc.DTLSRole{transportc.DTLSRoleClient, transportc.DTLSRoleServer} {
+		config := &transportc.Config{
+			Signal:         transportc.NewDebugSignal(8),
+			DialerDTLSRole: role,
+		}
+
+		// Setup a listener to accept the connection first
+		listener, err := config.NewListener()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer listener.Close()
+		listener.Start()
+
+		dialer, err := config.NewDialer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dialer.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel() // cancel the context to make sure it is done
+		conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+		if err != nil {
+			t.Fatalf("DialContext error as %s: %v", role, err)
+		}
+		conn.Close()
+	}
+}
+
+// Negative Test for a Dialer requiring the same DTLS role as the Listener
+func TestDialContextWithDTLSRoleConflict(t *testing.T) {
+	config := &transportc.Config{
+		Signal:           transportc.NewDebugSignal(8),
+		DialerDTLSRole:   transportc.DTLSRoleClient,
+		ListenerDTLSRole: transportc.DTLSRoleClient,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if conn != nil {
+		conn.Close()
+	}
+	if err == nil {
+		t.Fatal("DialContext should fail as both peers require the DTLS client role")
+	}
+}
+
+func TestDialContextWithICERole(t *testing.T) {
+	for _, role := range []transportc.ICERole{transportc.ICERoleControlling, transportc.ICERoleControlled} {
+		listenerRole := transportc.ICERoleControlled
+		if role == transportc.ICERoleControlled {
+			listenerRole = transportc.ICERoleControlling // in ICE-lite mode
+		}
+		config := &transportc.Config{
+			Signal:          transportc.NewDebugSignal(8),
+			DialerICERole:   role,
+			ListenerICERole: listenerRole,
+		}
+
+		// Setup a listener to accept the connection first
+		listener, err := config.NewListener()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer listener.Close()
+		listener.Start()
+
+		dialer, err := config.NewDialer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dialer.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel() // cancel the context to make sure it is done
+		conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+		if err != nil {
+			t.Fatalf("DialContext error as %s: %v", role, err)
+		}
+		conn.Close()
+	}
+}
+
+// Negative Test for a Dialer requiring the ICE role the Listener takes
+func TestDialContextWithICERoleConflict(t *testing.T) {
+	config := &transportc.Config{
+		Signal:        transportc.NewDebugSignal(8),
+		DialerICERole: transportc.ICERoleControlled,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if conn != nil {
+		conn.Close()
+	}
+	if !errors.Is(err, transportc.ErrICERoleConflict) {
+		t.Fatalf("DialContext error is %v, expected ErrICERoleConflict as the Listener is not in ICE-lite mode", err)
+	}
+
+	// The Listener can't be controlled in ICE-lite mode
+	config.ListenerICELite = true
+	config.ListenerICERole = transportc.ICERoleControlled
+	if _, err := config.NewListener(); !errors.Is(err, transportc.ErrInvalidICERole) {
+		t.Fatalf("NewListener error is %v, expected ErrInvalidICERole", err)
+	}
+}
+
+func TestDialContextWithPreGatherPool(t *testing.T) {
+	config := &transportc.Config{
+		Signal:            transportc.NewDebugSignal(8),
+		PreGatherPoolSize: 2,
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	time.Sleep(time.Second) // wait for the pool to be filled
+
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			dialer.UpdateICEServers(nil) // invalidate the pool
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel() // cancel the context to make sure it is done
+
+		label := fmt.Sprintf("RANDOM_LABEL_%d", i)
+		cConn, err := dialer.DialContext(ctx, label)
+		if err != nil {
+			t.Fatalf("DialContext #%d error: %v", i, err)
+		}
+		defer cConn.Close() // skipcq: GO-S2307
+
+		sConn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept #%d error: %v", i, err)
+		}
+		defer sConn.Close() // skipcq: GO-S2307
+
+		// the DataChannel used for pre-gathering must not be accepted
+		if sConn.(*transportc.Conn).Label() != label {
+			t.Fatalf("Accepted Conn #%d has label %q, expected %q", i, sConn.(*transportc.Conn).Label(), label)
+		}
+
+		if _, err := cConn.Write([]byte("Hello")); err != nil {
+			t.Fatalf("Write #%d error: %v", i, err)
+		}
+		buf := make([]byte, 16)
+		if n, err := sConn.Read(buf); err != nil || string(buf[:n]) != "Hello" {
+			t.Fatalf("Read #%d returned %q, %v", i, buf[:n], err)
+		}
+	}
+}
+
+// Positive Test for Dialer.DialContext with ICE bound to a single local IP
+func TestDialContextWithLocalIPs(t *testing.T) {
+	var localIP net.IP
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			localIP = ipNet.IP
+			break
+		}
+	}
+	if localIP == nil {
+		t.Skip("no non-loopback IPv4 address available")
+	}
+
+	config := &transportc.Config{
+		Signal:   transportc.NewDebugSignal(8),
+		LocalIPs: []net.IP{localIP},
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	if host := conn.LocalAddr().(*transportc.Addr).Hostname; host != localIP.String() {
+		t.Fatalf("Conn bound to %s, expected %s", host, localIP)
+	}
+}
+
+func TestDialPersistent(t *testing.T) {
+	debugSignal := transportc.NewDebugSignal(8)
+
+	listenerConfig := &transportc.Config{
+		Signal: debugSignal,
+	}
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	// the first 2 attempts fail to signal the offer
+	dialerConfig := &transportc.Config{
+		Signal: &flakySignal{Signal: debugSignal, failures: 2},
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+	events := dialer.Events()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialPersistent(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialPersistent error: %v", err)
+	}
+	conn.Close()
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		event := nextEvent(t, events, transportc.EVENT_DIAL_FAILED)
+		if event.Attempt != attempt || event.Err == nil || event.Label != "RANDOM_LABEL" {
+			t.Fatalf("unexpected DialFailed: %+v", event)
+		}
+	}
+}
+
+// Negative Test for Dialer.DialPersistent never succeeding before the context is done
+func TestDialPersistentWithDoneContext(t *testing.T) {
+	config := &transportc.Config{
+		Signal: &flakySignal{Signal: transportc.NewDebugSignal(8), failures: 1000},
+	}
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialPersistent(ctx, "RANDOM_LABEL")
+	if conn != nil {
+		conn.Close()
+	}
+	if err == nil || !strings.Contains(err.Error(), "temporary failure") {
+		t.Fatalf("DialPersistent returned %v, expected the error of the last attempt", err)
+	}
+}
+
+func countICEAgentGoroutines() int {
+	buf := make([]byte, 1<<20)
+	stacks := string(buf[:runtime.Stack(buf, true)])
+	return strings.Count(stacks, "ice/v2.(*Agent).taskLoop")
+}
+
+// Regression test: a Dial canceled before the DataChannel opens must not
+// leave its PeerConnection running until the Dialer is closed.
+func TestDialContextCanceledBeforeOpen(t *testing.T) {
+	// Neither the offer nor the answer has candidates, so ICE never connects
+	stripCandidates := func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+		lines := strings.Split(desc.SDP, "\r\n")
+		stripped := lines[:0]
+		for _, line := range lines {
+			if !strings.HasPrefix(line, "a=candidate:") {
+				stripped = append(stripped, line)
+			}
+		}
+		desc.SDP = strings.Join(stripped, "\r\n")
+		return desc, nil
+	}
+	config := &transportc.Config{
+		Signal:               transportc.NewDebugSignal(8),
+		SDPTransformOutgoing: stripCandidates,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	if conn, err := dialer.DialContext(ctx, "RANDOM_LABEL"); err == nil {
+		conn.Close()
+		t.Fatal("DialContext should fail without candidates")
+	}
+	listener.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for countICEAgentGoroutines() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d ICE agents still running after the canceled Dial", countICEAgentGoroutines())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Positive Test for Dialer.DialPeer: the Conns dialed on a PeerHandle share
+// its PeerConnection, even without Config.ReusePeerConnection
+func TestDialPeer(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	peer, err := dialer.DialPeer(ctx)
+	if err != nil {
+		t.Fatalf("DialPeer error: %v", err)
+	}
+	defer peer.Close() // skipcq: GO-S2307
+
+	if state := peer.PeerConnection().ConnectionState(); state != webrtc.PeerConnectionStateConnected {
+		t.Fatalf("PeerConnection is %s after DialPeer, expected connected", state)
+	}
+
+	var peerIDs []uint64
+	for _, label := range []string{"RANDOM_LABEL", "RANDOM_LABEL_2"} {
+		cConn, err := peer.DialContext(ctx, label)
+		if err != nil {
+			t.Fatalf("PeerHandle.DialContext error: %v", err)
+		}
+		defer cConn.Close() // skipcq: GO-S2307
+
+		sConn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept error: %v", err)
+		}
+		defer sConn.Close() // skipcq: GO-S2307
+
+		if sConn.(*transportc.Conn).Label() != label {
+			t.Fatalf("Accepted Conn labeled %s, expected %s", sConn.(*transportc.Conn).Label(), label)
+		}
+		peerIDs = append(peerIDs, sConn.(*transportc.Conn).PeerID())
+	}
+	if peerIDs[0] != peerIDs[1] {
+		t.Fatalf("Conns accepted from PeerConnections %d and %d, expected the same", peerIDs[0], peerIDs[1])
+	}
+
+	peer.Close()
+	if _, err := peer.DialContext(ctx, "RANDOM_LABEL_3"); !errors.Is(err, transportc.ErrPeerHandleClosed) {
+		t.Fatalf("DialContext on a closed PeerHandle returned %v, expected ErrPeerHandleClosed", err)
+	}
+}
+
+// Positive Test for Dialer.DialContext after the PeerConnection is closed
+// for being idle.
+func TestDialContextIdlePeerConnection(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	config := &transportc.Config{
+		Signal:                          signal,
+		ReusePeerConnection:             true,
+		DialerIdlePeerConnectionTimeout: 200 * time.Millisecond,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+	events := dialer.Events()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	// the PeerConnection is closed once idle
+	cConn.Close()
+	for idle := false; !idle; {
+		select {
+		case event := <-events:
+			idle = event.Type == transportc.EVENT_PC_IDLE
+		case <-ctx.Done():
+			t.Fatal("PeerConnection not closed once idle")
+		}
+	}
+
+	// and a new one is negotiated by the next Dial
+	cConn, err = dialer.DialContext(ctx, "RANDOM_LABEL_2")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+	if cConn.(*transportc.Conn).HandshakeInfo().Reused {
+		t.Fatal("Conn dialed on the idle PeerConnection, expected a new one")
+	}
+}
+
+// blackholePacketConn drops every packet once blackholed, as a peer gone
+// without closing would.
+type blackholePacketConn struct {
+	net.PacketConn
+	blackholed atomic.Bool
+}
+
+func (c *blackholePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil || !c.blackholed.Load() {
+			return n, addr, err
+		}
+	}
+}
+
+func (c *blackholePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.blackholed.Load() {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// Positive Test for Config.ICETimeouts detecting a dead peer within seconds
+func TestDialerICETimeouts(t *testing.T) {
+	packetConn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blackhole := &blackholePacketConn{PacketConn: packetConn}
+	udpMux := webrtc.NewICEUDPMux(nil, blackhole)
+	defer udpMux.Close() // skipcq: GO-S2307
+
+	signal := transportc.NewDebugSignal(8)
+	listenerConfig := &transportc.Config{
+		Signal: signal,
+		UDPMux: udpMux,
+	}
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{
+		Signal: signal,
+		ICETimeouts: &transportc.ICETimeouts{
+			Disconnected: 500 * time.Millisecond,
+			Failed:       500 * time.Millisecond,
+			KeepAlive:    100 * time.Millisecond,
+		},
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	// the PeerConnection is closed once disconnected, ending the Conn well
+	// before the 5 seconds taken to disconnect by default
+	blackhole.blackholed.Store(true)
+	cConn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := cConn.Read(make([]byte, 16)); err != io.EOF {
+		t.Fatalf("Read returned %v once the peer is gone, expected io.EOF", err)
+	}
+}
+
+// Negative Test for Config.ICETimeouts with keepalives sent too late
+func TestNewDialerInvalidICETimeouts(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+		ICETimeouts: &transportc.ICETimeouts{
+			Disconnected: time.Second,
+			KeepAlive:    2 * time.Second,
+		},
+	}
+
+	_, err := config.NewDialer()
+	if err != transportc.ErrInvalidICETimeouts {
+		t.Fatalf("NewDialer returned %v, expected ErrInvalidICETimeouts", err)
+	}
+}
+
+// stallingSignal withholds the answer to the first offer until released, so
+// the Dial of that offer is stuck in the negotiation meanwhile.
+type stallingSignal struct {
+	*transportc.DebugSignal
+	stalled  chan struct{} // closed once the first offer is submitted
+	released chan struct{}
+
+	once      sync.Once
+	stalledID uint64
+}
+
+func (s *stallingSignal) Offer(offer []byte) (uint64, error) {
+	offerID, err := s.DebugSignal.Offer(offer)
+	if err == nil {
+		s.once.Do(func() {
+			s.stalledID = offerID
+			close(s.stalled)
+		})
+	}
+	return offerID, err
+}
+
+func (s *stallingSignal) ReadAnswer(offerID uint64) ([]byte, error) {
+	select {
+	case <-s.stalled:
+		if offerID == s.stalledID {
+			select {
+			case <-s.released:
+			default:
+				return nil, transportc.ErrAnswerNotReady
+			}
+		}
+	default:
+	}
+	return s.DebugSignal.ReadAnswer(offerID)
+}
+
+// Positive Test for Dialer.DialContext not blocked by another Dial stuck in
+// the negotiation of its PeerConnection
+func TestDialContextConcurrentNegotiation(t *testing.T) {
+	signal := &stallingSignal{
+		DebugSignal: transportc.NewDebugSignal(8),
+		stalled:     make(chan struct{}),
+		released:    make(chan struct{}),
+	}
+	config := &transportc.Config{
+		Signal: signal,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	stalledErr := make(chan error, 1)
+	go func() {
+		conn, err := dialer.DialContext(ctx, "STALLED_LABEL")
+		if err == nil {
+			conn.Close()
+		}
+		stalledErr <- err
+	}()
+
+	select {
+	case <-signal.stalled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first offer not submitted")
+	}
+
+	dialCtx, dialCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer dialCancel()
+	conn, err := dialer.DialContext(dialCtx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext blocked by the stalled Dial: %v", err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	select {
+	case err := <-stalledErr:
+		t.Fatalf("stalled DialContext returned before its answer: %v", err)
+	default:
+	}
+
+	close(signal.released)
+	if err := <-stalledErr; err != nil {
+		t.Fatalf("stalled DialContext error once answered: %v", err)
+	}
+}
+
+// Positive Test for concurrent Dialer.DialContext calls sharing the
+// PeerConnection negotiated by the first one
+func TestDialContextConcurrentReuse(t *testing.T) {
+	config := &transportc.Config{
+		Signal:              transportc.NewDebugSignal(8),
+		ReusePeerConnection: true,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+	events := dialer.Events()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	const dials = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, dials)
+	for i := 0; i < dials; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := dialer.DialContext(ctx, fmt.Sprintf("RANDOM_LABEL_%d", i))
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer conn.Close() // skipcq: GO-S2307
+
+			msg := []byte(fmt.Sprintf("hello %d", i))
+			if _, err := conn.Write(msg); err != nil {
+				errs <- err
+				return
+			}
+			lconn, err := listener.Accept()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer lconn.Close() // skipcq: GO-S2307
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent DialContext error: %v", err)
+	}
+
+	nextEvent(t, events, transportc.EVENT_PC_CREATED)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == transportc.EVENT_PC_CREATED {
+				t.Fatal("concurrent DialContext calls created more than one PeerConnection")
+			}
+		default:
+			return
+		}
+	}
+}
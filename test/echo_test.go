@@ -0,0 +1,58 @@
+package transportc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestPing(t *testing.T) {
+	config := &transportc.Config{
+		Signal:              transportc.NewDebugSignal(8),
+		ReusePeerConnection: true,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- listener.ServeEcho()
+	}()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	for i := 0; i < 3; i++ {
+		rtt, err := dialer.Ping(ctx)
+		if err != nil {
+			t.Fatalf("Ping #%d error: %v", i, err)
+		}
+		if rtt <= 0 || rtt > time.Second {
+			t.Fatalf("Ping #%d returned unexpected RTT %v", i, rtt)
+		}
+	}
+
+	listener.Close()
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Fatal("ServeEcho returned nil after the Listener is closed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeEcho not returned after the Listener is closed")
+	}
+}
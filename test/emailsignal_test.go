@@ -0,0 +1,139 @@
+package transportc_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/emailsignal"
+)
+
+// fakeMail delivers the emails sent to the mailbox of their recipient, and
+// is both the Sender and the Mailbox of all the addresses.
+type fakeMail struct {
+	mutex     sync.Mutex
+	mailboxes map[string][]emailsignal.Email
+	sent      int
+}
+
+func (m *fakeMail) Send(_ context.Context, email emailsignal.Email) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.mailboxes[email.To] = append(m.mailboxes[email.To], email)
+	m.sent++
+	return nil
+}
+
+// mailbox returns the Mailbox of address.
+func (m *fakeMail) mailbox(address string) emailsignal.Mailbox {
+	return fakeMailbox{mail: m, address: address}
+}
+
+type fakeMailbox struct {
+	mail    *fakeMail
+	address string
+}
+
+func (mb fakeMailbox) Receive(_ context.Context, subjectPrefix string) ([]emailsignal.Email, error) {
+	mb.mail.mutex.Lock()
+	defer mb.mail.mutex.Unlock()
+
+	var emails, kept []emailsignal.Email
+	for _, email := range mb.mail.mailboxes[mb.address] {
+		if strings.HasPrefix(email.Subject, subjectPrefix) {
+			emails = append(emails, email)
+		} else {
+			kept = append(kept, email)
+		}
+	}
+	mb.mail.mailboxes[mb.address] = kept
+	return emails, nil
+}
+
+func TestEmailSignal(t *testing.T) {
+	mail := &fakeMail{mailboxes: make(map[string][]emailsignal.Email)}
+
+	listenerSignal, err := emailsignal.NewSignal(&emailsignal.Config{
+		Address:      "listener@example.com",
+		Sender:       mail,
+		Mailbox:      mail.mailbox("listener@example.com"),
+		ChunkSize:    256,
+		PollInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialerSignal, err := emailsignal.NewSignal(&emailsignal.Config{
+		Address:      "dialer@example.com",
+		PeerAddress:  "listener@example.com",
+		Sender:       mail,
+		Mailbox:      mail.mailbox("dialer@example.com"),
+		ChunkSize:    256,
+		PollInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := listenerSignal.Offer([]byte("offer")); err != transportc.ErrSignalDirection {
+		t.Fatalf("Offer without PeerAddress returned %v, expected ErrSignalDirection", err)
+	}
+
+	// offers are chunked and reassembled
+	offer := []byte(strings.Repeat("offer", 100))
+	offerID, err := dialerSignal.Offer(offer)
+	if err != nil {
+		t.Fatalf("Error making offer: %v", err)
+	}
+	if mail.sent != 3 {
+		t.Fatalf("Offer of %d bytes sent %d emails, expected 3", len(offer), mail.sent)
+	}
+	oid, offerOutput, err := listenerSignal.ReadOffer()
+	if err != nil || oid != offerID || string(offerOutput) != string(offer) {
+		t.Fatalf("ReadOffer returned %d, %q, %v", oid, offerOutput, err)
+	}
+
+	if err := listenerSignal.Answer(offerID, []byte("answer")); err != nil {
+		t.Fatalf("Error answering: %v", err)
+	}
+	if err := listenerSignal.Answer(offerID, []byte("answer")); err != transportc.ErrInvalidOfferID {
+		t.Fatalf("Answer of an answered offer returned %v, expected ErrInvalidOfferID", err)
+	}
+	time.Sleep(50 * time.Millisecond) // the dialer polls at most every PollInterval
+	if answerOutput, err := dialerSignal.ReadAnswer(offerID); err != nil || string(answerOutput) != "answer" {
+		t.Fatalf("ReadAnswer returned %q, %v", answerOutput, err)
+	}
+
+	// Dialer and Listener signal by email
+	listener, err := (&transportc.Config{Signal: listenerSignal}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: dialerSignal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+}
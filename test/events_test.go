@@ -0,0 +1,121 @@
+package transportc_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// nextEvent returns the next event of eventType, skipping the others.
+func nextEvent(t *testing.T, events <-chan transportc.TransportEvent, eventType transportc.TransportEventType) transportc.TransportEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("%s not emitted", eventType)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listenerEvents := listener.Events()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+	dialerEvents := dialer.Events()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	peerID := sConn.(*transportc.Conn).PeerID()
+
+	offerReceived := nextEvent(t, listenerEvents, transportc.EVENT_OFFER_RECEIVED)
+	pcCreated := nextEvent(t, listenerEvents, transportc.EVENT_PC_CREATED)
+	if pcCreated.PeerID != peerID || pcCreated.OfferID != offerReceived.OfferID {
+		t.Fatalf("PCCreated has PeerID %d and OfferID %d, expected %d and %d", pcCreated.PeerID, pcCreated.OfferID, peerID, offerReceived.OfferID)
+	}
+	if dcOpened := nextEvent(t, listenerEvents, transportc.EVENT_DC_OPENED); dcOpened.PeerID != peerID || dcOpened.Label != "RANDOM_LABEL" {
+		t.Fatalf("unexpected DCOpened: %+v", dcOpened)
+	}
+
+	nextEvent(t, dialerEvents, transportc.EVENT_PC_CREATED)
+	if dcOpened := nextEvent(t, dialerEvents, transportc.EVENT_DC_OPENED); dcOpened.Label != "RANDOM_LABEL" || dcOpened.Time.IsZero() {
+		t.Fatalf("unexpected DCOpened: %+v", dcOpened)
+	}
+
+	cConn.Close()
+	sConn.Close()
+	nextEvent(t, dialerEvents, transportc.EVENT_CONN_CLOSED)
+	if connClosed := nextEvent(t, listenerEvents, transportc.EVENT_CONN_CLOSED); connClosed.PeerID != peerID {
+		t.Fatalf("unexpected ConnClosed: %+v", connClosed)
+	}
+}
+
+func TestListenerAcceptError(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	allowedPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	listener, err := (&transportc.Config{
+		Signal:       signal,
+		AllowedPeers: []ed25519.PublicKey{allowedPub},
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listenerEvents := listener.Events()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	if _, err := dialer.DialContext(ctx, "RANDOM_LABEL"); err == nil {
+		t.Fatal("DialContext succeeded without the identity required by the Listener")
+	}
+
+	// the unsigned offer is reported instead of silently discarded
+	event := nextEvent(t, listenerEvents, transportc.EVENT_ACCEPT_FAILED)
+	var acceptErr *transportc.AcceptError
+	if !errors.As(event.Err, &acceptErr) {
+		t.Fatalf("EVENT_ACCEPT_FAILED with %v, expected an AcceptError", event.Err)
+	}
+	if acceptErr.OfferID == 0 || acceptErr.OfferID != event.OfferID || acceptErr.Stage != transportc.ACCEPT_STAGE_OFFER || !errors.Is(acceptErr, transportc.ErrMissingIdentity) {
+		t.Fatalf("AcceptError %+v, expected ErrMissingIdentity at ACCEPT_STAGE_OFFER for offer #%d", acceptErr, event.OfferID)
+	}
+}
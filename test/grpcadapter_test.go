@@ -0,0 +1,90 @@
+package transportc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/grpcadapter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCAdapter(t *testing.T) {
+	config := &transportc.Config{
+		Signal:  transportc.NewDebugSignal(8),
+		Timeout: 30 * time.Second,
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Start()
+
+	server := grpc.NewServer(grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+		MinTime:             10 * time.Second,
+		PermitWithoutStream: true,
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(grpcadapter.Listener(listener))
+	defer server.Stop()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	client, err := grpc.Dial("transportc",
+		grpcadapter.DialOption(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		t.Fatalf("grpc.Dial error: %v", err)
+	}
+	defer client.Close()
+
+	healthClient := healthpb.NewHealthClient(client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	resp, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Check returned %s, expected SERVING", resp.Status)
+	}
+
+	// A call exceeding its deadline must not break the connection
+	ctxShort, cancelShort := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancelShort()
+
+	watch, err := healthClient.Watch(ctxShort, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch error: %v", err)
+	}
+	for err == nil {
+		_, err = watch.Recv()
+	}
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Watch should end with DeadlineExceeded, got %v", err)
+	}
+
+	if _, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check error after deadline exceeded: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package transportc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestConnHalves(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	conn := sConn.(*transportc.Conn)
+	reader, writer := conn.Reader(), conn.Writer()
+
+	// the deadline of the read half doesn't affect the write half
+	reader.SetReadDeadline(time.Now().Add(-time.Second))
+	buf := make([]byte, 16)
+	if _, err := reader.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read returned %v, expected os.ErrDeadlineExceeded", err)
+	}
+	if _, err := writer.Write([]byte("Hello")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if n, err := cConn.Read(buf); err != nil || string(buf[:n]) != "Hello" {
+		t.Fatalf("Read returned %q, %v", buf[:n], err)
+	}
+
+	// closing the read half unblocks a pending Read, but doesn't close the Conn
+	reader.SetReadDeadline(time.Time{})
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := reader.Read(buf)
+		readErr <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	reader.Close()
+	select {
+	case err := <-readErr:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("pending Read returned %v, expected net.ErrClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending Read not unblocked by closing the read half")
+	}
+	if _, err := writer.Write([]byte("World")); err != nil {
+		t.Fatalf("Write error after closing the read half: %v", err)
+	}
+
+	// closing both halves closes the Conn
+	writer.Close()
+	if _, err := writer.Write([]byte("Hello")); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Write returned %v, expected net.ErrClosed", err)
+	}
+	select {
+	case <-conn.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Conn not closed after closing both halves")
+	}
+}
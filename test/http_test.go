@@ -0,0 +1,63 @@
+package transportc_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestServeHTTP(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	go transportc.ServeHTTP(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s HTTP/%d", r.Method, r.Host, r.ProtoMajor)
+	}))
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	for _, tc := range []struct {
+		name      string
+		transport http.RoundTripper
+		expected  string
+	}{
+		{"HTTP/1.1", dialer.HTTPTransport(), "GET example.com HTTP/1"},
+		{"h2c", dialer.H2CTransport(), "GET example.com HTTP/2"},
+	} {
+		client := &http.Client{
+			Transport: tc.transport,
+			Timeout:   10 * time.Second,
+		}
+
+		resp, err := client.Get("http://example.com/")
+		if err != nil {
+			t.Fatalf("%s: Get error: %v", tc.name, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: ReadAll error: %v", tc.name, err)
+		}
+		if string(body) != tc.expected {
+			t.Fatalf("%s: unexpected response %q, expected %q", tc.name, body, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package transportc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// dialHTTPSignal dials a Listener answering offers via handler with a Dialer
+// sending them via signal.
+func dialHTTPSignal(t *testing.T, handler *transportc.HTTPSignalHandler, signal *transportc.HTTPSignal) {
+	listener, err := (&transportc.Config{Signal: handler}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+	defer signal.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+}
+
+func TestHTTPSignal(t *testing.T) {
+	handler := transportc.NewHTTPSignalHandler()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	signal, err := transportc.NewHTTPSignal(server.URL + "/offer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialHTTPSignal(t, handler, signal)
+}
+
+// Positive Test for HTTPSignal via a domain-fronted AMP cache
+func TestHTTPSignalAMPCache(t *testing.T) {
+	handler := transportc.NewHTTPSignalHandler()
+
+	// the AMP cache relays the GET to the broker, addressed by the Host header
+	// only, as the request is fronted
+	cache := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "broker-example-com.cache.example" || !strings.HasPrefix(r.URL.Path, "/c/s/broker.example.com/amp/") {
+			t.Errorf("AMP cache received a request for %s%s", r.Host, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer cache.Close()
+
+	signal, err := transportc.NewHTTPSignal("https://broker.example.com/amp/",
+		transportc.WithAMPCache("https://cache.example/"),
+		transportc.WithDomainFront(strings.TrimPrefix(cache.URL, "https://")),
+		transportc.WithHTTPClient(cache.Client()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialHTTPSignal(t, handler, signal)
+}
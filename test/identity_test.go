@@ -0,0 +1,311 @@
+package transportc_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestIdentityAllowedPeers(t *testing.T) {
+	dialerPub, dialerKey, _ := ed25519.GenerateKey(rand.Reader)
+	listenerPub, listenerKey, _ := ed25519.GenerateKey(rand.Reader)
+	signal := transportc.NewDebugSignal(8)
+
+	listenerConfig := &transportc.Config{
+		Signal:       signal,
+		IdentityKey:  listenerKey,
+		AllowedPeers: []ed25519.PublicKey{dialerPub},
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{
+		Signal:       signal,
+		IdentityKey:  dialerKey,
+		AllowedPeers: []ed25519.PublicKey{listenerPub},
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	if !cConn.(*transportc.Conn).PeerIdentity().Equal(listenerPub) {
+		t.Fatal("Dialed Conn has unexpected PeerIdentity")
+	}
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	if !sConn.(*transportc.Conn).PeerIdentity().Equal(dialerPub) {
+		t.Fatal("Accepted Conn has unexpected PeerIdentity")
+	}
+}
+
+// Negative Test for a Dialer with an identity not allowed by the Listener
+func TestIdentityUnauthorizedPeer(t *testing.T) {
+	allowedPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, dialerKey, _ := ed25519.GenerateKey(rand.Reader)
+	signal := transportc.NewDebugSignal(8)
+
+	listenerConfig := &transportc.Config{
+		Signal:       signal,
+		AllowedPeers: []ed25519.PublicKey{allowedPub},
+	}
+
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{
+		Signal:      signal,
+		IdentityKey: dialerKey,
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if conn != nil {
+		conn.Close()
+	}
+	if err == nil {
+		t.Fatal("DialContext should fail as the identity is not allowed")
+	}
+}
+
+// capturingSignal records the offers read by the Listener, so they can be
+// replayed.
+type capturingSignal struct {
+	*transportc.DebugSignal
+	offers chan []byte
+}
+
+func (s *capturingSignal) ReadOffer() (uint64, []byte, error) {
+	offerID, offer, err := s.DebugSignal.ReadOffer()
+	if err == nil {
+		select {
+		case s.offers <- offer:
+		default:
+		}
+	}
+	return offerID, offer, err
+}
+
+// Negative Test for Config.SignedOfferTTL with a signed offer replayed once
+// expired
+func TestIdentitySignedOfferReplay(t *testing.T) {
+	_, dialerKey, _ := ed25519.GenerateKey(rand.Reader)
+	signal := &capturingSignal{
+		DebugSignal: transportc.NewDebugSignal(8),
+		offers:      make(chan []byte, 1),
+	}
+
+	listenerConfig := &transportc.Config{
+		Signal:               signal,
+		SignedOfferTTL:       time.Second,
+		SignedOfferClockSkew: time.Millisecond,
+	}
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listenerEvents := listener.Events()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{
+		Signal:         signal,
+		IdentityKey:    dialerKey,
+		SignedOfferTTL: time.Second,
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	// replay the offer captured on the signaling path once expired
+	offer := <-signal.offers
+	time.Sleep(2100 * time.Millisecond)
+	if _, err := signal.DebugSignal.Offer(offer); err != nil {
+		t.Fatalf("Offer error: %v", err)
+	}
+
+	event := nextEvent(t, listenerEvents, transportc.EVENT_ACCEPT_FAILED)
+	if !errors.Is(event.Err, transportc.ErrOfferExpired) {
+		t.Fatalf("Replayed offer failed with %v, expected ErrOfferExpired", event.Err)
+	}
+}
+
+// Negative Test for Config.SignedOfferTTL on the Listener with signed offers
+// without expiry
+func TestIdentitySignedOfferWithoutExpiry(t *testing.T) {
+	_, dialerKey, _ := ed25519.GenerateKey(rand.Reader)
+	signal := transportc.NewDebugSignal(8)
+
+	listenerConfig := &transportc.Config{
+		Signal:         signal,
+		SignedOfferTTL: time.Minute,
+	}
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listenerEvents := listener.Events()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{
+		Signal:      signal,
+		IdentityKey: dialerKey,
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if conn != nil {
+		conn.Close()
+	}
+	if err == nil {
+		t.Fatal("DialContext should fail as the offer has no expiry")
+	}
+
+	event := nextEvent(t, listenerEvents, transportc.EVENT_ACCEPT_FAILED)
+	if !errors.Is(event.Err, transportc.ErrMissingOfferExpiry) {
+		t.Fatalf("Offer failed with %v, expected ErrMissingOfferExpiry", event.Err)
+	}
+}
+
+// tamperingSignal rewrites a field of the offers on the signaling path.
+type tamperingSignal struct {
+	*transportc.DebugSignal
+	field string
+	value any
+}
+
+func (s *tamperingSignal) ReadOffer() (uint64, []byte, error) {
+	offerID, offer, err := s.DebugSignal.ReadOffer()
+	if err != nil {
+		return offerID, offer, err
+	}
+
+	var envelope map[string]any
+	if err := json.Unmarshal(offer, &envelope); err != nil {
+		return offerID, offer, err
+	}
+	envelope[s.field] = s.value
+	offer, err = json.Marshal(envelope)
+	return offerID, offer, err
+}
+
+// Negative Test for a signed offer with any field rewritten on the signaling
+// path
+func TestIdentityTamperedOffer(t *testing.T) {
+	_, dialerKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	for field, value := range map[string]any{
+		"ns":      "other",
+		"restart": 1,
+		"nonce":   1,
+		"trace":   map[string]string{"traceparent": "forged"},
+		"label":   "other",
+		"proto":   "other",
+		"meta":    map[string]string{"role": "admin"},
+		"tkt":     "forged",
+		"v":       1, // downgraded not to sign the fields above
+	} {
+		t.Run(field, func(t *testing.T) {
+			signal := &tamperingSignal{
+				DebugSignal: transportc.NewDebugSignal(8),
+				field:       field,
+				value:       value,
+			}
+
+			listenerConfig := &transportc.Config{
+				Signal: signal,
+			}
+			listener, err := listenerConfig.NewListener()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			listenerEvents := listener.Events()
+			listener.Start()
+
+			dialerConfig := &transportc.Config{
+				Signal:      signal,
+				IdentityKey: dialerKey,
+			}
+			dialer, err := dialerConfig.NewDialer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dialer.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel() // cancel the context to make sure it is done
+
+			go func() {
+				conn, err := dialer.DialContext(ctx, "RANDOM_LABEL", transportc.WithOfferMetadata(map[string]string{"role": "user"}))
+				if err == nil {
+					conn.Close()
+				}
+			}()
+
+			event := nextEvent(t, listenerEvents, transportc.EVENT_ACCEPT_FAILED)
+			if !errors.Is(event.Err, transportc.ErrInvalidIdentity) {
+				t.Fatalf("Offer with %s rewritten failed with %v, expected ErrInvalidIdentity", field, event.Err)
+			}
+		})
+	}
+}
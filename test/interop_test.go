@@ -0,0 +1,320 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/pion/webrtc/v3"
+)
+
+// browserProfile rewrites an SDP generated by pion into the shape generated by
+// a browser, as seen on the wire. The ICE credentials, fingerprint and
+// candidates are kept, so the rewritten SDP still negotiates with the pion
+// PeerConnection which generated it.
+type browserProfile struct {
+	name           string
+	origin         string   // o= line
+	sessionAttrs   []string // appended after t=
+	maxMessageSize string   // a=max-message-size value, "" to strip
+}
+
+var browserProfiles = []browserProfile{
+	{
+		name:           "chrome",
+		origin:         "o=- 4611731400430051336 2 IN IP4 127.0.0.1",
+		sessionAttrs:   []string{"a=extmap-allow-mixed", "a=msid-semantic: WMS"},
+		maxMessageSize: "262144",
+	},
+	{
+		name:           "firefox",
+		origin:         "o=mozilla...THIS_IS_SDPARTA-99.0 4327637917391235346 0 IN IP4 0.0.0.0",
+		sessionAttrs:   []string{"a=sendrecv", "a=ice-options:trickle", "a=msid-semantic:WMS *"},
+		maxMessageSize: "1073741823",
+	},
+	{
+		name:           "safari",
+		origin:         "o=- 1937412376521087123 2 IN IP4 127.0.0.1",
+		sessionAttrs:   []string{"a=msid-semantic: WMS"},
+		maxMessageSize: "65536",
+	},
+	{
+		name:   "no max-message-size", // RFC 8841 default of 64 KiB
+		origin: "o=- 0 0 IN IP4 127.0.0.1",
+	},
+	{
+		name:           "zero max-message-size", // RFC 8841 "no limit"
+		origin:         "o=- 0 0 IN IP4 127.0.0.1",
+		maxMessageSize: "0",
+	},
+}
+
+func (p browserProfile) rewrite(desc *webrtc.SessionDescription) ([]byte, error) {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(desc.SDP, "\r\n"), "\r\n") {
+		switch {
+		case strings.HasPrefix(line, "o="):
+			line = p.origin
+		case strings.HasPrefix(line, "a=max-message-size:"):
+			continue // re-added below if set
+		case strings.HasPrefix(line, "a=msid-semantic"), strings.HasPrefix(line, "a=extmap-allow-mixed"):
+			continue
+		}
+		lines = append(lines, line)
+		if strings.HasPrefix(line, "t=") {
+			lines = append(lines, p.sessionAttrs...)
+		}
+		if strings.HasPrefix(line, "a=sctp-port:") && p.maxMessageSize != "" {
+			lines = append(lines, "a=max-message-size:"+p.maxMessageSize)
+		}
+	}
+
+	data, err := json.Marshal(webrtc.SessionDescription{
+		Type: desc.Type,
+		SDP:  strings.Join(lines, "\r\n") + "\r\n",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := transportc.ParseSessionDescription(data, desc.Type); err != nil {
+		return nil, fmt.Errorf("%s: rewritten SDP rejected: %w", p.name, err)
+	}
+	return data, nil
+}
+
+// newBrowserPeer creates a PeerConnection playing the browser.
+func newBrowserPeer(t *testing.T) *webrtc.PeerConnection {
+	t.Helper()
+
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peerConnection.Close() })
+	return peerConnection
+}
+
+// setLocalAndGather sets the local SessionDescription and waits for all
+// candidates to be gathered, as browsers do without trickle ICE.
+func setLocalAndGather(t *testing.T, peerConnection *webrtc.PeerConnection, desc webrtc.SessionDescription) *webrtc.SessionDescription {
+	t.Helper()
+
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(desc); err != nil {
+		t.Fatal(err)
+	}
+	<-gatherComplete
+	return peerConnection.LocalDescription()
+}
+
+// echoBrowserDataChannel echoes every message received on the DataChannels
+// opened by the remote peer, preserving the string/binary type.
+func echoBrowserDataChannel(peerConnection *webrtc.PeerConnection) {
+	peerConnection.OnDataChannel(func(d *webrtc.DataChannel) {
+		d.OnMessage(func(msg webrtc.DataChannelMessage) {
+			if msg.IsString {
+				d.SendText(string(msg.Data))
+			} else {
+				d.Send(msg.Data)
+			}
+		})
+	})
+}
+
+// TestInteropBrowserOffer has a Listener answer offers shaped as generated by
+// browsers, for DataChannels created with various channel parameters.
+func TestInteropBrowserOffer(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	config := &transportc.Config{
+		Signal: signal,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	// unreliable DataChannels are accepted as DatagramConns, not covered here
+	channelInits := map[string]*webrtc.DataChannelInit{
+		"default":   nil,
+		"unordered": {Ordered: new(bool)},
+		"protocol":  {Protocol: func() *string { s := "chat"; return &s }()},
+	}
+
+	for _, profile := range browserProfiles {
+		for initName, init := range channelInits {
+			t.Run(fmt.Sprintf("%s/%s", profile.name, initName), func(t *testing.T) {
+				browser := newBrowserPeer(t)
+
+				dataChannel, err := browser.CreateDataChannel("BROWSER_"+initName, init)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opened := make(chan struct{})
+				received := make(chan webrtc.DataChannelMessage, 1)
+				dataChannel.OnOpen(func() { close(opened) })
+				dataChannel.OnMessage(func(msg webrtc.DataChannelMessage) { received <- msg })
+
+				offer, err := browser.CreateOffer(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				offerBytes, err := profile.rewrite(setLocalAndGather(t, browser, offer))
+				if err != nil {
+					t.Fatal(err)
+				}
+				offerID, err := signal.Offer(offerBytes)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				answerBytes, err := signal.ReadAnswer(offerID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				answer, err := transportc.ParseSessionDescription(answerBytes, webrtc.SDPTypeAnswer)
+				if err != nil {
+					t.Fatalf("Listener answered with an invalid SDP: %v", err)
+				}
+				if !strings.Contains(answer.SDP, "m=application") || strings.Contains(answer.SDP, "a=setup:actpass") {
+					t.Fatalf("Listener answered with an unexpected SDP:\n%s", answer.SDP)
+				}
+				if err := browser.SetRemoteDescription(answer); err != nil {
+					t.Fatalf("browser rejected the answer: %v", err)
+				}
+
+				sConn, err := listener.Accept()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer sConn.Close() // skipcq: GO-S2307
+
+				conn := sConn.(*transportc.Conn)
+				if conn.Label() != dataChannel.Label() || conn.Protocol() != dataChannel.Protocol() {
+					t.Fatalf("Accepted %q/%q, expected %q/%q", conn.Label(), conn.Protocol(), dataChannel.Label(), dataChannel.Protocol())
+				}
+
+				select {
+				case <-opened:
+				case <-time.After(10 * time.Second):
+					t.Fatal("DataChannel not opened")
+				}
+
+				if err := dataChannel.SendText("hello from " + profile.name); err != nil {
+					t.Fatal(err)
+				}
+				buf := make([]byte, 1024)
+				sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, isString, err := conn.ReadMessage(buf)
+				if err != nil {
+					t.Fatalf("ReadMessage error: %v", err)
+				}
+				if !isString || string(buf[:n]) != "hello from "+profile.name {
+					t.Fatalf("ReadMessage returned %q (string: %v)", buf[:n], isString)
+				}
+
+				msg := bytes.Repeat([]byte{0x5a}, 16*1024)
+				if _, err := sConn.Write(msg); err != nil {
+					t.Fatalf("Write error: %v", err)
+				}
+				select {
+				case recv := <-received:
+					if recv.IsString || !bytes.Equal(recv.Data, msg) {
+						t.Fatal("browser received wrong message")
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("browser received no message")
+				}
+			})
+		}
+	}
+}
+
+// TestInteropBrowserAnswer has a Dialer dial into a peer answering with SDP
+// shaped as generated by browsers.
+func TestInteropBrowserAnswer(t *testing.T) {
+	for _, profile := range browserProfiles {
+		t.Run(profile.name, func(t *testing.T) {
+			signal := transportc.NewDebugSignal(8)
+			config := &transportc.Config{
+				Signal: signal,
+			}
+
+			dialer, err := config.NewDialer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dialer.Close()
+
+			browser := newBrowserPeer(t)
+			echoBrowserDataChannel(browser)
+
+			go func() {
+				var offerID uint64
+				var offerBytes []byte
+				var err error
+				for offerID, offerBytes, err = signal.ReadOffer(); err != nil; offerID, offerBytes, err = signal.ReadOffer() {
+					time.Sleep(10 * time.Millisecond)
+				}
+
+				offer, err := transportc.ParseSessionDescription(offerBytes, webrtc.SDPTypeOffer)
+				if err != nil {
+					t.Errorf("Dialer offered an invalid SDP: %v", err)
+					return
+				}
+				if err := browser.SetRemoteDescription(offer); err != nil {
+					t.Errorf("browser rejected the offer: %v", err)
+					return
+				}
+				answer, err := browser.CreateAnswer(nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				gatherComplete := webrtc.GatheringCompletePromise(browser)
+				if err := browser.SetLocalDescription(answer); err != nil {
+					t.Error(err)
+					return
+				}
+				<-gatherComplete
+
+				answerBytes, err := profile.rewrite(browser.LocalDescription())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				signal.Answer(offerID, answerBytes)
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cConn, err := dialer.DialContext(ctx, "DIALER_LABEL")
+			if err != nil {
+				t.Fatalf("DialContext error: %v", err)
+			}
+			defer cConn.Close() // skipcq: GO-S2307
+
+			msg := []byte("hello " + profile.name)
+			if _, err := cConn.Write(msg); err != nil {
+				t.Fatalf("Write error: %v", err)
+			}
+			buf := make([]byte, 1024)
+			cConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, err := cConn.Read(buf)
+			if err != nil {
+				t.Fatalf("Read error: %v", err)
+			}
+			if !bytes.Equal(buf[:n], msg) {
+				t.Fatalf("Read returned %q, expected %q", buf[:n], msg)
+			}
+		})
+	}
+}
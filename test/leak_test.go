@@ -0,0 +1,92 @@
+package transportc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/internal/leakcheck"
+)
+
+// connLifecycle dials a Conn, echoes a message over it and closes both ends.
+func connLifecycle(t *testing.T, dialer *transportc.Dialer, listener *transportc.Listener) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	var sConn net.Conn
+	select {
+	case sConn = <-accepted:
+	case <-ctx.Done():
+		t.Fatal("Accept timed out")
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	if _, err := cConn.Write([]byte("Hello")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, 64)
+	sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := sConn.Read(buf); err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+}
+
+// Regression test: the lifecycle of a Conn, from Dial to Close on both ends,
+// leaks no goroutine nor file descriptor, whether its PeerConnection is
+// dedicated or shared, and neither does closing the Dialer and Listener.
+func TestConnLifecycleLeak(t *testing.T) {
+	for _, reuse := range []bool{false, true} {
+		reuse := reuse
+		t.Run(map[bool]string{false: "Dedicated", true: "Reused"}[reuse], func(t *testing.T) {
+			before := leakcheck.Take()
+
+			config := &transportc.Config{
+				Signal:              transportc.NewDebugSignal(8),
+				ReusePeerConnection: reuse,
+			}
+			listener, err := config.NewListener()
+			if err != nil {
+				t.Fatal(err)
+			}
+			listener.Start()
+			dialer, err := config.NewDialer()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			connLifecycle(t, dialer, listener) // starts what lives as long as the Dialer and Listener
+			baseline := leakcheck.Take()
+			for i := 0; i < 20; i++ {
+				connLifecycle(t, dialer, listener)
+			}
+			if s, err := leakcheck.WaitSettled(baseline, 0, 30*time.Second); err != nil {
+				t.Fatalf("after 20 Conns: %v\n%s", err, leakcheck.Stacks())
+			} else {
+				t.Logf("after 20 Conns: %s, baseline %s", s, baseline)
+			}
+
+			dialer.Close()
+			listener.Close()
+			if s, err := leakcheck.WaitSettled(before, 0, 30*time.Second); err != nil {
+				t.Fatalf("after Close: %v\n%s", err, leakcheck.Stacks())
+			} else {
+				t.Logf("after Close: %s, before %s", s, before)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestDialerPauseResume(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	listenerConfig := &transportc.Config{
+		Signal:                 signal,
+		ListenerRestartTimeout: 10 * time.Second,
+	}
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+	listenerEvents := listener.Events()
+
+	// a short idle timeout, which a paused Conn must survive
+	dialerConfig := &transportc.Config{
+		Signal:  signal,
+		Timeout: 200 * time.Millisecond,
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+	dialerEvents := dialer.Events()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	dialer.Pause()
+	time.Sleep(time.Second) // idle for several timeouts
+	select {
+	case <-cConn.(*transportc.Conn).Done():
+		t.Fatal("paused Conn closed for being idle")
+	default:
+	}
+
+	if err := dialer.Resume(ctx); err != nil {
+		t.Fatalf("Resume error: %v", err)
+	}
+	nextEvent(t, dialerEvents, transportc.EVENT_ICE_RESTARTED)
+	nextEvent(t, listenerEvents, transportc.EVENT_ICE_RESTARTED)
+
+	// the Conns survive the ICE restart
+	msg := []byte("after resume")
+	if _, err := cConn.Write(msg); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, 1024)
+	sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := sConn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if !bytes.Equal(buf[:n], msg) {
+		t.Fatalf("Read returned %q, expected %q", buf[:n], msg)
+	}
+
+	// once resumed, the idle timeout applies again
+	select {
+	case <-cConn.(*transportc.Conn).Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("resumed Conn not closed for being idle")
+	}
+}
+
+// Negative Test for Dialer.Resume with a Listener not accepting ICE restarts
+func TestDialerResumeWithoutRestartTimeout(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	dialer.Pause()
+	resumeCtx, resumeCancel := context.WithTimeout(ctx, 2*time.Second)
+	defer resumeCancel()
+	if err := dialer.Resume(resumeCtx); err == nil {
+		t.Fatal("Resume should fail without Config.ListenerRestartTimeout")
+	}
+
+	// the PeerConnection failed to restart is replaced
+	cConn2, err := dialer.DialContext(ctx, "RANDOM_LABEL_2")
+	if err != nil {
+		t.Fatalf("DialContext after failed Resume error: %v", err)
+	}
+	cConn2.Close()
+}
@@ -2,12 +2,25 @@ package transportc_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gaukas/transportc"
+	"github.com/pion/webrtc/v3"
 )
 
 func TestAccept(t *testing.T) {
@@ -159,3 +172,1094 @@ func TestAccept(t *testing.T) {
 		}
 	}
 }
+
+func TestAcceptICELite(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	listenerConfig := &transportc.Config{
+		Signal:          signal,
+		ListenerICELite: true,
+		ListenerICECredentials: &transportc.ICECredentials{
+			UsernameFragment: "transportc",
+			Password:         "transportc-static-ice-password",
+		},
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{
+		Signal: signal,
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	_, err = cConn.Write([]byte("Hello"))
+	if err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+
+	buf := make([]byte, 16)
+	n, err := sConn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if string(buf[:n]) != "Hello" {
+		t.Fatalf("Read returned %s", string(buf[:n]))
+	}
+}
+
+func TestNewListenerInvalidICECredentials(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+		ListenerICECredentials: &transportc.ICECredentials{
+			UsernameFragment: "abc",
+			Password:         "short",
+		},
+	}
+
+	_, err := config.NewListener()
+	if err != transportc.ErrInvalidICECredentials {
+		t.Fatalf("NewListener returned %v, expected ErrInvalidICECredentials", err)
+	}
+}
+
+func TestListenerHealthz(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if health := listener.Healthz(); health.Status != "new" {
+		t.Fatalf("Healthz status is %s before Start, expected new", health.Status)
+	}
+
+	listener.Start()
+	handler := listener.HealthzHandler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("HealthzHandler returned %d for running listener", recorder.Code)
+	}
+
+	var health transportc.ListenerHealth
+	if err := json.Unmarshal(recorder.Body.Bytes(), &health); err != nil {
+		t.Fatalf("HealthzHandler returned malformed JSON: %v", err)
+	}
+	if health.Status != "running" {
+		t.Fatalf("Healthz status is %s after Start, expected running", health.Status)
+	}
+
+	listener.Close()
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("HealthzHandler returned %d for stopped listener", recorder.Code)
+	}
+}
+
+// Test that a panic while handling one peer doesn't affect other peers
+func TestListenerPanicRecovery(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	var panicked atomic.Bool
+	listenerConfig := &transportc.Config{
+		Signal: signal,
+		SDPTransformOutgoing: func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+			if panicked.CompareAndSwap(false, true) {
+				panic("malformed peer")
+			}
+			return desc, nil
+		},
+	}
+
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{
+		Signal: signal,
+	}
+
+	// First dial triggers the panic
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	if conn, err := dialer.DialContext(ctx, "RANDOM_LABEL"); err == nil {
+		conn.Close()
+		t.Fatal("DialContext should fail as the listener panicked")
+	}
+
+	health := listener.Healthz()
+	if health.RecoveredPanics != 1 {
+		t.Fatalf("Healthz reports %d recovered panics, expected 1", health.RecoveredPanics)
+	}
+	if health.ActivePeerConnections != 0 {
+		t.Fatalf("Healthz reports %d active PeerConnections, expected 0", health.ActivePeerConnections)
+	}
+
+	// Second dial should succeed
+	dialer2, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer2.Close()
+
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel2() // cancel the context to make sure it is done
+
+	cConn, err := dialer2.DialContext(ctx2, "RANDOM_LABEL_2")
+	if err != nil {
+		t.Fatalf("DialContext error after recovered panic: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error after recovered panic: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+}
+
+func TestListenerMaxDataChannels(t *testing.T) {
+	config := &transportc.Config{
+		Signal:                  transportc.NewDebugSignal(8),
+		ReusePeerConnection:     true,
+		ListenerMaxDataChannels: 2,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	// Each DataChannel on the same PeerConnection is accepted as a Conn
+	for i := 0; i < 2; i++ {
+		cConn, err := dialer.DialContext(ctx, fmt.Sprintf("RANDOM_LABEL_%d", i))
+		if err != nil {
+			t.Fatalf("DialContext #%d error: %v", i, err)
+		}
+		defer cConn.Close() // skipcq: GO-S2307
+
+		sConn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept #%d error: %v", i, err)
+		}
+		defer sConn.Close() // skipcq: GO-S2307
+
+		if health := listener.Healthz(); health.ActivePeerConnections != 1 {
+			t.Fatalf("Healthz reports %d active PeerConnections, expected 1", health.ActivePeerConnections)
+		}
+	}
+
+	// The third DataChannel exceeds the limit
+	if cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL_2"); err == nil {
+		defer cConn.Close() // skipcq: GO-S2307
+		cConn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := cConn.Read(make([]byte, 16)); err == nil {
+			t.Fatal("Read should fail as the DataChannel is rejected")
+		}
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+		t.Fatal("Listener accepted a DataChannel exceeding the limit")
+	case <-time.After(time.Second):
+	}
+
+	if err := listener.ClosePeer(0); err != transportc.ErrUnknownPeer {
+		t.Fatalf("ClosePeer returned %v, expected ErrUnknownPeer", err)
+	}
+}
+
+func TestListenerPeers(t *testing.T) {
+	config := &transportc.Config{
+		Signal:              transportc.NewDebugSignal(8),
+		ReusePeerConnection: true,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	var sConns []*transportc.Conn
+	for i := 0; i < 2; i++ {
+		cConn, err := dialer.DialContext(ctx, fmt.Sprintf("RANDOM_LABEL_%d", i))
+		if err != nil {
+			t.Fatalf("DialContext #%d error: %v", i, err)
+		}
+		defer cConn.Close() // skipcq: GO-S2307
+
+		if id := cConn.(*transportc.Conn).PeerID(); id != 0 {
+			t.Fatalf("Dialed Conn has PeerID %d, expected 0", id)
+		}
+
+		sConn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept #%d error: %v", i, err)
+		}
+		defer sConn.Close() // skipcq: GO-S2307
+		sConns = append(sConns, sConn.(*transportc.Conn))
+	}
+
+	id := sConns[0].PeerID()
+	if id == 0 || sConns[1].PeerID() != id {
+		t.Fatalf("Accepted Conns have PeerIDs %d and %d, expected the same non-zero ID", id, sConns[1].PeerID())
+	}
+
+	peers := listener.Peers()
+	if len(peers) != 1 {
+		t.Fatalf("Peers returned %d peers, expected 1", len(peers))
+	}
+	if peers[0].ID != id || peers[0].Conns != 2 || peers[0].State != webrtc.PeerConnectionStateConnected {
+		t.Fatalf("Peers returned unexpected peer: %+v", peers[0])
+	}
+
+	if err := listener.ClosePeer(id); err != nil {
+		t.Fatalf("ClosePeer error: %v", err)
+	}
+	if len(listener.Peers()) != 0 {
+		t.Fatal("Peers should be empty after ClosePeer")
+	}
+	if _, err := sConns[0].Read(make([]byte, 16)); err == nil {
+		t.Fatal("Read should fail after ClosePeer")
+	}
+}
+
+// Positive Test for Listener.ClosePeer, Peers and Close called concurrently
+// with each other and from the callbacks of the PeerConnections, which MUST
+// NOT deadlock
+func TestListenerConcurrentPeers(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	var listener *transportc.Listener
+	var closedFromCallback atomic.Int32
+	listenerConfig := &transportc.Config{
+		Signal: signal,
+		// Called from the OnOpen callback of the DataChannel
+		ConnContext: func(ctx context.Context, conn *transportc.Conn) context.Context {
+			listener.Peers()
+			if conn.Label() == "CLOSE_FROM_CALLBACK" {
+				listener.ClosePeer(conn.PeerID())
+				closedFromCallback.Add(1)
+			}
+			return ctx
+		},
+	}
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	const peers = 4
+	var wg sync.WaitGroup
+	for i := 0; i < peers; i++ {
+		dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dialer.Close()
+
+		label := "RANDOM_LABEL"
+		if i%2 == 1 {
+			label = "CLOSE_FROM_CALLBACK"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := dialer.DialContext(ctx, label)
+			if err != nil {
+				t.Errorf("DialContext error: %v", err)
+				return
+			}
+			defer conn.Close() // skipcq: GO-S2307
+
+			// until closed by the Listener, from the callback or ClosePeer
+			conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+			if _, err := conn.Read(make([]byte, 16)); errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Errorf("%s not closed by the Listener", label)
+			}
+		}()
+	}
+
+	stop := make(chan struct{})
+	var pollers sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, peer := range listener.Peers() {
+					if peer.Conns > 0 {
+						listener.ClosePeer(peer.ID)
+					}
+				}
+				listener.Healthz()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stop)
+		pollers.Wait()
+		listener.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatal("Listener deadlocked on concurrent Peers, ClosePeer and Close")
+	}
+
+	if n := closedFromCallback.Load(); n == 0 {
+		t.Fatal("no PeerConnection closed from its callback")
+	}
+	if peers := listener.Peers(); len(peers) != 0 {
+		t.Fatalf("Peers returned %d peers after Close, expected none", len(peers))
+	}
+}
+
+func TestListenerHandle(t *testing.T) {
+	config := &transportc.Config{
+		Signal:                         transportc.NewDebugSignal(8),
+		ReusePeerConnection:            true,
+		ListenerRejectUnknownProtocols: true,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	handled := make(chan net.Conn, 1)
+	listener.Handle("echo", func(conn net.Conn) {
+		handled <- conn
+	})
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL", transportc.WithProtocol("echo"))
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	select {
+	case sConn := <-handled:
+		defer sConn.Close() // skipcq: GO-S2307
+		if protocol := sConn.(*transportc.Conn).Protocol(); protocol != "echo" {
+			t.Fatalf("Handled Conn has protocol %q, expected %q", protocol, "echo")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Conn not routed to the handler")
+	}
+
+	// Unknown protocols are rejected, not surfaced via Accept
+	if conn, err := dialer.DialContext(ctx, "RANDOM_LABEL_2", transportc.WithProtocol("unknown")); err == nil {
+		defer conn.Close() // skipcq: GO-S2307
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+		t.Fatal("Listener accepted a Conn of an unknown protocol")
+	case <-time.After(time.Second):
+	}
+}
+
+func TestListenerNamespace(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	tenant := listener.Namespace("tenant", transportc.WithNamespaceMaxPeerConnections(1))
+	if listener.Namespace("tenant") != tenant {
+		t.Fatal("Namespace returned a different net.Listener for the same name")
+	}
+	listener.Start()
+
+	tenantConfig := *config
+	tenantConfig.Namespace = "tenant"
+	dialer, err := tenantConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := tenant.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	peers := listener.Peers()
+	if len(peers) != 1 || peers[0].Namespace != "tenant" {
+		t.Fatalf("Peers returned %+v, expected 1 peer in namespace %q", peers, "tenant")
+	}
+
+	// The namespace is full, and other namespaces are unknown
+	for _, namespace := range []string{"tenant", "unknown"} {
+		otherConfig := *config
+		otherConfig.Namespace = namespace
+		otherDialer, err := otherConfig.NewDialer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer otherDialer.Close()
+
+		ctxShort, cancelShort := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancelShort()
+		if conn, err := otherDialer.DialContext(ctxShort, "RANDOM_LABEL"); err == nil {
+			conn.Close()
+			t.Fatalf("DialContext into namespace %q should fail", namespace)
+		}
+	}
+
+	if err := tenant.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if _, err := tenant.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Accept on a closed namespace returned %v, expected net.ErrClosed", err)
+	}
+	if peers := listener.Peers(); len(peers) != 0 {
+		t.Fatalf("Peers returned %+v after the namespace is closed", peers)
+	}
+}
+
+func TestListenerCertificates(t *testing.T) {
+	secretKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := webrtc.GenerateCertificate(secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprints, err := certificate.GetFingerprints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answers := make(chan string, 2)
+	signal := transportc.NewDebugSignal(8)
+	listenerConfig := &transportc.Config{
+		Signal:       signal,
+		BundlePolicy: webrtc.BundlePolicyMaxBundle,
+		Certificates: []webrtc.Certificate{*certificate},
+		SDPTransformOutgoing: func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+			answers <- desc.SDP
+			return desc, nil
+		},
+	}
+
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	// every PeerConnection presents the same fingerprint
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel() // cancel the context to make sure it is done
+
+		conn, err := dialer.DialContext(ctx, fmt.Sprintf("RANDOM_LABEL_%d", i))
+		if err != nil {
+			t.Fatalf("DialContext error: %v", err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		if answer := <-answers; !strings.Contains(strings.ToLower(answer), strings.ToLower(fingerprints[0].Value)) {
+			t.Fatalf("answer does not present the fingerprint of the certificate: %s", answer)
+		}
+	}
+}
+
+// expiringSignal attaches the same expiry to every offer.
+type expiringSignal struct {
+	transportc.Signal
+	expiry time.Time
+}
+
+func (s *expiringSignal) OfferExpiry(uint64) time.Time {
+	return s.expiry
+}
+
+func TestListenerOfferExpiry(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	listener, err := (&transportc.Config{
+		Signal: &expiringSignal{Signal: signal, expiry: time.Now()},
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	events := listener.Events()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	if conn, err := dialer.DialContext(ctx, "RANDOM_LABEL"); err == nil {
+		conn.Close()
+		t.Fatal("DialContext should fail with an expired offer")
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("Listener emitted %v for an expired offer", event.Type)
+	default:
+	}
+}
+
+func TestListenerAcceptPriority(t *testing.T) {
+	config := &transportc.Config{
+		Signal:              transportc.NewDebugSignal(8),
+		ReusePeerConnection: true,
+		ListenerAcceptPriority: func(label, protocol string) int {
+			if protocol == "control" {
+				return 1
+			}
+			return 0
+		},
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	for _, protocol := range []string{"bulk", "bulk", "control"} {
+		conn, err := dialer.DialContext(ctx, protocol, transportc.WithProtocol(protocol))
+		if err != nil {
+			t.Fatalf("DialContext error: %v", err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+	}
+
+	// wait for all Conns to be pending
+	for listener.Healthz().AcceptBacklog < 3 {
+		if ctx.Err() != nil {
+			t.Fatalf("%d Conns pending on Accept, expected 3", listener.Healthz().AcceptBacklog)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, expected := range []string{"control", "bulk", "bulk"} {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept error: %v", err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+		if protocol := conn.(*transportc.Conn).Protocol(); protocol != expected {
+			t.Fatalf("Accepted Conn has protocol %q, expected %q", protocol, expected)
+		}
+	}
+}
+
+func TestListenerSignals(t *testing.T) {
+	signals := []transportc.Signal{transportc.NewDebugSignal(8), transportc.NewDebugSignal(8), transportc.NewDebugSignal(8)}
+	listener, err := (&transportc.Config{
+		Signal:          signals[0],
+		ListenerSignals: signals[1:],
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	// offers from every Signal are accepted from the same Listener, and
+	// answered via the Signal they were read from
+	for i, signal := range signals {
+		dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dialer.Close()
+
+		label := fmt.Sprintf("SIGNAL_%d", i)
+		cConn, err := dialer.DialContext(ctx, label)
+		if err != nil {
+			t.Fatalf("DialContext via Signal #%d error: %v", i, err)
+		}
+		defer cConn.Close() // skipcq: GO-S2307
+
+		sConn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept error: %v", err)
+		}
+		defer sConn.Close() // skipcq: GO-S2307
+		if got := sConn.(*transportc.Conn).Label(); got != label {
+			t.Fatalf("Accept returned %q, expected %q", got, label)
+		}
+	}
+}
+
+func TestListenerSetHostCandidateIPs(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	listener, err := (&transportc.Config{
+		Signal:                signal,
+		CandidateNetworkTypes: []webrtc.NetworkType{webrtc.NetworkTypeUDP4},
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	if err := listener.SetHostCandidateIPs([]string{"203.0.113.7/not-an-ip"}); !errors.Is(err, transportc.ErrInvalidCandidateIP) {
+		t.Fatalf("SetHostCandidateIPs returned %v, expected ErrInvalidCandidateIP", err)
+	}
+	if err := listener.SetHostCandidateIPs([]string{"203.0.113.7"}); err != nil {
+		t.Fatalf("SetHostCandidateIPs error: %v", err)
+	}
+
+	answers := make(chan string, 1)
+	dialer, err := (&transportc.Config{
+		Signal: signal,
+		SDPTransformIncoming: func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+			answers <- desc.SDP
+			return desc, nil
+		},
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	// only the answer matters, whether or not the peers connect via peer
+	// reflexive candidates
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err == nil {
+		cConn.Close()
+	}
+
+	answer := <-answers
+	for _, line := range strings.Split(answer, "\r\n") {
+		if strings.HasPrefix(line, "a=candidate:") && strings.Contains(line, "typ host") && !strings.Contains(line, " 203.0.113.7 ") {
+			t.Fatalf("answer advertises %q, expected the host candidate IP set", line)
+		}
+	}
+	if !strings.Contains(answer, " 203.0.113.7 ") {
+		t.Fatal("answer should advertise the host candidate IP set")
+	}
+}
+
+func TestListenerTCPMux(t *testing.T) {
+	tcpListener, err := net.Listen("tcp4", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpListener.Close()
+
+	signal := transportc.NewDebugSignal(8)
+	listener, err := (&transportc.Config{
+		Signal: signal,
+		TCPMux: webrtc.NewICETCPMux(nil, tcpListener, 8),
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	answers := make(chan string, 1)
+	dialer, err := (&transportc.Config{
+		Signal: signal,
+		SDPTransformIncoming: func(desc webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+			answers <- desc.SDP
+			return desc, nil
+		},
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	// the answer advertises the port of the TCPMux as a passive TCP candidate
+	port := strconv.Itoa(tcpListener.Addr().(*net.TCPAddr).Port)
+	if answer := <-answers; !strings.Contains(answer, " "+port+" typ host tcptype passive") {
+		t.Fatalf("answer advertises no passive TCP candidate on port %s:\n%s", port, answer)
+	}
+
+	if _, err := (&transportc.Config{
+		TCPMux:                 webrtc.NewICETCPMux(nil, tcpListener, 8),
+		ListenerICECredentials: &transportc.ICECredentials{UsernameFragment: "ufrag", Password: "passwordpasswordpassword"},
+	}).NewListener(); !errors.Is(err, transportc.ErrICECredentialsWithTCPMux) {
+		t.Fatalf("NewListener returned %v, expected ErrICECredentialsWithTCPMux", err)
+	}
+}
+
+// dialAsync dials label in a goroutine, returning the channel of its result.
+func dialAsync(ctx context.Context, dialer *transportc.Dialer, label string) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		conn, err := dialer.DialContext(ctx, label)
+		if err == nil {
+			defer conn.Close() // skipcq: GO-S2307
+		}
+		result <- err
+	}()
+	return result
+}
+
+func TestListenerMaxAcceptBacklog(t *testing.T) {
+	config := &transportc.Config{
+		Signal:                   transportc.NewDebugSignal(8),
+		ListenerMaxAcceptBacklog: 1,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+	for listener.Healthz().AcceptBacklog < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !listener.Healthz().Overloaded {
+		t.Fatal("Listener not overloaded with a full accept backlog")
+	}
+
+	// the offer is left in the Signal until the backlog is accepted
+	dialer2, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer2.Close()
+
+	result := dialAsync(ctx, dialer2, "RANDOM_LABEL_2")
+	select {
+	case err := <-result:
+		t.Fatalf("DialContext returned %v with a full accept backlog, expected pending", err)
+	case <-time.After(2 * time.Second):
+	}
+
+	for _, label := range []string{"RANDOM_LABEL", "RANDOM_LABEL_2"} {
+		sConn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept error: %v", err)
+		}
+		defer sConn.Close() // skipcq: GO-S2307
+		if got := sConn.(*transportc.Conn).Label(); got != label {
+			t.Fatalf("Accept returned %q, expected %q", got, label)
+		}
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("DialContext error once the backlog is accepted: %v", err)
+	}
+}
+
+func TestListenerMaxPeerConnections(t *testing.T) {
+	config := &transportc.Config{
+		Signal:                     transportc.NewDebugSignal(8),
+		ListenerMaxPeerConnections: 1,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	// the offer is left in the Signal until the PeerConnection is closed
+	dialer2, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer2.Close()
+
+	result := dialAsync(ctx, dialer2, "RANDOM_LABEL_2")
+	select {
+	case err := <-result:
+		t.Fatalf("DialContext returned %v with all PeerConnections in use, expected pending", err)
+	case <-time.After(2 * time.Second):
+	}
+
+	if err := listener.ClosePeer(sConn.(*transportc.Conn).PeerID()); err != nil {
+		t.Fatalf("ClosePeer error: %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("DialContext error once a PeerConnection is closed: %v", err)
+	}
+}
+
+func TestListenerOfferFilter(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	var filtered atomic.Value
+	listener, err := (&transportc.Config{
+		Signal: signal,
+		ListenerOfferFilter: func(info transportc.OfferInfo) error {
+			filtered.Store(info)
+			if info.Metadata["token"] != "secret" {
+				return errors.New("invalid token")
+			}
+			return nil
+		},
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	// rejected before negotiation, so the Dialer waits for an answer in vain
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	if _, err := dialer.DialContext(ctx, "RANDOM_LABEL", transportc.WithOfferMetadata(map[string]string{"token": "wrong"})); err == nil {
+		t.Fatal("DialContext succeeded with an offer rejected by the filter")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL", transportc.WithProtocol("echo"), transportc.WithOfferMetadata(map[string]string{"token": "secret"}))
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	info, _ := filtered.Load().(transportc.OfferInfo)
+	if info.Label != "RANDOM_LABEL" || info.Protocol != "echo" {
+		t.Fatalf("Filtered offer for %q/%q, expected RANDOM_LABEL/echo", info.Label, info.Protocol)
+	}
+	if token := sConn.(*transportc.Conn).OfferMetadata()["token"]; token != "secret" {
+		t.Fatalf("Accepted Conn with token %q in its offer metadata, expected secret", token)
+	}
+}
+
+func TestParseSessionDescriptionEnvelopeVersion(t *testing.T) {
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConnection.Close()
+	if _, err := peerConnection.CreateDataChannel("RANDOM_LABEL", nil); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for version, valid := range map[int]bool{0: true, transportc.SDP_ENVELOPE_VERSION: true, transportc.SDP_ENVELOPE_VERSION + 1: false} {
+		data, err := json.Marshal(map[string]interface{}{"type": "offer", "sdp": offer.SDP, "v": version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = transportc.ParseSessionDescription(data, webrtc.SDPTypeOffer)
+		if valid && err != nil {
+			t.Fatalf("ParseSessionDescription of envelope version %d error: %v", version, err)
+		} else if !valid && !errors.Is(err, transportc.ErrMalformedSignal) {
+			t.Fatalf("ParseSessionDescription of envelope version %d returned %v, expected ErrMalformedSignal", version, err)
+		}
+	}
+}
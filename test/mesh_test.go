@@ -0,0 +1,164 @@
+package transportc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/mesh"
+)
+
+func TestMesh(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	listener, err := (&transportc.Config{Signal: signal}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	peerDown := make(chan string, 1)
+	meshA, err := (&mesh.Config{
+		ID:         "A",
+		Listener:   listener,
+		OnPeerDown: func(peerID string) { peerDown <- peerID },
+	}).NewMesh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer meshA.Close()
+
+	// B keeps dialing until connected to A
+	meshB, err := (&mesh.Config{
+		ID:             "B",
+		Dialer:         dialer,
+		MinPeers:       1,
+		RedialInterval: 100 * time.Millisecond,
+	}).NewMesh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer meshB.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	for (len(meshA.Peers()) == 0 || len(meshB.Peers()) == 0) && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if peers := meshB.Peers(); len(peers) != 1 || peers[0] != "A" {
+		t.Fatalf("Mesh B has peers %q, expected A", peers)
+	}
+
+	if err := meshB.SendTo("A", []byte("hello A")); err != nil {
+		t.Fatalf("SendTo error: %v", err)
+	}
+	if msg, err := meshA.Receive(ctx); err != nil || msg.From != "B" || string(msg.Data) != "hello A" {
+		t.Fatalf("Receive returned %+v, %v", msg, err)
+	}
+	if err := meshA.Broadcast([]byte("hello all")); err != nil {
+		t.Fatalf("Broadcast error: %v", err)
+	}
+	if msg, err := meshB.Receive(ctx); err != nil || msg.From != "A" || string(msg.Data) != "hello all" {
+		t.Fatalf("Receive returned %+v, %v", msg, err)
+	}
+	if err := meshA.SendTo("C", []byte("hello C")); err != mesh.ErrUnknownPeer {
+		t.Fatalf("SendTo an unknown peer returned %v, expected ErrUnknownPeer", err)
+	}
+
+	// A sees B leave
+	meshB.Close()
+	select {
+	case peerID := <-peerDown:
+		if peerID != "B" {
+			t.Fatalf("OnPeerDown called for %q, expected B", peerID)
+		}
+	case <-ctx.Done():
+		t.Fatal("OnPeerDown not called once B closed")
+	}
+}
+
+// Positive Test for the failure detector: members connected through another
+// peer are known by gossip, and detected dead once gone.
+func TestMeshFailureDetector(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	listener, err := (&transportc.Config{Signal: signal}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	newMesh := func(id string, listener *transportc.Listener, onMemberDown func(string)) *mesh.Mesh {
+		var dialer *transportc.Dialer
+		if listener == nil {
+			dialer, err = (&transportc.Config{Signal: signal, ReusePeerConnection: true}).NewDialer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { dialer.Close() })
+		}
+		m, err := (&mesh.Config{
+			ID:              id,
+			Dialer:          dialer,
+			Listener:        listener,
+			MinPeers:        1,
+			RedialInterval:  100 * time.Millisecond,
+			FailureDetector: true,
+			ProbeInterval:   100 * time.Millisecond,
+			ProbeTimeout:    50 * time.Millisecond,
+			SuspectTimeout:  500 * time.Millisecond,
+			OnMemberDown:    onMemberDown,
+		}).NewMesh()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	// B and C are only connected to A
+	memberDown := make(chan string, 1)
+	meshA := newMesh("A", listener, nil)
+	defer meshA.Close()
+	meshB := newMesh("B", nil, func(memberID string) { memberDown <- memberID })
+	defer meshB.Close()
+	meshC := newMesh("C", nil, nil)
+	defer meshC.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	for len(meshB.Members()) < 2 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	members := meshB.Members()
+	if len(members) != 2 || members[0].ID != "A" || members[1].ID != "C" {
+		t.Fatalf("Mesh B has members %+v, expected A and C", members)
+	}
+	if peers := meshB.Peers(); len(peers) != 1 || peers[0] != "A" {
+		t.Fatalf("Mesh B has peers %q, expected A", peers)
+	}
+
+	// B learns from A that C is dead
+	meshC.Close()
+	select {
+	case memberID := <-memberDown:
+		if memberID != "C" {
+			t.Fatalf("OnMemberDown called for %q, expected C", memberID)
+		}
+	case <-ctx.Done():
+		t.Fatal("OnMemberDown not called once C closed")
+	}
+	if members := meshB.Members(); len(members) != 1 || members[0].ID != "A" || members[0].State != mesh.MEMBER_ALIVE {
+		t.Fatalf("Mesh B has members %+v, expected A alive", members)
+	}
+}
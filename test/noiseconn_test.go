@@ -0,0 +1,135 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/noiseconn"
+)
+
+func TestNoiseConn(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+	cNoise, sNoise := noiseConnPair(t, config)
+
+	// Write a message longer than one Noise message
+	msg := make([]byte, noiseconn.MAX_PLAINTEXT_SIZE+1024)
+	rand.Read(msg)
+	go cNoise.Write(msg)
+
+	recv := make([]byte, len(msg))
+	if _, err := io.ReadFull(sNoise, recv); err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if !bytes.Equal(msg, recv) {
+		t.Fatal("Read returned wrong message")
+	}
+}
+
+// Positive Test for a noiseconn.Conn over a Conn with a small MaxMessageSize,
+// and Negative Test for writing once a Write failed.
+func TestNoiseConnMaxMessageSize(t *testing.T) {
+	config := &transportc.Config{
+		Signal:         transportc.NewDebugSignal(8),
+		MaxMessageSize: 1024,
+	}
+	cNoise, sNoise := noiseConnPair(t, config)
+
+	// Write a message split into Noise messages of up to MaxMessageSize
+	msg := make([]byte, 5000)
+	rand.Read(msg)
+	go cNoise.Write(msg)
+
+	recv := make([]byte, len(msg))
+	if _, err := io.ReadFull(sNoise, recv); err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if !bytes.Equal(msg, recv) {
+		t.Fatal("Read returned wrong message")
+	}
+
+	// A Write failed after encrypting breaks the Conn
+	cNoise.Conn.Close()
+	if _, err := cNoise.Write([]byte("Hello")); err == nil {
+		t.Fatal("Write succeeded on a closed Conn")
+	}
+	if _, err := cNoise.Write([]byte("Hello")); !errors.Is(err, noiseconn.ErrBrokenConn) {
+		t.Fatalf("Write error is %v, expected ErrBrokenConn", err)
+	}
+}
+
+// noiseConnPair dials a Conn with config and secures both ends with Noise.
+// The Conns are closed once t is done.
+func noiseConnPair(t *testing.T, config *transportc.Config) (*noiseconn.Conn, *noiseconn.Conn) {
+	t.Helper()
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dialer.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	t.Cleanup(func() { cConn.Close() })
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	t.Cleanup(func() { sConn.Close() })
+
+	clientKey, _ := noiseconn.GenerateKeypair()
+	serverKey, _ := noiseconn.GenerateKeypair()
+
+	type result struct {
+		conn *noiseconn.Conn
+		err  error
+	}
+	serverResult := make(chan result, 1)
+	go func() {
+		conn, err := noiseconn.Server(ctx, sConn, &noiseconn.Config{
+			StaticKeypair: serverKey,
+			AllowedPeers:  [][]byte{clientKey.Public},
+		})
+		serverResult <- result{conn, err}
+	}()
+
+	cNoise, err := noiseconn.Client(ctx, cConn, &noiseconn.Config{
+		StaticKeypair: clientKey,
+		AllowedPeers:  [][]byte{serverKey.Public},
+	})
+	if err != nil {
+		t.Fatalf("noiseconn.Client error: %v", err)
+	}
+	if !bytes.Equal(cNoise.PeerStatic(), serverKey.Public) {
+		t.Fatal("Client PeerStatic mismatch")
+	}
+
+	res := <-serverResult
+	if res.err != nil {
+		t.Fatalf("noiseconn.Server error: %v", res.err)
+	}
+	return cNoise, res.conn
+}
@@ -0,0 +1,122 @@
+package transportc_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// Positive Test for Config.NewPacer, delaying each message written
+func TestConnPacer(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	var mutex sync.Mutex
+	var sizes []int
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+		NewPacer: func() transportc.Pacer {
+			return transportc.PacerFunc(func(size int, estimate transportc.BandwidthEstimate) time.Duration {
+				mutex.Lock()
+				defer mutex.Unlock()
+				sizes = append(sizes, size)
+				return delay
+			})
+		},
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	start := time.Now()
+	for i := 1; i <= 4; i++ {
+		if _, err := cConn.Write(make([]byte, i)); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 4*delay {
+		t.Fatalf("4 messages written in %v, expected paced by %v each", elapsed, delay)
+	}
+	if _, err := sConn.Write([]byte("paced")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(sizes) != 5 || sizes[0] != 1 || sizes[3] != 4 || sizes[4] != len("paced") {
+		t.Fatalf("Pace called with sizes %v, expected [1 2 3 4 5]", sizes)
+	}
+}
+
+// Negative Test for Conn.SetPacer, with a delay cut short by the write
+// deadline
+func TestConnPacerDeadline(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	conn := cConn.(*transportc.Conn)
+	conn.SetPacer(transportc.PacerFunc(func(int, transportc.BandwidthEstimate) time.Duration {
+		return time.Hour
+	}))
+	conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Write([]byte("Hello")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Write returned %v, expected os.ErrDeadlineExceeded", err)
+	}
+
+	conn.SetPacer(nil)
+	conn.SetWriteDeadline(time.Time{})
+	if _, err := conn.Write([]byte("Hello")); err != nil {
+		t.Fatalf("Write error without Pacer: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package transportc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/pastesignal"
+)
+
+// fakeGist serves a single gist of the GitHub API, with GET and PATCH.
+type fakeGist struct {
+	t     *testing.T
+	mutex sync.Mutex
+	files map[string]string
+}
+
+func (g *fakeGist) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/gists/GIST" || r.Header.Get("Authorization") != "Bearer TOKEN" {
+		g.t.Errorf("fake gist received a request for %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if r.Method == http.MethodPatch {
+		var update struct {
+			Files map[string]*struct {
+				Content string `json:"content"`
+			} `json:"files"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for name, file := range update.Files {
+			if _, ok := g.files[name]; file == nil && !ok {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			} else if file == nil {
+				delete(g.files, name)
+			} else {
+				g.files[name] = file.Content
+			}
+		}
+	}
+
+	files := make(map[string]map[string]string)
+	for name, content := range g.files {
+		files[name] = map[string]string{"filename": name, "content": content}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"files": files}) // skipcq: GO-S1040
+}
+
+func TestPasteSignal(t *testing.T) {
+	server := httptest.NewServer(&fakeGist{t: t, files: make(map[string]string)})
+	defer server.Close()
+
+	gist := pastesignal.NewGist(&pastesignal.GistConfig{
+		GistID: "GIST",
+		Token:  "TOKEN",
+		APIURL: server.URL,
+	})
+	store := pastesignal.NewStore(gist, 50*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	if err := store.Create(ctx, "drop/key", []byte{0, 1, 2}, time.Minute); err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	if err := store.Create(ctx, "drop/key", []byte{0, 1, 2}, time.Minute); err != transportc.ErrKVKeyExists {
+		t.Fatalf("Create of an existing key returned %v, expected ErrKVKeyExists", err)
+	}
+	if keys, err := store.Keys(ctx, "drop/"); err != nil || len(keys) != 1 || keys[0] != "drop/key" {
+		t.Fatalf("Keys returned %q, %v", keys, err)
+	}
+	if value, err := store.Take(ctx, "drop/key"); err != nil || string(value) != "\x00\x01\x02" {
+		t.Fatalf("Take returned %q, %v", value, err)
+	}
+	if _, err := store.Take(ctx, "drop/key"); err != transportc.ErrKVKeyNotFound {
+		t.Fatalf("Take of a taken key returned %v, expected ErrKVKeyNotFound", err)
+	}
+	if err := gist.Delete(ctx, "missing"); err != pastesignal.ErrPasteNotFound {
+		t.Fatalf("Delete of a missing paste returned %v, expected ErrPasteNotFound", err)
+	}
+
+	// Dialer and Listener signal through the gist
+	listener, err := (&transportc.Config{
+		Signal: transportc.NewKVSignal(pastesignal.NewStore(gist, 50*time.Millisecond), "transportc/", 0),
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{
+		Signal: transportc.NewKVSignal(pastesignal.NewStore(gist, 50*time.Millisecond), "transportc/", 0),
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+}
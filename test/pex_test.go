@@ -0,0 +1,85 @@
+package transportc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// Positive Test for a Conn between two peers signaled by a third peer
+// connected to both, via PeerExchange.
+func TestPeerExchange(t *testing.T) {
+	pxA := transportc.NewPeerExchange(0)
+	pxB := transportc.NewPeerExchange(1) // forwards the offers of A to C
+	pxC := transportc.NewPeerExchange(0, "https://broker.example/")
+
+	// A and B exchange over a Conn
+	signal := transportc.NewDebugSignal(8)
+	listenerB, err := (&transportc.Config{Signal: signal}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listenerB.Close()
+	listenerB.Handle(transportc.PEX_PROTOCOL, pxB.Handle)
+	listenerB.Start()
+
+	dialerA, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialerA.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	pexConn, err := dialerA.DialContext(ctx, "pex", transportc.WithProtocol(transportc.PEX_PROTOCOL))
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer pexConn.Close() // skipcq: GO-S2307
+	go pxA.Serve(pexConn)
+
+	// B and C exchange over any net.Conn
+	connB, connC := net.Pipe()
+	defer connB.Close()
+	defer connC.Close()
+	go pxB.Serve(connB)
+	go pxC.Serve(connC)
+
+	// the endpoints of C are gossiped to A via B
+	for len(pxA.Endpoints()) == 0 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if endpoints := pxA.Endpoints(); len(endpoints) != 1 || endpoints[0] != "https://broker.example/" {
+		t.Fatalf("PeerExchange of A knows endpoints %q, expected those of C", endpoints)
+	}
+
+	// A dials C, signaled via B
+	listenerC, err := (&transportc.Config{Signal: pxC}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listenerC.Close()
+	listenerC.Start()
+
+	dialerAC, err := (&transportc.Config{Signal: pxA}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialerAC.Close()
+
+	cConn, err := dialerAC.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext via PeerExchange error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listenerC.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+}
@@ -0,0 +1,113 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestPresetLowLatency(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	listenerConfig := &transportc.Config{Signal: signal}
+	transportc.PRESET_LOW_LATENCY.Apply(listenerConfig)
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{Signal: signal, GatherTimeout: 5 * time.Second}
+	transportc.PRESET_LOW_LATENCY.Apply(dialerConfig)
+	if dialerConfig.GatherTimeout != 5*time.Second {
+		t.Fatalf("Apply overrode GatherTimeout set explicitly with %v", dialerConfig.GatherTimeout)
+	}
+	if dialerConfig.PreGatherPoolSize != 1 || !dialerConfig.ReusePeerConnection || dialerConfig.MaxBufferedAmount == 0 {
+		t.Fatalf("Apply left %+v, expected the fields of PRESET_LOW_LATENCY", dialerConfig)
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	msg := []byte("with a preset")
+	if _, err := cConn.Write(msg); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, 64)
+	sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := sConn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if !bytes.Equal(buf[:n], msg) {
+		t.Fatalf("Read returned %q, expected %q", buf[:n], msg)
+	}
+}
+
+func TestPresetCovert(t *testing.T) {
+	config := &transportc.Config{}
+	transportc.PRESET_COVERT.Apply(config)
+	if config.WebRTCConfiguration.ICETransportPolicy != webrtc.ICETransportPolicyAll {
+		t.Fatal("PRESET_COVERT should not require relayed candidates without a TURN server")
+	}
+
+	config = &transportc.Config{
+		WebRTCConfiguration: webrtc.Configuration{
+			ICEServers: []webrtc.ICEServer{{URLs: []string{"turn:turn.example.com:3478"}}},
+		},
+	}
+	transportc.PRESET_COVERT.Apply(config)
+	if config.WebRTCConfiguration.ICETransportPolicy != webrtc.ICETransportPolicyRelay {
+		t.Fatal("PRESET_COVERT should require relayed candidates with a TURN server")
+	}
+	if config.WireHandshake {
+		t.Fatal("PRESET_COVERT should leave the wire handshake disabled")
+	}
+}
+
+func TestPresetUDPBlocked(t *testing.T) {
+	for _, tc := range []struct {
+		url   string
+		relay bool
+	}{
+		{"turn:turn.example.com:3478", false},
+		{"turns:turn.example.com:443?transport=udp", false},
+		{"turn:turn.example.com:3478?transport=tcp", true},
+		{"turns:turn.example.com:443", true},
+	} {
+		config := &transportc.Config{
+			WebRTCConfiguration: webrtc.Configuration{
+				ICEServers: []webrtc.ICEServer{{URLs: []string{tc.url}}},
+			},
+		}
+		transportc.PRESET_UDP_BLOCKED.Apply(config)
+		if relay := config.WebRTCConfiguration.ICETransportPolicy == webrtc.ICETransportPolicyRelay; relay != tc.relay {
+			t.Fatalf("PRESET_UDP_BLOCKED with %q requires relayed candidates: %v, expected %v", tc.url, relay, tc.relay)
+		}
+		if config.GatherTimeout == 0 {
+			t.Fatal("PRESET_UDP_BLOCKED should bound the ICE gathering")
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package transportc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"golang.org/x/net/proxy"
+)
+
+func TestProxyDialer(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	var contextDialer proxy.ContextDialer = dialer.ProxyDialer()
+	cConn, err := contextDialer.DialContext(ctx, "tcp", "[::1]:443")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	network, addr, err := transportc.ParseProxyLabel(sConn.(*transportc.Conn).Label())
+	if err != nil {
+		t.Fatalf("ParseProxyLabel error: %v", err)
+	}
+	if network != "tcp" || addr != "[::1]:443" {
+		t.Fatalf("ParseProxyLabel returned %s %s, expected tcp [::1]:443", network, addr)
+	}
+}
+
+func TestParseProxyLabelInvalid(t *testing.T) {
+	for _, label := range []string{"", "RANDOM_LABEL", "proxy:", "proxy:tcp", "proxy::443"} {
+		if _, _, err := transportc.ParseProxyLabel(label); err != transportc.ErrNotProxyLabel {
+			t.Errorf("ParseProxyLabel(%q) should fail with ErrNotProxyLabel, got %v", label, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package transportc_test
+
+import (
+	"testing"
+
+	"github.com/gaukas/transportc"
+)
+
+// offerIDs returns the IDs of n offers submitted to a new DebugSignal.
+func offerIDs(t *testing.T, n int) []uint64 {
+	signal := transportc.NewDebugSignal(n)
+	ids := make([]uint64, 0, n)
+	for i := 0; i < n; i++ {
+		id, err := signal.Offer([]byte("offer"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestWithDeterministicRand(t *testing.T) {
+	restore := transportc.WithDeterministicRand(42)
+	first := offerIDs(t, 4)
+	restore()
+
+	restore = transportc.WithDeterministicRand(42)
+	second := offerIDs(t, 4)
+	restore()
+
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("offer IDs %v and %v differ with the same seed", first, second)
+		}
+	}
+
+	restore = transportc.WithDeterministicRand(24)
+	other := offerIDs(t, 4)
+	restore()
+
+	if other[0] == first[0] {
+		t.Fatalf("offer IDs %v are the same with different seeds", other)
+	}
+}
@@ -0,0 +1,104 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/relay"
+)
+
+func TestRelayProxyProtocol(t *testing.T) {
+	// Setup a TCP backend expecting a PROXY v2 header and echoing afterwards
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	headerChan := make(chan []byte, 1)
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		addrs := make([]byte, int(header[14])<<8|int(header[15]))
+		if _, err := io.ReadFull(conn, addrs); err != nil {
+			return
+		}
+		headerChan <- header
+		io.Copy(conn, conn)
+	}()
+
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Start()
+
+	relayConfig := &relay.Config{
+		Backend:       backend.Addr().String(),
+		ProxyProtocol: true,
+	}
+	r, err := relayConfig.NewRelay(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	go r.Serve()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	_, err = conn.Write([]byte("Hello"))
+	if err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+
+	select {
+	case header := <-headerChan:
+		if !bytes.Equal(header[:12], []byte("\r\n\r\n\x00\r\nQUIT\n")) {
+			t.Fatalf("PROXY v2 signature mismatch: %x", header[:12])
+		}
+		if header[12] != 0x21 {
+			t.Fatalf("PROXY v2 command is %x, expected 0x21", header[12])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for PROXY header")
+	}
+
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if string(buf[:n]) != "Hello" {
+		t.Fatalf("Read returned %s", string(buf[:n]))
+	}
+}
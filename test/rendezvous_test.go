@@ -0,0 +1,103 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestRendezvous(t *testing.T) {
+	signalA, signalB := transportc.NewInProcessSignalPair()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 2)
+	for _, signal := range []transportc.Signal{signalA, signalB} {
+		config := &transportc.Config{Signal: signal}
+		go func() {
+			conn, err := config.Rendezvous(ctx, "RENDEZVOUS")
+			results <- result{conn, err}
+		}()
+	}
+
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("Rendezvous error: %v", r.err)
+		}
+		defer r.conn.Close() // skipcq: GO-S2307
+		conns = append(conns, r.conn)
+	}
+
+	// both directions work, whichever peer offered
+	for i, msg := range [][]byte{[]byte("from one"), []byte("from the other")} {
+		src, dst := conns[i], conns[1-i]
+		if _, err := src.Write(msg); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		buf := make([]byte, 64)
+		dst.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := dst.Read(buf)
+		if err != nil {
+			t.Fatalf("Read error: %v", err)
+		}
+		if !bytes.Equal(buf[:n], msg) {
+			t.Fatalf("Read returned %q, expected %q", buf[:n], msg)
+		}
+	}
+}
+
+// Positive Test for Config.Rendezvous answering a designated Dialer
+func TestRendezvousWithDialer(t *testing.T) {
+	signalA, signalB := transportc.NewInProcessSignalPair()
+
+	dialer, err := (&transportc.Config{Signal: signalA}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	rendezvous := make(chan net.Conn, 1)
+	go func() {
+		conn, err := (&transportc.Config{Signal: signalB}).Rendezvous(ctx, "RENDEZVOUS")
+		if err != nil {
+			t.Errorf("Rendezvous error: %v", err)
+		}
+		rendezvous <- conn
+	}()
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn := <-rendezvous
+	if sConn == nil {
+		t.FailNow()
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+	if label := sConn.(*transportc.Conn).Label(); label != "RANDOM_LABEL" {
+		t.Fatalf("Rendezvous accepted %q, expected the label of the Dialer", label)
+	}
+}
+
+// Negative Test for Config.Rendezvous without a Signal
+func TestRendezvousWithoutSignal(t *testing.T) {
+	if _, err := (&transportc.Config{}).Rendezvous(context.Background(), "RENDEZVOUS"); err != transportc.ErrRendezvousWithoutSignal {
+		t.Fatalf("Rendezvous returned %v, expected ErrRendezvousWithoutSignal", err)
+	}
+}
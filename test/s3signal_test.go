@@ -0,0 +1,155 @@
+package transportc_test
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/s3signal"
+)
+
+// fakeS3 serves the objects of a single path-style bucket, with PUT, GET,
+// DELETE and ListObjectsV2.
+type fakeS3 struct {
+	t       *testing.T
+	mutex   sync.Mutex
+	objects map[string][]byte
+	created map[string]time.Time
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		s.t.Errorf("fake S3 received a request without signature: %q", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		var keys []string
+		for k := range s.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		type object struct {
+			Key          string
+			LastModified time.Time
+		}
+		result := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []object
+		}{}
+		for _, k := range keys {
+			result.Contents = append(result.Contents, object{k, s.created[k]})
+		}
+		xml.NewEncoder(w).Encode(result) // skipcq: GO-S1040
+	case r.Method == http.MethodPut:
+		if _, ok := s.objects[key]; ok && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		s.objects[key], _ = io.ReadAll(r.Body)
+		s.created[key] = time.Now()
+	case r.Method == http.MethodGet:
+		object, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(object) // skipcq: GO-S1040
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		delete(s.created, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Signal(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{
+		t:       t,
+		objects: make(map[string][]byte),
+		created: make(map[string]time.Time),
+	})
+	defer server.Close()
+
+	config := &s3signal.Config{
+		Endpoint:        server.URL,
+		Bucket:          "bucket",
+		PathStyle:       true,
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		PollInterval:    50 * time.Millisecond,
+	}
+
+	store, err := s3signal.NewStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	if err := store.Create(ctx, "drop/a b", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	if err := store.Create(ctx, "drop/a b", []byte("value"), time.Minute); err != transportc.ErrKVKeyExists {
+		t.Fatalf("Create of an existing key returned %v, expected ErrKVKeyExists", err)
+	}
+	if keys, err := store.Keys(ctx, "drop/"); err != nil || len(keys) != 1 || keys[0] != "drop/a b" {
+		t.Fatalf("Keys returned %q, %v", keys, err)
+	}
+	if value, err := store.Take(ctx, "drop/a b"); err != nil || string(value) != "value" {
+		t.Fatalf("Take returned %q, %v", value, err)
+	}
+	if _, err := store.Take(ctx, "drop/a b"); err != transportc.ErrKVKeyNotFound {
+		t.Fatalf("Take of a taken key returned %v, expected ErrKVKeyNotFound", err)
+	}
+
+	// Dialer and Listener signal through the bucket
+	listenerSignal, err := s3signal.NewSignal(config, "transportc/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := (&transportc.Config{Signal: listenerSignal}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialerSignal, err := s3signal.NewSignal(config, "transportc/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer, err := (&transportc.Config{Signal: dialerSignal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+}
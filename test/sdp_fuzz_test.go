@@ -0,0 +1,82 @@
+package transportc_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gaukas/transportc"
+	"github.com/pion/webrtc/v3"
+)
+
+func realOffer(t testing.TB) []byte {
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConnection.Close()
+
+	if _, err := peerConnection.CreateDataChannel("RANDOM_LABEL", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offerBytes, err := json.Marshal(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offerBytes
+}
+
+func TestParseSessionDescription(t *testing.T) {
+	offer := realOffer(t)
+
+	desc, err := transportc.ParseSessionDescription(offer, webrtc.SDPTypeOffer)
+	if err != nil {
+		t.Fatalf("ParseSessionDescription error: %v", err)
+	}
+	if desc.Type != webrtc.SDPTypeOffer {
+		t.Fatalf("ParseSessionDescription returned unexpected type %s", desc.Type)
+	}
+
+	for name, data := range map[string][]byte{
+		"wrong type": offer,
+		"oversized":  []byte(`{"type":"answer","sdp":"` + strings.Repeat("a", transportc.MAX_SIGNAL_MESSAGE_SIZE) + `"}`),
+		"deep JSON":  []byte(strings.Repeat("[", 10000) + strings.Repeat("]", 10000)),
+		"not JSON":   []byte("v=0"),
+		"empty SDP":  []byte(`{"type":"answer","sdp":""}`),
+		"no media":   []byte(`{"type":"answer","sdp":"v=0\r\no=- 0 0 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\n"}`),
+	} {
+		_, err := transportc.ParseSessionDescription(data, webrtc.SDPTypeAnswer)
+		if !errors.Is(err, transportc.ErrMalformedSignal) {
+			t.Errorf("%s: expected ErrMalformedSignal, got %v", name, err)
+		}
+	}
+}
+
+func FuzzParseSessionDescription(f *testing.F) {
+	f.Add(realOffer(f))
+	f.Add([]byte(`{"type":"offer","sdp":"v=0\r\n"}`))
+	f.Add([]byte(`{"type":"offer","sdp":"v=0\r\no=- 0 0 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n"}`))
+	f.Add([]byte(`{"type":"offer","pk":"AAAA","sig":"AAAA"}`))
+	f.Add([]byte(`[[[[{}]]]]`))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		desc, err := transportc.ParseSessionDescription(data, webrtc.SDPTypeOffer)
+		if err != nil {
+			if !errors.Is(err, transportc.ErrMalformedSignal) {
+				t.Fatalf("error does not wrap ErrMalformedSignal: %v", err)
+			}
+			return
+		}
+		if desc.Type != webrtc.SDPTypeOffer || desc.SDP == "" {
+			t.Fatalf("ParseSessionDescription accepted invalid SessionDescription: %+v", desc)
+		}
+	})
+}
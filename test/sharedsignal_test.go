@@ -0,0 +1,148 @@
+package transportc_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// pipeSession is an in-memory SignalSession delivering messages to its peer.
+type pipeSession struct {
+	in  chan []byte
+	out chan []byte
+}
+
+func newPipeSessionPair() (*pipeSession, *pipeSession) {
+	a2b := make(chan []byte, 16)
+	b2a := make(chan []byte, 16)
+	return &pipeSession{in: b2a, out: a2b}, &pipeSession{in: a2b, out: b2a}
+}
+
+func (ps *pipeSession) Send(msg []byte) error {
+	ps.out <- msg
+	return nil
+}
+
+func (ps *pipeSession) Receive() ([]byte, error) {
+	msg, ok := <-ps.in
+	if !ok {
+		return nil, errors.New("pipe closed")
+	}
+	return msg, nil
+}
+
+func TestSharedSignal(t *testing.T) {
+	sessionDialer, sessionListener := newPipeSessionPair()
+	sharedDialerSignal := transportc.NewSharedSignal(sessionDialer)
+
+	listenerConfig := &transportc.Config{
+		Signal: transportc.NewSharedSignal(sessionListener),
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	// Multiple Dialers dialing concurrently over the same session
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		dialerConfig := &transportc.Config{
+			Signal: sharedDialerSignal,
+		}
+		dialer, err := dialerConfig.NewDialer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dialer.Close()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+			if err != nil {
+				t.Errorf("DialContext error: %v", err)
+				return
+			}
+			_, err = conn.Write([]byte("Hello"))
+			if err != nil {
+				t.Errorf("Write error: %v", err)
+			}
+		}()
+	}
+
+	for i := 0; i < 3; i++ {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept error: %v", err)
+		}
+		defer conn.Close() // skipcq: GO-S2307
+
+		buf := make([]byte, 16)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Read error: %v", err)
+		}
+		if string(buf[:n]) != "Hello" {
+			t.Fatalf("Read returned %s", string(buf[:n]))
+		}
+	}
+	wg.Wait()
+}
+
+// Negative Test for DialContext over a SharedSignal never answered: neither
+// the goroutine reading the answer nor the pending offer outlive the Dial.
+func TestSharedSignalDialCanceled(t *testing.T) {
+	sessionDialer, sessionListener := newPipeSessionPair()
+	sharedDialerSignal := transportc.NewSharedSignal(sessionDialer)
+	_ = transportc.NewSharedSignal(sessionListener) // receives the offers, never answered
+
+	goroutines := runtime.NumGoroutine()
+
+	config := &transportc.Config{
+		Signal: sharedDialerSignal,
+	}
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	if _, err := dialer.DialContext(ctx, "RANDOM_LABEL"); err == nil {
+		t.Fatal("DialContext succeeded without an answer")
+	}
+	if err := dialer.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	// ReadAnswer returns within SHARED_SIGNAL_POLL_INTERVAL
+	deadline := time.Now().Add(transportc.SHARED_SIGNAL_POLL_INTERVAL + 3*time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Fatalf("%d goroutines remain after the Dial, expected at most %d", n, goroutines)
+	}
+
+	if n := sharedDialerSignal.PendingOffers(); n != 1 {
+		t.Fatalf("PendingOffers is %d before the expiry, expected 1", n)
+	}
+	defer transportc.WithClock(transportc.NewFakeClock(time.Now().Add(transportc.SHARED_SIGNAL_ANSWER_EXPIRY + time.Second)))()
+	if n := sharedDialerSignal.PendingOffers(); n != 0 {
+		t.Fatalf("PendingOffers is %d after the expiry, expected 0", n)
+	}
+}
@@ -2,7 +2,11 @@ package transportc_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"crypto/rand"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -78,3 +82,285 @@ func TestDebugSignal(t *testing.T) {
 	}
 	close(chanAnswer)
 }
+
+func TestFileSignal(t *testing.T) {
+	dir := t.TempDir()
+
+	fs, err := transportc.NewFileSignal(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offerID, err := fs.Offer([]byte("offer"))
+	if err != nil {
+		t.Fatalf("Error making offer: %v", err)
+	}
+
+	// offers survive a restart
+	fs, err = transportc.NewFileSignal(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oid, offerOutput, err := fs.ReadOffer()
+	if err != nil || oid != offerID || string(offerOutput) != "offer" {
+		t.Fatalf("ReadOffer returned %d, %q, %v", oid, offerOutput, err)
+	}
+	if expiry := fs.OfferExpiry(offerID); expiry.Before(time.Now()) || expiry.After(time.Now().Add(transportc.FILE_SIGNAL_DEFAULT_TTL)) {
+		t.Fatalf("OfferExpiry returned %v, expected within the TTL", expiry)
+	}
+	if _, _, err := fs.ReadOffer(); err != transportc.ErrOfferNotReady {
+		t.Fatalf("ReadOffer of a claimed offer returned %v, expected ErrOfferNotReady", err)
+	}
+
+	if _, err := fs.ReadAnswer(offerID); err != transportc.ErrAnswerNotReady {
+		t.Fatalf("ReadAnswer returned %v, expected ErrAnswerNotReady", err)
+	}
+	if err := fs.Answer(offerID, []byte("answer")); err != nil {
+		t.Fatalf("Error answering: %v", err)
+	}
+	if err := fs.Answer(offerID, []byte("answer")); err != transportc.ErrInvalidOfferID {
+		t.Fatalf("Answer of an answered offer returned %v, expected ErrInvalidOfferID", err)
+	}
+	if answerOutput, err := fs.ReadAnswer(offerID); err != nil || string(answerOutput) != "answer" {
+		t.Fatalf("ReadAnswer returned %q, %v", answerOutput, err)
+	}
+
+	// expired offers are discarded
+	fs, err = transportc.NewFileSignal(dir, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Offer([]byte("offer")); err != nil {
+		t.Fatalf("Error making offer: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, _, err := fs.ReadOffer(); err != transportc.ErrOfferNotReady {
+		t.Fatalf("ReadOffer of an expired offer returned %v, expected ErrOfferNotReady", err)
+	}
+}
+
+func TestInProcessSignal(t *testing.T) {
+	offerer, answerer := transportc.NewInProcessSignalPair()
+
+	// Serialized offers and answers are passed to the linked end
+	offerID, err := offerer.Offer([]byte("offer"))
+	if err != nil {
+		t.Fatalf("Error making offer: %v", err)
+	}
+	oid, offerOutput, err := answerer.ReadOffer()
+	if err != nil || oid != offerID || string(offerOutput) != "offer" {
+		t.Fatalf("ReadOffer returned %d, %q, %v", oid, offerOutput, err)
+	}
+	if _, _, err := offerer.ReadOffer(); err != transportc.ErrOfferNotReady {
+		t.Fatalf("ReadOffer of the offerer returned %v, expected ErrOfferNotReady", err)
+	}
+	if err := answerer.Answer(offerID, []byte("answer")); err != nil {
+		t.Fatalf("Error answering: %v", err)
+	}
+	if answerOutput, err := offerer.ReadAnswer(offerID); err != nil || string(answerOutput) != "answer" {
+		t.Fatalf("ReadAnswer returned %q, %v", answerOutput, err)
+	}
+
+	// Dialer and Listener pass SessionDescriptions as is
+	dialerPub, dialerKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	listener, err := (&transportc.Config{
+		Signal:       answerer,
+		AllowedPeers: []ed25519.PublicKey{dialerPub},
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{
+		Signal:      offerer,
+		IdentityKey: dialerKey,
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	if !sConn.(*transportc.Conn).PeerIdentity().Equal(dialerPub) {
+		t.Fatal("Accepted Conn has an unexpected peer identity")
+	}
+}
+
+// memKVStore is a transportc.KVStore in memory, ignoring TTLs.
+type memKVStore struct {
+	mutex    sync.Mutex
+	keys     []string
+	values   map[string][]byte
+	watchers map[chan struct{}]string // watcher:prefix pair
+}
+
+func newMemKVStore() *memKVStore {
+	return &memKVStore{
+		values:   make(map[string][]byte),
+		watchers: make(map[chan struct{}]string),
+	}
+}
+
+func (s *memKVStore) Create(_ context.Context, key string, value []byte, _ time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.values[key]; ok {
+		return transportc.ErrKVKeyExists
+	}
+	s.keys = append(s.keys, key)
+	s.values[key] = value
+	for watcher, prefix := range s.watchers {
+		if strings.HasPrefix(key, prefix) {
+			select {
+			case watcher <- struct{}{}:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+func (s *memKVStore) Take(_ context.Context, key string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value, ok := s.values[key]
+	if !ok {
+		return nil, transportc.ErrKVKeyNotFound
+	}
+	delete(s.values, key)
+	for i := range s.keys {
+		if s.keys[i] == key {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			break
+		}
+	}
+	return value, nil
+}
+
+func (s *memKVStore) Keys(_ context.Context, prefix string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var keys []string
+	for _, key := range s.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memKVStore) Watch(ctx context.Context, prefix string) <-chan struct{} {
+	watcher := make(chan struct{}, 1)
+	s.mutex.Lock()
+	s.watchers[watcher] = prefix
+	s.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mutex.Lock()
+		delete(s.watchers, watcher)
+		s.mutex.Unlock()
+	}()
+	return watcher
+}
+
+func TestKVSignal(t *testing.T) {
+	store := newMemKVStore()
+	ks := transportc.NewKVSignal(store, "transportc/", 0)
+
+	if _, _, err := ks.ReadOffer(); err != transportc.ErrOfferNotReady {
+		t.Fatalf("ReadOffer returned %v, expected ErrOfferNotReady", err)
+	}
+
+	offerID, err := ks.Offer([]byte("offer"))
+	if err != nil {
+		t.Fatalf("Error making offer: %v", err)
+	}
+
+	// offers are taken by a single KVSignal
+	oid, offerOutput, err := transportc.NewKVSignal(store, "transportc/", 0).ReadOffer()
+	if err != nil || oid != offerID || string(offerOutput) != "offer" {
+		t.Fatalf("ReadOffer returned %d, %q, %v", oid, offerOutput, err)
+	}
+	if _, _, err := ks.ReadOffer(); err != transportc.ErrOfferNotReady {
+		t.Fatalf("ReadOffer of a taken offer returned %v, expected ErrOfferNotReady", err)
+	}
+
+	// ReadAnswer is woken up by the answer
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if err := ks.Answer(offerID, []byte("answer")); err != nil {
+			t.Errorf("Error answering: %v", err)
+		}
+	}()
+	if answerOutput, err := ks.ReadAnswer(offerID); err != nil || string(answerOutput) != "answer" {
+		t.Fatalf("ReadAnswer returned %q, %v", answerOutput, err)
+	}
+	if _, err := ks.ReadAnswer(offerID); err != transportc.ErrAnswerNotReady {
+		t.Fatalf("ReadAnswer of a taken answer returned %v, expected ErrAnswerNotReady", err)
+	}
+
+	// expired offers are discarded
+	ks = transportc.NewKVSignal(store, "transportc/", 50*time.Millisecond)
+	if _, err := ks.Offer([]byte("offer")); err != nil {
+		t.Fatalf("Error making offer: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, _, err := ks.ReadOffer(); err != transportc.ErrOfferNotReady {
+		t.Fatalf("ReadOffer of an expired offer returned %v, expected ErrOfferNotReady", err)
+	}
+
+	// Dialer and Listener signal through the store
+	listener, err := (&transportc.Config{
+		Signal: transportc.NewKVSignal(store, "transportc/", 0),
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{
+		Signal: transportc.NewKVSignal(store, "transportc/", 0),
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+}
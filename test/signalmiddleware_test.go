@@ -0,0 +1,141 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaukas/logging"
+	"github.com/gaukas/transportc"
+)
+
+// recordingSignal records the offers passed to the underlying Signal.
+type recordingSignal struct {
+	transportc.Signal
+	offers [][]byte
+}
+
+func (s *recordingSignal) Offer(offer []byte) (uint64, error) {
+	s.offers = append(s.offers, offer)
+	return s.Signal.Offer(offer)
+}
+
+// flakySignal fails the first failures calls to Offer.
+type flakySignal struct {
+	transportc.Signal
+	failures int
+	calls    int
+}
+
+func (s *flakySignal) Offer(offer []byte) (uint64, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		return 0, errors.New("temporary failure")
+	}
+	return s.Signal.Offer(offer)
+}
+
+func TestChainSignal(t *testing.T) {
+	encrypt, err := transportc.EncryptSignal(bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &recordingSignal{Signal: transportc.NewDebugSignal(8)}
+	signal := transportc.ChainSignal(recorder,
+		transportc.LoggingSignal(logging.DefaultStderrLogger(logging.LOG_WARN)),
+		transportc.RetrySignal(3, 10*time.Millisecond),
+		transportc.RateLimitSignal(100*time.Millisecond, 4),
+		encrypt,
+	)
+
+	config := &transportc.Config{
+		Signal: signal,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	conn.Close()
+
+	if len(recorder.offers) != 1 {
+		t.Fatalf("%d offers signaled, expected 1", len(recorder.offers))
+	}
+	if bytes.Contains(recorder.offers[0], []byte("sdp")) {
+		t.Fatal("offer is signaled in plaintext")
+	}
+}
+
+func TestEncryptSignal(t *testing.T) {
+	if _, err := transportc.EncryptSignal([]byte("short key")); err != transportc.ErrInvalidSignalKey {
+		t.Fatalf("EncryptSignal returned %v, expected ErrInvalidSignalKey", err)
+	}
+
+	encrypt, err := transportc.EncryptSignal(bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptOther, err := transportc.EncryptSignal(bytes.Repeat([]byte{0x24}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	debugSignal := transportc.NewDebugSignal(8)
+	offerer := encrypt(debugSignal)
+	answerer := encryptOther(debugSignal)
+
+	if _, err := offerer.Offer([]byte("offer")); err != nil {
+		t.Fatalf("Offer error: %v", err)
+	}
+	if _, _, err := answerer.ReadOffer(); !errors.Is(err, transportc.ErrMalformedSignal) {
+		t.Fatalf("ReadOffer with a different key returned %v, expected ErrMalformedSignal", err)
+	}
+
+	offerID, err := offerer.Offer([]byte("offer"))
+	if err != nil {
+		t.Fatalf("Offer error: %v", err)
+	}
+	if _, offer, err := encrypt(debugSignal).ReadOffer(); err != nil || string(offer) != "offer" {
+		t.Fatalf("ReadOffer returned %q, %v", offer, err)
+	}
+
+	// answers are bound to the offerID
+	if err := debugSignal.Answer(offerID+1, []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := offerer.ReadAnswer(offerID + 1); !errors.Is(err, transportc.ErrMalformedSignal) {
+		t.Fatalf("ReadAnswer of a forged answer returned %v, expected ErrMalformedSignal", err)
+	}
+}
+
+func TestRetrySignal(t *testing.T) {
+	flaky := &flakySignal{Signal: transportc.NewDebugSignal(8), failures: 2}
+
+	if _, err := transportc.RetrySignal(2, time.Millisecond)(flaky).Offer([]byte("offer")); err == nil {
+		t.Fatal("Offer should fail after 2 attempts")
+	}
+
+	flaky.calls = 0
+	if _, err := transportc.RetrySignal(3, time.Millisecond)(flaky).Offer([]byte("offer")); err != nil {
+		t.Fatalf("Offer should succeed after 3 attempts: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package transportc_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// tcpPair returns both ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.(*net.TCPConn), server.(*net.TCPConn)
+}
+
+// Positive Test for Splice between a Conn and a TCP connection.
+func TestSplice(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	listener, err := (&transportc.Config{Signal: signal}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+
+	backend, relayed := tcpPair(t)
+	defer backend.Close()
+
+	var stats transportc.SpliceStats
+	spliced := make(chan error, 1)
+	go func() {
+		spliced <- transportc.Splice(sConn, relayed, transportc.WithSpliceStats(&stats))
+	}()
+
+	if _, err := cConn.Write([]byte("request")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, 64)
+	n, err := io.ReadFull(backend, buf[:len("request")])
+	if err != nil || string(buf[:n]) != "request" {
+		t.Fatalf("backend read %q, %v, expected request", buf[:n], err)
+	}
+	if _, err := backend.Write([]byte("response")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	n, err = cConn.Read(buf)
+	if err != nil || string(buf[:n]) != "response" {
+		t.Fatalf("Read %q, %v, expected response", buf[:n], err)
+	}
+	if aToB, bToA := stats.AToB.Load(), stats.BToA.Load(); aToB != 7 || bToA != 8 {
+		t.Fatalf("SpliceStats counted %d and %d bytes, expected 7 and 8", aToB, bToA)
+	}
+
+	// a Conn cannot be half-closed, so closing it ends the splice
+	cConn.Close()
+	select {
+	case err := <-spliced:
+		if err != nil {
+			t.Fatalf("Splice returned %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Splice not done once the Conn closed")
+	}
+	if _, err := backend.Read(buf); err != io.EOF {
+		t.Fatalf("backend read returned %v, expected io.EOF", err)
+	}
+}
+
+// Positive Test for the half-close propagation and the idle timeout of
+// Splice.
+func TestSpliceHalfCloseAndIdle(t *testing.T) {
+	client, relayedClient := tcpPair(t)
+	defer client.Close()
+	relayedServer, server := tcpPair(t)
+	defer server.Close()
+
+	spliced := make(chan error, 1)
+	go func() {
+		spliced <- transportc.Splice(relayedClient, relayedServer, transportc.WithSpliceIdleTimeout(500*time.Millisecond))
+	}()
+
+	// the server reads the request until EOF, then responds
+	if _, err := client.Write([]byte("request")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	client.CloseWrite()
+	request, err := io.ReadAll(server)
+	if err != nil || string(request) != "request" {
+		t.Fatalf("server read %q, %v, expected request", request, err)
+	}
+	if _, err := server.Write([]byte("response")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, 64)
+	n, err := io.ReadFull(client, buf[:len("response")])
+	if err != nil || string(buf[:n]) != "response" {
+		t.Fatalf("client read %q, %v, expected response", buf[:n], err)
+	}
+
+	// nothing more is copied, the splice times out idle
+	select {
+	case err := <-spliced:
+		if err != nil {
+			t.Fatalf("Splice returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Splice not done once idle")
+	}
+}
@@ -0,0 +1,104 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/sshtunnel"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHTunnel(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		NoClientAuth: true,
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	tunnelConfig := &sshtunnel.Config{
+		KeepaliveInterval: 500 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	// Echo every channel opened
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, reqs, err := tunnelConfig.Server(ctx, conn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for newChannel := range chans {
+			channel, channelReqs, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(channelReqs)
+			go io.Copy(channel, channel)
+		}
+	}()
+
+	client, err := tunnelConfig.Dial(ctx, dialer, "RANDOM_LABEL", &ssh.ClientConfig{
+		HostKeyCallback: ssh.FixedHostKey(hostSigner.PublicKey()),
+	})
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer client.Close()
+
+	channel, channelReqs, err := client.OpenChannel("echo", nil)
+	if err != nil {
+		t.Fatalf("OpenChannel error: %v", err)
+	}
+	go ssh.DiscardRequests(channelReqs)
+
+	// Keepalives are exchanged in the meantime
+	time.Sleep(2 * time.Second)
+
+	// Write more than one SSH packet
+	msg := make([]byte, 100000)
+	rand.Read(msg)
+	go channel.Write(msg)
+
+	recv := make([]byte, len(msg))
+	if _, err := io.ReadFull(channel, recv); err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if !bytes.Equal(msg, recv) {
+		t.Fatal("Read returned wrong message")
+	}
+}
@@ -0,0 +1,83 @@
+package transportc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// Positive Test for Config.ListenerStandbyOffers, with more Conns dialed via
+// Dialer.DialStandby than offers in standby at once.
+func TestListenerStandby(t *testing.T) {
+	standbySignal := transportc.NewDebugSignal(8)
+	listener, err := (&transportc.Config{
+		ListenerStandbySignal: standbySignal,
+		ListenerStandbyOffers: 2,
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: standbySignal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel() // cancel the context to make sure it is done
+
+		cConn, err := dialer.DialStandby(ctx, "RANDOM_LABEL")
+		if err != nil {
+			t.Fatalf("DialStandby error: %v", err)
+		}
+		defer cConn.Close() // skipcq: GO-S2307
+
+		sConn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept error: %v", err)
+		}
+		defer sConn.Close() // skipcq: GO-S2307
+		if label := sConn.(*transportc.Conn).Label(); label != "RANDOM_LABEL" {
+			t.Fatalf("accepted Conn labeled %q, expected RANDOM_LABEL", label)
+		}
+
+		buf := make([]byte, 64)
+		if _, err := cConn.Write([]byte("Hello")); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if n, err := sConn.Read(buf); err != nil || string(buf[:n]) != "Hello" {
+			t.Fatalf("Read %q, %v, expected Hello", buf[:n], err)
+		}
+		if _, err := sConn.Write([]byte("World")); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		cConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if n, err := cConn.Read(buf); err != nil || string(buf[:n]) != "World" {
+			t.Fatalf("Read %q, %v, expected World", buf[:n], err)
+		}
+	}
+}
+
+// Negative Test for standby offers without a Signal.
+func TestListenerStandbyWithoutSignal(t *testing.T) {
+	if _, err := (&transportc.Config{ListenerStandbyOffers: 1}).NewListener(); !errors.Is(err, transportc.ErrStandbyWithoutSignal) {
+		t.Fatalf("NewListener returned %v, expected ErrStandbyWithoutSignal", err)
+	}
+
+	dialer, err := (&transportc.Config{}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+	if _, err := dialer.DialStandby(context.Background(), "RANDOM_LABEL"); !errors.Is(err, transportc.ErrStandbyWithoutSignal) {
+		t.Fatalf("DialStandby returned %v, expected ErrStandbyWithoutSignal", err)
+	}
+}
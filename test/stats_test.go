@@ -0,0 +1,248 @@
+package transportc_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestStatsByTag(t *testing.T) {
+	stats := transportc.NewStats()
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+		Stats:  stats,
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL", transportc.WithTag("client"))
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	sConn, ok := conn.(*transportc.Conn)
+	if !ok {
+		t.Fatalf("Accept returned %T, expected *transportc.Conn", conn)
+	}
+	sConn.SetTag("server")
+
+	_, err = cConn.Write([]byte("Hello"))
+	if err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+
+	buf := make([]byte, 16)
+	_, err = sConn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+
+	clientStats := stats.Tag("client")
+	if clientStats.ActiveConns != 1 || clientStats.BytesWritten != 5 {
+		t.Fatalf("Unexpected client stats: %+v", clientStats)
+	}
+
+	serverStats := stats.Tag("server")
+	if serverStats.ActiveConns != 1 || serverStats.BytesRead != 5 {
+		t.Fatalf("Unexpected server stats: %+v", serverStats)
+	}
+
+	if untagged := stats.Tag(""); untagged.ActiveConns != 0 || untagged.TotalConns != 1 {
+		t.Fatalf("Unexpected untagged stats: %+v", untagged)
+	}
+
+	cConn.Close()
+	if clientStats = stats.Tag("client"); clientStats.ActiveConns != 0 {
+		t.Fatalf("ActiveConns is %d after Close, expected 0", clientStats.ActiveConns)
+	}
+}
+
+func TestStatsListener(t *testing.T) {
+	stats := transportc.NewStats()
+	listenerConfig := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+		Stats:  stats,
+	}
+
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	// the Dialer is not tracked, so only the Listener is observed
+	dialer, err := (&transportc.Config{Signal: listenerConfig.Signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	listenerStats := stats.Listener()
+	if listenerStats.PeerConnections != 1 || listenerStats.ICEConnected != 1 || listenerStats.ICEFailed != 0 {
+		t.Fatalf("Unexpected listener stats: %+v", listenerStats)
+	}
+	if rate := listenerStats.ICEFailureRate(); rate != 0 {
+		t.Fatalf("ICEFailureRate is %v, expected 0", rate)
+	}
+	latency := listenerStats.AcceptLatency
+	if latency.Count != 1 || latency.Sum <= 0 {
+		t.Fatalf("Unexpected accept latency: %+v", latency)
+	}
+	if last := latency.Buckets[len(latency.Buckets)-1]; last.Count != 1 {
+		t.Fatalf("Accept latency above %v, expected within", last.UpperBound)
+	}
+
+	recorder := httptest.NewRecorder()
+	stats.PrometheusHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("PrometheusHandler returned %d", recorder.Code)
+	}
+	body := recorder.Body.String()
+	for _, line := range []string{
+		`transportc_conns_active{tag=""} 1`,
+		`transportc_listener_accept_latency_seconds_bucket{le="+Inf"} 1`,
+		`transportc_listener_accept_latency_seconds_count 1`,
+		`transportc_listener_peer_connections_total 1`,
+		`transportc_listener_ice_connected_total 1`,
+		`transportc_listener_ice_failed_total 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("PrometheusHandler output missing %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestConnCloseReason(t *testing.T) {
+	stats := transportc.NewStats()
+	config := &transportc.Config{
+		Signal:              transportc.NewDebugSignal(8),
+		Stats:               stats,
+		ReusePeerConnection: true,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL", transportc.WithTag("client"))
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+	sConn := conn.(*transportc.Conn)
+	sConn.SetTag("server")
+
+	if reason := sConn.CloseReason(); reason != transportc.CLOSE_REASON_NONE {
+		t.Fatalf("CloseReason of an open Conn is %s, expected none", reason)
+	}
+
+	// the reason recorded first is kept, even once closed by the application
+	cConn.Close()
+	sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := sConn.Read(make([]byte, 16)); err != io.EOF {
+		t.Fatalf("Read after the remote Close returned %v, expected io.EOF", err)
+	}
+	sConn.Close()
+	if reason := cConn.(*transportc.Conn).CloseReason(); reason != transportc.CLOSE_REASON_LOCAL {
+		t.Fatalf("CloseReason of the Conn closed locally is %s, expected local", reason)
+	}
+	if reason := sConn.CloseReason(); reason != transportc.CLOSE_REASON_REMOTE {
+		t.Fatalf("CloseReason of the Conn closed remotely is %s, expected remote", reason)
+	}
+
+	cConn2, err := dialer.DialContext(ctx, "RANDOM_LABEL_2", transportc.WithTag("client"))
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn2.Close() // skipcq: GO-S2307
+
+	conn2, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer conn2.Close() // skipcq: GO-S2307
+	sConn2 := conn2.(*transportc.Conn)
+	sConn2.SetTag("server")
+	if err := listener.ClosePeer(sConn2.PeerID()); err != nil {
+		t.Fatalf("ClosePeer error: %v", err)
+	}
+	if reason := sConn2.CloseReason(); reason != transportc.CLOSE_REASON_PEER_CLOSED {
+		t.Fatalf("CloseReason of the Conn closed by ClosePeer is %s, expected peer_closed", reason)
+	}
+
+	if closed := stats.Tag("client").ClosedConns; closed[transportc.CLOSE_REASON_LOCAL] != 1 {
+		t.Fatalf("Client Conns closed by reason %v, expected 1 local", closed)
+	}
+	if closed := stats.Tag("server").ClosedConns; closed[transportc.CLOSE_REASON_REMOTE] != 1 || closed[transportc.CLOSE_REASON_PEER_CLOSED] != 1 {
+		t.Fatalf("Server Conns closed by reason %v, expected 1 remote and 1 peer_closed", closed)
+	}
+
+	recorder := httptest.NewRecorder()
+	stats.PrometheusHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if metric := `transportc_conns_closed_total{tag="server",reason="remote"} 1`; !strings.Contains(recorder.Body.String(), metric) {
+		t.Fatalf("Prometheus output lacks %s:\n%s", metric, recorder.Body.String())
+	}
+}
@@ -0,0 +1,164 @@
+// Command compatpeer echoes every message on the Conns it dials or accepts,
+// built against a pinned previous version of transportc by
+// TestWireCompatibility. It only uses the API of the oldest version tested.
+//
+// The SDP offers and answers are exchanged with the test over stdin and
+// stdout, one per line:
+//
+//	offer <offerID> <base64 SDP>
+//	answer <offerID> <base64 SDP>
+//
+// It exits once stdin is closed.
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gaukas/transportc"
+)
+
+type offer struct {
+	id  uint64
+	sdp []byte
+}
+
+// stdioSignal implements transportc.Signal over stdin and stdout.
+type stdioSignal struct {
+	offers chan offer
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	answers map[uint64][]byte
+	nextID  uint64
+}
+
+func newStdioSignal() *stdioSignal {
+	s := &stdioSignal{
+		offers:  make(chan offer, 8),
+		answers: make(map[uint64][]byte),
+		nextID:  1,
+	}
+	s.cond = sync.NewCond(&s.mutex)
+	go s.readLoop()
+	return s
+}
+
+func (s *stdioSignal) readLoop() {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			log.Fatalf("compatpeer: malformed line %q", scanner.Text())
+		}
+		id, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			log.Fatalf("compatpeer: malformed offer ID: %v", err)
+		}
+		sdp, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			log.Fatalf("compatpeer: malformed SDP: %v", err)
+		}
+
+		switch fields[0] {
+		case "offer":
+			s.offers <- offer{id: id, sdp: sdp}
+		case "answer":
+			s.mutex.Lock()
+			s.answers[id] = sdp
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+		}
+	}
+	os.Exit(0) // stdin closed, the test is done
+}
+
+func (*stdioSignal) write(kind string, id uint64, sdp []byte) {
+	fmt.Printf("%s %d %s\n", kind, id, base64.StdEncoding.EncodeToString(sdp))
+}
+
+func (s *stdioSignal) Offer(sdp []byte) (uint64, error) {
+	s.mutex.Lock()
+	id := s.nextID
+	s.nextID++
+	s.mutex.Unlock()
+	s.write("offer", id, sdp)
+	return id, nil
+}
+
+func (s *stdioSignal) ReadOffer() (uint64, []byte, error) {
+	o := <-s.offers
+	return o.id, o.sdp, nil
+}
+
+func (s *stdioSignal) Answer(id uint64, sdp []byte) error {
+	s.write("answer", id, sdp)
+	return nil
+}
+
+func (s *stdioSignal) ReadAnswer(id uint64) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for s.answers[id] == nil {
+		s.cond.Wait()
+	}
+	answer := s.answers[id]
+	delete(s.answers, id)
+	return answer, nil
+}
+
+func echo(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: compatpeer dial|listen")
+	}
+	config := &transportc.Config{Signal: newStdioSignal()}
+
+	switch os.Args[1] {
+	case "dial":
+		dialer, err := config.NewDialer()
+		if err != nil {
+			log.Fatalf("compatpeer: NewDialer: %v", err)
+		}
+		conn, err := dialer.Dial("compat")
+		if err != nil {
+			log.Fatalf("compatpeer: Dial: %v", err)
+		}
+		echo(conn)
+	case "listen":
+		listener, err := config.NewListener()
+		if err != nil {
+			log.Fatalf("compatpeer: NewListener: %v", err)
+		}
+		listener.Start()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Fatalf("compatpeer: Accept: %v", err)
+			}
+			go echo(conn)
+		}
+	}
+	select {} // until stdin is closed
+}
@@ -0,0 +1,243 @@
+package transportc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func newTicketKey(t *testing.T) []byte {
+	key := make([]byte, transportc.TICKET_KEY_MIN_SIZE)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// tokenFilter only admits offers carrying the token, as a broker would
+// authenticate the Dialers.
+func tokenFilter(info transportc.OfferInfo) error {
+	if info.Metadata["token"] != "secret" {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// Positive Test for Config.ListenerTicketKey: the ticket issued on the first
+// connection skips ListenerOfferFilter on the next ones, including from a new
+// Dialer set with the ticket persisted
+func TestReconnectTicket(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	listener, err := (&transportc.Config{
+		Signal:              signal,
+		ListenerTicketKey:   newTicketKey(t),
+		ListenerOfferFilter: tokenFilter,
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL", transportc.WithOfferMetadata(map[string]string{"token": "secret"}))
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+	if sConn.(*transportc.Conn).Reconnected() {
+		t.Fatal("Conn accepted without ticket is reconnected")
+	}
+
+	ticket := dialer.ReconnectTicket()
+	if ticket == "" {
+		t.Fatal("no reconnect ticket issued")
+	}
+
+	// Without the token, only the ticket gets the offer through the filter
+	reconnecting, err := (&transportc.Config{
+		Signal:                signal,
+		DialerReconnectTicket: ticket,
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reconnecting.Close()
+
+	cConn2, err := reconnecting.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext with ticket error: %v", err)
+	}
+	defer cConn2.Close() // skipcq: GO-S2307
+
+	sConn2, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn2.Close() // skipcq: GO-S2307
+	if !sConn2.(*transportc.Conn).Reconnected() {
+		t.Fatal("Conn accepted with ticket is not reconnected")
+	}
+	if reconnecting.ReconnectTicket() == "" {
+		t.Fatal("no reconnect ticket kept after reconnecting")
+	}
+}
+
+// Negative Test for Config.ListenerTicketKey with a ticket issued by a
+// Listener with another key, which MUST NOT skip ListenerOfferFilter
+func TestReconnectTicketInvalid(t *testing.T) {
+	issuing := transportc.NewDebugSignal(8)
+	issuer, err := (&transportc.Config{
+		Signal:            issuing,
+		ListenerTicketKey: newTicketKey(t),
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer issuer.Close()
+	issuer.Start()
+
+	dialer, err := (&transportc.Config{Signal: issuing}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	conn.Close()
+
+	signal := transportc.NewDebugSignal(8)
+	listener, err := (&transportc.Config{
+		Signal:              signal,
+		ListenerTicketKey:   newTicketKey(t),
+		ListenerOfferFilter: tokenFilter,
+	}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	reconnecting, err := (&transportc.Config{
+		Signal:                signal,
+		DialerReconnectTicket: dialer.ReconnectTicket(),
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reconnecting.Close()
+
+	// rejected before negotiation, so the Dialer waits for an answer in vain
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	if conn, err := reconnecting.DialContext(ctx, "RANDOM_LABEL"); err == nil {
+		conn.Close()
+		t.Fatal("DialContext succeeded with a ticket of another Listener")
+	}
+}
+
+// Negative Test for a reconnect ticket pinning the fingerprint of the
+// Listener that issued it, answered by a Listener with another certificate
+func TestReconnectTicketPinnedFingerprint(t *testing.T) {
+	key := newTicketKey(t)
+	newListener := func(signal transportc.Signal) *transportc.Listener {
+		certificate, err := transportc.GenerateCertificate(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener, err := (&transportc.Config{
+			Signal:            signal,
+			Certificates:      []transportc.Certificate{*certificate},
+			ListenerTicketKey: key,
+		}).NewListener()
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.Start()
+		return listener
+	}
+
+	signal := transportc.NewDebugSignal(8)
+	issuer := newListener(signal)
+	defer issuer.Close()
+
+	dialer, err := (&transportc.Config{Signal: signal}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	conn.Close()
+	issuer.Close()
+
+	// Same ticket key, but another certificate, e.g., an impostor
+	other := transportc.NewDebugSignal(8)
+	listener := newListener(other)
+	defer listener.Close()
+
+	reconnecting, err := (&transportc.Config{
+		Signal:                other,
+		DialerReconnectTicket: dialer.ReconnectTicket(),
+	}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reconnecting.Close()
+
+	if conn, err := reconnecting.DialContext(ctx, "RANDOM_LABEL"); !errors.Is(err, transportc.ErrFingerprintNotPinned) {
+		if err == nil {
+			conn.Close()
+		}
+		t.Fatalf("DialContext returned %v, expected ErrFingerprintNotPinned", err)
+	}
+	if reconnecting.ReconnectTicket() != "" {
+		t.Fatal("reconnect ticket kept after its fingerprint was not answered with")
+	}
+
+	// Without the ticket, the Dialer goes through the admission checks again
+	conn, err = reconnecting.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext without ticket error: %v", err)
+	}
+	conn.Close()
+}
+
+// Negative Test for Config.ListenerTicketKey shorter than TICKET_KEY_MIN_SIZE
+func TestNewListenerInvalidTicketKey(t *testing.T) {
+	_, err := (&transportc.Config{
+		Signal:            transportc.NewDebugSignal(8),
+		ListenerTicketKey: []byte("short"),
+	}).NewListener()
+	if !errors.Is(err, transportc.ErrInvalidTicketKey) {
+		t.Fatalf("NewListener returned %v, expected ErrInvalidTicketKey", err)
+	}
+}
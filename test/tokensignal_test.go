@@ -0,0 +1,164 @@
+package transportc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// uuidSignal is a TokenSignal identifying offers by random UUID-like tokens,
+// as a broker would.
+type uuidSignal struct {
+	offers chan uuidOffer
+
+	mutex   sync.Mutex
+	answers map[string][]byte
+}
+
+type uuidOffer struct {
+	id   string
+	body []byte
+}
+
+func newUUIDSignal() *uuidSignal {
+	return &uuidSignal{
+		offers:  make(chan uuidOffer, 8),
+		answers: make(map[string][]byte),
+	}
+}
+
+func (s *uuidSignal) Offer(offer []byte) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	s.offers <- uuidOffer{id: id, body: offer}
+	return id, nil
+}
+
+func (s *uuidSignal) ReadOffer() (string, []byte, error) {
+	select {
+	case offer := <-s.offers:
+		return offer.id, offer.body, nil
+	case <-time.After(100 * time.Millisecond):
+		return "", nil, transportc.ErrOfferNotReady
+	}
+}
+
+func (s *uuidSignal) Answer(offerID string, answer []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.answers[offerID] = answer
+	return nil
+}
+
+func (s *uuidSignal) ReadAnswer(offerID string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	answer, ok := s.answers[offerID]
+	if !ok {
+		return nil, transportc.ErrAnswerNotReady
+	}
+	delete(s.answers, offerID)
+	return answer, nil
+}
+
+func TestTokenSignal(t *testing.T) {
+	signal := transportc.FromTokenSignal(newUUIDSignal())
+	config := &transportc.Config{
+		Signal:                 signal,
+		ListenerRestartTimeout: 10 * time.Second,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	// the ICE restart refers to the first offer by the same offer ID on both
+	// ends
+	dialer.Pause()
+	if err := dialer.Resume(ctx); err != nil {
+		t.Fatalf("Resume error: %v", err)
+	}
+
+	msg := []byte("over opaque offer IDs")
+	if _, err := cConn.Write(msg); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, 1024)
+	sConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := sConn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if !bytes.Equal(buf[:n], msg) {
+		t.Fatalf("Read returned %q, expected %q", buf[:n], msg)
+	}
+}
+
+func TestToTokenSignal(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	ts := transportc.ToTokenSignal(signal)
+	if transportc.FromTokenSignal(ts) != transportc.Signal(signal) {
+		t.Fatal("FromTokenSignal should unwrap ToTokenSignal")
+	}
+
+	offerID, err := ts.Offer([]byte("offer"))
+	if err != nil {
+		t.Fatalf("Offer error: %v", err)
+	}
+	if _, err := strconv.ParseUint(offerID, 10, 64); err != nil {
+		t.Fatalf("Offer returned %q, expected a decimal offer ID", offerID)
+	}
+
+	readID, offer, err := ts.ReadOffer()
+	if err != nil {
+		t.Fatalf("ReadOffer error: %v", err)
+	}
+	if readID != offerID || string(offer) != "offer" {
+		t.Fatalf("ReadOffer returned %q: %q, expected %q: %q", readID, offer, offerID, "offer")
+	}
+
+	if err := ts.Answer("not-a-number", []byte("answer")); !errors.Is(err, transportc.ErrInvalidOfferID) {
+		t.Fatalf("Answer returned %v, expected ErrInvalidOfferID", err)
+	}
+	if err := ts.Answer(offerID, []byte("answer")); err != nil {
+		t.Fatalf("Answer error: %v", err)
+	}
+	if answer, err := ts.ReadAnswer(offerID); err != nil || string(answer) != "answer" {
+		t.Fatalf("ReadAnswer returned %q, %v", answer, err)
+	}
+}
@@ -0,0 +1,126 @@
+package transportc_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+// recordingTracer records the spans ended, propagating its trace IDs as the
+// "trace" key.
+type recordingTracer struct {
+	mutex  sync.Mutex
+	traces int
+	spans  []recordedSpan
+}
+
+type recordedSpan struct {
+	name   string
+	parent string
+	trace  string
+	err    error
+}
+
+type spanContextKey struct{}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	recordedSpan
+}
+
+func (s *recordingSpan) End(err error) {
+	s.err = err
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s.recordedSpan)
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ ...transportc.TraceAttribute) (context.Context, transportc.Span) {
+	span := &recordingSpan{tracer: t, recordedSpan: recordedSpan{name: name}}
+	if parent, ok := ctx.Value(spanContextKey{}).(*recordingSpan); ok {
+		span.parent, span.trace = parent.name, parent.trace
+	} else {
+		t.mutex.Lock()
+		t.traces++
+		span.trace = strconv.Itoa(t.traces)
+		t.mutex.Unlock()
+	}
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+func (*recordingTracer) Inject(ctx context.Context) map[string]string {
+	if span, ok := ctx.Value(spanContextKey{}).(*recordingSpan); ok {
+		return map[string]string{"trace": span.trace}
+	}
+	return nil
+}
+
+func (t *recordingTracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	remote := &recordingSpan{tracer: t, recordedSpan: recordedSpan{name: "remote", trace: carrier["trace"]}}
+	return context.WithValue(ctx, spanContextKey{}, remote)
+}
+
+func (t *recordingTracer) span(name string) (recordedSpan, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, span := range t.spans {
+		if span.name == name {
+			return span, true
+		}
+	}
+	return recordedSpan{}, false
+}
+
+func TestTracer(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+	tracer := &recordingTracer{}
+
+	listener, err := (&transportc.Config{Signal: signal, Tracer: tracer}).NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := (&transportc.Config{Signal: signal, Tracer: tracer}).NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	dial, ok := tracer.span(transportc.SPAN_DIAL)
+	if !ok || dial.err != nil || dial.parent != "" {
+		t.Fatalf("SPAN_DIAL recorded as %+v, expected a root span without error", dial)
+	}
+	for _, name := range []string{transportc.SPAN_ICE_GATHER, transportc.SPAN_SIGNAL} {
+		span, ok := tracer.span(name)
+		if !ok || span.err != nil || span.trace != dial.trace {
+			t.Fatalf("%s recorded as %+v, expected in the trace of SPAN_DIAL", name, span)
+		}
+	}
+
+	// the Listener joins the trace of the Dialer carried by the offer
+	accept, ok := tracer.span(transportc.SPAN_ACCEPT)
+	if !ok || accept.err != nil || accept.parent != "remote" || accept.trace != dial.trace {
+		t.Fatalf("SPAN_ACCEPT recorded as %+v, expected in the trace of SPAN_DIAL", accept)
+	}
+}
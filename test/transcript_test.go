@@ -0,0 +1,113 @@
+package transportc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/pion/webrtc/v3"
+)
+
+// Positive Test for Config.RecordTranscript, on both the Dialer and Listener
+func TestConnTranscript(t *testing.T) {
+	config := &transportc.Config{
+		Signal:           transportc.NewDebugSignal(8),
+		RecordTranscript: true,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	for side, conn := range map[string]*transportc.Conn{"dialer": cConn.(*transportc.Conn), "listener": sConn.(*transportc.Conn)} {
+		transcript := conn.Transcript()
+		if transcript == nil {
+			t.Fatalf("%s: Transcript returned nil", side)
+		}
+		if transcript.Offer.Type != webrtc.SDPTypeOffer || transcript.Offer.SDP == "" {
+			t.Fatalf("%s: offer not recorded: %+v", side, transcript.Offer)
+		}
+		if transcript.Answer.Type != webrtc.SDPTypeAnswer || transcript.Answer.SDP == "" {
+			t.Fatalf("%s: answer not recorded: %+v", side, transcript.Answer)
+		}
+
+		recorded := make(map[transportc.TranscriptEventType]int)
+		for _, event := range transcript.Events {
+			recorded[event.Type]++
+		}
+		for _, eventType := range []transportc.TranscriptEventType{
+			transportc.TRANSCRIPT_LOCAL_CANDIDATE,
+			transportc.TRANSCRIPT_GATHERING_COMPLETE,
+			transportc.TRANSCRIPT_ICE_STATE,
+			transportc.TRANSCRIPT_PC_STATE,
+			transportc.TRANSCRIPT_SELECTED_PAIR,
+		} {
+			if recorded[eventType] == 0 {
+				t.Fatalf("%s: no %s event recorded in %+v", side, eventType, transcript.Events)
+			}
+		}
+
+		conn.Close()
+		if transcript := conn.Transcript(); transcript != nil {
+			t.Fatalf("%s: Transcript not purged on Close", side)
+		}
+	}
+}
+
+// Negative Test for Conn.Transcript without Config.RecordTranscript
+func TestConnTranscriptDisabled(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	if transcript := cConn.(*transportc.Conn).Transcript(); transcript != nil {
+		t.Fatalf("Transcript returned %+v, expected nil", transcript)
+	}
+}
@@ -0,0 +1,177 @@
+package transportc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// startTURNServer starts a local TURN server, closed along with t, and returns
+// its ICE server.
+func startTURNServer(t *testing.T) webrtc.ICEServer {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authKey := turn.GenerateAuthKey("user", "transportc", "pass")
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm: "transportc",
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			return authKey, username == "user"
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: udpListener,
+			RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	return webrtc.ICEServer{
+		URLs:       []string{"turn:" + udpListener.LocalAddr().String() + "?transport=udp"},
+		Username:   "user",
+		Credential: "pass",
+	}
+}
+
+// Positive Test for Dialer.TURNState and Stats.TURN with a local TURN server.
+func TestTURNState(t *testing.T) {
+	iceServer := startTURNServer(t)
+	turnAddr := strings.TrimSuffix(strings.TrimPrefix(iceServer.URLs[0], "turn:"), "?transport=udp")
+
+	stats := transportc.NewStats()
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+		Stats:  stats,
+	}
+
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer.UpdateICEServers([]webrtc.ICEServer{iceServer})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "turn")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+
+	state := dialer.TURNState()
+	if len(state.Allocations) != 1 {
+		t.Fatalf("Expected 1 TURN allocation, got %+v", state)
+	}
+	allocation := state.Allocations[0]
+	if !strings.Contains(allocation.Server, turnAddr) || !allocation.Expiry.After(time.Now()) || allocation.RefreshFailures != 0 {
+		t.Fatalf("Unexpected TURN allocation: %+v", allocation)
+	}
+	if len(state.RelayedAddrs) != 1 || state.RelayedAddrs[0].Hostname != "127.0.0.1" {
+		t.Fatalf("Unexpected relayed addresses: %+v", state.RelayedAddrs)
+	}
+	if connState := conn.(*transportc.Conn).TURNState(); len(connState.Allocations) != 1 {
+		t.Fatalf("Expected 1 TURN allocation on the Conn, got %+v", connState)
+	}
+	if turnStats := stats.TURN(); turnStats.ActiveAllocations != 1 || turnStats.TotalAllocations != 1 {
+		t.Fatalf("Unexpected TURN stats: %+v", turnStats)
+	}
+
+	conn.Close()
+	dialer.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for stats.TURN().ActiveAllocations != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("TURN allocation not released: %+v", stats.TURN())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if state := dialer.TURNState(); len(state.Allocations) != 0 {
+		t.Fatalf("Expected no TURN allocation after Close, got %+v", state)
+	}
+}
+
+// Positive Test for Config.ICEPairPolicy, nominating a relay pair only with
+// ICE_PAIR_POLICY_PREFER_RELAY while direct pairs are available.
+func TestICEPairPolicy(t *testing.T) {
+	iceServer := startTURNServer(t)
+
+	for _, policy := range []transportc.ICEPairPolicy{
+		transportc.ICE_PAIR_POLICY_DEFAULT,
+		transportc.ICE_PAIR_POLICY_PREFER_HOST,
+		transportc.ICE_PAIR_POLICY_PREFER_RELAY,
+		transportc.ICE_PAIR_POLICY_PREFER_LOWEST_RTT,
+	} {
+		policy := policy
+		t.Run(policy.String(), func(t *testing.T) {
+			config := &transportc.Config{
+				Signal:        transportc.NewDebugSignal(8),
+				ICEPairPolicy: policy,
+				WebRTCConfiguration: webrtc.Configuration{
+					ICEServers: []webrtc.ICEServer{iceServer},
+				},
+			}
+			listener, err := config.NewListener()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			listener.Start()
+
+			dialer, err := config.NewDialer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dialer.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel() // cancel the context to make sure it is done
+
+			conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+			if err != nil {
+				t.Fatalf("DialContext error: %v", err)
+			}
+			defer conn.Close() // skipcq: GO-S2307
+
+			expected := policy == transportc.ICE_PAIR_POLICY_PREFER_RELAY
+			if relayed := conn.(*transportc.Conn).TURNState().Relayed; relayed != expected {
+				t.Fatalf("relayed is %v, expected %v", relayed, expected)
+			}
+		})
+	}
+}
+
+// Negative Test for Config.ICEPairPolicy with an unknown policy.
+func TestICEPairPolicyInvalid(t *testing.T) {
+	config := &transportc.Config{
+		Signal:        transportc.NewDebugSignal(8),
+		ICEPairPolicy: transportc.ICE_PAIR_POLICY_PREFER_LOWEST_RTT + 1,
+	}
+	if _, err := config.NewDialer(); !errors.Is(err, transportc.ErrInvalidICEPairPolicy) {
+		t.Fatalf("NewDialer returned %v, expected ErrInvalidICEPairPolicy", err)
+	}
+	if _, err := config.NewListener(); !errors.Is(err, transportc.ErrInvalidICEPairPolicy) {
+		t.Fatalf("NewListener returned %v, expected ErrInvalidICEPairPolicy", err)
+	}
+}
@@ -0,0 +1,89 @@
+package transportc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+	"github.com/gaukas/transportc/wgbind"
+)
+
+func TestWireGuardBind(t *testing.T) {
+	config := &transportc.Config{
+		Signal: transportc.NewDebugSignal(8),
+	}
+
+	// Setup a listener to accept the connection first
+	listener, err := config.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialer, err := config.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+
+	cConn, err := dialer.DialDatagramContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialDatagramContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer conn.Close() // skipcq: GO-S2307
+
+	clientBind := wgbind.NewBind()
+	clientBind.AddConn("server", cConn)
+	serverBind := wgbind.NewBind()
+	serverBind.AddConn("client", conn.(*transportc.DatagramConn))
+
+	if _, _, err := clientBind.Open(0); err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	defer clientBind.Close()
+	fns, _, err := serverBind.Open(51820)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+
+	ep, err := clientBind.ParseEndpoint("server")
+	if err != nil {
+		t.Fatalf("ParseEndpoint error: %v", err)
+	}
+	if err := clientBind.Send([]byte("Hello"), ep); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	buf := make([]byte, 1500)
+	n, from, err := fns[0](buf)
+	if err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	if string(buf[:n]) != "Hello" || from.DstToString() != "client" {
+		t.Fatalf("Received %q from %s, expected \"Hello\" from client", buf[:n], from.DstToString())
+	}
+
+	unknown, _ := clientBind.ParseEndpoint("unknown")
+	if err := clientBind.Send([]byte("Hello"), unknown); err != wgbind.ErrUnknownEndpoint {
+		t.Fatalf("Send to unknown endpoint should fail with ErrUnknownEndpoint, got %v", err)
+	}
+
+	serverBind.Close()
+	if _, _, err := fns[0](buf); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Receive after Close should fail with net.ErrClosed, got %v", err)
+	}
+}
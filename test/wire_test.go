@@ -0,0 +1,106 @@
+package transportc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaukas/transportc"
+)
+
+func TestWireHandshake(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	listenerConfig := &transportc.Config{
+		Signal:        signal,
+		WireHandshake: true,
+		WireFeatures:  0b0101,
+	}
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{
+		Signal:        signal,
+		WireHandshake: true,
+		WireFeatures:  0b0110,
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	cConn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if err != nil {
+		t.Fatalf("DialContext error: %v", err)
+	}
+	defer cConn.Close() // skipcq: GO-S2307
+
+	sConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	defer sConn.Close() // skipcq: GO-S2307
+
+	for _, conn := range []*transportc.Conn{cConn.(*transportc.Conn), sConn.(*transportc.Conn)} {
+		if conn.WireVersion() != transportc.WIRE_VERSION {
+			t.Fatalf("WireVersion is %d, expected %d", conn.WireVersion(), transportc.WIRE_VERSION)
+		}
+		if conn.WireFeatures() != 0b0100 {
+			t.Fatalf("WireFeatures is %b, expected 100", conn.WireFeatures())
+		}
+	}
+
+	// the handshake messages are not surfaced to Read
+	if _, err := cConn.Write([]byte("Hello")); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	buf := make([]byte, 16)
+	if n, err := sConn.Read(buf); err != nil || string(buf[:n]) != "Hello" {
+		t.Fatalf("Read returned %q, %v", buf[:n], err)
+	}
+}
+
+// Negative Test for the wire handshake with a remote peer in raw mode
+func TestWireHandshakeRawPeer(t *testing.T) {
+	signal := transportc.NewDebugSignal(8)
+
+	listenerConfig := &transportc.Config{
+		Signal: signal,
+	}
+	listener, err := listenerConfig.NewListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	listener.Start()
+
+	dialerConfig := &transportc.Config{
+		Signal:        signal,
+		WireHandshake: true,
+	}
+	dialer, err := dialerConfig.NewDialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel() // cancel the context to make sure it is done
+	conn, err := dialer.DialContext(ctx, "RANDOM_LABEL")
+	if conn != nil {
+		conn.Close()
+	}
+	if !errors.Is(err, transportc.ErrWireHandshake) {
+		t.Fatalf("DialContext returned %v, expected ErrWireHandshake", err)
+	}
+}
@@ -0,0 +1,213 @@
+package transportc
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	TICKET_VERSION         uint8 = 1
+	TICKET_TTL_DEFAULT           = 24 * time.Hour
+	TICKET_KEY_MIN_SIZE          = 32
+	TICKET_ACCEPT_PRIORITY       = math.MaxInt // priority of the Conns of a ticketed PeerConnection, see Config.ListenerAcceptPriority
+)
+
+var (
+	// ErrInvalidTicketKey is returned when Config.ListenerTicketKey is
+	// shorter than TICKET_KEY_MIN_SIZE.
+	ErrInvalidTicketKey = errors.New("reconnect ticket key too short")
+
+	// ErrInvalidTicket is returned when a reconnect ticket is malformed, or
+	// not MACed with the key of the Listener.
+	ErrInvalidTicket = errors.New("invalid reconnect ticket")
+
+	// ErrTicketExpired is returned when a reconnect ticket is expired.
+	ErrTicketExpired = errors.New("reconnect ticket expired")
+)
+
+// reconnectTicket is the payload of a reconnect ticket, issued by a Listener
+// in its answer, see Config.ListenerTicketKey.
+//
+// The ticket is opaque to applications, but not encrypted: the Dialer reads
+// Fingerprint to pin it when reconnecting, see Dialer.ReconnectTicket.
+type reconnectTicket struct {
+	Version uint8 `json:"v"`
+
+	// Namespace the PeerConnection was accepted in, see Listener.Namespace
+	Namespace string `json:"ns,omitempty"`
+
+	// Identity of the Dialer the ticket was issued to, if it signed its offer
+	Identity ed25519.PublicKey `json:"pk,omitempty"`
+
+	// DTLS fingerprint of the Listener, if its certificates are static, see
+	// Config.Certificates
+	Fingerprint string `json:"fp,omitempty"`
+
+	// Issued-at and expiry times in Unix seconds
+	IssuedAt int64 `json:"iat"`
+	Expiry   int64 `json:"exp"`
+}
+
+// issueTicket encodes ticket as base64(payload).base64(HMAC-SHA256(payload)),
+// MACed with key.
+func issueTicket(key []byte, ticket *reconnectTicket) (string, error) {
+	payload, err := json.Marshal(ticket)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(ticketMAC(key, encoded)), nil
+}
+
+// openTicket verifies the MAC of ticket with key, then its expiry.
+func openTicket(key []byte, ticket string) (*reconnectTicket, error) {
+	encoded, mac, ok := strings.Cut(ticket, ".")
+	if !ok {
+		return nil, ErrInvalidTicket
+	}
+	decodedMAC, err := base64.RawURLEncoding.DecodeString(mac)
+	if err != nil || !hmac.Equal(decodedMAC, ticketMAC(key, encoded)) {
+		return nil, ErrInvalidTicket
+	}
+
+	t, err := parseTicket(ticket)
+	if err != nil {
+		return nil, err
+	}
+	if t.expired() {
+		return nil, ErrTicketExpired
+	}
+	return t, nil
+}
+
+// parseTicket decodes the payload of ticket without verifying its MAC, as
+// the Dialer does not have the key.
+func parseTicket(ticket string) (*reconnectTicket, error) {
+	encoded, _, _ := strings.Cut(ticket, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidTicket
+	}
+
+	var t reconnectTicket
+	if err := json.Unmarshal(payload, &t); err != nil || t.Version != TICKET_VERSION {
+		return nil, ErrInvalidTicket
+	}
+	return &t, nil
+}
+
+func (t *reconnectTicket) expired() bool {
+	return !currentClock().Now().Before(time.Unix(t.Expiry, 0))
+}
+
+func ticketMAC(key []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// verifyTicket returns true if the offer of envelope carries a valid
+// reconnect ticket, issued for its namespace and, if bound, to remoteIdentity.
+// Invalid tickets are ignored, so the offer goes through the admission checks.
+func (l *Listener) verifyTicket(envelope *sdpEnvelope, remoteIdentity ed25519.PublicKey) bool {
+	if len(l.ticketKey) == 0 || envelope.Ticket == "" {
+		return false
+	}
+
+	ticket, err := openTicket(l.ticketKey, envelope.Ticket)
+	if err != nil {
+		l.logger.Debugf("listener: ignoring reconnect ticket: %v", err)
+		return false
+	}
+	if ticket.Namespace != envelope.Namespace {
+		l.logger.Debugf("listener: ignoring reconnect ticket issued for namespace %q", ticket.Namespace)
+		return false
+	}
+	if len(ticket.Identity) > 0 && !bytes.Equal(ticket.Identity, remoteIdentity) {
+		l.logger.Debugf("listener: ignoring reconnect ticket issued to another peer")
+		return false
+	}
+	return true
+}
+
+// issueTicket returns a reconnect ticket for the PeerConnection answering
+// with answer, accepted in namespace from the peer of remoteIdentity, or an
+// empty string if tickets are not enabled.
+func (l *Listener) issueTicket(answer *sdpEnvelope, namespace string, remoteIdentity ed25519.PublicKey) string {
+	if len(l.ticketKey) == 0 {
+		return ""
+	}
+
+	now := currentClock().Now()
+	ticket := &reconnectTicket{
+		Version:   TICKET_VERSION,
+		Namespace: namespace,
+		Identity:  remoteIdentity,
+		IssuedAt:  now.Unix(),
+		Expiry:    now.Add(l.ticketTTL).Unix(),
+	}
+	if l.staticCertificates { // otherwise, each PeerConnection has its own
+		ticket.Fingerprint = dtlsFingerprint(&answer.SessionDescription)
+	}
+	issued, err := issueTicket(l.ticketKey, ticket)
+	if err != nil {
+		l.logger.Warnf("listener: failed to issue reconnect ticket: %v", err)
+		return ""
+	}
+	return issued
+}
+
+// reconnectTicket returns the reconnect ticket to submit in the next offer,
+// unless expired or issued for another namespace.
+func (d *Dialer) reconnectTicket() string {
+	d.ticketMutex.Lock()
+	issued := d.ticket
+	d.ticketMutex.Unlock()
+	if issued == "" {
+		return ""
+	}
+
+	ticket, err := parseTicket(issued)
+	if err != nil || ticket.expired() || ticket.Namespace != d.namespace {
+		return ""
+	}
+	return issued
+}
+
+// storeTicket keeps ticket for the next offers, once its PeerConnection is
+// connected.
+func (d *Dialer) storeTicket(ticket string) {
+	if ticket == "" {
+		return
+	}
+	d.ticketMutex.Lock()
+	d.ticket = ticket
+	d.ticketMutex.Unlock()
+}
+
+// dropTicket forgets ticket, unless replaced meanwhile, so the next offers
+// go through the admission checks of the Listener.
+func (d *Dialer) dropTicket(ticket string) {
+	d.ticketMutex.Lock()
+	if d.ticket == ticket {
+		d.ticket = ""
+	}
+	d.ticketMutex.Unlock()
+}
+
+// ReconnectTicket returns the reconnect ticket issued by the Listener on the
+// last successful connection, or the Config.DialerReconnectTicket, e.g., to
+// be persisted across restarts. It is an empty string if none.
+func (d *Dialer) ReconnectTicket() string {
+	d.ticketMutex.Lock()
+	defer d.ticketMutex.Unlock()
+	return d.ticket
+}
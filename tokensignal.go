@@ -0,0 +1,247 @@
+package transportc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// TOKEN_SIGNAL_TTL is how long FromTokenSignal remembers the token of an
+	// offer neither answered nor whose answer is read, e.g., as the Listener
+	// failed to answer it.
+	TOKEN_SIGNAL_TTL = 10 * time.Minute
+)
+
+// TokenSignal is a Signal correlating offers and answers with opaque string
+// IDs instead of uint64, so brokers can use UUIDs, URLs or signed tokens as
+// offer IDs. Its methods behave as those of Signal.
+//
+// A TokenSignal is used by Dialers and Listeners via FromTokenSignal.
+type TokenSignal interface {
+	Offer(offer []byte) (offerID string, err error)
+	ReadOffer() (offerID string, offer []byte, err error)
+	Answer(offerID string, answer []byte) error
+	ReadAnswer(offerID string) ([]byte, error)
+}
+
+// OfferExpiryTokenSignal is the TokenSignal counterpart of OfferExpirySignal.
+type OfferExpiryTokenSignal interface {
+	TokenSignal
+
+	OfferExpiry(offerID string) time.Time
+}
+
+// FromTokenSignal adapts ts to a Signal, e.g., for Config.Signal.
+//
+// Each token is mapped to the uint64 offer ID derived from its SHA-256 hash,
+// so the Dialer and the Listener see the same offer IDs, e.g., in
+// TransportEvents. The tokens are remembered until answered or the answer is
+// read, for up to TOKEN_SIGNAL_TTL.
+func FromTokenSignal(ts TokenSignal) Signal {
+	if adapter, ok := ts.(*uint64TokenSignal); ok {
+		return adapter.signal
+	}
+	return &tokenSignalAdapter{
+		signal: ts,
+		tokens: make(map[uint64]tokenEntry),
+	}
+}
+
+// ToTokenSignal adapts signal to a TokenSignal, with the offer IDs formatted
+// as decimal strings, so existing Signals can be used by code written
+// against TokenSignal.
+func ToTokenSignal(signal Signal) TokenSignal {
+	if adapter, ok := signal.(*tokenSignalAdapter); ok {
+		return adapter.signal
+	}
+	return &uint64TokenSignal{signal: signal}
+}
+
+type tokenEntry struct {
+	token   string
+	refs    int // Offer and ReadOffer calls not yet followed by ReadAnswer or Answer
+	expires time.Time
+}
+
+type tokenSignalAdapter struct {
+	signal TokenSignal
+
+	mutex  sync.Mutex
+	tokens map[uint64]tokenEntry
+}
+
+// tokenOfferID returns the offer ID of token, which is never 0.
+func tokenOfferID(token string) uint64 {
+	sum := sha256.Sum256([]byte(token))
+	if offerID := binary.BigEndian.Uint64(sum[:8]); offerID != 0 {
+		return offerID
+	}
+	return 1
+}
+
+// remember maps the offer ID of token back to token and returns it. The
+// token is remembered until forgotten as many times, so a Dialer and a
+// Listener may share the adapter.
+func (a *tokenSignalAdapter) remember(token string) uint64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	for offerID, entry := range a.tokens {
+		if now.After(entry.expires) {
+			delete(a.tokens, offerID)
+		}
+	}
+
+	offerID := tokenOfferID(token)
+	entry := a.tokens[offerID]
+	a.tokens[offerID] = tokenEntry{token: token, refs: entry.refs + 1, expires: now.Add(TOKEN_SIGNAL_TTL)}
+	return offerID
+}
+
+// token returns the token of offerID.
+func (a *tokenSignalAdapter) token(offerID uint64) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry, ok := a.tokens[offerID]
+	if !ok {
+		return "", ErrInvalidOfferID
+	}
+	return entry.token, nil
+}
+
+func (a *tokenSignalAdapter) forget(offerID uint64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry, ok := a.tokens[offerID]
+	if !ok {
+		return
+	}
+	if entry.refs--; entry.refs > 0 {
+		a.tokens[offerID] = entry
+	} else {
+		delete(a.tokens, offerID)
+	}
+}
+
+// Offer implements Signal.Offer.
+func (a *tokenSignalAdapter) Offer(offer []byte) (uint64, error) {
+	token, err := a.signal.Offer(offer)
+	if err != nil {
+		return 0, err
+	}
+	return a.remember(token), nil
+}
+
+// ReadOffer implements Signal.ReadOffer.
+func (a *tokenSignalAdapter) ReadOffer() (uint64, []byte, error) {
+	token, offer, err := a.signal.ReadOffer()
+	if err != nil {
+		return 0, nil, err
+	}
+	return a.remember(token), offer, nil
+}
+
+// Answer implements Signal.Answer.
+func (a *tokenSignalAdapter) Answer(offerID uint64, answer []byte) error {
+	token, err := a.token(offerID)
+	if err != nil {
+		return err
+	}
+	if err := a.signal.Answer(token, answer); err != nil {
+		return err
+	}
+	a.forget(offerID)
+	return nil
+}
+
+// ReadAnswer implements Signal.ReadAnswer.
+func (a *tokenSignalAdapter) ReadAnswer(offerID uint64) ([]byte, error) {
+	token, err := a.token(offerID)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := a.signal.ReadAnswer(token)
+	if err != nil {
+		return nil, err
+	}
+	a.forget(offerID)
+	return answer, nil
+}
+
+// OfferExpiry implements OfferExpirySignal.OfferExpiry, returning the zero
+// time unless the TokenSignal is an OfferExpiryTokenSignal.
+func (a *tokenSignalAdapter) OfferExpiry(offerID uint64) time.Time {
+	es, ok := a.signal.(OfferExpiryTokenSignal)
+	if !ok {
+		return time.Time{}
+	}
+	token, err := a.token(offerID)
+	if err != nil {
+		return time.Time{}
+	}
+	return es.OfferExpiry(token)
+}
+
+type uint64TokenSignal struct {
+	signal Signal
+}
+
+func parseOfferID(offerID string) (uint64, error) {
+	id, err := strconv.ParseUint(offerID, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidOfferID
+	}
+	return id, nil
+}
+
+// Offer implements TokenSignal.Offer.
+func (s *uint64TokenSignal) Offer(offer []byte) (string, error) {
+	offerID, err := s.signal.Offer(offer)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(offerID, 10), nil
+}
+
+// ReadOffer implements TokenSignal.ReadOffer.
+func (s *uint64TokenSignal) ReadOffer() (string, []byte, error) {
+	offerID, offer, err := s.signal.ReadOffer()
+	if err != nil {
+		return "", nil, err
+	}
+	return strconv.FormatUint(offerID, 10), offer, nil
+}
+
+// Answer implements TokenSignal.Answer.
+func (s *uint64TokenSignal) Answer(offerID string, answer []byte) error {
+	id, err := parseOfferID(offerID)
+	if err != nil {
+		return err
+	}
+	return s.signal.Answer(id, answer)
+}
+
+// ReadAnswer implements TokenSignal.ReadAnswer.
+func (s *uint64TokenSignal) ReadAnswer(offerID string) ([]byte, error) {
+	id, err := parseOfferID(offerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.signal.ReadAnswer(id)
+}
+
+// OfferExpiry implements OfferExpiryTokenSignal.OfferExpiry, returning the
+// zero time unless the Signal is an OfferExpirySignal.
+func (s *uint64TokenSignal) OfferExpiry(offerID string) time.Time {
+	id, err := parseOfferID(offerID)
+	if err != nil {
+		return time.Time{}
+	}
+	return signalOfferExpiry(s.signal, id)
+}
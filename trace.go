@@ -0,0 +1,97 @@
+package transportc
+
+import (
+	"context"
+	"sync"
+)
+
+// Names of the spans started by the Tracer, see Config.Tracer.
+const (
+	SPAN_DIAL       = "transportc.Dial"      // Dialer: from DialContext to the Conn open
+	SPAN_ICE_GATHER = "transportc.ICEGather" // Dialer and Listener: the ICE gathering of the local description
+	SPAN_SIGNAL     = "transportc.Signal"    // Dialer: from the offer signaled to the answer set, Listener: the answer signaled
+	SPAN_ACCEPT     = "transportc.Accept"    // Listener: from the offer received to the first Conn open
+)
+
+// Tracer starts the spans of the connection establishment, so distributed
+// traces show where its time goes. The oteltrace package implements it with
+// OpenTelemetry.
+type Tracer interface {
+	// Start starts a span named name, as a child of the span carried by ctx
+	// if any, and returns a context carrying the span.
+	Start(ctx context.Context, name string, attributes ...TraceAttribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span, recording err as its error if non-nil. It is called
+	// once per span.
+	End(err error)
+}
+
+// TracePropagator is optionally implemented by a Tracer to carry the trace of
+// the Dialer in its offers, so the spans of the Listener join the trace.
+type TracePropagator interface {
+	// Inject returns the trace carried by ctx as a text map.
+	Inject(ctx context.Context) map[string]string
+
+	// Extract returns ctx carrying the trace of carrier.
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+}
+
+// TraceAttribute is an attribute of a span. Value is a string, bool, int or
+// uint64.
+type TraceAttribute struct {
+	Key   string
+	Value any
+}
+
+// traceSpan ends the Span it wraps at most once, so a span may be ended by
+// whichever of the callbacks of a PeerConnection completes it.
+type traceSpan struct {
+	span Span
+	once sync.Once
+}
+
+func (s *traceSpan) End(err error) {
+	if s.span == nil {
+		return
+	}
+	s.once.Do(func() {
+		s.span.End(err)
+	})
+}
+
+// startSpan starts a span with tracer, if set. The span returned is never
+// nil.
+func startSpan(ctx context.Context, tracer Tracer, name string, attributes ...TraceAttribute) (context.Context, *traceSpan) {
+	if tracer == nil {
+		return ctx, &traceSpan{}
+	}
+	ctx, span := tracer.Start(ctx, name, attributes...)
+	return ctx, &traceSpan{span: span}
+}
+
+// injectTrace returns the trace of ctx to be carried in an offer, if tracer
+// is a TracePropagator.
+func injectTrace(ctx context.Context, tracer Tracer) map[string]string {
+	propagator, ok := tracer.(TracePropagator)
+	if !ok {
+		return nil
+	}
+	carrier := propagator.Inject(ctx)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// extractTrace returns ctx joining the trace carried by an offer, if tracer
+// is a TracePropagator.
+func extractTrace(ctx context.Context, tracer Tracer, carrier map[string]string) context.Context {
+	propagator, ok := tracer.(TracePropagator)
+	if !ok || len(carrier) == 0 {
+		return ctx
+	}
+	return propagator.Extract(ctx, carrier)
+}
@@ -0,0 +1,137 @@
+package transportc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// TRANSCRIPT_MAX_EVENTS bounds the events recorded per PeerConnection, see
+// Transcript.DroppedEvents.
+const TRANSCRIPT_MAX_EVENTS = 256
+
+type TranscriptEventType uint8
+
+const (
+	TRANSCRIPT_LOCAL_CANDIDATE    TranscriptEventType = iota + 1 // a local ICE candidate was gathered
+	TRANSCRIPT_GATHERING_COMPLETE                                // the ICE gathering is complete
+	TRANSCRIPT_ICE_STATE                                         // the ICE connection state changed
+	TRANSCRIPT_PC_STATE                                          // the PeerConnection state changed
+	TRANSCRIPT_SELECTED_PAIR                                     // the selected ICE candidate pair changed, not on js
+)
+
+func (t TranscriptEventType) String() string {
+	switch t {
+	case TRANSCRIPT_LOCAL_CANDIDATE:
+		return "LocalCandidate"
+	case TRANSCRIPT_GATHERING_COMPLETE:
+		return "GatheringComplete"
+	case TRANSCRIPT_ICE_STATE:
+		return "ICEState"
+	case TRANSCRIPT_PC_STATE:
+		return "PCState"
+	case TRANSCRIPT_SELECTED_PAIR:
+		return "SelectedPair"
+	default:
+		return "Unknown"
+	}
+}
+
+// TranscriptEvent is an event of the negotiation of a PeerConnection.
+type TranscriptEvent struct {
+	Type   TranscriptEventType
+	Time   time.Time
+	Detail string // e.g., the candidate or the new state
+}
+
+// Transcript is the negotiation of the PeerConnection of a Conn, recorded if
+// Config.RecordTranscript is set, to debug interop issues and audit what was
+// exchanged with the remote peer. See Conn.Transcript.
+type Transcript struct {
+	// Offer and Answer are the descriptions as signaled by the local peer,
+	// i.e., after Config.SDPTransformOutgoing, and as applied from the remote
+	// peer, i.e., after Config.SDPTransformIncoming. Zero until exchanged.
+	Offer  webrtc.SessionDescription
+	Answer webrtc.SessionDescription
+
+	// Events are the events of the PeerConnection, in order, up to
+	// TRANSCRIPT_MAX_EVENTS. It is shared by the Conns of the PeerConnection.
+	Events []TranscriptEvent
+
+	// DroppedEvents is the number of events beyond TRANSCRIPT_MAX_EVENTS,
+	// not recorded.
+	DroppedEvents int
+}
+
+// transcriptRecorder records the Transcript of a PeerConnection.
+// All methods are safe to call on a nil transcriptRecorder.
+type transcriptRecorder struct {
+	mutex      sync.Mutex
+	transcript Transcript
+}
+
+// newTranscriptRecorder records the candidates gathered by peerConnection
+// and its selected candidate pair. It MUST be called before the ICE gathering
+// starts. The state changes are recorded by the handlers of the caller.
+func newTranscriptRecorder(peerConnection *webrtc.PeerConnection) *transcriptRecorder {
+	t := &transcriptRecorder{}
+	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			t.record(TRANSCRIPT_GATHERING_COMPLETE, "")
+		} else {
+			t.record(TRANSCRIPT_LOCAL_CANDIDATE, candidate.String())
+		}
+	})
+	onSelectedCandidatePairChange(peerConnection, func(pair *webrtc.ICECandidatePair) {
+		t.record(TRANSCRIPT_SELECTED_PAIR, pair.String())
+	})
+	return t
+}
+
+func (t *transcriptRecorder) setOffer(offer *webrtc.SessionDescription) {
+	if t == nil || offer == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.transcript.Offer = *offer
+}
+
+func (t *transcriptRecorder) setAnswer(answer *webrtc.SessionDescription) {
+	if t == nil || answer == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.transcript.Answer = *answer
+}
+
+func (t *transcriptRecorder) record(eventType TranscriptEventType, detail string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.transcript.Events) >= TRANSCRIPT_MAX_EVENTS {
+		t.transcript.DroppedEvents++
+		return
+	}
+	t.transcript.Events = append(t.transcript.Events, TranscriptEvent{
+		Type:   eventType,
+		Time:   time.Now(),
+		Detail: detail,
+	})
+}
+
+// snapshot returns a copy of the Transcript, or nil if not recorded.
+func (t *transcriptRecorder) snapshot() *Transcript {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	transcript := t.transcript
+	transcript.Events = append([]TranscriptEvent(nil), t.transcript.Events...)
+	return &transcript
+}
@@ -0,0 +1,213 @@
+package transportc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/webrtc/v3"
+)
+
+// turnLoggerScope is the scope of the logger of each TURN client created by
+// the ICE agent, i.e., of each TURN allocation.
+const turnLoggerScope = "turnc"
+
+// TURNAllocation is the state of a TURN allocation of a PeerConnection, to
+// audit the allocations on paid TURN servers and catch failing refreshes
+// before the allocation expires and the PeerConnection drops.
+type TURNAllocation struct {
+	Server      string    // address of the TURN server
+	Created     time.Time // when allocated
+	LastRefresh time.Time // when last refreshed, zero if never
+	Expiry      time.Time // when the allocation expires unless refreshed
+
+	RefreshFailures           uint64 // refreshes of the allocation failed
+	PermissionRefreshFailures uint64 // refreshes of the permissions of the allocation failed
+}
+
+// TURNState is the state of the TURN allocations of one or more
+// PeerConnections.
+type TURNState struct {
+	// Allocations are the TURN allocations not released yet.
+	Allocations []TURNAllocation
+
+	// RelayedAddrs are the relayed addresses of the local relay candidates,
+	// allocated on the TURN servers. They are not matched to Allocations.
+	RelayedAddrs []*Addr
+
+	// Relayed indicates a selected candidate pair is relayed on the local
+	// side, i.e., the traffic goes through a TURN server.
+	Relayed bool
+}
+
+// turnTracker is the logging.LoggerFactory of a PeerConnection, tracking its
+// TURN allocations from the logs of the TURN clients of pion/turn.
+type turnTracker struct {
+	base  logging.LoggerFactory
+	stats *Stats
+
+	mutex       sync.Mutex
+	allocations []*turnAllocationLogger
+}
+
+// NewLogger implements logging.LoggerFactory.
+func (t *turnTracker) NewLogger(scope string) logging.LeveledLogger {
+	logger := t.base.NewLogger(scope)
+	if scope != turnLoggerScope {
+		return logger
+	}
+
+	allocation := &turnAllocationLogger{LeveledLogger: logger, tracker: t}
+	t.mutex.Lock()
+	t.allocations = append(t.allocations, allocation)
+	t.mutex.Unlock()
+	return allocation
+}
+
+// close releases the allocations left, once the PeerConnection is closed.
+// All methods are safe to call on a nil turnTracker.
+func (t *turnTracker) close() {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, allocation := range t.allocations {
+		allocation.release()
+	}
+	t.allocations = nil
+}
+
+// state returns the TURN allocations not released, and the relay candidates
+// of peerConnection.
+func (t *turnTracker) state(peerConnection *webrtc.PeerConnection) TURNState {
+	var state TURNState
+	if t == nil {
+		return state
+	}
+
+	t.mutex.Lock()
+	for _, allocation := range t.allocations {
+		if a, ok := allocation.snapshot(); ok {
+			state.Allocations = append(state.Allocations, a)
+		}
+	}
+	t.mutex.Unlock()
+
+	if peerConnection == nil {
+		return state
+	}
+	state.RelayedAddrs, state.Relayed = relayedCandidates(peerConnection)
+	return state
+}
+
+// merge adds other to ts.
+func (ts *TURNState) merge(other TURNState) {
+	ts.Allocations = append(ts.Allocations, other.Allocations...)
+	ts.RelayedAddrs = append(ts.RelayedAddrs, other.RelayedAddrs...)
+	ts.Relayed = ts.Relayed || other.Relayed
+}
+
+// turnAllocationLogger is the logger of a TURN client, updating the state of
+// its allocation from the messages logged.
+//
+// It relies on the messages of pion/turn/v2: the address of the server is
+// logged when the client is created, the lifetime when allocated and
+// refreshed, and a failure on each failed refresh. The allocation is
+// released by a refresh with a zero lifetime, sent without waiting.
+type turnAllocationLogger struct {
+	logging.LeveledLogger
+	tracker *turnTracker
+
+	mutex      sync.Mutex
+	allocation TURNAllocation
+	allocated  bool
+	released   bool
+}
+
+func (l *turnAllocationLogger) Debugf(format string, args ...interface{}) {
+	switch format {
+	case "turnServ: %s":
+		if len(args) == 1 {
+			l.mutex.Lock()
+			l.allocation.Server = fmt.Sprint(args[0])
+			l.mutex.Unlock()
+		}
+	case "initial lifetime: %d seconds", "updated lifetime: %d seconds":
+		if seconds, ok := firstIntArg(args); ok {
+			l.refreshed(time.Duration(seconds)*time.Second, format == "initial lifetime: %d seconds")
+		}
+	case "send refresh request (dontWait=%v)":
+		if len(args) == 1 && args[0] == true {
+			l.release()
+		}
+	}
+	l.LeveledLogger.Debugf(format, args...)
+}
+
+func (l *turnAllocationLogger) Warnf(format string, args ...interface{}) {
+	switch format {
+	case "refresh allocation failed":
+		l.mutex.Lock()
+		l.allocation.RefreshFailures++
+		l.mutex.Unlock()
+		l.tracker.stats.observeTURNRefreshFailure(false)
+	case "refresh permissions failed":
+		l.mutex.Lock()
+		l.allocation.PermissionRefreshFailures++
+		l.mutex.Unlock()
+		l.tracker.stats.observeTURNRefreshFailure(true)
+	}
+	l.LeveledLogger.Warnf(format, args...)
+}
+
+// refreshed records the lifetime of the allocation, once allocated or
+// refreshed.
+func (l *turnAllocationLogger) refreshed(lifetime time.Duration, initial bool) {
+	now := time.Now()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.released {
+		return
+	}
+
+	if initial {
+		if l.allocated {
+			return
+		}
+		l.allocated = true
+		l.allocation.Created = now
+		l.tracker.stats.observeTURNAllocation(true)
+	} else {
+		l.allocation.LastRefresh = now
+	}
+	l.allocation.Expiry = now.Add(lifetime)
+}
+
+func (l *turnAllocationLogger) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.released {
+		return
+	}
+	l.released = true
+	if l.allocated {
+		l.tracker.stats.observeTURNAllocation(false)
+	}
+}
+
+func (l *turnAllocationLogger) snapshot() (TURNAllocation, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.allocation, l.allocated && !l.released
+}
+
+func firstIntArg(args []interface{}) (int, bool) {
+	if len(args) != 1 {
+		return 0, false
+	}
+	i, ok := args[0].(int)
+	return i, ok
+}
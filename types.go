@@ -1,7 +1,10 @@
 package transportc
 
 import (
-	"fmt"
+	"errors"
+	"net"
+	"strconv"
+	"time"
 
 	"github.com/pion/webrtc/v3"
 )
@@ -23,6 +26,19 @@ const (
 	DTLSRoleServer
 )
 
+// RFC 8445, Section 6.1.1
+type ICERole = webrtc.ICERole
+
+// From pion/webrtc. The zero ICERole leaves the role to the ICE agents.
+const (
+	// ICERoleControlling defines the ICE controlling role, nominating the
+	// candidate pair.
+	ICERoleControlling ICERole = webrtc.ICERoleControlling
+
+	// ICERoleControlled defines the ICE controlled role.
+	ICERoleControlled ICERole = webrtc.ICERoleControlled
+)
+
 // NAT1To1IPs consists of a slice of IP addresses and one single ICE Candidate Type.
 // Use this struct to set the IPs to be used as ICE Candidates.
 type NAT1To1IPs struct {
@@ -30,6 +46,150 @@ type NAT1To1IPs struct {
 	Type webrtc.ICECandidateType
 }
 
+// ICECredentials consists of the ICE username fragment and password.
+// See RFC8445, Section 5.3 for the requirements on their lengths.
+type ICECredentials struct {
+	UsernameFragment string // at least 4 characters
+	Password         string // at least 22 characters
+}
+
+var (
+	// ErrInvalidICECredentials is returned when ICECredentials are too short.
+	ErrInvalidICECredentials = errors.New("invalid ICE credentials")
+)
+
+func (c *ICECredentials) validate() error {
+	if len(c.UsernameFragment) < 4 || len(c.Password) < 22 {
+		return ErrInvalidICECredentials
+	}
+	return nil
+}
+
+// ICETimeouts tunes how fast the ICE agent detects a dead peer, see
+// Config.ICETimeouts. A zero field takes the default of pion.
+type ICETimeouts struct {
+	// Disconnected is the time without network activity before the
+	// PeerConnection is disconnected.
+	Disconnected time.Duration
+
+	// Failed is the time without network activity after being disconnected
+	// before the PeerConnection fails.
+	Failed time.Duration
+
+	// KeepAlive is the interval of the keepalives sent when nothing else
+	// is, which MUST be shorter than Disconnected.
+	KeepAlive time.Duration
+}
+
+const (
+	ICE_DISCONNECTED_TIMEOUT_DEFAULT = 5 * time.Second
+	ICE_FAILED_TIMEOUT_DEFAULT       = 25 * time.Second
+	ICE_KEEPALIVE_INTERVAL_DEFAULT   = 2 * time.Second
+)
+
+var (
+	// ErrInvalidICETimeouts is returned when ICETimeouts are negative, or the
+	// keepalives are not sent before the PeerConnection is disconnected.
+	ErrInvalidICETimeouts = errors.New("invalid ICE timeouts")
+)
+
+// withDefaults returns t with the zero fields set to their defaults.
+func (t ICETimeouts) withDefaults() ICETimeouts {
+	if t.Disconnected == 0 {
+		t.Disconnected = ICE_DISCONNECTED_TIMEOUT_DEFAULT
+	}
+	if t.Failed == 0 {
+		t.Failed = ICE_FAILED_TIMEOUT_DEFAULT
+	}
+	if t.KeepAlive == 0 {
+		t.KeepAlive = ICE_KEEPALIVE_INTERVAL_DEFAULT
+	}
+	return t
+}
+
+func (t ICETimeouts) validate() error {
+	if t.Disconnected < 0 || t.Failed < 0 || t.KeepAlive < 0 || t.KeepAlive >= t.Disconnected {
+		return ErrInvalidICETimeouts
+	}
+	return nil
+}
+
+// ICEPairPolicy is how the ICE candidate pair of a PeerConnection is
+// nominated, see Config.ICEPairPolicy, trading the privacy of relayed paths
+// for the latency of direct ones.
+//
+// pion nominates the connected pair of the highest priority by candidate
+// type, host first and relay last, once the candidates of its type have been
+// waited for long enough. The policies tune these waits, or the candidates
+// gathered, as far as pion allows.
+type ICEPairPolicy uint8
+
+const (
+	// ICE_PAIR_POLICY_DEFAULT keeps the waits of pion.
+	ICE_PAIR_POLICY_DEFAULT ICEPairPolicy = iota
+
+	// ICE_PAIR_POLICY_PREFER_HOST waits longer for direct pairs before
+	// falling back to reflexive and relay pairs, see
+	// ICE_PREFER_HOST_SRFLX_WAIT and the following.
+	ICE_PAIR_POLICY_PREFER_HOST
+
+	// ICE_PAIR_POLICY_PREFER_RELAY gathers relay candidates only, as
+	// webrtc.ICETransportPolicyRelay, if a TURN server is configured, so
+	// neither peer learns the address of the other. Otherwise, relay pairs
+	// are nominated without waiting, but direct pairs still win.
+	ICE_PAIR_POLICY_PREFER_RELAY
+
+	// ICE_PAIR_POLICY_PREFER_LOWEST_RTT nominates the first pair to answer
+	// the connectivity checks, sent to all pairs at once, without waiting
+	// for the pairs of a higher priority. It approximates the pair of the
+	// lowest RTT, as pion does not measure it before nominating.
+	ICE_PAIR_POLICY_PREFER_LOWEST_RTT
+)
+
+const (
+	ICE_PREFER_HOST_SRFLX_WAIT = time.Second
+	ICE_PREFER_HOST_PRFLX_WAIT = 2 * time.Second
+	ICE_PREFER_HOST_RELAY_WAIT = 5 * time.Second
+)
+
+var (
+	// ErrInvalidICEPairPolicy is returned for an unknown ICEPairPolicy.
+	ErrInvalidICEPairPolicy = errors.New("invalid ICE pair policy")
+)
+
+func (p ICEPairPolicy) String() string {
+	switch p {
+	case ICE_PAIR_POLICY_DEFAULT:
+		return "default"
+	case ICE_PAIR_POLICY_PREFER_HOST:
+		return "prefer-host"
+	case ICE_PAIR_POLICY_PREFER_RELAY:
+		return "prefer-relay"
+	case ICE_PAIR_POLICY_PREFER_LOWEST_RTT:
+		return "prefer-lowest-rtt"
+	default:
+		return "unknown"
+	}
+}
+
+func (p ICEPairPolicy) validate() error {
+	if p > ICE_PAIR_POLICY_PREFER_LOWEST_RTT {
+		return ErrInvalidICEPairPolicy
+	}
+	return nil
+}
+
+// configure returns configuration restricted to relay candidates if p is
+// ICE_PAIR_POLICY_PREFER_RELAY and one of its ICE servers is a TURN server.
+// It is applied to every new PeerConnection, so the ICE servers updated
+// since are taken into account.
+func (p ICEPairPolicy) configure(configuration webrtc.Configuration) webrtc.Configuration {
+	if p == ICE_PAIR_POLICY_PREFER_RELAY && configuration.ICETransportPolicy == webrtc.ICETransportPolicyAll && hasTURNServer(configuration.ICEServers, false) {
+		configuration.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	return configuration
+}
+
 // PortRange specifies the range of ports to use for ICE Transports.
 type PortRange struct {
 	Min uint16
@@ -46,5 +206,5 @@ func (*Addr) Network() string {
 }
 
 func (a *Addr) String() string {
-	return fmt.Sprintf("%s:%d", a.Hostname, a.Port)
+	return net.JoinHostPort(a.Hostname, strconv.Itoa(int(a.Port)))
 }
@@ -0,0 +1,194 @@
+// Package wgbind exposes DatagramConns as a conn.Bind of wireguard-go, so
+// WireGuard tunnels through WebRTC DataChannels, e.g., to circumvent censorship
+// of WireGuard over UDP or to build NAT-to-NAT VPNs.
+//
+// Each DatagramConn added to a Bind is a peer endpoint, named after the
+// endpoint configured for the WireGuard peer.
+package wgbind
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/gaukas/transportc"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+var (
+	// ErrUnknownEndpoint is returned when sending to an endpoint without
+	// DatagramConn added.
+	ErrUnknownEndpoint = errors.New("no DatagramConn for endpoint")
+)
+
+// Bind implements conn.Bind over DatagramConns.
+type Bind struct {
+	mutex sync.Mutex
+	conns map[string]*transportc.DatagramConn // endpoint:DatagramConn pair
+	open  bool
+	done  chan struct{} // closed on Close, recreated on Open
+
+	recv chan packet
+}
+
+type packet struct {
+	data []byte
+	ep   *Endpoint
+}
+
+var _ conn.Bind = (*Bind)(nil)
+
+// NewBind creates a new Bind without any DatagramConn.
+func NewBind() *Bind {
+	done := make(chan struct{})
+	close(done)
+	return &Bind{
+		conns: make(map[string]*transportc.DatagramConn),
+		done:  done,
+		recv:  make(chan packet, transportc.CONN_DEFAULT_CONCURRENCY),
+	}
+}
+
+// AddConn adds dc as the endpoint named endpoint, replacing the DatagramConn
+// previously added for the endpoint, if any.
+//
+// Packets are received from dc until it fails or is replaced, and the
+// endpoint is removed afterwards.
+func (b *Bind) AddConn(endpoint string, dc *transportc.DatagramConn) {
+	b.mutex.Lock()
+	previous := b.conns[endpoint]
+	b.conns[endpoint] = dc
+	b.mutex.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+
+	go b.readloop(endpoint, dc)
+}
+
+func (b *Bind) readloop(endpoint string, dc *transportc.DatagramConn) {
+	defer func() {
+		b.mutex.Lock()
+		if b.conns[endpoint] == dc {
+			delete(b.conns, endpoint)
+		}
+		b.mutex.Unlock()
+	}()
+
+	ep := &Endpoint{name: endpoint}
+	for {
+		buf := make([]byte, transportc.CONN_DEFAULT_MTU)
+		n, err := dc.Read(buf)
+		if err != nil {
+			if errors.Is(err, transportc.ErrMalformedDatagram) {
+				continue
+			}
+			return
+		}
+		b.recv <- packet{data: buf[:n], ep: ep}
+	}
+}
+
+// Open implements conn.Bind.Open. No port is bound, so port is
+// returned as is.
+func (b *Bind) Open(port uint16) (fns []conn.ReceiveFunc, actualPort uint16, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.open {
+		return nil, 0, conn.ErrBindAlreadyOpen
+	}
+	b.open = true
+	done := make(chan struct{})
+	b.done = done
+
+	receive := func(buf []byte) (int, conn.Endpoint, error) {
+		select {
+		case <-done: // takes priority over pending packets
+			return 0, nil, net.ErrClosed
+		default:
+		}
+
+		select {
+		case <-done:
+			return 0, nil, net.ErrClosed
+		case pkt := <-b.recv:
+			return copy(buf, pkt.data), pkt.ep, nil
+		}
+	}
+	return []conn.ReceiveFunc{receive}, port, nil
+}
+
+// Close implements conn.Bind.Close. The DatagramConns are kept
+// open, to be used once the Bind is opened again.
+func (b *Bind) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.open {
+		b.open = false
+		close(b.done)
+	}
+	return nil
+}
+
+// SetMark implements conn.Bind.SetMark. It is a no-op.
+func (*Bind) SetMark(uint32) error {
+	return nil
+}
+
+// Send implements conn.Bind.Send.
+func (b *Bind) Send(buf []byte, ep conn.Endpoint) error {
+	endpoint, ok := ep.(*Endpoint)
+	if !ok {
+		return conn.ErrWrongEndpointType
+	}
+
+	b.mutex.Lock()
+	dc := b.conns[endpoint.name]
+	b.mutex.Unlock()
+	if dc == nil {
+		return ErrUnknownEndpoint
+	}
+
+	_, err := dc.Write(buf)
+	return err
+}
+
+// ParseEndpoint implements conn.Bind.ParseEndpoint. Any string
+// is a valid endpoint name.
+func (*Bind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	return &Endpoint{name: s}, nil
+}
+
+// Endpoint implements conn.Endpoint, identifying a DatagramConn
+// added to a Bind by name.
+type Endpoint struct {
+	name string
+}
+
+var _ conn.Endpoint = (*Endpoint)(nil)
+
+func (*Endpoint) ClearSrc() {}
+
+func (*Endpoint) SrcToString() string {
+	return ""
+}
+
+func (e *Endpoint) DstToString() string {
+	return e.name
+}
+
+func (e *Endpoint) DstToBytes() []byte {
+	return []byte(e.name)
+}
+
+func (*Endpoint) DstIP() netip.Addr {
+	return netip.Addr{}
+}
+
+func (*Endpoint) SrcIP() netip.Addr {
+	return netip.Addr{}
+}
@@ -0,0 +1,84 @@
+package transportc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	WIRE_MAGIC                   = "TRTC"
+	WIRE_VERSION           uint8 = 1
+	WIRE_HANDSHAKE_TIMEOUT       = 5 * time.Second
+
+	wireHelloSize = len(WIRE_MAGIC) + 1 + 4 // magic | version | features
+)
+
+var (
+	// ErrWireHandshake is returned when the remote peer fails the wire
+	// handshake, e.g., it does not have Config.WireHandshake set.
+	ErrWireHandshake = errors.New("wire handshake failed")
+)
+
+// WireFeatures is a bitmask of the optional features of the wire format,
+// such as compression or fragmentation, negotiated by the wire handshake.
+// Only the features supported by both peers are enabled on a Conn.
+//
+// Bits are reserved for features of future versions of this package.
+// Until then, applications MAY use them to negotiate their own features.
+type WireFeatures uint32
+
+// wireHello encodes the wire handshake message announcing features.
+func wireHello(features WireFeatures) []byte {
+	hello := make([]byte, 0, wireHelloSize)
+	hello = append(hello, WIRE_MAGIC...)
+	hello = append(hello, WIRE_VERSION)
+	return binary.BigEndian.AppendUint32(hello, uint32(features))
+}
+
+// wireHandshake exchanges the wire handshake messages over the Conn, before
+// any other message, and negotiates the wire version and features. It fails
+// if no valid handshake message is received before deadline.
+//
+// Newer versions MAY append fields to the handshake message, which are
+// ignored by older versions.
+func (c *Conn) wireHandshake(features WireFeatures, deadline time.Time) error {
+	if _, err := c.writeMessage(wireHello(features)); err != nil {
+		return fmt.Errorf("%w: %v", ErrWireHandshake, err)
+	}
+
+	c.SetReadDeadline(deadline)
+	defer c.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, wireHelloSize)
+	n, err := c.Read(buf)
+	if err != nil && !errors.Is(err, io.ErrShortBuffer) {
+		return fmt.Errorf("%w: %v", ErrWireHandshake, err)
+	}
+	if n < wireHelloSize || !bytes.Equal(buf[:len(WIRE_MAGIC)], []byte(WIRE_MAGIC)) {
+		return fmt.Errorf("%w: unexpected message from remote peer", ErrWireHandshake)
+	}
+
+	c.wireVersion = buf[len(WIRE_MAGIC)]
+	if c.wireVersion > WIRE_VERSION {
+		c.wireVersion = WIRE_VERSION
+	} else if c.wireVersion == 0 {
+		return fmt.Errorf("%w: invalid version", ErrWireHandshake)
+	}
+	c.wireFeatures = features & WireFeatures(binary.BigEndian.Uint32(buf[len(WIRE_MAGIC)+1:]))
+	return nil
+}
+
+// WireVersion returns the wire version negotiated with the remote peer, or
+// 0 if the Conn is in raw mode, i.e., Config.WireHandshake is not set.
+func (c *Conn) WireVersion() uint8 {
+	return c.wireVersion
+}
+
+// WireFeatures returns the WireFeatures enabled by both peers.
+func (c *Conn) WireFeatures() WireFeatures {
+	return c.wireFeatures
+}
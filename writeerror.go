@@ -0,0 +1,86 @@
+package transportc
+
+import (
+	"errors"
+	"net"
+
+	"github.com/pion/webrtc/v3"
+)
+
+var (
+	// ErrWriteBufferFull is wrapped by the WriteError of a write exceeding
+	// Config.MaxBufferedAmount.
+	ErrWriteBufferFull = errors.New("write buffer full")
+)
+
+// WriteErrorKind classifies the failure of a write to a Conn.
+type WriteErrorKind uint8
+
+const (
+	WRITE_ERROR_DEADLINE               WriteErrorKind = iota + 1 // the write deadline is exceeded, see Conn.SetWriteDeadline
+	WRITE_ERROR_STALLED                                          // the write blocked longer than Config.DefaultWriteTimeout and the Conn is closed
+	WRITE_ERROR_BUFFER_FULL                                      // the BufferedAmount would exceed Config.MaxBufferedAmount
+	WRITE_ERROR_CLOSED                                           // the Conn or its DataChannel is closed
+	WRITE_ERROR_PEER_CONNECTION_FAILED                           // the PeerConnection of the Conn failed
+)
+
+func (k WriteErrorKind) String() string {
+	switch k {
+	case WRITE_ERROR_DEADLINE:
+		return "deadline"
+	case WRITE_ERROR_STALLED:
+		return "stalled"
+	case WRITE_ERROR_BUFFER_FULL:
+		return "buffer full"
+	case WRITE_ERROR_CLOSED:
+		return "closed"
+	case WRITE_ERROR_PEER_CONNECTION_FAILED:
+		return "PeerConnection failed"
+	default:
+		return "unknown"
+	}
+}
+
+// WriteError is returned by a failed write to a Conn. It implements net.Error,
+// so generic retry logic tells transient failures, i.e., an exceeded deadline
+// or a full buffer, apart from a Conn no longer writable.
+//
+// It wraps the underlying error, e.g., os.ErrDeadlineExceeded, and matches
+// net.ErrClosed if the Conn is closed or its PeerConnection failed.
+type WriteError struct {
+	Kind WriteErrorKind
+	Err  error
+}
+
+func (e *WriteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether e matches target, i.e., net.ErrClosed for a Conn no
+// longer writable.
+func (e *WriteError) Is(target error) bool {
+	return target == net.ErrClosed && (e.Kind == WRITE_ERROR_CLOSED || e.Kind == WRITE_ERROR_PEER_CONNECTION_FAILED)
+}
+
+// Timeout implements net.Error.Timeout.
+func (e *WriteError) Timeout() bool {
+	return e.Kind == WRITE_ERROR_DEADLINE || e.Kind == WRITE_ERROR_STALLED
+}
+
+// Temporary implements net.Error.Temporary, reporting whether the write may
+// succeed if retried on the same Conn.
+func (e *WriteError) Temporary() bool {
+	return e.Kind == WRITE_ERROR_DEADLINE || e.Kind == WRITE_ERROR_BUFFER_FULL
+}
+
+// writeFailure classifies err returned by a write to the datachannel.
+func (c *Conn) writeFailure(err error) *WriteError {
+	if c.peerConnection != nil && c.peerConnection.ConnectionState() == webrtc.PeerConnectionStateFailed {
+		return &WriteError{Kind: WRITE_ERROR_PEER_CONNECTION_FAILED, Err: err}
+	}
+	return &WriteError{Kind: WRITE_ERROR_CLOSED, Err: err}
+}